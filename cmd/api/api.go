@@ -11,12 +11,22 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 	"github.com/yabeye/addis_verify_backend/internal/account"
+	"github.com/yabeye/addis_verify_backend/internal/challenge"
 	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/delivery"
+	"github.com/yabeye/addis_verify_backend/internal/export"
+	"github.com/yabeye/addis_verify_backend/internal/fraud"
 	"github.com/yabeye/addis_verify_backend/internal/media"
 	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+	"github.com/yabeye/addis_verify_backend/internal/oidc"
 	"github.com/yabeye/addis_verify_backend/internal/users"
 	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
 	"github.com/yabeye/addis_verify_backend/pkg/messenger"
+	"github.com/yabeye/addis_verify_backend/pkg/otp"
+	"github.com/yabeye/addis_verify_backend/pkg/simcheck"
+	"github.com/yabeye/addis_verify_backend/pkg/templates"
+	"github.com/yabeye/addis_verify_backend/pkg/totp"
 
 	httpSwagger "github.com/swaggo/http-swagger"
 	_ "github.com/yabeye/addis_verify_backend/docs"
@@ -31,15 +41,50 @@ type config struct {
 	RedisAddr   string
 	JWTSecret   string
 	HashPepper  string
+	AdminAPIKey string
+	OTP         otp.Policy
+	SMS         messenger.Config
+	Outbox      delivery.WorkerConfig
+	Purge       account.PurgeConfig
+	Export      export.Config
+	Fraud       fraud.Config
+	Challenge   challenge.Config
+	SIMCheck    simcheck.Config
+	Tokens      auth.Config
+	OIDC        oidc.Config
+	// CaptchaVerifyURL and CaptchaSecret configure the siteverify endpoint for captcha
+	// challenges; without a secret, CaptchaFakePass is accepted instead (local development).
+	CaptchaVerifyURL string
+	CaptchaSecret    string
+	CaptchaFakePass  string
+	// SMSWebhookToken must be appended as ?token= to provider receipt callback URLs.
+	SMSWebhookToken string
+	// SMSTemplatesDir overlays <lang>/<name>.txt files on the built-in SMS templates.
+	SMSTemplatesDir string
+	// TOTPKey encrypts authenticator app secrets at rest. It must stay the same on every
+	// instance and across restarts, or enrolled apps stop working.
+	TOTPKey string
+
+	// JWTSigningKeyFile is a PEM private key (Ed25519, RSA or P-256) access and refresh
+	// tokens are signed with; JWTVerifyKeyFiles are earlier keys still accepted.
+	JWTSigningKeyFile string
+	JWTVerifyKeyFiles []string
 }
 
 type application struct {
-	config    config
-	db        *pgxpool.Pool
-	cache     *redis.Client
-	logger    *slog.Logger
-	messenger messenger.Provider
-	auth      auth.TokenManager
+	config     config
+	db         *pgxpool.Pool
+	cache      *redis.Client
+	logger     *slog.Logger
+	messenger  messenger.Provider
+	outbox     *delivery.Queue
+	exports    *export.Exporter
+	fraud      *fraud.Guard
+	challenges *challenge.Issuer
+	sims       account.SIMChecker
+	totp       *totp.Cipher
+	templates  *templates.Set
+	auth       auth.TokenManager
 }
 
 func (app *application) run(handler http.Handler) error {
@@ -67,6 +112,19 @@ func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Reques
 	w.Write([]byte(`{"status": "available", "message": "API is live 🚀", "serverTimeStamp": "` + now.Format(time.RFC3339) + `"}`))
 }
 
+// jwksHandler godoc
+// @Summary      Token Verification Keys
+// @Description  Publishes the public keys access tokens are signed with (RFC 7517), so other services can verify them offline. Tokens name their key in the kid header.
+// @Tags         system
+// @Produce      json
+// @Success      200  {object}  auth.JWKS
+// @Router       /.well-known/jwks.json [get]
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	// Short enough that a newly added key is picked up well before it signs anything
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.Write(w, http.StatusOK, app.auth.JWKS())
+}
+
 func (app *application) mount() http.Handler {
 	r := chi.NewRouter()
 
@@ -106,26 +164,56 @@ func (app *application) mount() http.Handler {
 	// Health Check (Public)
 	r.Get("/health", app.healthCheckHandler)
 
+	// Token verification keys for other services (Public)
+	r.Get("/.well-known/jwks.json", app.jwksHandler)
+
 	// ALL APIS //
 	queries := repo.New(app.db)
 
-	accountSvc := account.New(queries)
+	accountSvc := account.New(queries, app.db)
 	accountHandler := account.NewHandler(
 		accountSvc,
 		app.logger.With("handler", "accounts"),
 		app.cache,
-		app.messenger,
+		app.outbox,
+		app.fraud,
+		app.challenges,
+		app.sims,
+		app.totp,
+		app.templates,
 		app.auth,
 		app.config.HashPepper,
+		app.config.OTP,
 	)
 
 	userSvc := users.New(queries)
 	mediaSvc := media.NewService("store/media", "http://localhost:8080")
 	usersHandler := users.NewHandler(userSvc, mediaSvc, app.logger.With("handler", "users"))
 
+	oidcHandler := oidc.NewHandler(
+		oidc.New(queries),
+		app.cache,
+		app.auth,
+		app.config.OIDC,
+		app.logger.With("handler", "oidc"),
+	)
+	// "Log in with AddisVerify" is off until an issuer URL is configured
+	if app.config.OIDC.Issuer != "" {
+		r.Get(oidc.DiscoveryPath, oidcHandler.Discovery)
+	}
+
+	exportHandler := export.NewHandler(app.exports, app.logger.With("handler", "exports"))
+
+	messagesHandler := delivery.NewHandler(
+		app.outbox,
+		messenger.ReceiptParsers(app.config.SMS, app.config.SMSWebhookToken),
+		app.config.SMSWebhookToken,
+		app.logger.With("handler", "messages"),
+	)
+
 	r.Route("/api/v1", func(r chi.Router) {
 		// This mounts Auth (with 10KB limit), Users, and Links from internal/routes
-		r.Mount("/", MountRoutes(app, accountHandler, usersHandler))
+		r.Mount("/", MountRoutes(app, accountHandler, usersHandler, messagesHandler, oidcHandler, exportHandler))
 	})
 
 	return r
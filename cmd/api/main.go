@@ -1,17 +1,39 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"log/slog"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
+	"github.com/yabeye/addis_verify_backend/internal/account"
+	"github.com/yabeye/addis_verify_backend/internal/challenge"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/delivery"
 	"github.com/yabeye/addis_verify_backend/internal/env"
+	"github.com/yabeye/addis_verify_backend/internal/export"
+	"github.com/yabeye/addis_verify_backend/internal/fraud"
+	"github.com/yabeye/addis_verify_backend/internal/oidc"
 	"github.com/yabeye/addis_verify_backend/internal/store"
 	"github.com/yabeye/addis_verify_backend/pkg/auth"
 	"github.com/yabeye/addis_verify_backend/pkg/messenger"
+	"github.com/yabeye/addis_verify_backend/pkg/otp"
+	"github.com/yabeye/addis_verify_backend/pkg/simcheck"
+	"github.com/yabeye/addis_verify_backend/pkg/templates"
+	"github.com/yabeye/addis_verify_backend/pkg/totp"
 )
 
+// smsRoutesKey holds the live SMS routing table as JSON: [{"prefix":"+2519","providers":["smpp","africastalking"]}]
+const smsRoutesKey = "sms:routes"
+
 // @title           AddisVerify API
 // @version         1.0
 // @description     Backend API for AddisVerify identity services.
@@ -45,6 +67,203 @@ func main() {
 		RedisAddr:   env.GetString("REDIS_ADDR", "localhost:6379"),
 		JWTSecret:   env.GetString("JWT_SECRET", ""),
 		HashPepper:  env.GetString("HASH_PEPPER", "default-dev-pepper-do-not-use-in-prod"),
+		AdminAPIKey: env.GetString("ADMIN_API_KEY", ""),
+
+		JWTSigningKeyFile: env.GetString("JWT_SIGNING_KEY_FILE", ""),
+		JWTVerifyKeyFiles: env.GetList("JWT_VERIFY_KEY_FILES"),
+
+		SMSWebhookToken: env.GetString("SMS_WEBHOOK_TOKEN", ""),
+		SMSTemplatesDir: env.GetString("SMS_TEMPLATES_DIR", ""),
+	}
+
+	defaultOTP := otp.DefaultPolicy()
+	cfg.OTP = otp.Policy{
+		Length:          env.GetInt("OTP_LENGTH", defaultOTP.Length),
+		Alphabet:        env.GetString("OTP_ALPHABET", defaultOTP.Alphabet),
+		TTL:             env.GetDuration("OTP_TTL", defaultOTP.TTL),
+		ResendCooldowns: env.GetDurations("OTP_RESEND_COOLDOWNS", defaultOTP.ResendCooldowns),
+		DailyCap:        env.GetInt("OTP_DAILY_CAP", defaultOTP.DailyCap),
+	}
+	channels, err := messenger.ParseChannels(env.GetString("OTP_CHANNELS", ""))
+	if err != nil {
+		logger.Error("invalid otp channels", "error", err)
+		os.Exit(1)
+	}
+	cfg.OTP.Channels = []string{string(messenger.ChannelSMS)}
+	for channel := range channels {
+		cfg.OTP.Channels = append(cfg.OTP.Channels, string(channel))
+	}
+	cfg.OTP.Fallbacks, err = otp.ParseFallbacks(env.GetString("OTP_FALLBACKS", ""))
+	if err != nil {
+		logger.Error("invalid otp fallbacks", "error", err)
+		os.Exit(1)
+	}
+	if err := cfg.OTP.Validate(); err != nil {
+		logger.Error("invalid otp policy", "error", err)
+		os.Exit(1)
+	}
+
+	// Set once Redis and Postgres are up, before the SMPP session that records receipts through it binds
+	var outbox *delivery.Queue
+
+	smsTimeout := env.GetDuration("SMS_TIMEOUT", 10*time.Second)
+	cfg.SMS = messenger.Config{
+		Driver: env.GetString("SMS_PROVIDER", messenger.DriverMock),
+		Twilio: messenger.TwilioConfig{
+			AccountSID:          env.GetString("TWILIO_ACCOUNT_SID", ""),
+			AuthToken:           env.GetString("TWILIO_AUTH_TOKEN", ""),
+			From:                env.GetString("TWILIO_FROM", ""),
+			MessagingServiceSID: env.GetString("TWILIO_MESSAGING_SERVICE_SID", ""),
+			StatusCallbackURL:   env.GetString("TWILIO_STATUS_CALLBACK_URL", ""),
+			WhatsAppFrom:        env.GetString("TWILIO_WHATSAPP_FROM", ""),
+			WhatsAppContentSID:  env.GetString("TWILIO_WHATSAPP_CONTENT_SID", ""),
+			VoiceFrom:           env.GetString("TWILIO_VOICE_FROM", ""),
+			Timeout:             smsTimeout,
+		},
+		AfricasTalking: messenger.AfricasTalkingConfig{
+			Username: env.GetString("AT_USERNAME", ""),
+			APIKey:   env.GetString("AT_API_KEY", ""),
+			From:     env.GetString("AT_SENDER_ID", ""),
+			Timeout:  smsTimeout,
+		},
+		Gateway: messenger.GatewayConfig{
+			Name:           env.GetString("SMS_GATEWAY_NAME", "gateway"),
+			URL:            env.GetString("SMS_GATEWAY_URL", ""),
+			Method:         env.GetString("SMS_GATEWAY_METHOD", "POST"),
+			ContentType:    env.GetString("SMS_GATEWAY_CONTENT_TYPE", "application/json"),
+			Headers:        env.GetMap("SMS_GATEWAY_HEADERS"),
+			Username:       env.GetString("SMS_GATEWAY_USERNAME", ""),
+			Password:       env.GetString("SMS_GATEWAY_PASSWORD", ""),
+			BearerToken:    env.GetString("SMS_GATEWAY_TOKEN", ""),
+			From:           env.GetString("SMS_GATEWAY_FROM", ""),
+			BodyTemplate:   env.GetString("SMS_GATEWAY_BODY_TEMPLATE", ""),
+			MessageIDField: env.GetString("SMS_GATEWAY_MESSAGE_ID_FIELD", ""),
+			Timeout:        smsTimeout,
+		},
+		SMPP: messenger.SMPPConfig{
+			Addr:                env.GetString("SMPP_ADDR", ""),
+			SystemID:            env.GetString("SMPP_SYSTEM_ID", ""),
+			Password:            env.GetString("SMPP_PASSWORD", ""),
+			SystemType:          env.GetString("SMPP_SYSTEM_TYPE", ""),
+			SourceAddr:          env.GetString("SMPP_SOURCE_ADDR", ""),
+			SourceTON:           byte(env.GetInt("SMPP_SOURCE_TON", 5)),
+			SourceNPI:           byte(env.GetInt("SMPP_SOURCE_NPI", 0)),
+			EnquireLinkInterval: env.GetDuration("SMPP_ENQUIRE_LINK_INTERVAL", 30*time.Second),
+			ResponseTimeout:     smsTimeout,
+			OnReceipt: func(r messenger.DeliveryReport) {
+				if err := outbox.ApplyReport(context.Background(), r); err != nil {
+					logger.Warn("sms delivery receipt not recorded", "provider", r.Provider, "message_id", r.MessageID, "status", r.Status, "error", err)
+				}
+			},
+			Logger: logger,
+		},
+		Telegram: messenger.TelegramConfig{
+			Token:   env.GetString("TELEGRAM_GATEWAY_TOKEN", ""),
+			TTL:     cfg.OTP.TTL,
+			Timeout: smsTimeout,
+		},
+		Channels:  channels,
+		Providers: env.GetList("SMS_PROVIDERS"),
+		Breaker: messenger.BreakerConfig{
+			FailureThreshold: env.GetInt("SMS_BREAKER_THRESHOLD", 5),
+			OpenTimeout:      env.GetDuration("SMS_BREAKER_TIMEOUT", 30*time.Second),
+		},
+		Logger: logger,
+	}
+	routes, err := messenger.ParseRoutes(env.GetString("SMS_ROUTES", ""))
+	if err != nil {
+		logger.Error("invalid sms routes", "error", err)
+		os.Exit(1)
+	}
+	cfg.SMS.Routes = routes
+
+	hostname, _ := os.Hostname()
+	cfg.Outbox = delivery.WorkerConfig{
+		Consumer:    env.GetString("OUTBOX_CONSUMER", fmt.Sprintf("%s-%d", hostname, os.Getpid())),
+		MaxAttempts: env.GetInt("OUTBOX_MAX_ATTEMPTS", 5),
+		BaseBackoff: env.GetDuration("OUTBOX_BASE_BACKOFF", 2*time.Second),
+		MaxBackoff:  env.GetDuration("OUTBOX_MAX_BACKOFF", 5*time.Minute),
+		SendTimeout: smsTimeout + 5*time.Second,
+	}
+
+	cfg.Export = export.Config{
+		Dir:       env.GetString("EXPORT_DIR", "store/exports"),
+		MediaDir:  "store/media",
+		PublicURL: env.GetString("EXPORT_PUBLIC_URL", ""),
+		LinkTTL:   env.GetDuration("EXPORT_LINK_TTL", 15*time.Minute),
+	}
+	cfg.Purge = account.PurgeConfig{
+		MediaDir: "store/media",
+		Interval: env.GetDuration("PURGE_INTERVAL", time.Hour),
+	}
+
+	defaultFraud := fraud.DefaultConfig()
+	cfg.Fraud = fraud.Config{
+		CountryDailyBudget: env.GetInt("FRAUD_COUNTRY_DAILY_BUDGET", defaultFraud.CountryDailyBudget),
+		RangeDailyBudget:   env.GetInt("FRAUD_RANGE_DAILY_BUDGET", defaultFraud.RangeDailyBudget),
+		IPDailyBudget:      env.GetInt("FRAUD_IP_DAILY_BUDGET", defaultFraud.IPDailyBudget),
+		ASNDailyBudget:     env.GetInt("FRAUD_ASN_DAILY_BUDGET", defaultFraud.ASNDailyBudget),
+		IPChallengeAfter:   env.GetInt("FRAUD_IP_CHALLENGE_AFTER", defaultFraud.IPChallengeAfter),
+		ASNChallengeAfter:  env.GetInt("FRAUD_ASN_CHALLENGE_AFTER", defaultFraud.ASNChallengeAfter),
+		SpikeFactor:        env.GetInt("FRAUD_SPIKE_FACTOR", defaultFraud.SpikeFactor),
+		SpikeMin:           env.GetInt("FRAUD_SPIKE_MIN", defaultFraud.SpikeMin),
+		SequentialRun:      env.GetInt("FRAUD_SEQUENTIAL_RUN", defaultFraud.SequentialRun),
+		SequentialWindow:   env.GetDuration("FRAUD_SEQUENTIAL_WINDOW", defaultFraud.SequentialWindow),
+		BlockTTL:           env.GetDuration("FRAUD_BLOCK_TTL", defaultFraud.BlockTTL),
+		ASNHeader:          env.GetString("FRAUD_ASN_HEADER", ""),
+		ServedPrefixes:     env.GetList("FRAUD_SERVED_PREFIXES"),
+	}
+
+	cfg.Challenge = challenge.Config{
+		Secret:     []byte(env.GetString("CHALLENGE_SECRET", "")),
+		Kind:       env.GetString("CHALLENGE_KIND", challenge.KindPoW),
+		Difficulty: env.GetInt("CHALLENGE_POW_DIFFICULTY", 20),
+		TTL:        env.GetDuration("CHALLENGE_TTL", 2*time.Minute),
+		SiteKey:    env.GetString("CAPTCHA_SITE_KEY", ""),
+	}
+	cfg.CaptchaVerifyURL = env.GetString("CAPTCHA_VERIFY_URL", challenge.TurnstileVerifyURL)
+	cfg.CaptchaSecret = env.GetString("CAPTCHA_SECRET", "")
+	cfg.CaptchaFakePass = env.GetString("CAPTCHA_FAKE_PASS", "")
+
+	cfg.TOTPKey = env.GetString("TOTP_ENCRYPTION_KEY", "")
+
+	cfg.SIMCheck = simcheck.Config{
+		Driver: env.GetString("SIMCHECK_PROVIDER", simcheck.DriverNone),
+		CAMARA: simcheck.CAMARAConfig{
+			BaseURL: env.GetString("SIMCHECK_URL", ""),
+			Token:   env.GetString("SIMCHECK_TOKEN", ""),
+			Timeout: env.GetDuration("SIMCHECK_TIMEOUT", 5*time.Second),
+		},
+		SwapWindow: env.GetDuration("SIMCHECK_SWAP_WINDOW", simcheck.DefaultSwapWindow),
+	}
+
+	cfg.Tokens = auth.DefaultConfig()
+	cfg.Tokens.Issuer = env.GetString("JWT_ISSUER", cfg.Tokens.Issuer)
+	for name, policy := range cfg.Tokens.Clients {
+		prefix := "JWT_" + strings.ToUpper(name)
+		policy.AccessTTL = env.GetDuration(prefix+"_ACCESS_TTL", policy.AccessTTL)
+		policy.RefreshTTL = env.GetDuration(prefix+"_REFRESH_TTL", policy.RefreshTTL)
+		cfg.Tokens.Clients[name] = policy
+	}
+	if err := cfg.Tokens.Validate(); err != nil {
+		logger.Error("invalid token config", "error", err)
+		os.Exit(1)
+	}
+
+	cfg.OIDC = oidc.Config{
+		Issuer:         strings.TrimSuffix(env.GetString("OIDC_ISSUER", ""), "/"),
+		ConsentPageURL: env.GetString("OIDC_CONSENT_PAGE_URL", ""),
+	}
+	// Relying parties verify ID tokens against the JWKS, which never holds HS256 secrets
+	if cfg.OIDC.Issuer != "" && cfg.JWTSigningKeyFile == "" {
+		logger.Error("OIDC_ISSUER requires JWT_SIGNING_KEY_FILE")
+		os.Exit(1)
+	}
+
+	smsTemplates, err := templates.Load(cfg.SMSTemplatesDir)
+	if err != nil {
+		logger.Error("failed to load sms templates", "error", err)
+		os.Exit(1)
 	}
 
 	// 4. Database Connection
@@ -66,17 +285,130 @@ func main() {
 	defer cache.Close()
 	logger.Info("redis connection established")
 
-	jwtManager := auth.NewJWTManager(cfg.JWTSecret)
-	smsProvider := messenger.NewMockProvider()
+	jwtManager, err := newTokenManager(cfg)
+	if err != nil {
+		logger.Error("failed to configure token signing", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("token signing configured", "published_keys", len(jwtManager.JWKS().Keys))
+
+	// Handlers only enqueue; the worker owns the (possibly slow) provider calls
+	outbox = delivery.NewQueue(cache, repo.New(pool), cfg.OTP.TTL)
+
+	smsProvider, err := messenger.New(cfg.SMS)
+	if err != nil {
+		logger.Error("failed to configure sms provider", "error", err)
+		os.Exit(1)
+	}
+	if closer, ok := smsProvider.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if router, ok := smsProvider.(*messenger.Router); ok {
+		// Ops can move traffic between aggregators by writing a JSON route list to this key
+		go router.Watch(context.Background(), env.GetDuration("SMS_ROUTES_RELOAD_INTERVAL", 30*time.Second),
+			func(ctx context.Context) ([]messenger.Route, error) {
+				raw, err := cache.Get(ctx, smsRoutesKey).Bytes()
+				if errors.Is(err, redis.Nil) {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				var routes []messenger.Route
+				return routes, json.Unmarshal(raw, &routes)
+			})
+	}
+	logger.Info("sms provider configured", "driver", cfg.SMS.Driver, "routed_providers", cfg.SMS.Providers)
+	if cfg.SMSWebhookToken == "" {
+		logger.Warn("SMS_WEBHOOK_TOKEN is not set; only signed delivery receipts (twilio) are accepted")
+	}
+
+	otpChannels, err := messenger.NewChannels(cfg.SMS, smsProvider)
+	if err != nil {
+		logger.Error("failed to configure otp channels", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("otp channels configured", "channels", otpChannels.Channels())
+
+	var captcha challenge.Verifier = challenge.FakeVerifier{Pass: cfg.CaptchaFakePass}
+	if cfg.CaptchaSecret != "" {
+		captcha = challenge.NewSiteVerifier(cfg.CaptchaVerifyURL, cfg.CaptchaSecret, smsTimeout)
+	}
+	// Anyone who knows the signing secret can mint solved challenges, so it gets its own
+	if string(cfg.Challenge.Secret) == cfg.HashPepper {
+		logger.Error("CHALLENGE_SECRET must be set and differ from HASH_PEPPER")
+		os.Exit(1)
+	}
+	challenges, err := challenge.NewIssuer(cache, cfg.Challenge, captcha)
+	if err != nil {
+		logger.Error("failed to configure otp challenges", "error", err)
+		os.Exit(1)
+	}
+
+	simChecker, err := simcheck.New(cfg.SIMCheck)
+	if err != nil {
+		logger.Error("failed to configure sim checks", "error", err)
+		os.Exit(1)
+	}
+	// A nil checker skips the account lookup the checks need
+	var sims account.SIMChecker
+	if simChecker.Enabled() {
+		sims = simChecker
+	}
+	logger.Info("sim checks configured", "driver", cfg.SIMCheck.Driver)
+
+	// The pepper ships in every environment's config; the key to stored secrets can't be it
+	if cfg.TOTPKey == cfg.HashPepper {
+		logger.Error("TOTP_ENCRYPTION_KEY must be set and differ from HASH_PEPPER")
+		os.Exit(1)
+	}
+	totpCipher, err := totp.NewCipher(cfg.TOTPKey)
+	if err != nil {
+		logger.Error("failed to configure totp secret encryption", "error", err)
+		os.Exit(1)
+	}
+
+	worker := delivery.NewWorker(outbox, otpChannels, cfg.Outbox, logger)
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	go func() {
+		if err := worker.Run(workerCtx); err != nil {
+			logger.Error("delivery worker stopped", "error", err)
+		}
+	}()
+
+	// Deleted accounts are erased for good once their restore window is over
+	purger := account.NewPurger(repo.New(pool), cfg.Purge, logger)
+	go func() {
+		if err := purger.Run(workerCtx); err != nil {
+			logger.Error("account purger stopped", "error", err)
+		}
+	}()
+
+	// Data exports are built off the request path too
+	exports := export.New(cache, cfg.Export)
+	exportWorker := export.NewWorker(exports, repo.New(pool), logger)
+	go func() {
+		if err := exportWorker.Run(workerCtx); err != nil {
+			logger.Error("export worker stopped", "error", err)
+		}
+	}()
 
 	// 6. Initialize Application
 	app := &application{
-		config:    cfg,
-		db:        pool,
-		cache:     cache,
-		logger:    logger,
-		messenger: smsProvider,
-		auth:      jwtManager,
+		config:     cfg,
+		db:         pool,
+		cache:      cache,
+		logger:     logger,
+		messenger:  smsProvider,
+		outbox:     outbox,
+		exports:    exports,
+		fraud:      fraud.NewGuard(cache, cfg.Fraud, logger),
+		challenges: challenges,
+		sims:       sims,
+		totp:       totpCipher,
+		templates:  smsTemplates,
+		auth:       jwtManager,
 	}
 
 	// 7. Start Server
@@ -86,3 +418,44 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// newTokenManager signs with JWT_SIGNING_KEY_FILE and also accepts the keys in
+// JWT_VERIFY_KEY_FILES (being rotated out). JWT_SECRET is the legacy HS256 secret:
+// it signs only when no key file is set, otherwise it keeps verifying HS256 tokens
+// that carry iss, aud and sid. Tokens from before those claims are refused whatever
+// the key, so upgrading signs every existing session out once.
+func newTokenManager(cfg config) (auth.TokenManager, error) {
+	var verify []auth.Key
+	for _, path := range cfg.JWTVerifyKeyFiles {
+		k, err := auth.LoadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		verify = append(verify, k)
+	}
+
+	var legacy *auth.Key
+	if cfg.JWTSecret != "" {
+		k, err := auth.NewHMACKey([]byte(cfg.JWTSecret))
+		if err != nil {
+			return nil, err
+		}
+		legacy = &k
+	}
+
+	if cfg.JWTSigningKeyFile == "" {
+		if legacy == nil {
+			return nil, errors.New("set JWT_SIGNING_KEY_FILE (or JWT_SECRET for HS256)")
+		}
+		return auth.NewJWTManager(cfg.Tokens, *legacy, verify...)
+	}
+
+	signing, err := auth.LoadKeyFile(cfg.JWTSigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if legacy != nil {
+		verify = append(verify, *legacy)
+	}
+	return auth.NewJWTManager(cfg.Tokens, signing, verify...)
+}
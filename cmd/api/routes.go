@@ -7,12 +7,16 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/yabeye/addis_verify_backend/internal/account"
 	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/delivery"
+	"github.com/yabeye/addis_verify_backend/internal/export"
 	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+	"github.com/yabeye/addis_verify_backend/internal/oidc"
 	"github.com/yabeye/addis_verify_backend/internal/users"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
 )
 
 // MountRoutes connects the specific sub-handlers for the v1 API.
-func MountRoutes(app *application, accountHandler account.Handler, userHandler users.Handler) http.Handler {
+func MountRoutes(app *application, accountHandler account.Handler, userHandler users.Handler, messagesHandler delivery.Handler, oidcHandler oidc.Handler, exportHandler export.Handler) http.Handler {
 	r := chi.NewRouter()
 	queries := repo.New(app.db)
 
@@ -26,19 +30,100 @@ func MountRoutes(app *application, accountHandler account.Handler, userHandler u
 			r.Post("/auth/send-otp", accountHandler.SendOTP)
 			r.Post("/auth/verify-otp", accountHandler.VerifyOTP)
 			r.Post("/auth/refresh", accountHandler.RefreshToken)
+			r.Post("/auth/recover", accountHandler.Recover)
+			r.Post("/auth/totp", accountHandler.CompleteTOTPLogin)
 		})
 
 		// Protected Account Routes
 		r.Group(func(r chi.Router) {
-			r.Use(middlewares.AuthMiddleware(app.auth, queries))
+			r.Use(middlewares.AuthMiddleware(app.auth, queries, auth.AudienceAPI))
+			r.Use(middlewares.RequireScope(auth.ScopeAccount))
 			r.Get("/me", accountHandler.GetMe)
+			r.Delete("/me", accountHandler.DeleteMe)
+			r.Put("/me/language", accountHandler.UpdateLanguage)
+			r.Put("/me/phone", accountHandler.ChangePhone)
+			r.Get("/me/sessions", accountHandler.ListSessions)
+			r.Delete("/me/sessions", accountHandler.RevokeAllSessions)
+			r.Delete("/me/sessions/{sessionID}", accountHandler.RevokeSession)
+			r.Get("/me/recovery-codes", accountHandler.GetRecoveryCodes)
+			r.Post("/me/recovery-codes", accountHandler.RegenerateRecoveryCodes)
+			r.Post("/me/totp", accountHandler.EnrollTOTP)
+			r.Post("/me/totp/confirm", accountHandler.ConfirmTOTP)
+			r.Delete("/me/totp", accountHandler.DisableTOTP)
+			r.Post("/me/export", exportHandler.Request)
+			r.Get("/me/export/{exportID}", exportHandler.GetStatus)
 			r.Post("/auth/logout", accountHandler.Logout)
 		})
 	})
 
+	// --- MESSAGE DELIVERY STATUS ---
+	// Message IDs are random UUIDs handed out by send-otp, so the lookup stays public
+	r.Route("/messages", func(r chi.Router) {
+		r.Use(middlewares.RateLimit(30, 1*time.Minute, "Too many status checks."))
+		r.Get("/{messageID}", messagesHandler.GetStatus)
+	})
+
+	// --- DATA EXPORT DOWNLOADS ---
+	// The unguessable, short-lived token in the link is the credential
+	r.Route("/exports", func(r chi.Router) {
+		r.Use(middlewares.RateLimit(10, 1*time.Minute, "Too many downloads."))
+		r.Get("/{token}", exportHandler.Download)
+	})
+
+	// --- PROVIDER CALLBACKS ---
+	r.Route("/webhooks", func(r chi.Router) {
+		r.Use(middlewares.LimitRequestSize(64 * 1024))
+		r.Post("/sms/{provider}", messagesHandler.HandleReceipt)
+	})
+
+	// --- SUPPORT & BACK-OFFICE ---
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(middlewares.AdminKey(app.config.AdminAPIKey))
+		r.Get("/messages", messagesHandler.ListByPhone)
+		r.Put("/accounts/{accountID}/status", accountHandler.SetStatus)
+		r.Get("/oauth/clients", oidcHandler.ListClients)
+		r.Post("/oauth/clients", oidcHandler.CreateClient)
+	})
+
+	// --- OPENID CONNECT ("Log in with AddisVerify") ---
+	if app.config.OIDC.Issuer != "" {
+		r.Route("/oauth", func(r chi.Router) {
+			// Relying parties' back ends
+			r.Group(func(r chi.Router) {
+				r.Use(middlewares.LimitRequestSize(10 * 1024))
+				r.Use(middlewares.RateLimit(30, 1*time.Minute, "Too many token requests."))
+				r.Post("/token", oidcHandler.Token)
+			})
+			r.Group(func(r chi.Router) {
+				// Resource servers may introspect on every request they serve
+				r.Use(middlewares.LimitRequestSize(10 * 1024))
+				r.Use(middlewares.RateLimit(600, 1*time.Minute, "Too many introspection requests."))
+				r.Post("/introspect", oidcHandler.Introspect)
+				r.Post("/revoke", oidcHandler.Revoke)
+			})
+
+			// The consent screen: read the request, then the signed-in user decides
+			r.Get("/authorize", oidcHandler.Authorize)
+			r.Group(func(r chi.Router) {
+				r.Use(middlewares.AuthMiddleware(app.auth, queries, auth.AudienceAPI))
+				r.Use(middlewares.RequireScope(auth.ScopeAccount))
+				r.Post("/authorize", oidcHandler.Approve)
+			})
+
+			// Only tokens issued to relying parties are accepted here
+			r.Group(func(r chi.Router) {
+				r.Use(middlewares.AuthMiddleware(app.auth, queries, auth.AudienceUserInfo))
+				r.Use(middlewares.RequireScope(auth.ScopeOpenID))
+				r.Get("/userinfo", oidcHandler.UserInfo)
+				r.Post("/userinfo", oidcHandler.UserInfo)
+			})
+		})
+	}
+
 	// --- USER & PROFILE ROUTES ---
 	r.Route("/users", func(r chi.Router) {
-		r.Use(middlewares.AuthMiddleware(app.auth, queries))
+		r.Use(middlewares.AuthMiddleware(app.auth, queries, auth.AudienceAPI))
+		r.Use(middlewares.RequireScope(auth.ScopeProfile))
 
 		r.Get("/me", userHandler.GetMe)
 		r.Put("/profile", userHandler.UpdateProfile)
@@ -53,7 +138,8 @@ func MountRoutes(app *application, accountHandler account.Handler, userHandler u
 	// We put this outside /users if you want it to be a dedicated media endpoint.
 	r.Route("/media", func(r chi.Router) {
 		// We protect the upload because it writes to our disk/storage
-		r.Use(middlewares.AuthMiddleware(app.auth, queries))
+		r.Use(middlewares.AuthMiddleware(app.auth, queries, auth.AudienceAPI))
+		r.Use(middlewares.RequireScope(auth.ScopeProfile))
 
 		// The path becomes: /api/v1/media/upload/{userID}/{fileName}
 		r.Put("/upload/{userID}/{fileName}", userHandler.HandleBinaryUpload)
@@ -0,0 +1,134 @@
+package account
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+)
+
+// DeletionGracePeriod is how long a self-deleted account can be restored before
+// the purge job erases it.
+const DeletionGracePeriod = 30 * 24 * time.Hour
+
+// deleteAccountRequest confirms a deletion with a code sent to the account's phone
+// @Name DeleteAccountRequest
+type deleteAccountRequest struct {
+	// OTP is a fresh code from send-otp for the account's own phone
+	OTP string `json:"otp" validate:"required" example:"123456"`
+}
+
+// deleteAccountResponse tells the user until when they can change their mind
+type deleteAccountResponse struct {
+	Message      string    `json:"message" example:"Account scheduled for deletion"`
+	RestoreUntil time.Time `json:"restore_until" example:"2026-11-15T09:30:00Z"`
+}
+
+// restorable reports whether acc was deleted by its holder and the restore window is still open.
+func restorable(acc repo.Account) bool {
+	return acc.Status == repo.AccountStatusDeleted && acc.RestoreUntil.Valid && time.Now().Before(acc.RestoreUntil.Time)
+}
+
+// DeleteMe godoc
+// @Summary      Delete My Account
+// @Description  Deletes the signed-in account after confirming a fresh OTP sent to its phone. Every session is signed out at once. Signing in again with restore=true within 30 days undoes the deletion; after that the profile, address and uploaded files are erased for good.
+// @Tags         accounts
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      deleteAccountRequest  true  "Confirmation code"
+// @Success      200      {object}  deleteAccountResponse
+// @Failure      401      {object}  json.ErrorResponse
+// @Failure      409      {object}  json.ErrorResponse
+// @Failure      429      {object}  retryLaterResponse
+// @Router       /api/v1/accounts/me [delete]
+func (h *handler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accID, ok := ctx.Value(middlewares.UserIDKey).(pgtype.UUID)
+	if !ok || !accID.Valid {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrUnauthorizedError)
+		return
+	}
+
+	var req deleteAccountRequest
+	if err := json.Read(r, &req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, constants.ErrInvalidJSON)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, "Validation failed: "+err.Error())
+		return
+	}
+
+	acc, err := h.service.GetAccountByID(ctx, accID)
+	if err != nil {
+		json.WriteError(w, http.StatusNotFound, constants.ErrAccountNotFound)
+		return
+	}
+
+	// 1. A stolen access token alone must not be enough to delete the account
+	if !h.checkOTP(ctx, w, acc.Phone, req.OTP) {
+		return
+	}
+
+	// 2. Only active accounts can delete themselves
+	restoreUntil := time.Now().Add(DeletionGracePeriod)
+	deleted, err := h.service.DeleteAccount(ctx, accID, restoreUntil)
+	if err != nil {
+		h.logger.Error("failed to delete account", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	if !deleted {
+		json.WriteErrorCode(w, http.StatusConflict, constants.CodeInvalidTransition, constants.ErrInvalidTransition)
+		return
+	}
+	h.clearAttempts(ctx, acc.Phone)
+
+	// 3. Sign out everywhere, including this device
+	revoked, err := h.service.RevokeAllSessions(ctx, accID, pgtype.UUID{})
+	if err != nil {
+		// The deleted status alone already locks the account out
+		h.logger.Error("failed to revoke sessions after deletion", "account_id", accID, "error", err)
+	}
+	h.recordEvent(r, accID, pgtype.UUID{}, EventAccountDeleted, map[string]string{
+		"restore_until": restoreUntil.UTC().Format(time.RFC3339),
+	})
+
+	h.logger.Info("account deleted by holder", "account_id", accID, "sessions_revoked", revoked)
+	json.Write(w, http.StatusOK, deleteAccountResponse{
+		Message:      "Account scheduled for deletion",
+		RestoreUntil: restoreUntil,
+	})
+}
+
+// restore reactivates acc during sign-in when the user asked for it. Without
+// restore it answers 403 and leaves the code unspent, so the app can ask the user
+// and retry with restore=true.
+func (h *handler) restore(w http.ResponseWriter, r *http.Request, acc repo.Account, restore bool) (repo.Account, bool) {
+	if !restore {
+		json.WriteErrorCode(w, http.StatusForbidden, constants.CodeAccountRestorable, constants.ErrAccountRestorable)
+		return acc, false
+	}
+
+	restored, err := h.service.RestoreAccount(r.Context(), acc.ID)
+	if err != nil {
+		h.logger.Error("failed to restore account", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return acc, false
+	}
+	// The window closed in the meantime: fall through to the usual deleted answer
+	if !restored {
+		return acc, true
+	}
+
+	h.recordEvent(r, acc.ID, pgtype.UUID{}, EventAccountRestored, map[string]string{})
+	h.logger.Info("account restored by holder", "account_id", acc.ID)
+	acc.Status = repo.AccountStatusActive
+	acc.DeletedAt, acc.RestoreUntil = pgtype.Timestamptz{}, pgtype.Timestamptz{}
+	return acc, true
+}
@@ -0,0 +1,252 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/otp"
+)
+
+func TestHandler_DeleteMe(t *testing.T) {
+	accID := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	phone, code, pepper := "+251911223344", "123456", "test-pepper"
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+
+	setup := func(t *testing.T) (*handler, *mockService, *miniredis.Miniredis) {
+		mr := miniredis.RunT(t)
+		mr.Set("otp:"+phone, fmt.Sprintf("%x", sha256.Sum256([]byte(phone+code+pepper))))
+		svc := new(mockService)
+		svc.On("GetAccountByID", mock.Anything, accID).Return(repo.Account{ID: accID, Phone: phone, Status: repo.AccountStatusActive}, nil)
+		h := &handler{
+			service: svc, logger: logger, validate: validator.New(), hashPepper: pepper, policy: otp.DefaultPolicy(),
+			cache: redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		}
+		return h, svc, mr
+	}
+	deleteMe := func(h *handler, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/accounts/me", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), middlewares.UserIDKey, accID))
+		w := httptest.NewRecorder()
+		h.DeleteMe(w, req)
+		return w
+	}
+
+	t.Run("Deletes with a fresh code and signs out everywhere", func(t *testing.T) {
+		h, svc, mr := setup(t)
+		svc.On("DeleteAccount", mock.Anything, accID, mock.MatchedBy(func(until time.Time) bool {
+			return until.Sub(time.Now().Add(DeletionGracePeriod)).Abs() < time.Minute
+		})).Return(true, nil)
+		svc.On("RevokeAllSessions", mock.Anything, accID, pgtype.UUID{}).Return(int64(2), nil)
+		svc.On("RecordSecurityEvent", mock.Anything, mock.MatchedBy(func(e repo.CreateSecurityEventParams) bool {
+			return e.EventType == EventAccountDeleted && e.AccountID == accID
+		})).Return(nil)
+
+		w := deleteMe(h, `{"otp":"123456"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp deleteAccountResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.WithinDuration(t, time.Now().Add(DeletionGracePeriod), resp.RestoreUntil, time.Minute)
+		assert.False(t, mr.Exists("otp:"+phone), "the code is spent")
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("A wrong code deletes nothing", func(t *testing.T) {
+		h, svc, mr := setup(t)
+
+		w := deleteMe(h, `{"otp":"654321"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeInvalidOTP)
+		attempts, _ := mr.Get("otp:attempts:" + phone)
+		assert.Equal(t, "1", attempts, "counts towards the lockout")
+		svc.AssertNotCalled(t, "DeleteAccount", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Requires a code", func(t *testing.T) {
+		h, svc, _ := setup(t)
+
+		w := deleteMe(h, `{}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		svc.AssertNotCalled(t, "DeleteAccount", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Conflicts when the account is no longer active", func(t *testing.T) {
+		h, svc, _ := setup(t)
+		svc.On("DeleteAccount", mock.Anything, accID, mock.Anything).Return(false, nil)
+
+		w := deleteMe(h, `{"otp":"123456"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		svc.AssertNotCalled(t, "RevokeAllSessions", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestHandler_VerifyOTPRestore(t *testing.T) {
+	accID := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	phone, code, pepper := "+251911223344", "123456", "test-pepper"
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+	deleted := repo.Account{
+		ID: accID, Phone: phone, Status: repo.AccountStatusDeleted,
+		DeletedAt:    pgtype.Timestamptz{Time: time.Now().Add(-24 * time.Hour), Valid: true},
+		RestoreUntil: pgtype.Timestamptz{Time: time.Now().Add(DeletionGracePeriod - 24*time.Hour), Valid: true},
+	}
+
+	setup := func(t *testing.T, acc repo.Account) (*handler, *mockService, *mockAuth, *miniredis.Miniredis) {
+		mr := miniredis.RunT(t)
+		mr.Set("otp:"+phone, fmt.Sprintf("%x", sha256.Sum256([]byte(phone+code+pepper))))
+		svc, authMgr := new(mockService), new(mockAuth)
+		svc.On("UpsertByPhone", mock.Anything, phone).Return(acc, nil)
+		h := &handler{
+			service: svc, auth: authMgr, logger: logger, validate: validator.New(), hashPepper: pepper, policy: otp.DefaultPolicy(),
+			cache: redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		}
+		return h, svc, authMgr, mr
+	}
+	verify := func(h *handler, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.VerifyOTP(w, httptest.NewRequest(http.MethodPost, "/verify", bytes.NewBufferString(body)))
+		return w
+	}
+
+	t.Run("Asks before restoring and keeps the code", func(t *testing.T) {
+		h, svc, _, mr := setup(t, deleted)
+
+		w := verify(h, `{"phone":"+251911223344","otp":"123456"}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeAccountRestorable)
+		assert.True(t, mr.Exists("otp:"+phone), "the app retries with restore=true")
+		svc.AssertNotCalled(t, "RestoreAccount", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Restores and signs in", func(t *testing.T) {
+		h, svc, authMgr, mr := setup(t, deleted)
+		sessionID := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+		svc.On("RestoreAccount", mock.Anything, accID).Return(true, nil)
+		svc.On("RecordSecurityEvent", mock.Anything, mock.MatchedBy(func(e repo.CreateSecurityEventParams) bool {
+			return e.EventType == EventAccountRestored
+		})).Return(nil)
+		svc.On("CreateSession", mock.Anything, mock.Anything).Return(repo.Session{ID: sessionID, AccountID: accID, ClientType: auth.ClientMobile}, nil)
+		svc.On("SaveRefreshToken", mock.Anything, sessionID, pgtype.UUID{}, "jti", mock.Anything).Return(nil)
+		svc.On("EnrollRecoveryCodes", mock.Anything, accID, mock.Anything).Return(false, nil)
+		svc.On("GetTOTP", mock.Anything, accID).Return(repo.AccountTotp{}, pgx.ErrNoRows)
+		authMgr.On("GenerateTokenPair", mock.Anything).Return(&auth.TokenDetails{AccessToken: "at", RefreshToken: "rt", RefreshTokenID: "jti"}, nil)
+
+		w := verify(h, `{"phone":"+251911223344","otp":"123456","restore":true}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp authSuccessResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "active", resp.Account.Status)
+		assert.False(t, mr.Exists("otp:"+phone))
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("The window closed in the meantime", func(t *testing.T) {
+		h, svc, _, _ := setup(t, deleted)
+		svc.On("RestoreAccount", mock.Anything, accID).Return(false, nil)
+
+		w := verify(h, `{"phone":"+251911223344","otp":"123456","restore":true}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeAccountDeleted)
+		svc.AssertNotCalled(t, "CreateSession", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Accounts deleted by support can't be restored", func(t *testing.T) {
+		byAdmin := deleted
+		byAdmin.RestoreUntil = pgtype.Timestamptz{}
+		h, svc, _, _ := setup(t, byAdmin)
+
+		w := verify(h, `{"phone":"+251911223344","otp":"123456","restore":true}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeAccountDeleted)
+		svc.AssertNotCalled(t, "RestoreAccount", mock.Anything, mock.Anything)
+	})
+}
+
+type fakePurgeStore struct {
+	due    []pgtype.UUID
+	cutoff time.Time
+	purged []pgtype.UUID
+	err    error
+}
+
+func (s *fakePurgeStore) ListPurgeableAccounts(_ context.Context, arg repo.ListPurgeableAccountsParams) ([]pgtype.UUID, error) {
+	s.cutoff = arg.DeletedAt.Time
+	return s.due, nil
+}
+
+func (s *fakePurgeStore) PurgeAccount(_ context.Context, id pgtype.UUID) (int64, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	s.purged = append(s.purged, id)
+	return 1, nil
+}
+
+func TestPurger_PurgeDue(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+	gone := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	kept := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+
+	mediaDir := func(t *testing.T) string {
+		dir := t.TempDir()
+		for _, id := range []pgtype.UUID{gone, kept} {
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, id.String()), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, id.String(), "headshot.jpg"), []byte("jpg"), 0o644))
+		}
+		return dir
+	}
+
+	t.Run("Erases files and rows of due accounts only", func(t *testing.T) {
+		dir := mediaDir(t)
+		store := &fakePurgeStore{due: []pgtype.UUID{gone}}
+		p := NewPurger(store, PurgeConfig{MediaDir: dir}, logger)
+
+		n, err := p.PurgeDue(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []pgtype.UUID{gone}, store.purged)
+		assert.WithinDuration(t, time.Now().Add(-DeletionGracePeriod), store.cutoff, time.Minute)
+		assert.NoDirExists(t, filepath.Join(dir, gone.String()))
+		assert.FileExists(t, filepath.Join(dir, kept.String(), "headshot.jpg"))
+	})
+
+	t.Run("Accounts without uploads purge too", func(t *testing.T) {
+		store := &fakePurgeStore{due: []pgtype.UUID{gone}}
+		p := NewPurger(store, PurgeConfig{MediaDir: t.TempDir()}, logger)
+
+		n, err := p.PurgeDue(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+	})
+
+	t.Run("A database failure is reported for the next run", func(t *testing.T) {
+		store := &fakePurgeStore{due: []pgtype.UUID{gone}, err: errors.New("connection reset")}
+		p := NewPurger(store, PurgeConfig{MediaDir: mediaDir(t)}, logger)
+
+		n, err := p.PurgeDue(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, 0, n)
+	})
+}
@@ -3,56 +3,148 @@ package account
 import (
 	"time"
 
+	"github.com/yabeye/addis_verify_backend/internal/challenge"
 	repo "github.com/yabeye/addis_verify_backend/internal/database"
 )
 
 // sendOTPRequest represents the payload for requesting a new OTP
 // @Name SendOTPRequest
 type sendOTPRequest struct {
-	// Phone must be in E.164 format and include the '+' prefix
-	Phone string `json:"phone" validate:"required,e164,startswith=+" example:"+251911223344"`
+	// Phone is an Ethiopian mobile number in local or international format (0911..., +251 91 1...)
+	Phone string `json:"phone" validate:"required,max=32" example:"+251911223344"`
+	// Channel picks the delivery channel: sms (default), voice, whatsapp or telegram
+	Channel string `json:"channel" validate:"omitempty,oneof=sms voice whatsapp telegram" example:"sms"`
+	// Challenge answers the challenge from a previous 428 response
+	Challenge *challenge.Solution `json:"challenge,omitempty"`
 }
 
 // sendOTPResponse represents the success message after an OTP is triggered
 // @Name SendOTPResponse
 type sendOTPResponse struct {
 	Message string `json:"message" example:"OTP sent successfully"`
+	// ExpiresIn is how many seconds the code stays valid
+	ExpiresIn int `json:"expires_in" example:"300"`
+	// RetryAfter is how many seconds the client must wait before requesting another code
+	RetryAfter int `json:"retry_after" example:"60"`
+	// MessageID can be polled at /api/v1/messages/{messageID} for delivery status
+	MessageID string `json:"message_id,omitempty" example:"0b9f6c1e-5d0e-4c39-9b7e-2f4a8c1d3e55"`
+	// Channel is how the code was sent
+	Channel string `json:"channel" example:"sms"`
+	// Fallback, when present, may be requested once After seconds pass without delivery,
+	// even inside the resend cooldown
+	Fallback *fallbackOffer `json:"fallback,omitempty"`
+}
+
+// fallbackOffer tells the client which channel to offer if the code doesn't arrive
+// @Name FallbackOffer
+type fallbackOffer struct {
+	Channel string `json:"channel" example:"voice"`
+	After   int    `json:"after" example:"30"`
+}
+
+// retryLaterResponse is returned with 429 when a phone is in cooldown or locked out
+// @Name RetryLaterResponse
+type retryLaterResponse struct {
+	Error      string `json:"error" example:"Please wait before requesting a new code"`
+	Code       string `json:"code" example:"OTP_COOLDOWN"`
+	RetryAfter int    `json:"retry_after" example:"120"`
+}
+
+// challengeRequiredResponse is returned with 428 when the client must solve a challenge
+// and resend the request with the solution
+// @Name ChallengeRequiredResponse
+type challengeRequiredResponse struct {
+	Error     string              `json:"error" example:"Please complete the challenge to continue"`
+	Code      string              `json:"code" example:"CHALLENGE_REQUIRED"`
+	Challenge challenge.Challenge `json:"challenge"`
 }
 
 // verifyOTPRequest represents the payload to exchange an OTP for a JWT
 // @Name VerifyOTPRequest
 type verifyOTPRequest struct {
-	Phone string `json:"phone" validate:"required,e164,startswith=+" example:"+251911223344"`
-	// OTP must be exactly 6 digits
-	OTP string `json:"otp" validate:"required,len=6,numeric" example:"123456"`
+	// Phone accepts the same formats as send-otp
+	Phone string `json:"phone" validate:"required,max=32" example:"+251911223344"`
+	// OTP must match the configured OTP policy (6 digits by default)
+	OTP string `json:"otp" validate:"required" example:"123456"`
+	// DeviceName labels the session in the user's device list
+	DeviceName string `json:"device_name" validate:"omitempty,max=100" example:"Abebe's Pixel 7"`
+	// ClientType picks token lifetimes: mobile (the default) or web
+	ClientType string `json:"client_type" validate:"omitempty,oneof=mobile web" example:"mobile"`
+	// Restore cancels a pending self-service deletion and signs in
+	Restore bool `json:"restore" example:"false"`
+	// RecoveryCode confirms a login held because the number changed hands
+	RecoveryCode string `json:"recovery_code,omitempty" validate:"omitempty,max=32" example:"k7m2p-x9qrt"`
+}
+
+// updateLanguageRequest sets the language SMS are sent in
+// @Name UpdateLanguageRequest
+type updateLanguageRequest struct {
+	// Language is an ISO 639-1 code: en, am (Amharic), om (Afaan Oromo) or ti (Tigrinya)
+	Language string `json:"language" validate:"required,max=8" example:"am"`
 }
 
 // authSuccessResponse contains the authentication token and user profile
 // @Name AuthSuccessResponse
 type authSuccessResponse struct {
-	Message      string     `json:"message" example:"OTP verified successfully"`
-	AccessToken  string     `json:"access_token" example:"eyJhbGciOiJIUzI1Ni..."`
-	RefreshToken string     `json:"refresh_token" example:"eyJhbGciOiJIUzI1Ni..."`
-	Account      AccountDTO `json:"account"`
+	Message      string `json:"message" example:"OTP verified successfully"`
+	AccessToken  string `json:"access_token" example:"eyJhbGciOiJIUzI1Ni..."`
+	RefreshToken string `json:"refresh_token" example:"eyJhbGciOiJIUzI1Ni..."`
+	SessionID    string `json:"session_id" example:"7c9e6679-7425-40de-944b-e07fc1f90ae7"`
+	// ExpiresIn is the access token lifetime in seconds
+	ExpiresIn int64      `json:"expires_in" example:"900"`
+	Account   AccountDTO `json:"account"`
+	// RecoveryCodes are returned once, on the login that created them. Store them offline.
+	RecoveryCodes []string `json:"recovery_codes,omitempty" example:"k7m2p-x9qrt,4hwn8-cd3fv"`
 }
 
 // AccountDTO represents the public-facing account profile
 // @Name AccountDTO
 type AccountDTO struct {
-	ID        string `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
-	Phone     string `json:"phone" example:"+251911223344"`
-	Status    string `json:"status" example:"active"`
-	UpdatedAt string `json:"updated_at" example:"2023-10-27T10:00:00Z"`
-	CreatedAt string `json:"created_at" example:"2023-10-27T10:00:00Z"`
+	ID     string `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Phone  string `json:"phone" example:"+251911223344"`
+	Status string `json:"status" example:"active"`
+	// PreferredLanguage is empty until the user picks one
+	PreferredLanguage string `json:"preferred_language,omitempty" example:"am"`
+	UpdatedAt         string `json:"updated_at" example:"2023-10-27T10:00:00Z"`
+	CreatedAt         string `json:"created_at" example:"2023-10-27T10:00:00Z"`
 }
 
 // MapAccountRow translates the database record into a clean API response
 func MapAccountRow(u repo.Account) AccountDTO {
 	return AccountDTO{
-		ID:        u.ID.String(),
-		Phone:     u.Phone,
-		Status:    string(u.Status),
-		UpdatedAt: u.UpdatedAt.Time.Format(time.RFC3339),
-		CreatedAt: u.CreatedAt.Time.Format(time.RFC3339),
+		ID:                u.ID.String(),
+		Phone:             u.Phone,
+		Status:            string(u.Status),
+		PreferredLanguage: u.PreferredLanguage.String,
+		UpdatedAt:         u.UpdatedAt.Time.Format(time.RFC3339),
+		CreatedAt:         u.CreatedAt.Time.Format(time.RFC3339),
+	}
+}
+
+// SessionDTO describes one signed-in device
+// @Name SessionDTO
+type SessionDTO struct {
+	ID         string `json:"id" example:"7c9e6679-7425-40de-944b-e07fc1f90ae7"`
+	DeviceName string `json:"device_name,omitempty" example:"Abebe's Pixel 7"`
+	UserAgent  string `json:"user_agent,omitempty" example:"AddisVerify/2.3 (Android 14)"`
+	IPAddress  string `json:"ip_address,omitempty" example:"196.188.10.4"`
+	ClientType string `json:"client_type" example:"mobile"`
+	// Current marks the session the request was made with
+	Current    bool   `json:"current" example:"true"`
+	CreatedAt  string `json:"created_at" example:"2023-10-27T10:00:00Z"`
+	LastSeenAt string `json:"last_seen_at" example:"2023-10-28T08:30:00Z"`
+}
+
+// MapSessionRow translates a session record into its API form
+func MapSessionRow(s repo.Session, current bool) SessionDTO {
+	return SessionDTO{
+		ID:         s.ID.String(),
+		DeviceName: s.DeviceName.String,
+		UserAgent:  s.UserAgent.String,
+		IPAddress:  s.IpAddress.String,
+		ClientType: s.ClientType,
+		Current:    current,
+		CreatedAt:  s.CreatedAt.Time.Format(time.RFC3339),
+		LastSeenAt: s.LastSeenAt.Time.Format(time.RFC3339),
 	}
 }
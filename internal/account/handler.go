@@ -2,20 +2,28 @@ package account
 
 import (
 	"context"
-	"crypto/sha256"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/redis/go-redis/v9"
+	"github.com/yabeye/addis_verify_backend/internal/challenge"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/fraud"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
 	"github.com/yabeye/addis_verify_backend/pkg/auth"
 	"github.com/yabeye/addis_verify_backend/pkg/constants"
 	"github.com/yabeye/addis_verify_backend/pkg/json"
 	"github.com/yabeye/addis_verify_backend/pkg/messenger"
-	"github.com/yabeye/addis_verify_backend/pkg/random"
+	"github.com/yabeye/addis_verify_backend/pkg/otp"
+	"github.com/yabeye/addis_verify_backend/pkg/phone"
+	"github.com/yabeye/addis_verify_backend/pkg/simcheck"
+	"github.com/yabeye/addis_verify_backend/pkg/templates"
 )
 
 // Cache interface abstracts Redis for testability
@@ -23,7 +31,32 @@ type Cache interface {
 	Exists(ctx context.Context, keys ...string) *redis.IntCmd
 	Pipeline() redis.Pipeliner
 	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
 	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	TTL(ctx context.Context, key string) *redis.DurationCmd
+}
+
+// FraudGuard screens send-otp requests for SMS pumping.
+type FraudGuard interface {
+	Screen(r *http.Request, phone string) (fraud.Verdict, error)
+}
+
+// Challenger issues and checks the proof-of-work or CAPTCHA challenges risky clients must solve.
+type Challenger interface {
+	Issue(phone string) (challenge.Challenge, error)
+	Redeem(ctx context.Context, phone string, sol challenge.Solution, remoteIP string) error
+}
+
+// SIMChecker asks the mobile operator whether a number changed hands after since.
+type SIMChecker interface {
+	Check(ctx context.Context, phone string, since time.Time) (simcheck.Verdict, error)
+}
+
+// SecretSealer encrypts authenticator app secrets before they are stored, binding
+// each to its owner.
+type SecretSealer interface {
+	Seal(secret, owner []byte) ([]byte, error)
+	Open(sealed, owner []byte) ([]byte, error)
 }
 
 type handler struct {
@@ -32,7 +65,13 @@ type handler struct {
 	cache      Cache
 	validate   *validator.Validate
 	genOTP     func() (string, error)
+	policy     otp.Policy
 	messenger  messenger.Provider
+	fraud      FraudGuard
+	challenges Challenger
+	sims       SIMChecker
+	secrets    SecretSealer
+	templates  *templates.Set
 	auth       auth.TokenManager
 	hashPepper string
 }
@@ -42,21 +81,47 @@ type Handler interface {
 	VerifyOTP(w http.ResponseWriter, r *http.Request)
 	RefreshToken(w http.ResponseWriter, r *http.Request)
 	GetMe(w http.ResponseWriter, r *http.Request)
+	UpdateLanguage(w http.ResponseWriter, r *http.Request)
 	Logout(w http.ResponseWriter, r *http.Request)
+	ListSessions(w http.ResponseWriter, r *http.Request)
+	RevokeSession(w http.ResponseWriter, r *http.Request)
+	RevokeAllSessions(w http.ResponseWriter, r *http.Request)
+	SetStatus(w http.ResponseWriter, r *http.Request)
+	DeleteMe(w http.ResponseWriter, r *http.Request)
+	Recover(w http.ResponseWriter, r *http.Request)
+	RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request)
+	GetRecoveryCodes(w http.ResponseWriter, r *http.Request)
+	ChangePhone(w http.ResponseWriter, r *http.Request)
+	EnrollTOTP(w http.ResponseWriter, r *http.Request)
+	ConfirmTOTP(w http.ResponseWriter, r *http.Request)
+	DisableTOTP(w http.ResponseWriter, r *http.Request)
+	CompleteTOTPLogin(w http.ResponseWriter, r *http.Request)
 }
 
 // NewHandler creates a new account handler with dependencies
 func NewHandler(service Service, logger *slog.Logger, cache Cache, messenger messenger.Provider,
+	guard FraudGuard,
+	challenges Challenger,
+	sims SIMChecker,
+	secrets SecretSealer,
+	tmpl *templates.Set,
 	tokenManager auth.TokenManager,
 	hashPepper string,
+	policy otp.Policy,
 ) Handler {
 	return &handler{
 		service:    service,
 		logger:     logger,
 		cache:      cache,
 		validate:   validator.New(),
-		genOTP:     random.GenerateOTP,
+		genOTP:     policy.Generate,
+		policy:     policy,
 		messenger:  messenger,
+		fraud:      guard,
+		challenges: challenges,
+		sims:       sims,
+		secrets:    secrets,
+		templates:  tmpl,
 		auth:       tokenManager,
 		hashPepper: hashPepper,
 	}
@@ -80,22 +145,44 @@ func (h *handler) SendOTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Everything below (Redis keys, the account, the message) uses the canonical E.164 form
+	number, ok := h.parsePhone(w, http.StatusUnprocessableEntity, req.Phone)
+	if !ok {
+		return
+	}
+	req.Phone = number.E164
+
+	if req.Channel == "" {
+		req.Channel = string(messenger.ChannelSMS)
+	}
+	if !h.policy.AllowsChannel(req.Channel) {
+		json.WriteError(w, http.StatusUnprocessableEntity, constants.ErrChannelUnavailable)
+		return
+	}
+
 	ctx := r.Context()
-	lockKey := fmt.Sprintf("lock:otp:%s", req.Phone)
-	otpKey := fmt.Sprintf("otp:%s", req.Phone)
 
-	// 3. Rate Limit Check
-	exists, err := h.cache.Exists(ctx, lockKey).Result()
-	if err != nil {
+	// 3. Rate Limit Check (escalating resend cooldown + daily cap)
+	// Switching to the fallback channel of an undelivered code skips the cooldown.
+	if remaining, err := h.lockRemaining(ctx, otpLockKey(req.Phone)); err != nil {
+		h.logger.Error("redis error", "error", err)
+	} else if remaining > 0 && !h.fallbackAllowed(ctx, req.Phone, req.Channel) {
+		h.writeRetryLater(w, remaining, constants.CodeOTPCooldown, constants.ErrRateLimit)
+		return
+	}
+
+	sends, err := h.cache.Get(ctx, sendsKey(req.Phone)).Int()
+	if err != nil && err != redis.Nil {
 		h.logger.Error("redis error", "error", err)
 	}
-	if exists > 0 {
-		json.WriteError(w, http.StatusTooManyRequests, constants.ErrRateLimit)
+	if sends >= h.policy.DailyCap {
+		remaining, _ := h.lockRemaining(ctx, sendsKey(req.Phone))
+		h.writeRetryLater(w, remaining, constants.CodeOTPDailyCap, constants.ErrOTPDailyCap)
 		return
 	}
 
 	// 4. Generate OTP
-	otp, err := h.genOTP()
+	code, err := h.genOTP()
 	if err != nil {
 		h.logger.Error("otp generation failed", "error", err)
 		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
@@ -103,14 +190,44 @@ func (h *handler) SendOTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Hash the OTP before saving to Redis
-	combined := req.Phone + otp + h.hashPepper
-	hash := sha256.Sum256([]byte(combined))
-	otpHash := fmt.Sprintf("%x", hash)
+	otpHash := h.hashOTP(req.Phone, code)
+
+	// The cooldown grows with every send; once the daily cap is hit the phone
+	// waits for the 24h window to reset.
+	cooldown, ok := h.policy.ResendCooldown(sends + 1)
+	if !ok {
+		cooldown = otp.DailyWindow
+		if remaining, _ := h.lockRemaining(ctx, sendsKey(req.Phone)); remaining > 0 {
+			cooldown = remaining
+		}
+	}
+
+	// Fraud screening: a refused send gets the usual response and cooldown,
+	// but no code is stored or sent, so pumping scripts learn nothing.
+	verdict := fraud.Verdict{Allowed: true}
+	if h.fraud != nil {
+		if verdict, err = h.fraud.Screen(r, req.Phone); err != nil {
+			h.logger.Error("fraud check failed", "error", err)
+		}
+	}
+
+	// Suspicious volume from this client or to this range: no SMS until a challenge is solved
+	if verdict.Allowed && verdict.Challenge && h.challenges != nil && !h.passChallenge(w, r, req) {
+		return
+	}
 
 	// 5. Store in Cache (Atomic Pipeline)
+	// A fresh code also resets the failed-attempt counter for the previous one.
 	pipe := h.cache.Pipeline()
-	pipe.Set(ctx, otpKey, otpHash, 5*time.Minute)
-	pipe.Set(ctx, lockKey, "locked", 1*time.Minute)
+	if verdict.Allowed {
+		pipe.Set(ctx, otpKey(req.Phone), otpHash, h.policy.TTL)
+		pipe.Del(ctx, attemptsKey(req.Phone))
+	}
+	pipe.Set(ctx, otpLockKey(req.Phone), "locked", cooldown)
+	pipe.Incr(ctx, sendsKey(req.Phone))
+	if sends == 0 {
+		pipe.Expire(ctx, sendsKey(req.Phone), otp.DailyWindow)
+	}
 
 	if _, err := pipe.Exec(ctx); err != nil {
 		h.logger.Error("redis pipeline failed", "error", err)
@@ -118,30 +235,103 @@ func (h *handler) SendOTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 6. Send the message professionally
-	msg := messenger.Message{
-		To:   req.Phone,
-		Body: fmt.Sprintf("Your Addis Verify code is: %s. Valid for 5 minutes.", otp),
+	if !verdict.Allowed {
+		h.logger.Warn("otp send suppressed", "phone", req.Phone, "reason", verdict.Reason)
+		messageID := h.suppressedMessageID(ctx, req.Phone, req.Channel, verdict.Reason)
+		json.Write(w, http.StatusOK, h.otpSentResponse(req.Channel, cooldown, messageID))
+		return
 	}
 
-	// This runs the provider (Mock for now, Twilio later)
-	if err := h.messenger.Send(r.Context(), msg); err != nil {
-		h.logger.Error("failed to deliver message", "error", err, "phone", req.Phone)
+	// 6. Render the message in the account's language, or the one the client asked for
+	lang := h.templates.Match(h.preferredLanguage(ctx, req.Phone), r.Header.Get("Accept-Language"))
+	name := templates.OTP
+	if req.Channel == string(messenger.ChannelVoice) {
+		name = templates.OTPVoice
+	}
+	body, err := h.templates.Render(name, lang, templates.OTPData{
+		Code:    code,
+		Minutes: int(h.policy.TTL.Minutes()),
+		Spoken:  templates.SpellOut(code),
+	})
+	if err != nil {
+		h.logger.Error("failed to render otp message", "error", err, "lang", lang)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	msg := messenger.Message{To: req.Phone, Body: body, Channel: messenger.Channel(req.Channel), Code: code}
+
+	// In production this only enqueues into the delivery outbox; a worker talks to the provider
+	receipt, err := h.messenger.Send(r.Context(), msg)
+	if err != nil {
+		h.logger.Error("failed to deliver message", "error", err, "phone", req.Phone, "channel", req.Channel, "retryable", messenger.IsRetryable(err))
 		// We don't necessarily fail the whole request if the SMS provider is slow,
 		// but for OTP, it's usually better to return an error.
 		json.WriteError(w, http.StatusServiceUnavailable, constants.ErrFailedToSendSMS)
 		return
 	}
+	last := lastSend{Channel: req.Channel, MessageID: receipt.MessageID, At: time.Now()}
+	if err := h.cache.Set(ctx, lastSendKey(req.Phone), last.String(), h.policy.TTL).Err(); err != nil {
+		h.logger.Error("redis error", "error", err)
+	}
+	segments := messenger.CountSegments(body)
+	h.logger.Info("otp message accepted", "provider", receipt.Provider, "message_id", receipt.MessageID,
+		"channel", req.Channel, "operator", number.Operator, "lang", lang, "encoding", segments.Encoding, "segments", segments.Count)
 
 	// 7. Success
-	json.Write(w, http.StatusOK, sendOTPResponse{
-		Message: constants.MsgOTPSent,
+	json.Write(w, http.StatusOK, h.otpSentResponse(req.Channel, cooldown, receipt.MessageID))
+}
+
+// passChallenge redeems the solution sent with req. Without a valid one it answers
+// 428 with a fresh challenge and returns false.
+func (h *handler) passChallenge(w http.ResponseWriter, r *http.Request, req sendOTPRequest) bool {
+	code, msg := constants.CodeChallengeRequired, constants.ErrChallengeRequired
+	if req.Challenge != nil {
+		err := h.challenges.Redeem(r.Context(), req.Phone, *req.Challenge, fraud.ClientIP(r))
+		switch {
+		case err == nil:
+			return true
+		case errors.Is(err, challenge.ErrInvalid), errors.Is(err, challenge.ErrExpired), errors.Is(err, challenge.ErrReplayed):
+			h.logger.Warn("otp challenge failed", "phone", req.Phone, "error", err)
+			code, msg = constants.CodeChallengeFailed, constants.ErrChallengeFailed
+		default:
+			h.logger.Error("failed to check otp challenge", "error", err)
+			json.WriteError(w, http.StatusServiceUnavailable, constants.ErrServiceUnavailable)
+			return false
+		}
+	}
+
+	c, err := h.challenges.Issue(req.Phone)
+	if err != nil {
+		h.logger.Error("failed to issue otp challenge", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return false
+	}
+	json.Write(w, http.StatusPreconditionRequired, challengeRequiredResponse{
+		Error:     msg,
+		Code:      code,
+		Challenge: c,
 	})
+	return false
+}
+
+// otpSentResponse builds the send-otp success body, including the fallback channel on offer.
+func (h *handler) otpSentResponse(channel string, cooldown time.Duration, messageID string) sendOTPResponse {
+	resp := sendOTPResponse{
+		Message:    constants.MsgOTPSent,
+		ExpiresIn:  int(h.policy.TTL.Seconds()),
+		RetryAfter: int(cooldown.Seconds()),
+		MessageID:  messageID,
+		Channel:    channel,
+	}
+	if fallback, ok := h.policy.FallbackFor(channel); ok {
+		resp.Fallback = &fallbackOffer{Channel: fallback.To, After: int(fallback.After.Seconds())}
+	}
+	return resp
 }
 
 // VerifyOTP godoc
 // @Summary      Verify OTP and Login
-// @Description  Exchanges a 6-digit OTP for an Access and Refresh token pair.
+// @Description  Exchanges an OTP (6 digits by default, see the OTP policy) for an Access and Refresh token pair. An account deleted by its holder answers 403 ACCOUNT_RESTORABLE until the request repeats the code with restore=true. The first login of an account also returns its backup recovery codes, which are never shown again. When the mobile operator reports the number was swapped to a new SIM or recycled since the account last verified it, the login is held with 403 STEP_UP_REQUIRED until the request repeats the code with one of the account's recovery_code values. With an authenticator app enabled, the answer is a second factor challenge (code SECOND_FACTOR_REQUIRED) holding an mfa_token to finish the login at /auth/totp instead of tokens.
 // @Tags         accounts
 // @Accept       json
 // @Produce      json
@@ -161,60 +351,101 @@ func (h *handler) VerifyOTP(w http.ResponseWriter, r *http.Request) {
 		json.WriteError(w, http.StatusBadRequest, "Validation failed: "+err.Error())
 		return
 	}
-
-	// 2. Retrieve the hashed OTP from Redis
-	otpKey := "otp:" + req.Phone
-	storedHash, err := h.cache.Get(ctx, otpKey).Result()
-	if err != nil {
-		h.logger.Warn("OTP expired or not found", "phone", req.Phone)
-		json.WriteError(w, http.StatusUnauthorized, constants.ErrInvalidOTP)
+	number, ok := h.parsePhone(w, http.StatusBadRequest, req.Phone)
+	if !ok {
+		return
+	}
+	req.Phone = number.E164
+	// 2. Check the code, with the brute-force guard
+	if !h.checkOTP(ctx, w, req.Phone, req.OTP) {
 		return
 	}
 
-	// 3. Verify Hash (OTP + Phone + Server Pepper)
-	// This protects against attackers who might see the OTP in transit or access Redis
-	combined := req.Phone + req.OTP + h.hashPepper
-	inputHash := sha256.Sum256([]byte(combined))
-	if fmt.Sprintf("%x", inputHash) != storedHash {
-		h.logger.Warn("Invalid OTP attempt", "phone", req.Phone)
-		json.WriteError(w, http.StatusUnauthorized, constants.ErrInvalidOTP)
+	// 3. Hold the login when the number changed hands since the account's holder last
+	// proved they own it
+	amr, ok := h.passSIMCheck(w, r, req.Phone, req.RecoveryCode)
+	if !ok {
 		return
 	}
 
-	// 4. Update Database (Atomic Login)
-	// This updates 'token_valid_from' to NOW(), invalidating all previous tokens
+	// 4. Update Database: find or create the account and open a session for this device.
+	// Sessions on the user's other devices are left alone.
 	dbAccount, err := h.service.UpsertByPhone(ctx, req.Phone)
 	if err != nil {
 		h.logger.Error("failed to upsert account", "error", err)
 		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
 		return
 	}
+	if restorable(dbAccount) {
+		if dbAccount, ok = h.restore(w, r, dbAccount, req.Restore); !ok {
+			return
+		}
+	}
+	// The code was right, so the user may learn why they can't get in
+	if err := middlewares.CheckAccountStatus(dbAccount.Status); err != nil {
+		h.clearAttempts(ctx, req.Phone)
+		h.logger.Warn("login refused by account status", "account_id", dbAccount.ID, "status", dbAccount.Status)
+		middlewares.WriteAccountStatusError(w, dbAccount.Status)
+		return
+	}
+
+	// 5. With an authenticator app, the login finishes at /auth/totp
+	if h.challengeSecondFactor(w, r, dbAccount, req.DeviceName, req.ClientType, amr) {
+		return
+	}
 
-	// 5. Generate Token Pair (Access + Refresh)
-	// We pass dbAccount.TokenValidFrom.Time so the JWT 'iat' matches the DB exactly
-	tokenPair, err := h.auth.GenerateTokenPair(dbAccount.ID.String(), dbAccount.TokenValidFrom.Time)
+	// 6. Open a session for this device with the client type's token lifetimes and audience
+	resp, err := h.signIn(r, dbAccount, req.DeviceName, req.ClientType, amr...)
 	if err != nil {
-		h.logger.Error("failed to generate tokens", "error", err)
+		h.logger.Error("failed to sign in", "error", err)
 		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
 		return
 	}
+	// New accounts get their backup codes with their first login, and only then
+	resp.RecoveryCodes = h.enrollRecoveryCodes(ctx, dbAccount.ID)
 
-	// 6. Cleanup Redis
-	h.cache.Del(ctx, otpKey)
+	// 7. Cleanup Redis (OTP and brute-force counters)
+	h.clearAttempts(ctx, req.Phone)
 
-	// 7. Success Response
-	h.logger.Info("user logged in successfully", "account_id", dbAccount.ID)
-	json.Write(w, http.StatusOK, authSuccessResponse{
-		Message:      "OTP verified successfully",
-		AccessToken:  tokenPair.AccessToken,
-		RefreshToken: tokenPair.RefreshToken,
-		Account:      MapAccountRow(dbAccount),
+	// 8. Success Response
+	h.logger.Info("user logged in successfully", "account_id", dbAccount.ID, "session_id", resp.SessionID)
+	resp.Message = "OTP verified successfully"
+	json.Write(w, http.StatusOK, resp)
+}
+
+// parsePhone normalizes a user-supplied phone number, answering with status when it is unusable.
+func (h *handler) parsePhone(w http.ResponseWriter, status int, raw string) (phone.Number, bool) {
+	number, err := phone.Parse(raw)
+	switch {
+	case errors.Is(err, phone.ErrNotMobile):
+		json.WriteErrorCode(w, status, constants.CodeInvalidPhone, constants.ErrNotMobile)
+		return number, false
+	case err != nil:
+		json.WriteErrorCode(w, status, constants.CodeInvalidPhone, constants.ErrInvalidPhone)
+		return number, false
+	}
+	return number, true
+}
+
+// writeOTPLocked tells the client the phone is locked and when it may try again.
+func (h *handler) writeOTPLocked(w http.ResponseWriter, retryAfter time.Duration) {
+	h.writeRetryLater(w, retryAfter, constants.CodeOTPLocked, constants.ErrTooManyOTPAttempts)
+}
+
+// writeRetryLater sends a 429 with a Retry-After header and the same value in the body.
+func (h *handler) writeRetryLater(w http.ResponseWriter, retryAfter time.Duration, code string, msg string) {
+	seconds := int(retryAfter.Seconds())
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	json.Write(w, http.StatusTooManyRequests, retryLaterResponse{
+		Error:      msg,
+		Code:       code,
+		RetryAfter: seconds,
 	})
 }
 
 // RefreshToken godoc
 // @Summary      Refresh Access Token
-// @Description  Rotates the session and provides new tokens. Validates that the refresh token is not older than the last login.
+// @Description  Spends the refresh token and issues a new pair. A refresh token works once: presenting a spent one signs the session out everywhere it is used.
 // @Tags         accounts
 // @Accept       json
 // @Produce      json
@@ -245,48 +476,74 @@ func (h *handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 4. Convert string ID from token back to pgtype.UUID
-	var dbID pgtype.UUID
+	// 4. Convert string IDs from token back to pgtype.UUID
+	var dbID, sessionID pgtype.UUID
 	if err := dbID.Scan(claims.AccountID); err != nil {
-		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrInvalidOrExpiredToken)
+		return
+	}
+	if err := sessionID.Scan(claims.SessionID); err != nil {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrInvalidOrExpiredToken)
 		return
 	}
 
-	// 5. Fetch Account and check if this token is still valid
+	// 5. Only active accounts get new tokens. Checked before the session, which
+	// suspension also revokes, so the client learns the real reason.
 	acc, err := h.service.GetAccountByID(r.Context(), dbID)
 	if err != nil {
 		json.WriteError(w, http.StatusUnauthorized, constants.ErrAccountNotFound)
 		return
 	}
-
-	// Compare JWT IssuedAt with DB ValidFrom (Convert both to Unix for easy comparison)
-	if claims.IssuedAt.Time.Unix() < acc.TokenValidFrom.Time.Unix() {
-		// "Session invalidated by a newer login"
-		json.WriteError(w, http.StatusUnauthorized, constants.ErrInvalidOrExpiredToken)
+	if err := middlewares.CheckAccountStatus(acc.Status); err != nil {
+		middlewares.WriteAccountStatusError(w, acc.Status)
 		return
 	}
 
-	// 6. ROTATE: Update token_valid_from in DB to NOW()
-	// This makes the CURRENT refresh token unusable for the NEXT request
-	newAcc, err := h.service.UpsertByPhone(r.Context(), acc.Phone)
-	if err != nil {
-		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+	// Fetch the session (the token's family) and make sure it is still live
+	session, err := h.service.GetSession(r.Context(), sessionID)
+	if err != nil || session.AccountID != dbID || session.RevokedAt.Valid {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrInvalidOrExpiredToken)
 		return
 	}
 
-	// 7. Generate NEW pair
-	pair, err := h.auth.GenerateTokenPair(newAcc.ID.String(), newAcc.TokenValidFrom.Time)
-	if err != nil {
+	// 6. SPEND, ROTATE and ISSUE together. Each refresh token works once: seeing a
+	// spent one again means two parties hold it (the real client and a thief) and we
+	// can't tell which is which, so the whole family is revoked and both have to log
+	// in again. Rotating moves token_valid_from to NOW(), retiring the access token
+	// issued alongside the spent refresh token. Nothing sticks unless all of it does,
+	// so a client retrying after a failure isn't taken for a thief.
+	var pair *auth.TokenDetails
+	rotated, err := h.service.RefreshSession(r.Context(), sessionID, claims.ID, fraud.ClientIP(r), func(s repo.Session) (string, time.Time, error) {
+		// The new pair is the child of the spent token
+		var err error
+		pair, err = h.auth.GenerateTokenPair(sessionGrant(s))
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		return pair.RefreshTokenID, time.Unix(pair.RtExpires, 0), nil
+	})
+	switch {
+	case errors.Is(err, ErrRefreshTokenReused):
+		h.revokeFamily(r, session, claims.ID)
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrInvalidOrExpiredToken)
+		return
+	case errors.Is(err, ErrRefreshTokenInvalid):
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrInvalidOrExpiredToken)
+		return
+	case err != nil:
+		h.logger.Error("failed to refresh session", "error", err)
 		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
 		return
 	}
 
-	// 8. Success Response
+	// 7. Success Response
 	json.Write(w, http.StatusOK, authSuccessResponse{
 		Message:      "Tokens rotated successfully",
 		AccessToken:  pair.AccessToken,
 		RefreshToken: pair.RefreshToken,
-		Account:      MapAccountRow(newAcc),
+		SessionID:    rotated.ID.String(),
+		ExpiresIn:    pair.AtExpires - time.Now().Unix(),
+		Account:      MapAccountRow(acc),
 	})
 }
 
@@ -299,15 +556,12 @@ func (h *handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 // @Router       /api/v1/accounts/me [get]
 func (h *handler) GetMe(w http.ResponseWriter, r *http.Request) {
 	// 1. Get the ID stored in the context by the middleware
-	userIDStr, ok := r.Context().Value("user_id").(string)
-	if !ok {
-		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+	dbID, ok := r.Context().Value(middlewares.UserIDKey).(pgtype.UUID)
+	if !ok || !dbID.Valid {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrUnauthorizedError)
 		return
 	}
 
-	var dbID pgtype.UUID
-	dbID.Scan(userIDStr)
-
 	// 2. Fetch fresh data from DB
 	acc, err := h.service.GetAccountByID(r.Context(), dbID)
 	if err != nil {
@@ -319,46 +573,81 @@ func (h *handler) GetMe(w http.ResponseWriter, r *http.Request) {
 	json.Write(w, http.StatusOK, MapAccountRow(acc))
 }
 
-// Logout godoc
-// @Summary      Logout User
-// @Description  Invalidates all active sessions for the user by rotating the token_valid_from timestamp.
+// UpdateLanguage godoc
+// @Summary      Set SMS Language
+// @Description  Sets the language OTP and notification SMS are sent in (en, am, om or ti).
 // @Tags         accounts
 // @Security     BearerAuth
-// @Success      200  {object}  map[string]string
-// @Router       /api/v1/accounts/auth/logout [post]
-func (h *handler) Logout(w http.ResponseWriter, r *http.Request) {
-	// 1. Get the ID stored in the context by the middleware
-	userIDStr, ok := r.Context().Value("user_id").(string)
-	if !ok {
-		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+// @Accept       json
+// @Produce      json
+// @Param        request  body      updateLanguageRequest  true  "Language"
+// @Success      200      {object}  AccountDTO
+// @Failure      422      {object}  json.ErrorResponse
+// @Router       /api/v1/accounts/me/language [put]
+func (h *handler) UpdateLanguage(w http.ResponseWriter, r *http.Request) {
+	accID, ok := r.Context().Value(middlewares.UserIDKey).(pgtype.UUID)
+	if !ok || !accID.Valid {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrUnauthorizedError)
 		return
 	}
 
-	// 2. Convert string ID back to pgtype.UUID
-	var dbID pgtype.UUID
-	if err := dbID.Scan(userIDStr); err != nil {
+	var req updateLanguageRequest
+	if err := json.Read(r, &req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, constants.ErrInvalidJSON)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil || !h.templates.Supported(req.Language) {
+		json.WriteError(w, http.StatusUnprocessableEntity, constants.ErrUnsupportedLanguage)
+		return
+	}
+
+	if err := h.service.UpdateLanguage(r.Context(), accID, req.Language); err != nil {
+		h.logger.Error("failed to update language", "error", err)
 		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
 		return
 	}
 
-	// 3. Fetch current account to get the phone number
-	acc, err := h.service.GetAccountByID(r.Context(), dbID)
+	acc, err := h.service.GetAccountByID(r.Context(), accID)
 	if err != nil {
 		json.WriteError(w, http.StatusNotFound, constants.ErrAccountNotFound)
 		return
 	}
+	json.Write(w, http.StatusOK, MapAccountRow(acc))
+}
 
-	// 4. ROTATE: Update token_valid_from to NOW()
-	// This effectively "kills" all existing Access and Refresh tokens
-	_, err = h.service.UpsertByPhone(r.Context(), acc.Phone)
+// preferredLanguage returns the stored language for an existing account, or "" for new numbers.
+func (h *handler) preferredLanguage(ctx context.Context, phone string) string {
+	acc, err := h.service.GetAccountByPhone(ctx, phone)
 	if err != nil {
-		h.logger.Error("failed to rotate session for logout", "error", err)
+		return ""
+	}
+	return acc.PreferredLanguage.String
+}
+
+// Logout godoc
+// @Summary      Logout User
+// @Description  Signs out the session the request was made with. Other devices stay signed in.
+// @Tags         accounts
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]string
+// @Router       /api/v1/accounts/auth/logout [post]
+func (h *handler) Logout(w http.ResponseWriter, r *http.Request) {
+	// 1. Get the IDs stored in the context by the middleware
+	accID, sessionID, ok := currentSession(r)
+	if !ok {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrUnauthorizedError)
+		return
+	}
+
+	// 2. REVOKE: Kills this session's Access and Refresh tokens
+	if _, err := h.service.RevokeSession(r.Context(), accID, sessionID); err != nil {
+		h.logger.Error("failed to revoke session for logout", "error", err)
 		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
 		return
 	}
 
-	// 5. Success
+	// 3. Success
 	json.Write(w, http.StatusOK, map[string]string{
-		"message": "Logged out successfully. All sessions invalidated.",
+		"message": "Logged out successfully.",
 	})
 }
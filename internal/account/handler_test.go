@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -13,16 +14,23 @@ import (
 	"time"
 
 	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	"github.com/yabeye/addis_verify_backend/internal/challenge"
 	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/fraud"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
 	"github.com/yabeye/addis_verify_backend/pkg/auth"
 	"github.com/yabeye/addis_verify_backend/pkg/messenger"
+	"github.com/yabeye/addis_verify_backend/pkg/otp"
+	"github.com/yabeye/addis_verify_backend/pkg/templates"
 )
 
 // --- Mocks ---
@@ -40,16 +48,126 @@ func (m *mockService) GetAccountByPhone(ctx context.Context, p string) (repo.Acc
 func (m *mockService) UpdateAccountStatus(ctx context.Context, id pgtype.UUID, s repo.AccountStatus) error {
 	return m.Called(ctx, id, s).Error(0)
 }
+func (m *mockService) UpdateLanguage(ctx context.Context, id pgtype.UUID, lang string) error {
+	return m.Called(ctx, id, lang).Error(0)
+}
+func (m *mockService) TransitionStatus(ctx context.Context, id pgtype.UUID, from, to repo.AccountStatus) (bool, error) {
+	args := m.Called(ctx, id, from, to)
+	return args.Bool(0), args.Error(1)
+}
+func (m *mockService) DeleteAccount(ctx context.Context, id pgtype.UUID, restoreUntil time.Time) (bool, error) {
+	args := m.Called(ctx, id, restoreUntil)
+	return args.Bool(0), args.Error(1)
+}
+func (m *mockService) RestoreAccount(ctx context.Context, id pgtype.UUID) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
 func (m *mockService) UpsertByPhone(ctx context.Context, p string) (repo.Account, error) {
 	args := m.Called(ctx, p)
 	return args.Get(0).(repo.Account), args.Error(1)
 }
 
+func (m *mockService) CreateSession(ctx context.Context, arg repo.CreateSessionParams) (repo.Session, error) {
+	args := m.Called(ctx, arg)
+	return args.Get(0).(repo.Session), args.Error(1)
+}
+func (m *mockService) GetSession(ctx context.Context, id pgtype.UUID) (repo.Session, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(repo.Session), args.Error(1)
+}
+func (m *mockService) ListSessions(ctx context.Context, accountID pgtype.UUID) ([]repo.Session, error) {
+	args := m.Called(ctx, accountID)
+	return args.Get(0).([]repo.Session), args.Error(1)
+}
+func (m *mockService) RevokeSession(ctx context.Context, accountID, id pgtype.UUID) (bool, error) {
+	args := m.Called(ctx, accountID, id)
+	return args.Bool(0), args.Error(1)
+}
+func (m *mockService) RevokeAllSessions(ctx context.Context, accountID, keep pgtype.UUID) (int64, error) {
+	args := m.Called(ctx, accountID, keep)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockService) SaveRefreshToken(ctx context.Context, sessionID, parentID pgtype.UUID, jti string, expiresAt time.Time) error {
+	return m.Called(ctx, sessionID, parentID, jti, expiresAt).Error(0)
+}
+
+// RefreshSession returns the rotated session set up for it and, like the real one,
+// saves the issued child of jti as its last step.
+func (m *mockService) RefreshSession(ctx context.Context, sessionID pgtype.UUID, jti, ip string, issue func(repo.Session) (string, time.Time, error)) (repo.Session, error) {
+	args := m.Called(ctx, sessionID, jti, ip)
+	rotated, err := args.Get(0).(repo.Session), args.Error(1)
+	if err != nil {
+		return repo.Session{}, err
+	}
+	childJTI, expiresAt, err := issue(rotated)
+	if err != nil {
+		return repo.Session{}, err
+	}
+	var parentID pgtype.UUID
+	parentID.Scan(jti)
+	if err := m.SaveRefreshToken(ctx, sessionID, parentID, childJTI, expiresAt); err != nil {
+		return repo.Session{}, err
+	}
+	return rotated, nil
+}
+func (m *mockService) RecordSecurityEvent(ctx context.Context, arg repo.CreateSecurityEventParams) error {
+	return m.Called(ctx, arg).Error(0)
+}
+func (m *mockService) EnrollRecoveryCodes(ctx context.Context, accountID pgtype.UUID, hashes []string) (bool, error) {
+	args := m.Called(ctx, accountID, hashes)
+	return args.Bool(0), args.Error(1)
+}
+func (m *mockService) ReplaceRecoveryCodes(ctx context.Context, accountID pgtype.UUID, hashes []string) error {
+	return m.Called(ctx, accountID, hashes).Error(0)
+}
+func (m *mockService) CountRecoveryCodes(ctx context.Context, accountID pgtype.UUID) (int64, error) {
+	args := m.Called(ctx, accountID)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *mockService) ChangePhone(ctx context.Context, id pgtype.UUID, oldPhone, newPhone string) (bool, error) {
+	args := m.Called(ctx, id, oldPhone, newPhone)
+	return args.Bool(0), args.Error(1)
+}
+func (m *mockService) RecoverAccount(ctx context.Context, id pgtype.UUID, codeHash, newPhone string) (bool, error) {
+	args := m.Called(ctx, id, codeHash, newPhone)
+	return args.Bool(0), args.Error(1)
+}
+func (m *mockService) ConfirmPhoneOwner(ctx context.Context, id pgtype.UUID, codeHash string) (bool, error) {
+	args := m.Called(ctx, id, codeHash)
+	return args.Bool(0), args.Error(1)
+}
+func (m *mockService) UseRecoveryCode(ctx context.Context, accountID pgtype.UUID, codeHash string) (bool, error) {
+	args := m.Called(ctx, accountID, codeHash)
+	return args.Bool(0), args.Error(1)
+}
+func (m *mockService) GetTOTP(ctx context.Context, accountID pgtype.UUID) (repo.AccountTotp, error) {
+	args := m.Called(ctx, accountID)
+	return args.Get(0).(repo.AccountTotp), args.Error(1)
+}
+func (m *mockService) EnrollTOTP(ctx context.Context, accountID pgtype.UUID, sealed []byte) (bool, error) {
+	args := m.Called(ctx, accountID, sealed)
+	return args.Bool(0), args.Error(1)
+}
+func (m *mockService) ConfirmTOTP(ctx context.Context, accountID pgtype.UUID, step int64) (bool, error) {
+	args := m.Called(ctx, accountID, step)
+	return args.Bool(0), args.Error(1)
+}
+func (m *mockService) UseTOTPStep(ctx context.Context, accountID pgtype.UUID, step int64) (bool, error) {
+	args := m.Called(ctx, accountID, step)
+	return args.Bool(0), args.Error(1)
+}
+func (m *mockService) DisableTOTP(ctx context.Context, accountID pgtype.UUID) (bool, error) {
+	args := m.Called(ctx, accountID)
+	return args.Bool(0), args.Error(1)
+}
+
 type mockAuth struct{ mock.Mock }
 
 // Updated to use auth.TokenDetails to match your manager.go
-func (m *mockAuth) GenerateTokenPair(id string, iat time.Time) (*auth.TokenDetails, error) {
-	args := m.Called(id, iat)
+func (m *mockAuth) GenerateTokenPair(g auth.Grant) (*auth.TokenDetails, error) {
+	args := m.Called(g)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -64,10 +182,28 @@ func (m *mockAuth) VerifyToken(token string) (*auth.Claims, error) {
 	return args.Get(0).(*auth.Claims), args.Error(1)
 }
 
+func (m *mockAuth) Sign(claims jwt.Claims) (string, error) {
+	args := m.Called(claims)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockAuth) JWKS() auth.JWKS {
+	return auth.JWKS{}
+}
+
 type mockMessenger struct{ mock.Mock }
 
-func (m *mockMessenger) Send(ctx context.Context, msg messenger.Message) error {
-	return m.Called(ctx, msg).Error(0)
+func (m *mockMessenger) Send(ctx context.Context, msg messenger.Message) (messenger.Receipt, error) {
+	args := m.Called(ctx, msg)
+	return args.Get(0).(messenger.Receipt), args.Error(1)
+}
+
+// mockOutbox is a messenger that also records suppressed sends, like the delivery outbox.
+type mockOutbox struct{ mockMessenger }
+
+func (m *mockOutbox) Suppress(ctx context.Context, msg messenger.Message, reason string) (messenger.Receipt, error) {
+	args := m.Called(ctx, msg, reason)
+	return args.Get(0).(messenger.Receipt), args.Error(1)
 }
 
 // --- Test Suite ---
@@ -89,12 +225,14 @@ func TestHandler_VerifyOTP(t *testing.T) {
 		validate:   validator.New(),
 		auth:       authMgr,
 		hashPepper: pepper,
+		policy:     otp.DefaultPolicy(),
 	}
 
 	t.Run("Successful Verification", func(t *testing.T) {
 		phone := "+251911223344"
 		otp := "123456"
 		mockID := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+		sessionID := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
 		now := time.Now()
 
 		// 1. Seed Redis with peppered hash
@@ -104,25 +242,534 @@ func TestHandler_VerifyOTP(t *testing.T) {
 
 		// 2. Expectations
 		svc.On("UpsertByPhone", mock.Anything, phone).Return(repo.Account{
-			ID:             mockID,
-			Phone:          phone,
+			ID:     mockID,
+			Phone:  phone,
+			Status: repo.AccountStatusActive,
+		}, nil)
+
+		// The session records the device the login came from and how
+		svc.On("CreateSession", mock.Anything, repo.CreateSessionParams{
+			AccountID:  mockID,
+			DeviceName: pgtype.Text{String: "Pixel 7", Valid: true},
+			UserAgent:  pgtype.Text{String: "AddisVerify/2.3", Valid: true},
+			IpAddress:  pgtype.Text{String: "192.0.2.1", Valid: true},
+			ClientType: auth.ClientWeb,
+			Amr:        []string{auth.AMROTP},
+		}).Return(repo.Session{
+			ID:             sessionID,
+			AccountID:      mockID,
 			TokenValidFrom: pgtype.Timestamptz{Time: now, Valid: true},
+			CreatedAt:      pgtype.Timestamptz{Time: now, Valid: true},
+			ClientType:     auth.ClientWeb,
+			Amr:            []string{auth.AMROTP},
 		}, nil)
 
-		authMgr.On("GenerateTokenPair", mockID.String(), mock.Anything).Return(&auth.TokenDetails{
-			AccessToken:  "fake-access",
-			RefreshToken: "fake-refresh",
+		// Tokens get the web client's policy; iat matches token_valid_from exactly
+		authMgr.On("GenerateTokenPair", auth.Grant{
+			AccountID: mockID.String(),
+			SessionID: sessionID.String(),
+			Client:    auth.ClientWeb,
+			AuthTime:  now,
+			AMR:       []string{auth.AMROTP},
+			IssuedAt:  now,
+		}).Return(&auth.TokenDetails{
+			AccessToken:    "fake-access",
+			RefreshToken:   "fake-refresh",
+			RefreshTokenID: "7c9e6679-7425-40de-944b-e07fc1f90ae7",
+			AtExpires:      now.Add(15 * time.Minute).Unix(),
 		}, nil)
+		// The first refresh token of a login has no parent
+		svc.On("SaveRefreshToken", mock.Anything, sessionID, pgtype.UUID{}, "7c9e6679-7425-40de-944b-e07fc1f90ae7", mock.Anything).Return(nil)
+		// Without an authenticator app the phone OTP is enough
+		svc.On("GetTOTP", mock.Anything, mockID).Return(repo.AccountTotp{}, pgx.ErrNoRows)
+		// A first login enrolls backup codes; only their hashes reach the database
+		var stored []string
+		svc.On("EnrollRecoveryCodes", mock.Anything, mockID, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(2).([]string)
+		}).Return(true, nil)
 
-		body, _ := json.Marshal(map[string]string{"phone": phone, "otp": otp})
+		body, _ := json.Marshal(map[string]string{"phone": phone, "otp": otp, "device_name": "Pixel 7", "client_type": "web"})
 		req := httptest.NewRequest(http.MethodPost, "/verify", bytes.NewBuffer(body))
+		req.Header.Set("User-Agent", "AddisVerify/2.3")
 		w := httptest.NewRecorder()
 
 		h.VerifyOTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), sessionID.String())
+		var resp authSuccessResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.InDelta(t, 900, resp.ExpiresIn, 2)
 		assert.False(t, mr.Exists("otp:"+phone)) // Redis clean
+		assert.Len(t, resp.RecoveryCodes, recoveryCodeCount)
+		assert.Equal(t, h.hashRecoveryCode(mockID, resp.RecoveryCodes[0]), stored[0])
+		assert.NotContains(t, stored, resp.RecoveryCodes[0])
+	})
+}
+
+func TestHandler_PhoneNormalization(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+
+	var sent []messenger.Message
+	msgr := new(mockMessenger)
+	msgr.On("Send", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		sent = append(sent, args.Get(1).(messenger.Message))
+	}).Return(messenger.Receipt{Provider: "mock"}, nil)
+
+	svc := new(mockService)
+	svc.On("GetAccountByPhone", mock.Anything, mock.Anything).Return(repo.Account{}, pgx.ErrNoRows)
+	svc.On("UpsertByPhone", mock.Anything, "+251911223344").Return(repo.Account{
+		ID:     pgtype.UUID{Bytes: [16]byte{1}, Valid: true},
+		Status: repo.AccountStatusActive,
+	}, nil)
+	svc.On("CreateSession", mock.Anything, mock.Anything).Return(repo.Session{}, nil)
+	svc.On("SaveRefreshToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	svc.On("EnrollRecoveryCodes", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	svc.On("GetTOTP", mock.Anything, mock.Anything).Return(repo.AccountTotp{}, pgx.ErrNoRows)
+	authMgr := new(mockAuth)
+	authMgr.On("GenerateTokenPair", mock.Anything).Return(&auth.TokenDetails{}, nil)
+
+	h := &handler{
+		service:    svc,
+		logger:     logger,
+		cache:      rdb,
+		validate:   validator.New(),
+		genOTP:     func() (string, error) { return "123456", nil },
+		messenger:  msgr,
+		templates:  mustTemplates(t),
+		auth:       authMgr,
+		hashPepper: "test-pepper",
+		policy:     otp.DefaultPolicy(),
+	}
+
+	post := func(handle http.HandlerFunc, payload map[string]string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		w := httptest.NewRecorder()
+		handle(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(body)))
+		return w
+	}
+
+	// Local format goes in, E.164 comes out everywhere
+	w := post(h.SendOTP, map[string]string{"phone": "091 122 3344"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "+251911223344", sent[0].To)
+	assert.True(t, mr.Exists("otp:+251911223344"))
+	assert.True(t, mr.Exists("lock:otp:+251911223344"))
+
+	// Same phone in another spelling shares the cooldown
+	w = post(h.SendOTP, map[string]string{"phone": "251911223344"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	w = post(h.VerifyOTP, map[string]string{"phone": "0911-22-33-44", "otp": "123456"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Landlines can't receive codes
+	w = post(h.SendOTP, map[string]string{"phone": "0111234567"})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "INVALID_PHONE")
+}
+
+type stubGuard struct{ verdict fraud.Verdict }
+
+func (g stubGuard) Screen(r *http.Request, phone string) (fraud.Verdict, error) {
+	return g.verdict, nil
+}
+
+func TestHandler_SendOTP_FraudBlocked(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	// The refused send gets a real outbox ID, so looking it up answers like any other
+	msgr := new(mockOutbox)
+	msgr.On("Suppress", mock.Anything, messenger.Message{To: "+251911223344", Channel: messenger.ChannelSMS}, fraud.ReasonIPBudget).
+		Return(messenger.Receipt{Provider: "outbox", MessageID: "0b9f6c1e-5d0e-4c39-9b7e-2f4a8c1d3e55"}, nil)
+	h := &handler{
+		logger:     slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil)),
+		cache:      rdb,
+		validate:   validator.New(),
+		genOTP:     func() (string, error) { return "123456", nil },
+		messenger:  msgr,
+		fraud:      stubGuard{fraud.Verdict{Reason: fraud.ReasonIPBudget}},
+		templates:  mustTemplates(t),
+		hashPepper: "test-pepper",
+		policy:     otp.DefaultPolicy(),
+	}
+
+	body, _ := json.Marshal(map[string]string{"phone": "+251911223344"})
+	w := httptest.NewRecorder()
+	h.SendOTP(w, httptest.NewRequest(http.MethodPost, "/send-otp", bytes.NewBuffer(body)))
+
+	// Looks exactly like a real send...
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp sendOTPResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, 60, resp.RetryAfter)
+	assert.Equal(t, "0b9f6c1e-5d0e-4c39-9b7e-2f4a8c1d3e55", resp.MessageID)
+	assert.True(t, mr.Exists("lock:otp:+251911223344"))
+	msgr.AssertExpectations(t)
+
+	// ...but nothing was sent and no code can be verified
+	msgr.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+	assert.False(t, mr.Exists("otp:+251911223344"))
+}
+
+func TestHandler_SendOTP_Challenge(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	issuer, err := challenge.NewIssuer(rdb, challenge.Config{
+		Secret:     []byte("0123456789abcdef0123456789abcdef"),
+		Kind:       challenge.KindPoW,
+		Difficulty: 4,
+	}, nil)
+	assert.NoError(t, err)
+
+	msgr := new(mockMessenger)
+	msgr.On("Send", mock.Anything, mock.Anything).Return(messenger.Receipt{Provider: "mock"}, nil)
+	svc := new(mockService)
+	svc.On("GetAccountByPhone", mock.Anything, mock.Anything).Return(repo.Account{}, pgx.ErrNoRows)
+
+	h := &handler{
+		service:    svc,
+		logger:     slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil)),
+		cache:      rdb,
+		validate:   validator.New(),
+		genOTP:     func() (string, error) { return "123456", nil },
+		messenger:  msgr,
+		fraud:      stubGuard{fraud.Verdict{Allowed: true, Challenge: true}},
+		challenges: issuer,
+		templates:  mustTemplates(t),
+		hashPepper: "test-pepper",
+		policy:     otp.DefaultPolicy(),
+	}
+
+	send := func(sol *challenge.Solution) (*httptest.ResponseRecorder, challengeRequiredResponse) {
+		body, _ := json.Marshal(sendOTPRequest{Phone: "+251911223344", Challenge: sol})
+		w := httptest.NewRecorder()
+		h.SendOTP(w, httptest.NewRequest(http.MethodPost, "/send-otp", bytes.NewBuffer(body)))
+		var resp challengeRequiredResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	w, resp := send(nil)
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	assert.Equal(t, "CHALLENGE_REQUIRED", resp.Code)
+	assert.Equal(t, challenge.KindPoW, resp.Challenge.Type)
+	msgr.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+	assert.False(t, mr.Exists("lock:otp:+251911223344"), "challenges don't start the cooldown")
+
+	// A forged answer gets a fresh challenge
+	w, retry := send(&challenge.Solution{Token: resp.Challenge.Token + "x", Nonce: "1"})
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	assert.Equal(t, "CHALLENGE_FAILED", retry.Code)
+	assert.NotEqual(t, resp.Challenge.Token, retry.Challenge.Token)
+
+	nonce := challenge.Solve(resp.Challenge.Token, resp.Challenge.Difficulty)
+	w, _ = send(&challenge.Solution{Token: resp.Challenge.Token, Nonce: nonce})
+	assert.Equal(t, http.StatusOK, w.Code)
+	msgr.AssertNumberOfCalls(t, "Send", 1)
+}
+
+func TestHandler_SendOTP_Cooldown(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	msgr := new(mockMessenger)
+	msgr.On("Send", mock.Anything, mock.Anything).Return(messenger.Receipt{Provider: "mock"}, nil)
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+
+	svc := new(mockService)
+	svc.On("GetAccountByPhone", mock.Anything, mock.Anything).Return(repo.Account{}, pgx.ErrNoRows)
+
+	policy := otp.DefaultPolicy()
+	policy.DailyCap = 3
+	h := &handler{
+		service:    svc,
+		logger:     logger,
+		cache:      rdb,
+		validate:   validator.New(),
+		genOTP:     func() (string, error) { return "123456", nil },
+		messenger:  msgr,
+		templates:  mustTemplates(t),
+		hashPepper: "test-pepper",
+		policy:     policy,
+	}
+
+	phone := "+251911223344"
+	send := func() *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"phone": phone})
+		req := httptest.NewRequest(http.MethodPost, "/send-otp", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		h.SendOTP(w, req)
+		return w
+	}
+
+	t.Run("Cooldown escalates after each send", func(t *testing.T) {
+		for _, want := range []int{60, 120} {
+			w := send()
+			assert.Equal(t, http.StatusOK, w.Code)
+			var resp sendOTPResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			assert.Equal(t, want, resp.RetryAfter)
+			assert.Equal(t, 300, resp.ExpiresIn)
+
+			// Resending inside the cooldown is refused
+			w = send()
+			assert.Equal(t, http.StatusTooManyRequests, w.Code)
+			assert.Contains(t, w.Body.String(), "OTP_COOLDOWN")
+
+			mr.Del("lock:otp:" + phone)
+		}
 	})
+
+	t.Run("Daily cap locks until the window resets", func(t *testing.T) {
+		w := send()
+		assert.Equal(t, http.StatusOK, w.Code)
+		mr.Del("lock:otp:" + phone)
+
+		w = send()
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), "OTP_DAILY_CAP")
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	})
+}
+
+func mustTemplates(t *testing.T) *templates.Set {
+	t.Helper()
+	set, err := templates.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func TestHandler_SendOTP_Language(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+
+	var sent []messenger.Message
+	msgr := new(mockMessenger)
+	msgr.On("Send", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		sent = append(sent, args.Get(1).(messenger.Message))
+	}).Return(messenger.Receipt{Provider: "outbox", MessageID: "msg-1"}, nil)
+
+	svc := new(mockService)
+	svc.On("GetAccountByPhone", mock.Anything, "+251911000001").Return(repo.Account{
+		PreferredLanguage: pgtype.Text{String: "ti", Valid: true},
+	}, nil)
+	svc.On("GetAccountByPhone", mock.Anything, mock.Anything).Return(repo.Account{}, pgx.ErrNoRows)
+
+	h := &handler{
+		service:    svc,
+		logger:     logger,
+		cache:      rdb,
+		validate:   validator.New(),
+		genOTP:     func() (string, error) { return "123456", nil },
+		messenger:  msgr,
+		templates:  mustTemplates(t),
+		hashPepper: "test-pepper",
+		policy:     otp.DefaultPolicy(),
+	}
+
+	send := func(phone, acceptLanguage string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"phone": phone})
+		req := httptest.NewRequest(http.MethodPost, "/send-otp", bytes.NewBuffer(body))
+		req.Header.Set("Accept-Language", acceptLanguage)
+		w := httptest.NewRecorder()
+		h.SendOTP(w, req)
+		return w
+	}
+
+	// Account preference beats the header
+	w := send("+251911000001", "am")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, sent[0].Body, "ኮድኩም")
+
+	// New number: Accept-Language decides
+	w = send("+251911000002", "am-ET,en;q=0.8")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, sent[1].Body, "ኮድዎ")
+
+	var resp sendOTPResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "msg-1", resp.MessageID)
+
+	// Nothing usable: English
+	send("+251911000003", "")
+	assert.Contains(t, sent[2].Body, "Your Addis Verify code is: 123456")
+}
+
+// trackingMessenger also reports delivery, like the outbox does.
+type trackingMessenger struct {
+	mockMessenger
+	delivered bool
+}
+
+func (m *trackingMessenger) Delivered(ctx context.Context, id string) (bool, error) {
+	return m.delivered, nil
+}
+
+func TestHandler_SendOTP_ChannelFallback(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+
+	var sent []messenger.Message
+	msgr := new(trackingMessenger)
+	msgr.On("Send", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		sent = append(sent, args.Get(1).(messenger.Message))
+	}).Return(messenger.Receipt{Provider: "outbox", MessageID: "msg-1"}, nil)
+
+	svc := new(mockService)
+	svc.On("GetAccountByPhone", mock.Anything, mock.Anything).Return(repo.Account{}, pgx.ErrNoRows)
+
+	policy := otp.DefaultPolicy()
+	policy.Channels = []string{"sms", "voice"}
+	policy.Fallbacks = []otp.Fallback{{From: "sms", To: "voice", After: 30 * time.Second}}
+	h := &handler{
+		service:    svc,
+		logger:     logger,
+		cache:      rdb,
+		validate:   validator.New(),
+		genOTP:     func() (string, error) { return "123456", nil },
+		messenger:  msgr,
+		templates:  mustTemplates(t),
+		hashPepper: "test-pepper",
+		policy:     policy,
+	}
+
+	phone := "+251911223344"
+	send := func(channel string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"phone": phone, "channel": channel})
+		req := httptest.NewRequest(http.MethodPost, "/send-otp", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		h.SendOTP(w, req)
+		return w
+	}
+	backdate := func(d time.Duration) {
+		mr.Set(lastSendKey(phone), lastSend{Channel: "sms", MessageID: "msg-1", At: time.Now().Add(-d)}.String())
+	}
+
+	w := send("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp sendOTPResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, "sms", resp.Channel)
+	assert.Equal(t, &fallbackOffer{Channel: "voice", After: 30}, resp.Fallback)
+
+	// Too early for the fallback: the regular cooldown applies
+	w = send("voice")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// Delivered codes don't need a fallback
+	backdate(31 * time.Second)
+	msgr.delivered = true
+	w = send("voice")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// Undelivered after 30s: voice is allowed inside the cooldown, but only voice
+	msgr.delivered = false
+	w = send("whatsapp")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, "whatsapp is not enabled")
+	w = send("voice")
+	assert.Equal(t, http.StatusOK, w.Code)
+	last := sent[len(sent)-1]
+	assert.Equal(t, messenger.ChannelVoice, last.Channel)
+	assert.Equal(t, "123456", last.Code)
+	assert.Contains(t, last.Body, "1, 2, 3, 4, 5, 6")
+
+	// No fallback from voice, so the cooldown is back
+	w = send("sms")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+func TestHandler_VerifyOTP_BruteForce(t *testing.T) {
+	mr, _ := miniredis.Run()
+	defer mr.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	svc := new(mockService)
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+	pepper := "test-pepper"
+
+	h := &handler{
+		service:    svc,
+		logger:     logger,
+		cache:      rdb,
+		validate:   validator.New(),
+		auth:       new(mockAuth),
+		hashPepper: pepper,
+		policy:     otp.DefaultPolicy(),
+	}
+
+	phone := "+251911223344"
+	verify := func(otp string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"phone": phone, "otp": otp})
+		req := httptest.NewRequest(http.MethodPost, "/verify", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		h.VerifyOTP(w, req)
+		return w
+	}
+
+	t.Run("Locks phone and burns code after max attempts", func(t *testing.T) {
+		hash := sha256.Sum256([]byte(phone + "123456" + pepper))
+		mr.Set("otp:"+phone, fmt.Sprintf("%x", hash))
+
+		for i := 1; i < maxVerifyAttempts; i++ {
+			w := verify("000000")
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Contains(t, w.Body.String(), "INVALID_OTP")
+		}
+
+		w := verify("000000")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), "OTP_LOCKED")
+		assert.Equal(t, "300", w.Header().Get("Retry-After"))
+		assert.False(t, mr.Exists("otp:"+phone)) // code burned
+
+		// Even the correct code is refused while locked
+		mr.Set("otp:"+phone, fmt.Sprintf("%x", hash))
+		w = verify("123456")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		svc.AssertNotCalled(t, "UpsertByPhone", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Cooldown escalates on repeated lockouts", func(t *testing.T) {
+		mr.Del("lock:verify:" + phone)
+		for i := 0; i < maxVerifyAttempts; i++ {
+			verify("000000")
+		}
+		assert.Equal(t, 10*time.Minute, mr.TTL("lock:verify:"+phone))
+	})
+
+	t.Run("Guesses racing past the last attempt are not compared", func(t *testing.T) {
+		mr.Del("lock:verify:" + phone)
+		mr.Set("otp:"+phone, fmt.Sprintf("%x", sha256.Sum256([]byte(phone+"123456"+pepper))))
+		// Every attempt is already taken by requests still in flight
+		mr.Set("otp:attempts:"+phone, fmt.Sprint(maxVerifyAttempts))
+
+		w := verify("123456")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), "OTP_LOCKED")
+		svc.AssertNotCalled(t, "UpsertByPhone", mock.Anything, mock.Anything)
+	})
+}
+
+func TestLockoutDuration(t *testing.T) {
+	assert.Equal(t, 5*time.Minute, lockoutDuration(1))
+	assert.Equal(t, 10*time.Minute, lockoutDuration(2))
+	assert.Equal(t, 40*time.Minute, lockoutDuration(4))
+	assert.Equal(t, maxVerifyLockout, lockoutDuration(20))
 }
 
 func TestHandler_RefreshToken_Security(t *testing.T) {
@@ -134,6 +781,7 @@ func TestHandler_RefreshToken_Security(t *testing.T) {
 		auth:     authMgr,
 		logger:   logger,
 		validate: validator.New(),
+		policy:   otp.DefaultPolicy(),
 	}
 
 	t.Run("Failure: Reject Access Token on Refresh Endpoint", func(t *testing.T) {
@@ -163,76 +811,241 @@ func TestHandler_RefreshToken_Security(t *testing.T) {
 
 		// Verify that we didn't touch the database or generate new tokens
 		svc.AssertNotCalled(t, "GetAccountByID", mock.Anything, mock.Anything)
-		authMgr.AssertNotCalled(t, "GenerateTokenPair", mock.Anything, mock.Anything)
+		authMgr.AssertNotCalled(t, "GenerateTokenPair", mock.Anything)
 	})
 }
 
 func TestHandler_RefreshToken(t *testing.T) {
-	svc := new(mockService)
-	authMgr := new(mockAuth)
-	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
-	h := &handler{service: svc, auth: authMgr, logger: logger, validate: validator.New()}
+	mockID := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	sessionID := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+	const jti = "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+	var parentID pgtype.UUID
+	parentID.Scan(jti)
+	now := time.Now()
 
-	t.Run("Successful Rotation", func(t *testing.T) {
-		token := "old-refresh-token"
-		mockID := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
-		now := time.Now()
-
-		// FIX: Use jwt.NumericDate and initialize the embedded RegisteredClaims properly
-		authMgr.On("VerifyToken", token).Return(&auth.Claims{
+	refresh := func(h *handler, token string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"refresh_token": token})
+		req := httptest.NewRequest(http.MethodPost, "/refresh", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		h.RefreshToken(w, req)
+		return w
+	}
+	newHandler := func(svc *mockService, authMgr *mockAuth) *handler {
+		logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+		return &handler{service: svc, auth: authMgr, logger: logger, validate: validator.New()}
+	}
+	refreshClaims := func(issuedAt time.Time) *auth.Claims {
+		return &auth.Claims{
 			AccountID: mockID.String(),
 			Type:      "refresh",
-			// Initialize the embedded struct fields directly
+			SessionID: sessionID.String(),
 			RegisteredClaims: jwt.RegisteredClaims{
-				IssuedAt: jwt.NewNumericDate(now.Add(-time.Minute)),
+				ID:       jti,
+				IssuedAt: jwt.NewNumericDate(issuedAt),
 			},
-		}, nil)
+		}
+	}
+	login := now.Add(-48 * time.Hour)
+	liveSession := repo.Session{
+		ID:             sessionID,
+		AccountID:      mockID,
+		TokenValidFrom: pgtype.Timestamptz{Time: now.Add(-5 * time.Minute), Valid: true},
+		CreatedAt:      pgtype.Timestamptz{Time: login, Valid: true},
+		ClientType:     auth.ClientMobile,
+		Amr:            []string{auth.AMROTP},
+	}
+	activeAccount := repo.Account{ID: mockID, Phone: "+251911223344", Status: repo.AccountStatusActive}
 
-		// ... rest of the test code ...
-		svc.On("GetAccountByID", mock.Anything, mockID).Return(repo.Account{
-			Phone:          "+251911223344",
-			TokenValidFrom: pgtype.Timestamptz{Time: now.Add(-5 * time.Minute), Valid: true},
+	t.Run("Successful Rotation", func(t *testing.T) {
+		svc, authMgr := new(mockService), new(mockAuth)
+		authMgr.On("VerifyToken", "old-refresh-token").Return(refreshClaims(now.Add(-5*time.Minute)), nil)
+		svc.On("GetAccountByID", mock.Anything, mockID).Return(activeAccount, nil)
+		svc.On("GetSession", mock.Anything, sessionID).Return(liveSession, nil)
+		rotated := liveSession
+		rotated.TokenValidFrom = pgtype.Timestamptz{Time: now, Valid: true}
+		svc.On("RefreshSession", mock.Anything, sessionID, jti, "192.0.2.1").Return(rotated, nil)
+		// The client and login time carry over from the session, not the old token
+		authMgr.On("GenerateTokenPair", auth.Grant{
+			AccountID: mockID.String(),
+			SessionID: sessionID.String(),
+			Client:    auth.ClientMobile,
+			AuthTime:  login,
+			AMR:       []string{auth.AMROTP},
+			IssuedAt:  now,
+		}).Return(&auth.TokenDetails{
+			AccessToken: "new-access", RefreshToken: "new-refresh", RefreshTokenID: "child-jti",
 		}, nil)
+		// The new token joins the family as the child of the spent one
+		svc.On("SaveRefreshToken", mock.Anything, sessionID, parentID, "child-jti", mock.Anything).Return(nil)
 
-		svc.On("UpsertByPhone", mock.Anything, "+251911223344").Return(repo.Account{
-			ID:             mockID,
-			TokenValidFrom: pgtype.Timestamptz{Time: now, Valid: true},
-		}, nil)
+		w := refresh(newHandler(svc, authMgr), "old-refresh-token")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "new-refresh")
+		svc.AssertExpectations(t)
+	})
 
-		authMgr.On("GenerateTokenPair", mockID.String(), mock.Anything).Return(&auth.TokenDetails{
-			AccessToken: "new-access", RefreshToken: "new-refresh",
-		}, nil)
+	t.Run("Replayed token revokes the family", func(t *testing.T) {
+		svc, authMgr := new(mockService), new(mockAuth)
+		authMgr.On("VerifyToken", "spent").Return(refreshClaims(now.Add(-10*time.Minute)), nil)
+		svc.On("GetAccountByID", mock.Anything, mockID).Return(activeAccount, nil)
+		svc.On("GetSession", mock.Anything, sessionID).Return(liveSession, nil)
+		svc.On("RefreshSession", mock.Anything, sessionID, jti, "192.0.2.1").Return(repo.Session{}, ErrRefreshTokenReused)
+		svc.On("RevokeSession", mock.Anything, mockID, sessionID).Return(true, nil)
+		svc.On("RecordSecurityEvent", mock.Anything, mock.MatchedBy(func(e repo.CreateSecurityEventParams) bool {
+			return e.EventType == EventRefreshTokenReuse && e.AccountID == mockID && e.SessionID == sessionID
+		})).Return(nil)
 
-		body, _ := json.Marshal(map[string]string{"refresh_token": token})
-		req := httptest.NewRequest(http.MethodPost, "/refresh", bytes.NewBuffer(body))
-		w := httptest.NewRecorder()
+		w := refresh(newHandler(svc, authMgr), "spent")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		svc.AssertExpectations(t)
+		authMgr.AssertNotCalled(t, "GenerateTokenPair", mock.Anything)
+	})
 
-		h.RefreshToken(w, req)
+	t.Run("Rejects an unknown token without revoking", func(t *testing.T) {
+		svc, authMgr := new(mockService), new(mockAuth)
+		authMgr.On("VerifyToken", "unknown").Return(refreshClaims(now), nil)
+		svc.On("GetAccountByID", mock.Anything, mockID).Return(activeAccount, nil)
+		svc.On("GetSession", mock.Anything, sessionID).Return(liveSession, nil)
+		svc.On("RefreshSession", mock.Anything, sessionID, jti, "192.0.2.1").Return(repo.Session{}, ErrRefreshTokenInvalid)
+
+		w := refresh(newHandler(svc, authMgr), "unknown")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		svc.AssertNotCalled(t, "RevokeSession", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Rejects a revoked session", func(t *testing.T) {
+		svc, authMgr := new(mockService), new(mockAuth)
+		authMgr.On("VerifyToken", "revoked").Return(refreshClaims(now), nil)
+		svc.On("GetAccountByID", mock.Anything, mockID).Return(activeAccount, nil)
+		revoked := liveSession
+		revoked.RevokedAt = pgtype.Timestamptz{Time: now, Valid: true}
+		svc.On("GetSession", mock.Anything, sessionID).Return(revoked, nil)
+
+		w := refresh(newHandler(svc, authMgr), "revoked")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		svc.AssertNotCalled(t, "RefreshSession", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("A failed save is not taken for reuse on retry", func(t *testing.T) {
+		svc, authMgr := new(mockService), new(mockAuth)
+		authMgr.On("VerifyToken", "old-refresh-token").Return(refreshClaims(now.Add(-5*time.Minute)), nil)
+		svc.On("GetAccountByID", mock.Anything, mockID).Return(activeAccount, nil)
+		svc.On("GetSession", mock.Anything, sessionID).Return(liveSession, nil)
+		authMgr.On("GenerateTokenPair", mock.Anything).Return(&auth.TokenDetails{RefreshTokenID: "child-jti"}, nil)
+		// The save fails and the spend rolls back with it; the retry spends the same token
+		svc.On("RefreshSession", mock.Anything, sessionID, jti, "192.0.2.1").Return(liveSession, nil)
+		svc.On("SaveRefreshToken", mock.Anything, sessionID, parentID, "child-jti", mock.Anything).Return(errors.New("connection reset")).Once()
+		svc.On("SaveRefreshToken", mock.Anything, sessionID, parentID, "child-jti", mock.Anything).Return(nil).Once()
+		h := newHandler(svc, authMgr)
+
+		w := refresh(h, "old-refresh-token")
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		w = refresh(h, "old-refresh-token")
 		assert.Equal(t, http.StatusOK, w.Code)
+		svc.AssertNotCalled(t, "RevokeSession", mock.Anything, mock.Anything, mock.Anything)
 	})
 }
 
+// withSession injects what AuthMiddleware puts in the request context.
+func withSession(req *http.Request, accountID, sessionID pgtype.UUID) *http.Request {
+	ctx := context.WithValue(req.Context(), middlewares.UserIDKey, accountID)
+	ctx = context.WithValue(ctx, middlewares.SessionIDKey, sessionID)
+	return req.WithContext(ctx)
+}
+
 func TestHandler_Logout(t *testing.T) {
 	svc := new(mockService)
 	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
 	h := &handler{service: svc, logger: logger}
 
 	t.Run("Logout Success", func(t *testing.T) {
-		mockIDStr := "550e8400-e29b-41d4-a716-446655440000"
 		var mockID pgtype.UUID
-		mockID.Scan(mockIDStr)
+		mockID.Scan("550e8400-e29b-41d4-a716-446655440000")
+		sessionID := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
 
 		// Inject Context
-		req := httptest.NewRequest(http.MethodPost, "/logout", nil)
-		ctx := context.WithValue(req.Context(), "user_id", mockIDStr)
-		req = req.WithContext(ctx)
+		req := withSession(httptest.NewRequest(http.MethodPost, "/logout", nil), mockID, sessionID)
 
-		svc.On("GetAccountByID", mock.Anything, mockID).Return(repo.Account{Phone: "+251911223344"}, nil)
-		svc.On("UpsertByPhone", mock.Anything, "+251911223344").Return(repo.Account{}, nil)
+		// Only the current session is revoked
+		svc.On("RevokeSession", mock.Anything, mockID, sessionID).Return(true, nil)
 
 		w := httptest.NewRecorder()
 		h.Logout(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
+		svc.AssertExpectations(t)
+		svc.AssertNotCalled(t, "RevokeAllSessions", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Requires a session", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.Logout(w, httptest.NewRequest(http.MethodPost, "/logout", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestHandler_Sessions(t *testing.T) {
+	accID := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	current := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+	other := pgtype.UUID{Bytes: [16]byte{3}, Valid: true}
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+
+	t.Run("Lists devices and marks the current one", func(t *testing.T) {
+		svc := new(mockService)
+		h := &handler{service: svc, logger: logger}
+		svc.On("ListSessions", mock.Anything, accID).Return([]repo.Session{
+			{ID: other, DeviceName: pgtype.Text{String: "Old tablet", Valid: true}},
+			{ID: current, UserAgent: pgtype.Text{String: "AddisVerify/2.3", Valid: true}},
+		}, nil)
+
+		w := httptest.NewRecorder()
+		h.ListSessions(w, withSession(httptest.NewRequest(http.MethodGet, "/me/sessions", nil), accID, current))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var out []SessionDTO
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+		assert.Len(t, out, 2)
+		assert.Equal(t, "Old tablet", out[0].DeviceName)
+		assert.False(t, out[0].Current)
+		assert.True(t, out[1].Current)
+	})
+
+	t.Run("Revokes one session of the caller's account", func(t *testing.T) {
+		svc := new(mockService)
+		h := &handler{service: svc, logger: logger}
+		svc.On("RevokeSession", mock.Anything, accID, other).Return(true, nil)
+		svc.On("RevokeSession", mock.Anything, accID, mock.Anything).Return(false, nil)
+
+		revoke := func(id string) int {
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("sessionID", id)
+			req := httptest.NewRequest(http.MethodDelete, "/me/sessions/"+id, nil)
+			req = withSession(req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)), accID, current)
+			w := httptest.NewRecorder()
+			h.RevokeSession(w, req)
+			return w.Code
+		}
+
+		assert.Equal(t, http.StatusOK, revoke(other.String()))
+		// Someone else's (or an unknown) session looks the same
+		assert.Equal(t, http.StatusNotFound, revoke("7c9e6679-7425-40de-944b-e07fc1f90ae7"))
+		assert.Equal(t, http.StatusNotFound, revoke("not-a-uuid"))
+	})
+
+	t.Run("Revokes all sessions, optionally keeping the current one", func(t *testing.T) {
+		svc := new(mockService)
+		h := &handler{service: svc, logger: logger}
+		svc.On("RevokeAllSessions", mock.Anything, accID, current).Return(int64(2), nil).Once()
+		svc.On("RevokeAllSessions", mock.Anything, accID, pgtype.UUID{}).Return(int64(3), nil).Once()
+
+		w := httptest.NewRecorder()
+		h.RevokeAllSessions(w, withSession(httptest.NewRequest(http.MethodDelete, "/me/sessions?except_current=true", nil), accID, current))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"revoked":2}`, w.Body.String())
+
+		w = httptest.NewRecorder()
+		h.RevokeAllSessions(w, withSession(httptest.NewRequest(http.MethodDelete, "/me/sessions", nil), accID, current))
+		assert.JSONEq(t, `{"revoked":3}`, w.Body.String())
+		svc.AssertExpectations(t)
 	})
 }
@@ -0,0 +1,252 @@
+package account
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+	"github.com/yabeye/addis_verify_backend/pkg/messenger"
+)
+
+// Brute-force protection for VerifyOTP.
+// Every check takes an attempt from a per-phone counter that lives next to the OTP
+// before the code is compared, and a successful login clears it. Once a wrong code
+// uses the last attempt the code is burned and the phone is locked for a cooldown
+// that doubles with each lockout in the last 24 hours.
+const (
+	maxVerifyAttempts = 5
+	baseVerifyLockout = 5 * time.Minute
+	maxVerifyLockout  = 24 * time.Hour
+	lockoutWindow     = 24 * time.Hour
+)
+
+func otpKey(phone string) string          { return "otp:" + phone }
+func otpLockKey(phone string) string      { return "lock:otp:" + phone }
+func attemptsKey(phone string) string     { return "otp:attempts:" + phone }
+func sendsKey(phone string) string        { return "otp:sends:" + phone }
+func verifyLockKey(phone string) string   { return "lock:verify:" + phone }
+func lockoutCountKey(phone string) string { return "lockouts:verify:" + phone }
+func lastSendKey(phone string) string     { return "otp:last:" + phone }
+
+// deliveryTracker is implemented by messengers that know whether a message reached
+// the handset (the delivery outbox does, from provider receipts).
+type deliveryTracker interface {
+	Delivered(ctx context.Context, messageID string) (bool, error)
+}
+
+// suppressor is implemented by messengers that can record a send fraud screening
+// refused, so its message ID looks up like that of any other send.
+type suppressor interface {
+	Suppress(ctx context.Context, msg messenger.Message, reason string) (messenger.Receipt, error)
+}
+
+// lastSend remembers how the current code was sent, to decide on channel fallbacks.
+type lastSend struct {
+	Channel   string
+	MessageID string
+	At        time.Time
+}
+
+func (l lastSend) String() string {
+	return fmt.Sprintf("%s|%s|%d", l.Channel, l.MessageID, l.At.Unix())
+}
+
+func parseLastSend(s string) (lastSend, bool) {
+	parts := strings.Split(s, "|")
+	if len(parts) != 3 {
+		return lastSend{}, false
+	}
+	at, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return lastSend{}, false
+	}
+	return lastSend{Channel: parts[0], MessageID: parts[1], At: time.Unix(at, 0)}, true
+}
+
+// fallbackAllowed reports whether a send over channel may skip the resend cooldown:
+// the previous code went out over a channel whose fallback is channel, the fallback
+// delay has passed and the previous message has not been delivered.
+func (h *handler) fallbackAllowed(ctx context.Context, phone, channel string) bool {
+	raw, err := h.cache.Get(ctx, lastSendKey(phone)).Result()
+	if err != nil {
+		return false
+	}
+	last, ok := parseLastSend(raw)
+	if !ok {
+		return false
+	}
+	fallback, ok := h.policy.FallbackFor(last.Channel)
+	if !ok || fallback.To != channel || time.Since(last.At) < fallback.After {
+		return false
+	}
+
+	tracker, ok := h.messenger.(deliveryTracker)
+	if !ok || last.MessageID == "" {
+		return true
+	}
+	delivered, err := tracker.Delivered(ctx, last.MessageID)
+	if err != nil {
+		h.logger.Error("failed to check message delivery", "error", err, "message_id", last.MessageID)
+		return false
+	}
+	return !delivered
+}
+
+// suppressedMessageID records a send refused for reason and returns the message ID
+// to answer with.
+func (h *handler) suppressedMessageID(ctx context.Context, phone, channel, reason string) string {
+	s, ok := h.messenger.(suppressor)
+	if !ok {
+		return uuid.NewString()
+	}
+	receipt, err := s.Suppress(ctx, messenger.Message{To: phone, Channel: messenger.Channel(channel)}, reason)
+	if err != nil {
+		h.logger.Error("failed to record suppressed message", "error", err)
+		return uuid.NewString()
+	}
+	return receipt.MessageID
+}
+
+// hashOTP binds the code to the phone and the server pepper so a leaked Redis
+// dump cannot be replayed against another number.
+func (h *handler) hashOTP(phone, code string) string {
+	sum := sha256.Sum256([]byte(phone + code + h.hashPepper))
+	return fmt.Sprintf("%x", sum)
+}
+
+// otpMatches compares hashes in constant time.
+func otpMatches(storedHash, inputHash string) bool {
+	return subtle.ConstantTimeCompare([]byte(storedHash), []byte(inputHash)) == 1
+}
+
+// lockRemaining reports how long the given lock key still has to live.
+// A zero duration means the key is not set.
+func (h *handler) lockRemaining(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := h.cache.TTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	// Redis returns negative values for missing keys or keys without expiry
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// reserveAttempt counts a verification attempt before the code is compared, so
+// parallel guesses can't all slip in under the limit. It returns the attempt's
+// number in the current round.
+func (h *handler) reserveAttempt(ctx context.Context, phone string) (int, error) {
+	pipe := h.cache.Pipeline()
+	incr := pipe.Incr(ctx, attemptsKey(phone))
+	pipe.Expire(ctx, attemptsKey(phone), h.policy.TTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+// lockPhone burns the current OTP and locks the phone for a cooldown that grows
+// with every lockout. It returns the cooldown.
+func (h *handler) lockPhone(ctx context.Context, phone string) (time.Duration, error) {
+	pipe := h.cache.Pipeline()
+	pipe.Del(ctx, otpKey(phone), attemptsKey(phone))
+	lockouts := pipe.Incr(ctx, lockoutCountKey(phone))
+	pipe.Expire(ctx, lockoutCountKey(phone), lockoutWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	cooldown := lockoutDuration(int(lockouts.Val()))
+	if err := h.cache.Set(ctx, verifyLockKey(phone), "locked", cooldown).Err(); err != nil {
+		return 0, err
+	}
+	return cooldown, nil
+}
+
+// checkOTP verifies code for phone behind the brute-force guard and answers the
+// client itself when it fails. The code stays valid: callers clear it with
+// clearAttempts once they have acted on it.
+func (h *handler) checkOTP(ctx context.Context, w http.ResponseWriter, phone, code string) bool {
+	if !h.policy.Valid(code) {
+		json.WriteErrorCode(w, http.StatusBadRequest, constants.CodeInvalidOTP, constants.ErrInvalidOTP)
+		return false
+	}
+
+	// Brute-force guard: refuse while the phone is locked out
+	if remaining, err := h.lockRemaining(ctx, verifyLockKey(phone)); err != nil {
+		h.logger.Error("redis error", "error", err)
+		json.WriteError(w, http.StatusServiceUnavailable, constants.ErrServiceUnavailable)
+		return false
+	} else if remaining > 0 {
+		h.writeOTPLocked(w, remaining)
+		return false
+	}
+
+	// Take an attempt before looking at the code; requests racing past the last one are refused
+	attempt, err := h.reserveAttempt(ctx, phone)
+	if err != nil {
+		h.logger.Error("failed to record OTP attempt", "error", err)
+		json.WriteError(w, http.StatusServiceUnavailable, constants.ErrServiceUnavailable)
+		return false
+	}
+	if attempt > maxVerifyAttempts {
+		remaining, _ := h.lockRemaining(ctx, verifyLockKey(phone))
+		h.writeOTPLocked(w, max(remaining, baseVerifyLockout))
+		return false
+	}
+
+	// Retrieve the hashed OTP from Redis
+	storedHash, err := h.cache.Get(ctx, otpKey(phone)).Result()
+	if err != nil {
+		h.logger.Warn("OTP expired or not found", "phone", phone)
+		json.WriteErrorCode(w, http.StatusUnauthorized, constants.CodeInvalidOTP, constants.ErrInvalidOTP)
+		return false
+	}
+
+	// Verify Hash (OTP + Phone + Server Pepper)
+	// This protects against attackers who might see the OTP in transit or access Redis
+	if !otpMatches(storedHash, h.hashOTP(phone, code)) {
+		if attempt == maxVerifyAttempts {
+			lockout, err := h.lockPhone(ctx, phone)
+			if err != nil {
+				h.logger.Error("failed to lock phone", "error", err)
+				json.WriteError(w, http.StatusServiceUnavailable, constants.ErrServiceUnavailable)
+				return false
+			}
+			h.logger.Warn("OTP attempts exhausted, phone locked", "phone", phone, "cooldown", lockout)
+			h.writeOTPLocked(w, lockout)
+			return false
+		}
+		h.logger.Warn("Invalid OTP attempt", "phone", phone, "attempts_remaining", maxVerifyAttempts-attempt)
+		json.WriteErrorCode(w, http.StatusUnauthorized, constants.CodeInvalidOTP, constants.ErrInvalidOTP)
+		return false
+	}
+
+	return true
+}
+
+// clearAttempts wipes the OTP and all brute-force state after a successful login.
+func (h *handler) clearAttempts(ctx context.Context, phone string) {
+	h.cache.Del(ctx, otpKey(phone), attemptsKey(phone), lockoutCountKey(phone))
+}
+
+// lockoutDuration doubles the base cooldown for every previous lockout: 5m, 10m, 20m ... capped at 24h.
+func lockoutDuration(lockouts int) time.Duration {
+	d := baseVerifyLockout
+	for i := 1; i < lockouts; i++ {
+		d *= 2
+		if d >= maxVerifyLockout {
+			return maxVerifyLockout
+		}
+	}
+	return d
+}
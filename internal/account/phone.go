@@ -0,0 +1,183 @@
+package account
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+	"github.com/yabeye/addis_verify_backend/pkg/messenger"
+	"github.com/yabeye/addis_verify_backend/pkg/templates"
+)
+
+// changePhoneRequest moves the signed-in account to a new phone number
+// @Name ChangePhoneRequest
+type changePhoneRequest struct {
+	// NewPhone becomes the account's login. It must not belong to another account.
+	NewPhone string `json:"new_phone" validate:"required,max=32" example:"+251922334455"`
+	// NewOTP is a fresh code from send-otp for the new phone
+	NewOTP string `json:"new_otp" validate:"required" example:"654321"`
+	// OTP is a fresh code from send-otp for the current phone
+	OTP string `json:"otp" validate:"required_without=RecoveryCode,excluded_with=RecoveryCode" example:"123456"`
+	// RecoveryCode replaces OTP when the current phone is no longer available
+	RecoveryCode string `json:"recovery_code,omitempty" validate:"omitempty,max=32" example:"k7m2p-x9qrt"`
+}
+
+// changePhoneResponse shows the account on its new number
+type changePhoneResponse struct {
+	Message string     `json:"message" example:"Phone number changed"`
+	Account AccountDTO `json:"account"`
+	// SessionsRevoked counts the other devices that were signed out
+	SessionsRevoked int64 `json:"sessions_revoked" example:"2"`
+}
+
+// ChangePhone godoc
+// @Summary      Change Phone Number
+// @Description  Moves the signed-in account to a new phone number. Both numbers are verified: the current one with a fresh OTP, or with a backup recovery code when it is no longer available, and the new one with an OTP sent to it. Every other session is signed out and the old number gets an SMS about the change.
+// @Tags         accounts
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      changePhoneRequest  true  "Both verifications"
+// @Success      200      {object}  changePhoneResponse
+// @Failure      400      {object}  json.ErrorResponse
+// @Failure      401      {object}  json.ErrorResponse
+// @Failure      409      {object}  json.ErrorResponse
+// @Failure      429      {object}  retryLaterResponse
+// @Router       /api/v1/accounts/me/phone [put]
+func (h *handler) ChangePhone(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accID, sessionID, ok := currentSession(r)
+	if !ok {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrUnauthorizedError)
+		return
+	}
+
+	var req changePhoneRequest
+	if err := json.Read(r, &req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, constants.ErrInvalidJSON)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, "Validation failed: "+err.Error())
+		return
+	}
+	number, ok := h.parsePhone(w, http.StatusBadRequest, req.NewPhone)
+	if !ok {
+		return
+	}
+	newPhone := number.E164
+
+	acc, err := h.service.GetAccountByID(ctx, accID)
+	if err != nil {
+		json.WriteError(w, http.StatusNotFound, constants.ErrAccountNotFound)
+		return
+	}
+	oldPhone := acc.Phone
+	if oldPhone == newPhone {
+		json.WriteErrorCode(w, http.StatusBadRequest, constants.CodeInvalidPhone, constants.ErrSamePhone)
+		return
+	}
+
+	// 1. A session alone is not enough: the user proves they hold the current number,
+	// or owns the account through a recovery code when that number is gone
+	byCode := req.RecoveryCode != ""
+	if byCode {
+		if h.recoveryLocked(ctx, w, oldPhone) {
+			return
+		}
+	} else if !h.checkOTP(ctx, w, oldPhone, req.OTP) {
+		return
+	}
+
+	// 2. ...and that they hold the new one
+	if !h.checkOTP(ctx, w, newPhone, req.NewOTP) {
+		return
+	}
+
+	// 3. Numbers are logins, so one that already has an account can't be taken over.
+	// The update below catches the race where it registers in the meantime.
+	switch _, err := h.service.GetAccountByPhone(ctx, newPhone); {
+	case err == nil:
+		json.WriteErrorCode(w, http.StatusConflict, constants.CodePhoneInUse, constants.ErrPhoneInUse)
+		return
+	case !errors.Is(err, pgx.ErrNoRows):
+		h.logger.Error("failed to load account", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+
+	// 4. Move the account in one statement; a recovery code is spent in the same one
+	var changed bool
+	var attempt int64
+	if byCode {
+		if attempt, ok = h.reserveRecovery(ctx, w, oldPhone); !ok {
+			return
+		}
+		changed, err = h.service.RecoverAccount(ctx, accID, h.hashRecoveryCode(accID, req.RecoveryCode), newPhone)
+	} else {
+		changed, err = h.service.ChangePhone(ctx, accID, oldPhone, newPhone)
+	}
+	switch {
+	case errors.Is(err, ErrPhoneInUse):
+		json.WriteErrorCode(w, http.StatusConflict, constants.CodePhoneInUse, constants.ErrPhoneInUse)
+		return
+	case err != nil:
+		h.logger.Error("failed to change phone", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	case !changed && byCode:
+		h.failRecovery(w, oldPhone, attempt)
+		return
+	case !changed:
+		json.WriteError(w, http.StatusConflict, constants.ErrPhoneChangeConflict)
+		return
+	}
+	if byCode {
+		h.cache.Del(ctx, recoveryAttemptsKey(oldPhone))
+	} else {
+		h.clearAttempts(ctx, oldPhone)
+	}
+	h.clearAttempts(ctx, newPhone)
+
+	// 5. Sign out every other device, then tell the old number
+	revoked, err := h.service.RevokeAllSessions(ctx, accID, sessionID)
+	if err != nil {
+		h.logger.Error("failed to revoke sessions after phone change", "account_id", accID, "error", err)
+	}
+	method := "otp"
+	if byCode {
+		method = "recovery_code"
+	}
+	h.recordEvent(r, accID, sessionID, EventPhoneChanged, map[string]string{
+		"previous_phone": oldPhone,
+		"verified_by":    method,
+	})
+	h.notifyPhoneChanged(r, acc, newPhone)
+
+	h.logger.Info("phone number changed", "account_id", accID, "verified_by", method, "sessions_revoked", revoked)
+	acc.Phone = newPhone
+	json.Write(w, http.StatusOK, changePhoneResponse{
+		Message:         "Phone number changed",
+		Account:         MapAccountRow(acc),
+		SessionsRevoked: revoked,
+	})
+}
+
+// notifyPhoneChanged tells the number acc was on that the account moved to newPhone,
+// in the account's language. The change already happened, so a failed send is only logged.
+func (h *handler) notifyPhoneChanged(r *http.Request, acc repo.Account, newPhone string) {
+	lang := h.templates.Match(acc.PreferredLanguage.String, r.Header.Get("Accept-Language"))
+	body, err := h.templates.Render(templates.PhoneChanged, lang, templates.PhoneChangedData{
+		Ending: newPhone[max(len(newPhone)-4, 0):],
+	})
+	if err != nil {
+		h.logger.Error("failed to render phone change notice", "error", err, "lang", lang)
+		return
+	}
+	if _, err := h.messenger.Send(r.Context(), messenger.Message{To: acc.Phone, Body: body}); err != nil {
+		h.logger.Error("failed to notify previous phone", "account_id", acc.ID, "error", err)
+	}
+}
@@ -0,0 +1,157 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/messenger"
+	"github.com/yabeye/addis_verify_backend/pkg/otp"
+)
+
+func TestHandler_ChangePhone(t *testing.T) {
+	accID := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	sessionID := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+	oldPhone, newPhone, pepper := "+251911223344", "+251922334455", "test-pepper"
+	oldCode, newCode := "111111", "222222"
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+
+	setup := func(t *testing.T) (*handler, *mockService, *mockMessenger, *miniredis.Miniredis) {
+		mr := miniredis.RunT(t)
+		mr.Set("otp:"+oldPhone, fmt.Sprintf("%x", sha256.Sum256([]byte(oldPhone+oldCode+pepper))))
+		mr.Set("otp:"+newPhone, fmt.Sprintf("%x", sha256.Sum256([]byte(newPhone+newCode+pepper))))
+		svc, msgr := new(mockService), new(mockMessenger)
+		svc.On("GetAccountByID", mock.Anything, accID).Return(repo.Account{ID: accID, Phone: oldPhone, Status: repo.AccountStatusActive}, nil)
+		h := &handler{
+			service: svc, messenger: msgr, templates: mustTemplates(t), logger: logger, validate: validator.New(),
+			hashPepper: pepper, policy: otp.DefaultPolicy(), cache: redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		}
+		return h, svc, msgr, mr
+	}
+	// changed expects the bookkeeping that follows a successful move
+	changed := func(svc *mockService, msgr *mockMessenger) {
+		svc.On("RevokeAllSessions", mock.Anything, accID, sessionID).Return(int64(1), nil)
+		svc.On("RecordSecurityEvent", mock.Anything, mock.MatchedBy(func(e repo.CreateSecurityEventParams) bool {
+			return e.EventType == EventPhoneChanged && e.SessionID == sessionID
+		})).Return(nil)
+		msgr.On("Send", mock.Anything, mock.MatchedBy(func(m messenger.Message) bool {
+			return m.To == oldPhone
+		})).Return(messenger.Receipt{}, nil)
+	}
+	change := func(h *handler, payload map[string]string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPut, "/accounts/me/phone", bytes.NewBuffer(body))
+		ctx := context.WithValue(req.Context(), middlewares.UserIDKey, accID)
+		ctx = context.WithValue(ctx, middlewares.SessionIDKey, sessionID)
+		w := httptest.NewRecorder()
+		h.ChangePhone(w, req.WithContext(ctx))
+		return w
+	}
+
+	t.Run("Moves the account once both numbers are verified", func(t *testing.T) {
+		h, svc, msgr, mr := setup(t)
+		svc.On("GetAccountByPhone", mock.Anything, newPhone).Return(repo.Account{}, pgx.ErrNoRows)
+		svc.On("ChangePhone", mock.Anything, accID, oldPhone, newPhone).Return(true, nil)
+		changed(svc, msgr)
+
+		w := change(h, map[string]string{"new_phone": "0922334455", "new_otp": newCode, "otp": oldCode})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp changePhoneResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, newPhone, resp.Account.Phone)
+		assert.Equal(t, int64(1), resp.SessionsRevoked)
+		assert.False(t, mr.Exists("otp:"+oldPhone))
+		assert.False(t, mr.Exists("otp:"+newPhone))
+		svc.AssertExpectations(t)
+		msgr.AssertExpectations(t)
+	})
+
+	t.Run("A recovery code stands in for a lost number", func(t *testing.T) {
+		h, svc, msgr, _ := setup(t)
+		svc.On("GetAccountByPhone", mock.Anything, newPhone).Return(repo.Account{}, pgx.ErrNoRows)
+		svc.On("RecoverAccount", mock.Anything, accID, h.hashRecoveryCode(accID, "k7m2p-x9qrt"), newPhone).Return(true, nil)
+		changed(svc, msgr)
+
+		w := change(h, map[string]string{"new_phone": newPhone, "new_otp": newCode, "recovery_code": "K7M2P-X9QRT"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		svc.AssertNotCalled(t, "ChangePhone", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("A wrong recovery code counts towards the lock", func(t *testing.T) {
+		h, svc, _, mr := setup(t)
+		svc.On("GetAccountByPhone", mock.Anything, newPhone).Return(repo.Account{}, pgx.ErrNoRows)
+		svc.On("RecoverAccount", mock.Anything, accID, mock.Anything, newPhone).Return(false, nil)
+
+		w := change(h, map[string]string{"new_phone": newPhone, "new_otp": newCode, "recovery_code": "aaaaa-aaaaa"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeInvalidRecovery)
+		assert.True(t, mr.Exists(recoveryAttemptsKey(oldPhone)))
+	})
+
+	t.Run("Needs exactly one proof for the current number", func(t *testing.T) {
+		h, svc, _, _ := setup(t)
+
+		w := change(h, map[string]string{"new_phone": newPhone, "new_otp": newCode})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = change(h, map[string]string{"new_phone": newPhone, "new_otp": newCode, "otp": oldCode, "recovery_code": "k7m2p-x9qrt"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		svc.AssertNotCalled(t, "GetAccountByID", mock.Anything, mock.Anything)
+	})
+
+	t.Run("A wrong code for the new number changes nothing", func(t *testing.T) {
+		h, svc, _, _ := setup(t)
+
+		w := change(h, map[string]string{"new_phone": newPhone, "new_otp": "999999", "otp": oldCode})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeInvalidOTP)
+		svc.AssertNotCalled(t, "ChangePhone", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Won't take over another account's number", func(t *testing.T) {
+		h, svc, _, _ := setup(t)
+		svc.On("GetAccountByPhone", mock.Anything, newPhone).Return(repo.Account{ID: pgtype.UUID{Bytes: [16]byte{9}, Valid: true}}, nil)
+
+		w := change(h, map[string]string{"new_phone": newPhone, "new_otp": newCode, "otp": oldCode})
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodePhoneInUse)
+		svc.AssertNotCalled(t, "ChangePhone", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Loses the race for the new number gracefully", func(t *testing.T) {
+		h, svc, msgr, _ := setup(t)
+		svc.On("GetAccountByPhone", mock.Anything, newPhone).Return(repo.Account{}, pgx.ErrNoRows)
+		svc.On("ChangePhone", mock.Anything, accID, oldPhone, newPhone).Return(false, ErrPhoneInUse)
+
+		w := change(h, map[string]string{"new_phone": newPhone, "new_otp": newCode, "otp": oldCode})
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodePhoneInUse)
+		svc.AssertNotCalled(t, "RevokeAllSessions", mock.Anything, mock.Anything, mock.Anything)
+		msgr.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Rejects the number it already has", func(t *testing.T) {
+		h, _, _, _ := setup(t)
+
+		w := change(h, map[string]string{"new_phone": "0911223344", "new_otp": newCode, "otp": oldCode})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeInvalidPhone)
+	})
+}
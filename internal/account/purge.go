@@ -0,0 +1,97 @@
+package account
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+)
+
+// PurgeStore is the part of the database the purge job needs.
+type PurgeStore interface {
+	ListPurgeableAccounts(ctx context.Context, arg repo.ListPurgeableAccountsParams) ([]pgtype.UUID, error)
+	PurgeAccount(ctx context.Context, id pgtype.UUID) (int64, error)
+}
+
+// PurgeConfig tunes the purge job.
+type PurgeConfig struct {
+	// MediaDir holds each account's uploads under <MediaDir>/<accountID>. Defaults to store/media.
+	MediaDir string
+	// Interval between runs. Defaults to 1h.
+	Interval time.Duration
+	// BatchSize caps the accounts erased per run. Defaults to 100.
+	BatchSize int32
+}
+
+// Purger erases deleted accounts once their grace period is over.
+type Purger struct {
+	store  PurgeStore
+	cfg    PurgeConfig
+	logger *slog.Logger
+}
+
+// NewPurger creates a purge job over store.
+func NewPurger(store PurgeStore, cfg PurgeConfig, logger *slog.Logger) *Purger {
+	if cfg.MediaDir == "" {
+		cfg.MediaDir = "store/media"
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	return &Purger{store: store, cfg: cfg, logger: logger.With("component", "account_purger")}
+}
+
+// Run purges due accounts every Interval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := p.PurgeDue(ctx); err != nil && ctx.Err() == nil {
+			p.logger.Error("account purge failed", "purged", n, "error", err)
+		} else if n > 0 {
+			p.logger.Info("purged deleted accounts", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeDue erases one batch of accounts deleted more than DeletionGracePeriod ago
+// and returns how many it erased. Files go first: if anything fails the account
+// stays listed and the next run picks it up again.
+func (p *Purger) PurgeDue(ctx context.Context) (int, error) {
+	ids, err := p.store.ListPurgeableAccounts(ctx, repo.ListPurgeableAccountsParams{
+		DeletedAt: pgtype.Timestamptz{Time: time.Now().Add(-DeletionGracePeriod), Valid: true},
+		Limit:     p.cfg.BatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		if err := os.RemoveAll(filepath.Join(p.cfg.MediaDir, id.String())); err != nil {
+			return purged, err
+		}
+		n, err := p.store.PurgeAccount(ctx, id)
+		if err != nil {
+			return purged, err
+		}
+		if n > 0 {
+			purged++
+			p.logger.Info("account purged", "account_id", id)
+		}
+	}
+	return purged, nil
+}
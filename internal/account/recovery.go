@@ -0,0 +1,394 @@
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+)
+
+// Backup recovery codes let a user whose SIM was lost or recycled move the account
+// to a new number. Each set holds recoveryCodeCount single-use codes, shown to the
+// user once and stored only as hashes.
+const (
+	recoveryCodeCount = 10
+	recoveryCodeLen   = 10
+	// recoveryAlphabet leaves out 0/o, 1/l/i so codes survive being written down
+	recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+	// Wrong recovery codes are counted per old phone; the limit locks recovery
+	// of that number for the rest of the window.
+	maxRecoveryAttempts = 5
+	recoveryWindow      = 24 * time.Hour
+)
+
+func recoveryAttemptsKey(phone string) string { return "recovery:attempts:" + phone }
+
+// recoverAccountRequest moves an account to a new phone with a backup code
+// @Name RecoverAccountRequest
+type recoverAccountRequest struct {
+	// Phone is the number the account is registered with, which the user no longer has
+	Phone string `json:"phone" validate:"required,max=32" example:"+251911223344"`
+	// RecoveryCode is one of the account's unused backup codes; dashes and case don't matter
+	RecoveryCode string `json:"recovery_code" validate:"required,max=32" example:"k7m2p-x9qrt"`
+	// NewPhone receives the account. It must not belong to another account.
+	NewPhone string `json:"new_phone" validate:"required,max=32" example:"+251922334455"`
+	// OTP is a fresh code from send-otp for the new phone
+	OTP string `json:"otp" validate:"required" example:"123456"`
+	// DeviceName labels the session in the user's device list
+	DeviceName string `json:"device_name" validate:"omitempty,max=100" example:"Abebe's Pixel 7"`
+	// ClientType picks token lifetimes: mobile (the default) or web
+	ClientType string `json:"client_type" validate:"omitempty,oneof=mobile web" example:"mobile"`
+}
+
+// regenerateRecoveryCodesRequest confirms a new set of codes with a code sent to the account's phone
+// @Name RegenerateRecoveryCodesRequest
+type regenerateRecoveryCodesRequest struct {
+	// OTP is a fresh code from send-otp for the account's own phone
+	OTP string `json:"otp" validate:"required" example:"123456"`
+}
+
+// recoveryCodesResponse carries a new set of codes. They are never shown again.
+type recoveryCodesResponse struct {
+	Message       string   `json:"message" example:"Recovery codes regenerated"`
+	RecoveryCodes []string `json:"recovery_codes" example:"k7m2p-x9qrt,4hwn8-cd3fv"`
+}
+
+// recoveryCodesStatusResponse tells the user how many backup codes they have left
+type recoveryCodesStatusResponse struct {
+	Remaining int64 `json:"remaining" example:"9"`
+}
+
+// newRecoveryCodes returns a fresh set of codes formatted for display, e.g. k7m2p-x9qrt.
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	max := big.NewInt(int64(len(recoveryAlphabet)))
+	for i := range codes {
+		b := make([]byte, recoveryCodeLen)
+		for j := range b {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, err
+			}
+			b[j] = recoveryAlphabet[n.Int64()]
+		}
+		codes[i] = string(b[:recoveryCodeLen/2]) + "-" + string(b[recoveryCodeLen/2:])
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode undoes how users tend to retype a code: case, dashes and spaces.
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+}
+
+// hashRecoveryCode salts the code with its account, so equal codes on two accounts
+// don't share a hash, and with the server pepper like OTPs.
+func (h *handler) hashRecoveryCode(accountID pgtype.UUID, code string) string {
+	sum := sha256.Sum256([]byte(accountID.String() + normalizeRecoveryCode(code) + h.hashPepper))
+	return fmt.Sprintf("%x", sum)
+}
+
+// issueRecoveryCodes generates a set of codes for the account along with the hashes to store.
+func (h *handler) issueRecoveryCodes(accountID pgtype.UUID) ([]string, []string, error) {
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = h.hashRecoveryCode(accountID, code)
+	}
+	return codes, hashes, nil
+}
+
+// enrollRecoveryCodes gives an account its first set of codes and returns them, or
+// nil when it already has codes. A failure only costs the user their codes on this
+// login, so it is logged rather than failing the sign-in.
+func (h *handler) enrollRecoveryCodes(ctx context.Context, accountID pgtype.UUID) []string {
+	codes, hashes, err := h.issueRecoveryCodes(accountID)
+	if err != nil {
+		h.logger.Error("failed to generate recovery codes", "error", err)
+		return nil
+	}
+	enrolled, err := h.service.EnrollRecoveryCodes(ctx, accountID, hashes)
+	if err != nil {
+		h.logger.Error("failed to enroll recovery codes", "account_id", accountID, "error", err)
+		return nil
+	}
+	if !enrolled {
+		return nil
+	}
+	h.logger.Info("recovery codes enrolled", "account_id", accountID)
+	return codes
+}
+
+// Recover godoc
+// @Summary      Recover Account with a Backup Code
+// @Description  Moves an account to a new phone number when the old one is lost. The user proves they own the account with one of its backup recovery codes and that they hold the new number with an OTP sent to it. The code is spent, every existing session is signed out, the old number gets an SMS about the move and a new session is opened on this device. Five wrong codes lock recovery of that account for 24 hours.
+// @Tags         accounts
+// @Accept       json
+// @Produce      json
+// @Param        request  body      recoverAccountRequest  true  "Recovery Payload"
+// @Success      200      {object}  authSuccessResponse
+// @Failure      400      {object}  json.ErrorResponse
+// @Failure      401      {object}  json.ErrorResponse
+// @Failure      409      {object}  json.ErrorResponse
+// @Failure      429      {object}  retryLaterResponse
+// @Router       /api/v1/accounts/auth/recover [post]
+func (h *handler) Recover(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req recoverAccountRequest
+	if err := json.Read(r, &req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, constants.ErrInvalidJSON)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, "Validation failed: "+err.Error())
+		return
+	}
+	oldNumber, ok := h.parsePhone(w, http.StatusBadRequest, req.Phone)
+	if !ok {
+		return
+	}
+	newNumber, ok := h.parsePhone(w, http.StatusBadRequest, req.NewPhone)
+	if !ok {
+		return
+	}
+	oldPhone, newPhone := oldNumber.E164, newNumber.E164
+	if oldPhone == newPhone {
+		json.WriteErrorCode(w, http.StatusBadRequest, constants.CodeInvalidPhone, constants.ErrSamePhone)
+		return
+	}
+
+	// 1. Refuse while recovery of the old number is locked
+	if h.recoveryLocked(ctx, w, oldPhone) {
+		return
+	}
+
+	// 2. The user must hold the new number
+	if !h.checkOTP(ctx, w, newPhone, req.OTP) {
+		return
+	}
+
+	// 3. Take the attempt up front; unknown numbers fail like wrong codes, so
+	// recovery can't probe who is registered
+	attempt, ok := h.reserveRecovery(ctx, w, oldPhone)
+	if !ok {
+		return
+	}
+	acc, err := h.service.GetAccountByPhone(ctx, oldPhone)
+	if errors.Is(err, pgx.ErrNoRows) {
+		h.failRecovery(w, oldPhone, attempt)
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to load account", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	switch _, err := h.service.GetAccountByPhone(ctx, newPhone); {
+	case err == nil:
+		json.WriteErrorCode(w, http.StatusConflict, constants.CodePhoneInUse, constants.ErrPhoneInUse)
+		return
+	case !errors.Is(err, pgx.ErrNoRows):
+		h.logger.Error("failed to load account", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+
+	// 4. Spend the code and re-bind the account in one statement
+	recovered, err := h.service.RecoverAccount(ctx, acc.ID, h.hashRecoveryCode(acc.ID, req.RecoveryCode), newPhone)
+	if errors.Is(err, ErrPhoneInUse) {
+		json.WriteErrorCode(w, http.StatusConflict, constants.CodePhoneInUse, constants.ErrPhoneInUse)
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to recover account", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	if !recovered {
+		h.failRecovery(w, oldPhone, attempt)
+		return
+	}
+	h.cache.Del(ctx, recoveryAttemptsKey(oldPhone))
+	h.clearAttempts(ctx, newPhone)
+
+	// 5. Whoever holds the old number or a stolen token is signed out
+	revoked, err := h.service.RevokeAllSessions(ctx, acc.ID, pgtype.UUID{})
+	if err != nil {
+		h.logger.Error("failed to revoke sessions after recovery", "account_id", acc.ID, "error", err)
+	}
+	h.recordEvent(r, acc.ID, pgtype.UUID{}, EventAccountRecovered, map[string]string{
+		"previous_phone": oldPhone,
+	})
+	h.notifyPhoneChanged(r, acc, newPhone)
+
+	acc.Phone = newPhone
+	resp, err := h.signIn(r, acc, req.DeviceName, req.ClientType, auth.AMROTP, auth.AMRRecoveryCode)
+	if err != nil {
+		h.logger.Error("failed to sign in", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	h.logger.Info("account recovered to a new phone", "account_id", acc.ID, "sessions_revoked", revoked)
+	resp.Message = "Account recovered"
+	json.Write(w, http.StatusOK, resp)
+}
+
+// recoveryLocked answers 429 and returns true while recovery with phone's codes is
+// locked. It is a cheap early check; reserveRecovery is what enforces the limit.
+func (h *handler) recoveryLocked(ctx context.Context, w http.ResponseWriter, phone string) bool {
+	attempts, err := h.cache.Get(ctx, recoveryAttemptsKey(phone)).Int()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		h.logger.Error("redis error", "error", err)
+		json.WriteError(w, http.StatusServiceUnavailable, constants.ErrServiceUnavailable)
+		return true
+	}
+	if attempts >= maxRecoveryAttempts {
+		remaining, _ := h.lockRemaining(ctx, recoveryAttemptsKey(phone))
+		h.writeRetryLater(w, remaining, constants.CodeRecoveryLocked, constants.ErrRecoveryLocked)
+		return true
+	}
+	return false
+}
+
+// reserveRecovery takes one of phone's recovery attempts before a code is checked,
+// so parallel guesses can't slip in under the limit. It returns the attempt's
+// number, or false once it has answered.
+func (h *handler) reserveRecovery(ctx context.Context, w http.ResponseWriter, phone string) (int64, bool) {
+	attempt, err := h.takeAttempt(ctx, recoveryAttemptsKey(phone), recoveryWindow)
+	if err != nil {
+		h.logger.Error("failed to record recovery attempt", "error", err)
+		json.WriteError(w, http.StatusServiceUnavailable, constants.ErrServiceUnavailable)
+		return 0, false
+	}
+	if attempt > maxRecoveryAttempts {
+		remaining, _ := h.lockRemaining(ctx, recoveryAttemptsKey(phone))
+		h.writeRetryLater(w, remaining, constants.CodeRecoveryLocked, constants.ErrRecoveryLocked)
+		return 0, false
+	}
+	return attempt, true
+}
+
+// failRecovery answers a failed recovery attempt of phone with 401, or 429 when it
+// was the last one.
+func (h *handler) failRecovery(w http.ResponseWriter, phone string, attempt int64) {
+	if attempt >= maxRecoveryAttempts {
+		h.logger.Warn("recovery attempts exhausted, recovery locked", "phone", phone)
+		h.writeRetryLater(w, recoveryWindow, constants.CodeRecoveryLocked, constants.ErrRecoveryLocked)
+		return
+	}
+	h.logger.Warn("invalid recovery attempt", "phone", phone, "attempts_remaining", maxRecoveryAttempts-attempt)
+	json.WriteErrorCode(w, http.StatusUnauthorized, constants.CodeInvalidRecovery, constants.ErrInvalidRecoveryCode)
+}
+
+// takeAttempt counts an attempt against key, whose window starts with the first one.
+func (h *handler) takeAttempt(ctx context.Context, key string, window time.Duration) (int64, error) {
+	pipe := h.cache.Pipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary      Regenerate Recovery Codes
+// @Description  Replaces the account's backup recovery codes with a new set after confirming a fresh OTP sent to its phone. Every earlier code stops working. The new codes are shown only in this response.
+// @Tags         accounts
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      regenerateRecoveryCodesRequest  true  "Confirmation code"
+// @Success      200      {object}  recoveryCodesResponse
+// @Failure      401      {object}  json.ErrorResponse
+// @Failure      429      {object}  retryLaterResponse
+// @Router       /api/v1/accounts/me/recovery-codes [post]
+func (h *handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accID, ok := ctx.Value(middlewares.UserIDKey).(pgtype.UUID)
+	if !ok || !accID.Valid {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrUnauthorizedError)
+		return
+	}
+
+	var req regenerateRecoveryCodesRequest
+	if err := json.Read(r, &req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, constants.ErrInvalidJSON)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, "Validation failed: "+err.Error())
+		return
+	}
+
+	acc, err := h.service.GetAccountByID(ctx, accID)
+	if err != nil {
+		json.WriteError(w, http.StatusNotFound, constants.ErrAccountNotFound)
+		return
+	}
+	// A stolen access token alone must not be enough to mint recovery codes
+	if !h.checkOTP(ctx, w, acc.Phone, req.OTP) {
+		return
+	}
+
+	codes, hashes, err := h.issueRecoveryCodes(accID)
+	if err != nil {
+		h.logger.Error("failed to generate recovery codes", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	if err := h.service.ReplaceRecoveryCodes(ctx, accID, hashes); err != nil {
+		h.logger.Error("failed to replace recovery codes", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	h.clearAttempts(ctx, acc.Phone)
+	h.recordEvent(r, accID, pgtype.UUID{}, EventRecoveryCodesRegenerated, map[string]string{})
+
+	h.logger.Info("recovery codes regenerated", "account_id", accID)
+	json.Write(w, http.StatusOK, recoveryCodesResponse{
+		Message:       "Recovery codes regenerated",
+		RecoveryCodes: codes,
+	})
+}
+
+// GetRecoveryCodes godoc
+// @Summary      Recovery Codes Left
+// @Description  Returns how many unused backup recovery codes the account has. The codes themselves can't be shown again; regenerate them when few are left.
+// @Tags         accounts
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  recoveryCodesStatusResponse
+// @Failure      401  {object}  json.ErrorResponse
+// @Router       /api/v1/accounts/me/recovery-codes [get]
+func (h *handler) GetRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	accID, ok := r.Context().Value(middlewares.UserIDKey).(pgtype.UUID)
+	if !ok || !accID.Valid {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrUnauthorizedError)
+		return
+	}
+	remaining, err := h.service.CountRecoveryCodes(r.Context(), accID)
+	if err != nil {
+		h.logger.Error("failed to count recovery codes", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	json.Write(w, http.StatusOK, recoveryCodesStatusResponse{Remaining: remaining})
+}
@@ -0,0 +1,235 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/messenger"
+	"github.com/yabeye/addis_verify_backend/pkg/otp"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := newRecoveryCodes()
+	require.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+	assert.Regexp(t, `^[a-z2-9]{5}-[a-z2-9]{5}$`, codes[0])
+	assert.NotEqual(t, codes[0], codes[1])
+
+	// However the user retypes a code, it hashes the same
+	h := &handler{hashPepper: "test-pepper"}
+	accID := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	assert.Equal(t, h.hashRecoveryCode(accID, "k7m2p-x9qrt"), h.hashRecoveryCode(accID, " K7M2P X9QRT"))
+	assert.NotEqual(t, h.hashRecoveryCode(accID, "k7m2p-x9qrt"), h.hashRecoveryCode(pgtype.UUID{Bytes: [16]byte{2}, Valid: true}, "k7m2p-x9qrt"))
+}
+
+func TestHandler_Recover(t *testing.T) {
+	accID := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	oldPhone, newPhone, code, pepper := "+251911223344", "+251922334455", "123456", "test-pepper"
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+
+	setup := func(t *testing.T) (*handler, *mockService, *mockAuth, *miniredis.Miniredis) {
+		mr := miniredis.RunT(t)
+		mr.Set("otp:"+newPhone, fmt.Sprintf("%x", sha256.Sum256([]byte(newPhone+code+pepper))))
+		svc, authMgr := new(mockService), new(mockAuth)
+		svc.On("GetAccountByPhone", mock.Anything, oldPhone).Return(repo.Account{ID: accID, Phone: oldPhone, Status: repo.AccountStatusActive}, nil).Maybe()
+		h := &handler{
+			service: svc, auth: authMgr, logger: logger, validate: validator.New(), hashPepper: pepper, policy: otp.DefaultPolicy(),
+			cache: redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		}
+		return h, svc, authMgr, mr
+	}
+	recoverWith := func(h *handler, recoveryCode, otpCode string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{
+			"phone": "0911223344", "recovery_code": recoveryCode, "new_phone": "0922334455", "otp": otpCode,
+		})
+		w := httptest.NewRecorder()
+		h.Recover(w, httptest.NewRequest(http.MethodPost, "/accounts/auth/recover", bytes.NewBuffer(body)))
+		return w
+	}
+
+	t.Run("Moves the account to the new phone and signs out everywhere else", func(t *testing.T) {
+		h, svc, authMgr, mr := setup(t)
+		sessionID := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+		svc.On("GetAccountByPhone", mock.Anything, newPhone).Return(repo.Account{}, pgx.ErrNoRows)
+		svc.On("RecoverAccount", mock.Anything, accID, h.hashRecoveryCode(accID, "k7m2p-x9qrt"), newPhone).Return(true, nil)
+		svc.On("RevokeAllSessions", mock.Anything, accID, pgtype.UUID{}).Return(int64(2), nil)
+		svc.On("RecordSecurityEvent", mock.Anything, mock.MatchedBy(func(e repo.CreateSecurityEventParams) bool {
+			return e.EventType == EventAccountRecovered
+		})).Return(nil)
+		// The session remembers the login used a recovery code
+		svc.On("CreateSession", mock.Anything, mock.MatchedBy(func(p repo.CreateSessionParams) bool {
+			return assert.ObjectsAreEqual([]string{auth.AMROTP, auth.AMRRecoveryCode}, p.Amr)
+		})).Return(repo.Session{ID: sessionID, AccountID: accID, ClientType: auth.ClientMobile}, nil)
+		svc.On("SaveRefreshToken", mock.Anything, sessionID, pgtype.UUID{}, "jti", mock.Anything).Return(nil)
+		authMgr.On("GenerateTokenPair", mock.Anything).Return(&auth.TokenDetails{AccessToken: "at", RefreshToken: "rt", RefreshTokenID: "jti"}, nil)
+		mr.Set(recoveryAttemptsKey(oldPhone), "2")
+		// Whoever holds the old number learns the account moved away
+		msgr := new(mockMessenger)
+		msgr.On("Send", mock.Anything, mock.MatchedBy(func(m messenger.Message) bool {
+			return m.To == oldPhone && strings.Contains(m.Body, "4455")
+		})).Return(messenger.Receipt{}, nil)
+		h.messenger, h.templates = msgr, mustTemplates(t)
+
+		w := recoverWith(h, "K7M2P X9QRT", code)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp authSuccessResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, newPhone, resp.Account.Phone)
+		assert.Equal(t, sessionID.String(), resp.SessionID)
+		assert.False(t, mr.Exists("otp:"+newPhone))
+		assert.False(t, mr.Exists(recoveryAttemptsKey(oldPhone)))
+		svc.AssertExpectations(t)
+		msgr.AssertExpectations(t)
+	})
+
+	t.Run("Locks recovery after too many wrong codes", func(t *testing.T) {
+		h, svc, _, _ := setup(t)
+		svc.On("GetAccountByPhone", mock.Anything, newPhone).Return(repo.Account{}, pgx.ErrNoRows)
+		svc.On("RecoverAccount", mock.Anything, accID, mock.Anything, newPhone).Return(false, nil)
+
+		for i := 1; i < maxRecoveryAttempts; i++ {
+			w := recoverWith(h, "aaaaa-aaaaa", code)
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Contains(t, w.Body.String(), constants.CodeInvalidRecovery)
+		}
+		w := recoverWith(h, "aaaaa-aaaaa", code)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeRecoveryLocked)
+
+		// Even the right code waits out the lock
+		w = recoverWith(h, "k7m2p-x9qrt", code)
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		svc.AssertNumberOfCalls(t, "RecoverAccount", maxRecoveryAttempts)
+	})
+
+	t.Run("Parallel guesses can't outrun the limit", func(t *testing.T) {
+		h, _, _, _ := setup(t)
+
+		var wg sync.WaitGroup
+		var granted atomic.Int32
+		for range 3 * maxRecoveryAttempts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, ok := h.reserveRecovery(context.Background(), httptest.NewRecorder(), oldPhone); ok {
+					granted.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.EqualValues(t, maxRecoveryAttempts, granted.Load())
+	})
+
+	t.Run("Unknown numbers fail like wrong codes", func(t *testing.T) {
+		h, _, _, mr := setup(t)
+		svc := new(mockService)
+		svc.On("GetAccountByPhone", mock.Anything, oldPhone).Return(repo.Account{}, pgx.ErrNoRows)
+		h.service = svc
+
+		w := recoverWith(h, "k7m2p-x9qrt", code)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeInvalidRecovery)
+		attempts, err := mr.Get(recoveryAttemptsKey(oldPhone))
+		require.NoError(t, err)
+		assert.Equal(t, "1", attempts)
+	})
+
+	t.Run("Won't take over another account's phone", func(t *testing.T) {
+		h, svc, _, _ := setup(t)
+		svc.On("GetAccountByPhone", mock.Anything, newPhone).Return(repo.Account{ID: pgtype.UUID{Bytes: [16]byte{9}, Valid: true}}, nil)
+
+		w := recoverWith(h, "k7m2p-x9qrt", code)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodePhoneInUse)
+		svc.AssertNotCalled(t, "RecoverAccount", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Requires a code sent to the new phone", func(t *testing.T) {
+		h, svc, _, _ := setup(t)
+
+		w := recoverWith(h, "k7m2p-x9qrt", "654321")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeInvalidOTP)
+		svc.AssertNotCalled(t, "GetAccountByPhone", mock.Anything, mock.Anything)
+	})
+}
+
+func TestHandler_RegenerateRecoveryCodes(t *testing.T) {
+	accID := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	phone, code, pepper := "+251911223344", "123456", "test-pepper"
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+
+	setup := func(t *testing.T) (*handler, *mockService, *miniredis.Miniredis) {
+		mr := miniredis.RunT(t)
+		mr.Set("otp:"+phone, fmt.Sprintf("%x", sha256.Sum256([]byte(phone+code+pepper))))
+		svc := new(mockService)
+		svc.On("GetAccountByID", mock.Anything, accID).Return(repo.Account{ID: accID, Phone: phone, Status: repo.AccountStatusActive}, nil)
+		h := &handler{
+			service: svc, logger: logger, validate: validator.New(), hashPepper: pepper, policy: otp.DefaultPolicy(),
+			cache: redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		}
+		return h, svc, mr
+	}
+	regenerate := func(h *handler, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/accounts/me/recovery-codes", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), middlewares.UserIDKey, accID))
+		w := httptest.NewRecorder()
+		h.RegenerateRecoveryCodes(w, req)
+		return w
+	}
+
+	t.Run("Replaces the codes after a fresh OTP", func(t *testing.T) {
+		h, svc, mr := setup(t)
+		var stored []string
+		svc.On("ReplaceRecoveryCodes", mock.Anything, accID, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(2).([]string)
+		}).Return(nil)
+		svc.On("RecordSecurityEvent", mock.Anything, mock.MatchedBy(func(e repo.CreateSecurityEventParams) bool {
+			return e.EventType == EventRecoveryCodesRegenerated
+		})).Return(nil)
+
+		w := regenerate(h, `{"otp":"123456"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp recoveryCodesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Len(t, resp.RecoveryCodes, recoveryCodeCount)
+		require.Len(t, stored, recoveryCodeCount)
+		for i, c := range resp.RecoveryCodes {
+			assert.Equal(t, h.hashRecoveryCode(accID, c), stored[i])
+		}
+		assert.False(t, mr.Exists("otp:"+phone))
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("A wrong code changes nothing", func(t *testing.T) {
+		h, svc, _ := setup(t)
+
+		w := regenerate(h, `{"otp":"654321"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		svc.AssertNotCalled(t, "ReplaceRecoveryCodes", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
@@ -2,7 +2,11 @@ package account
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	repo "github.com/yabeye/addis_verify_backend/internal/database"
 )
@@ -12,17 +16,104 @@ type Service interface {
 	GetAccountByID(ctx context.Context, id pgtype.UUID) (repo.Account, error)
 	GetAccountByPhone(ctx context.Context, phone string) (repo.Account, error)
 	UpdateAccountStatus(ctx context.Context, id pgtype.UUID, status repo.AccountStatus) error
+	// TransitionStatus moves the account from one status to another. It returns false
+	// when the account was no longer in from.
+	TransitionStatus(ctx context.Context, id pgtype.UUID, from, to repo.AccountStatus) (bool, error)
+	// DeleteAccount marks an active account deleted, restorable until restoreUntil.
+	// It returns false when the account was not active.
+	DeleteAccount(ctx context.Context, id pgtype.UUID, restoreUntil time.Time) (bool, error)
+	// RestoreAccount reactivates a self-deleted account. It returns false once the
+	// restore window has closed.
+	RestoreAccount(ctx context.Context, id pgtype.UUID) (bool, error)
 	UpsertByPhone(ctx context.Context, phone string) (repo.Account, error)
+	UpdateLanguage(ctx context.Context, id pgtype.UUID, lang string) error
+	// ChangePhone moves an active account from oldPhone to newPhone. It returns false
+	// when the account is no longer active or no longer on oldPhone, and
+	// ErrPhoneInUse when another account holds newPhone.
+	ChangePhone(ctx context.Context, id pgtype.UUID, oldPhone, newPhone string) (bool, error)
+
+	CreateSession(ctx context.Context, arg repo.CreateSessionParams) (repo.Session, error)
+	GetSession(ctx context.Context, id pgtype.UUID) (repo.Session, error)
+	ListSessions(ctx context.Context, accountID pgtype.UUID) ([]repo.Session, error)
+	RevokeSession(ctx context.Context, accountID, id pgtype.UUID) (bool, error)
+	// RevokeAllSessions signs out every session of the account except keep (pass an invalid UUID to keep none).
+	RevokeAllSessions(ctx context.Context, accountID, keep pgtype.UUID) (int64, error)
+
+	// SaveRefreshToken records an issued refresh token in its session's family. parentID is
+	// the token it replaces (invalid for the first token of a login).
+	SaveRefreshToken(ctx context.Context, sessionID, parentID pgtype.UUID, jti string, expiresAt time.Time) error
+	// RefreshSession spends the refresh token jti, rotates its session and saves the
+	// token issue makes for the rotated session as jti's child, in one transaction: if
+	// any step fails jti stays spendable, so a retry isn't mistaken for reuse. It returns
+	// ErrRefreshTokenReused when jti was already spent and ErrRefreshTokenInvalid when it
+	// is unknown or expired.
+	RefreshSession(ctx context.Context, sessionID pgtype.UUID, jti, ip string, issue func(repo.Session) (childJTI string, expiresAt time.Time, err error)) (repo.Session, error)
+	RecordSecurityEvent(ctx context.Context, arg repo.CreateSecurityEventParams) error
+
+	// EnrollRecoveryCodes stores an account's first recovery codes. It returns false,
+	// storing nothing, when the account already has codes.
+	EnrollRecoveryCodes(ctx context.Context, accountID pgtype.UUID, hashes []string) (bool, error)
+	// ReplaceRecoveryCodes voids every earlier code of the account.
+	ReplaceRecoveryCodes(ctx context.Context, accountID pgtype.UUID, hashes []string) error
+	CountRecoveryCodes(ctx context.Context, accountID pgtype.UUID) (int64, error)
+	// RecoverAccount spends a recovery code and moves the account to newPhone. It
+	// returns false when the code is wrong or spent, or the account is not active,
+	// and ErrPhoneInUse when another account holds newPhone.
+	RecoverAccount(ctx context.Context, id pgtype.UUID, codeHash, newPhone string) (bool, error)
+	// ConfirmPhoneOwner spends a recovery code to prove the account's holder still owns
+	// its number after the operator flagged it. It returns false when the code is wrong or spent.
+	ConfirmPhoneOwner(ctx context.Context, id pgtype.UUID, codeHash string) (bool, error)
+	// UseRecoveryCode spends a recovery code in place of another factor. It returns
+	// false when the code is wrong or spent.
+	UseRecoveryCode(ctx context.Context, accountID pgtype.UUID, codeHash string) (bool, error)
+
+	// GetTOTP returns the account's authenticator app, confirmed or not.
+	GetTOTP(ctx context.Context, accountID pgtype.UUID) (repo.AccountTotp, error)
+	// EnrollTOTP stores a sealed secret awaiting its first code. It returns false
+	// when the account already has a confirmed authenticator.
+	EnrollTOTP(ctx context.Context, accountID pgtype.UUID, sealed []byte) (bool, error)
+	// ConfirmTOTP turns the authenticator on, spending the first code's step. It
+	// returns false when it was already on.
+	ConfirmTOTP(ctx context.Context, accountID pgtype.UUID, step int64) (bool, error)
+	// UseTOTPStep accepts a code's time step once. It returns false for a replayed code.
+	UseTOTPStep(ctx context.Context, accountID pgtype.UUID, step int64) (bool, error)
+	// DisableTOTP removes the authenticator. It returns false when there was none.
+	DisableTOTP(ctx context.Context, accountID pgtype.UUID) (bool, error)
+}
+
+var (
+	ErrRefreshTokenInvalid = errors.New("account: unknown or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("account: refresh token reused")
+	ErrPhoneInUse          = errors.New("account: phone belongs to another account")
+)
+
+// uniqueViolation is the Postgres error code for a broken unique constraint.
+const uniqueViolation = "23505"
+
+// phoneTaken turns a clash on accounts.phone into ErrPhoneInUse.
+func phoneTaken(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrPhoneInUse
+	}
+	return err
+}
+
+// TxStarter begins the transactions that steps which must commit together run in.
+type TxStarter interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
 }
 
 type svc struct {
 	repo repo.Querier
+	db   TxStarter
 }
 
 // New creates a new account service implementation
-func New(repo repo.Querier) Service {
+func New(repo repo.Querier, db TxStarter) Service {
 	return &svc{
 		repo: repo,
+		db:   db,
 	}
 }
 
@@ -41,6 +132,188 @@ func (s *svc) UpdateAccountStatus(ctx context.Context, id pgtype.UUID, status re
 	})
 }
 
+func (s *svc) TransitionStatus(ctx context.Context, id pgtype.UUID, from, to repo.AccountStatus) (bool, error) {
+	n, err := s.repo.TransitionAccountStatus(ctx, repo.TransitionAccountStatusParams{
+		ID:         id,
+		FromStatus: from,
+		ToStatus:   to,
+	})
+	return n > 0, err
+}
+
+func (s *svc) DeleteAccount(ctx context.Context, id pgtype.UUID, restoreUntil time.Time) (bool, error) {
+	n, err := s.repo.DeleteAccount(ctx, repo.DeleteAccountParams{
+		ID:           id,
+		RestoreUntil: pgtype.Timestamptz{Time: restoreUntil, Valid: true},
+	})
+	return n > 0, err
+}
+
+func (s *svc) RestoreAccount(ctx context.Context, id pgtype.UUID) (bool, error) {
+	n, err := s.repo.RestoreAccount(ctx, id)
+	return n > 0, err
+}
+
 func (s *svc) UpsertByPhone(ctx context.Context, phone string) (repo.Account, error) {
 	return s.repo.UpsertAccount(ctx, phone)
 }
+
+func (s *svc) UpdateLanguage(ctx context.Context, id pgtype.UUID, lang string) error {
+	return s.repo.UpdateAccountLanguage(ctx, repo.UpdateAccountLanguageParams{
+		ID:                id,
+		PreferredLanguage: pgtype.Text{String: lang, Valid: true},
+	})
+}
+
+func (s *svc) ChangePhone(ctx context.Context, id pgtype.UUID, oldPhone, newPhone string) (bool, error) {
+	n, err := s.repo.ChangeAccountPhone(ctx, repo.ChangeAccountPhoneParams{ID: id, OldPhone: oldPhone, NewPhone: newPhone})
+	return n > 0, phoneTaken(err)
+}
+
+func (s *svc) CreateSession(ctx context.Context, arg repo.CreateSessionParams) (repo.Session, error) {
+	return s.repo.CreateSession(ctx, arg)
+}
+
+func (s *svc) GetSession(ctx context.Context, id pgtype.UUID) (repo.Session, error) {
+	return s.repo.GetSession(ctx, id)
+}
+
+func (s *svc) ListSessions(ctx context.Context, accountID pgtype.UUID) ([]repo.Session, error) {
+	return s.repo.ListActiveSessions(ctx, accountID)
+}
+
+func (s *svc) RevokeSession(ctx context.Context, accountID, id pgtype.UUID) (bool, error) {
+	n, err := s.repo.RevokeSession(ctx, repo.RevokeSessionParams{ID: id, AccountID: accountID})
+	return n > 0, err
+}
+
+func (s *svc) RevokeAllSessions(ctx context.Context, accountID, keep pgtype.UUID) (int64, error) {
+	return s.repo.RevokeAllSessions(ctx, repo.RevokeAllSessionsParams{AccountID: accountID, KeepID: keep})
+}
+
+func (s *svc) SaveRefreshToken(ctx context.Context, sessionID, parentID pgtype.UUID, jti string, expiresAt time.Time) error {
+	return saveRefreshToken(ctx, s.repo, sessionID, parentID, jti, expiresAt)
+}
+
+func (s *svc) RefreshSession(ctx context.Context, sessionID pgtype.UUID, jti, ip string, issue func(repo.Session) (string, time.Time, error)) (repo.Session, error) {
+	var parentID pgtype.UUID
+	if err := parentID.Scan(jti); err != nil {
+		return repo.Session{}, ErrRefreshTokenInvalid
+	}
+
+	var rotated repo.Session
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		q := repo.New(tx)
+		if err := useRefreshToken(ctx, q, sessionID, parentID); err != nil {
+			return err
+		}
+		var err error
+		rotated, err = q.RotateSession(ctx, repo.RotateSessionParams{
+			ID:        sessionID,
+			IpAddress: pgtype.Text{String: ip, Valid: ip != ""},
+		})
+		if err != nil {
+			return err
+		}
+		childJTI, expiresAt, err := issue(rotated)
+		if err != nil {
+			return err
+		}
+		return saveRefreshToken(ctx, q, sessionID, parentID, childJTI, expiresAt)
+	})
+	return rotated, err
+}
+
+// saveRefreshToken records jti in the session's token family.
+func saveRefreshToken(ctx context.Context, q repo.Querier, sessionID, parentID pgtype.UUID, jti string, expiresAt time.Time) error {
+	var id pgtype.UUID
+	if err := id.Scan(jti); err != nil {
+		return err
+	}
+	return q.CreateRefreshToken(ctx, repo.CreateRefreshTokenParams{
+		ID:        id,
+		SessionID: sessionID,
+		ParentID:  parentID,
+		ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+	})
+}
+
+// useRefreshToken spends the refresh token id, telling a reused token from an unknown one.
+func useRefreshToken(ctx context.Context, q repo.Querier, sessionID, id pgtype.UUID) error {
+	n, err := q.UseRefreshToken(ctx, repo.UseRefreshTokenParams{ID: id, SessionID: sessionID})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	// Not spendable: find out whether it was spent before
+	tok, err := q.GetRefreshToken(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if tok.UsedAt.Valid && tok.SessionID == sessionID {
+		return ErrRefreshTokenReused
+	}
+	return ErrRefreshTokenInvalid
+}
+
+func (s *svc) RecordSecurityEvent(ctx context.Context, arg repo.CreateSecurityEventParams) error {
+	return s.repo.CreateSecurityEvent(ctx, arg)
+}
+
+func (s *svc) EnrollRecoveryCodes(ctx context.Context, accountID pgtype.UUID, hashes []string) (bool, error) {
+	n, err := s.repo.EnrollRecoveryCodes(ctx, repo.EnrollRecoveryCodesParams{AccountID: accountID, CodeHashes: hashes})
+	return n > 0, err
+}
+
+func (s *svc) ReplaceRecoveryCodes(ctx context.Context, accountID pgtype.UUID, hashes []string) error {
+	return s.repo.ReplaceRecoveryCodes(ctx, repo.ReplaceRecoveryCodesParams{AccountID: accountID, CodeHashes: hashes})
+}
+
+func (s *svc) CountRecoveryCodes(ctx context.Context, accountID pgtype.UUID) (int64, error) {
+	return s.repo.CountUnusedRecoveryCodes(ctx, accountID)
+}
+
+func (s *svc) RecoverAccount(ctx context.Context, id pgtype.UUID, codeHash, newPhone string) (bool, error) {
+	n, err := s.repo.RecoverAccount(ctx, repo.RecoverAccountParams{ID: id, CodeHash: codeHash, NewPhone: newPhone})
+	return n > 0, phoneTaken(err)
+}
+
+func (s *svc) ConfirmPhoneOwner(ctx context.Context, id pgtype.UUID, codeHash string) (bool, error) {
+	n, err := s.repo.ConfirmPhoneOwner(ctx, repo.ConfirmPhoneOwnerParams{ID: id, CodeHash: codeHash})
+	return n > 0, err
+}
+
+func (s *svc) UseRecoveryCode(ctx context.Context, accountID pgtype.UUID, codeHash string) (bool, error) {
+	n, err := s.repo.UseRecoveryCode(ctx, repo.UseRecoveryCodeParams{AccountID: accountID, CodeHash: codeHash})
+	return n > 0, err
+}
+
+func (s *svc) GetTOTP(ctx context.Context, accountID pgtype.UUID) (repo.AccountTotp, error) {
+	return s.repo.GetAccountTOTP(ctx, accountID)
+}
+
+func (s *svc) EnrollTOTP(ctx context.Context, accountID pgtype.UUID, sealed []byte) (bool, error) {
+	n, err := s.repo.EnrollTOTP(ctx, repo.EnrollTOTPParams{AccountID: accountID, Secret: sealed})
+	return n > 0, err
+}
+
+func (s *svc) ConfirmTOTP(ctx context.Context, accountID pgtype.UUID, step int64) (bool, error) {
+	n, err := s.repo.ConfirmTOTP(ctx, repo.ConfirmTOTPParams{AccountID: accountID, Step: step})
+	return n > 0, err
+}
+
+func (s *svc) UseTOTPStep(ctx context.Context, accountID pgtype.UUID, step int64) (bool, error) {
+	n, err := s.repo.UseTOTPStep(ctx, repo.UseTOTPStepParams{AccountID: accountID, Step: step})
+	return n > 0, err
+}
+
+func (s *svc) DisableTOTP(ctx context.Context, accountID pgtype.UUID) (bool, error) {
+	n, err := s.repo.DeleteAccountTOTP(ctx, accountID)
+	return n > 0, err
+}
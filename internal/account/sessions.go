@@ -0,0 +1,237 @@
+package account
+
+import (
+	stdjson "encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/fraud"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+)
+
+// maxUserAgent matches the sessions.user_agent column.
+const maxUserAgent = 255
+
+// Security event types recorded in security_events.
+const (
+	EventRefreshTokenReuse = "refresh_token_reuse"
+	EventStatusChanged     = "account_status_changed"
+	EventAccountDeleted    = "account_deleted"
+	EventAccountRestored   = "account_restored"
+	EventAccountRecovered  = "account_recovered"
+	EventPhoneChanged      = "phone_changed"
+	EventLoginHeld         = "login_held"
+	EventTOTPEnabled       = "totp_enabled"
+	EventTOTPDisabled      = "totp_disabled"
+
+	EventRecoveryCodesRegenerated = "recovery_codes_regenerated"
+	EventPhoneOwnerConfirmed      = "phone_owner_confirmed"
+)
+
+// openSession records a new signed-in device for accountID, logged in by amr from a clientType app.
+func (h *handler) openSession(r *http.Request, accountID pgtype.UUID, deviceName, clientType string, amr []string) (repo.Session, error) {
+	ua, ip := userAgent(r), fraud.ClientIP(r)
+	if clientType == "" {
+		clientType = auth.ClientMobile
+	}
+	return h.service.CreateSession(r.Context(), repo.CreateSessionParams{
+		AccountID:  accountID,
+		DeviceName: pgtype.Text{String: deviceName, Valid: deviceName != ""},
+		UserAgent:  pgtype.Text{String: ua, Valid: ua != ""},
+		IpAddress:  pgtype.Text{String: ip, Valid: ip != ""},
+		ClientType: clientType,
+		Amr:        amr,
+	})
+}
+
+// signIn opens a session for acc on this device and issues its first token pair.
+// amr records how the user proved who they are.
+func (h *handler) signIn(r *http.Request, acc repo.Account, deviceName, clientType string, amr ...string) (authSuccessResponse, error) {
+	session, err := h.openSession(r, acc.ID, deviceName, clientType, amr)
+	if err != nil {
+		return authSuccessResponse{}, fmt.Errorf("create session: %w", err)
+	}
+	tokenPair, err := h.auth.GenerateTokenPair(sessionGrant(session))
+	if err != nil {
+		return authSuccessResponse{}, fmt.Errorf("generate tokens: %w", err)
+	}
+	// The login's refresh token starts the session's token family
+	if err := h.service.SaveRefreshToken(r.Context(), session.ID, pgtype.UUID{}, tokenPair.RefreshTokenID, time.Unix(tokenPair.RtExpires, 0)); err != nil {
+		return authSuccessResponse{}, fmt.Errorf("save refresh token: %w", err)
+	}
+	return authSuccessResponse{
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokenPair.RefreshToken,
+		SessionID:    session.ID.String(),
+		ExpiresIn:    tokenPair.AtExpires - time.Now().Unix(),
+		Account:      MapAccountRow(acc),
+	}, nil
+}
+
+// sessionGrant describes the tokens a session is entitled to. The client type and
+// login method come from the session, never from the token being refreshed, so a
+// refresh can't widen what the login granted.
+func sessionGrant(s repo.Session) auth.Grant {
+	return auth.Grant{
+		AccountID: s.AccountID.String(),
+		SessionID: s.ID.String(),
+		Client:    s.ClientType,
+		AuthTime:  s.CreatedAt.Time,
+		AMR:       s.Amr,
+		// Matches token_valid_from exactly so the middleware's iat check passes
+		IssuedAt: s.TokenValidFrom.Time,
+	}
+}
+
+// userAgent returns the request's User-Agent, cut to fit the database.
+func userAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgent {
+		ua = ua[:maxUserAgent]
+	}
+	return ua
+}
+
+// currentSession returns the account and session the AuthMiddleware put in the context.
+func currentSession(r *http.Request) (accountID, sessionID pgtype.UUID, ok bool) {
+	accountID, ok1 := r.Context().Value(middlewares.UserIDKey).(pgtype.UUID)
+	sessionID, ok2 := r.Context().Value(middlewares.SessionIDKey).(pgtype.UUID)
+	return accountID, sessionID, ok1 && ok2 && accountID.Valid && sessionID.Valid
+}
+
+// ListSessions godoc
+// @Summary      List Signed-in Devices
+// @Description  Returns the account's active sessions, most recently used first. The session making the request is marked current.
+// @Tags         accounts
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}   SessionDTO
+// @Router       /api/v1/accounts/me/sessions [get]
+func (h *handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	accID, sessionID, ok := currentSession(r)
+	if !ok {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrUnauthorizedError)
+		return
+	}
+
+	// Sessions without a live refresh token can't come back and aren't listed
+	sessions, err := h.service.ListSessions(r.Context(), accID)
+	if err != nil {
+		h.logger.Error("failed to list sessions", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+
+	out := make([]SessionDTO, 0, len(sessions))
+	for _, s := range sessions {
+		out = append(out, MapSessionRow(s, s.ID == sessionID))
+	}
+	json.Write(w, http.StatusOK, out)
+}
+
+// RevokeSession godoc
+// @Summary      Sign Out a Device
+// @Description  Revokes one of the account's sessions. Its tokens stop working immediately.
+// @Tags         accounts
+// @Security     BearerAuth
+// @Produce      json
+// @Param        sessionID  path      string  true  "Session ID"
+// @Success      200        {object}  map[string]string
+// @Failure      404        {object}  json.ErrorResponse
+// @Router       /api/v1/accounts/me/sessions/{sessionID} [delete]
+func (h *handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	accID, _, ok := currentSession(r)
+	if !ok {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrUnauthorizedError)
+		return
+	}
+
+	var target pgtype.UUID
+	if err := target.Scan(chi.URLParam(r, "sessionID")); err != nil {
+		json.WriteError(w, http.StatusNotFound, constants.ErrSessionNotFound)
+		return
+	}
+
+	// Scoped to the caller's account: other people's session IDs look like unknown ones
+	revoked, err := h.service.RevokeSession(r.Context(), accID, target)
+	if err != nil {
+		h.logger.Error("failed to revoke session", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	if !revoked {
+		json.WriteError(w, http.StatusNotFound, constants.ErrSessionNotFound)
+		return
+	}
+
+	json.Write(w, http.StatusOK, map[string]string{"message": "Session signed out."})
+}
+
+// RevokeAllSessions godoc
+// @Summary      Sign Out All Devices
+// @Description  Revokes every session of the account, or every other one with except_current=true.
+// @Tags         accounts
+// @Security     BearerAuth
+// @Produce      json
+// @Param        except_current  query     bool  false  "Keep the session making the request"
+// @Success      200             {object}  map[string]int
+// @Router       /api/v1/accounts/me/sessions [delete]
+func (h *handler) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	accID, sessionID, ok := currentSession(r)
+	if !ok {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrUnauthorizedError)
+		return
+	}
+
+	var keep pgtype.UUID
+	if r.URL.Query().Get("except_current") == "true" {
+		keep = sessionID
+	}
+
+	n, err := h.service.RevokeAllSessions(r.Context(), accID, keep)
+	if err != nil {
+		h.logger.Error("failed to revoke sessions", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+
+	h.logger.Info("sessions revoked", "account_id", accID, "count", n, "kept_current", keep.Valid)
+	json.Write(w, http.StatusOK, map[string]int64{"revoked": n})
+}
+
+// revokeFamily signs out a session whose refresh token was replayed and records why.
+func (h *handler) revokeFamily(r *http.Request, session repo.Session, jti string) {
+	ctx := r.Context()
+	h.logger.Warn("refresh token reuse detected, revoking session",
+		"account_id", session.AccountID, "session_id", session.ID, "jti", jti, "ip", fraud.ClientIP(r))
+
+	if _, err := h.service.RevokeSession(ctx, session.AccountID, session.ID); err != nil {
+		h.logger.Error("failed to revoke session after token reuse", "error", err)
+	}
+
+	h.recordEvent(r, session.AccountID, session.ID, EventRefreshTokenReuse, map[string]string{"jti": jti})
+}
+
+// recordEvent adds to the account's security events, with where the request came
+// from. A failure is logged but never fails the request.
+func (h *handler) recordEvent(r *http.Request, accountID, sessionID pgtype.UUID, eventType string, details map[string]string) {
+	ua, ip := userAgent(r), fraud.ClientIP(r)
+	raw, _ := stdjson.Marshal(details)
+	if err := h.service.RecordSecurityEvent(r.Context(), repo.CreateSecurityEventParams{
+		AccountID: accountID,
+		SessionID: sessionID,
+		EventType: eventType,
+		IpAddress: pgtype.Text{String: ip, Valid: ip != ""},
+		UserAgent: pgtype.Text{String: ua, Valid: ua != ""},
+		Details:   raw,
+	}); err != nil {
+		h.logger.Error("failed to record security event", "event_type", eventType, "error", err)
+	}
+}
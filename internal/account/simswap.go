@@ -0,0 +1,71 @@
+package account
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+)
+
+// passSIMCheck asks the operator whether phone changed hands since its account's holder
+// last proved they own it. A held login goes through only with one of the account's
+// recovery codes, which is spent. It returns the login's authentication methods, or
+// false once it has answered.
+func (h *handler) passSIMCheck(w http.ResponseWriter, r *http.Request, phone, recoveryCode string) ([]string, bool) {
+	amr := []string{auth.AMROTP}
+	if h.sims == nil {
+		return amr, true
+	}
+	ctx := r.Context()
+
+	acc, err := h.service.GetAccountByPhone(ctx, phone)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		// A first login has no earlier holder to protect
+		return amr, true
+	case err != nil:
+		h.logger.Error("failed to load account", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return nil, false
+	}
+
+	verdict, err := h.sims.Check(ctx, phone, acc.PhoneBoundAt.Time)
+	if err != nil {
+		// Failing closed would lock every user out while the operator API is down
+		h.logger.Warn("sim check failed, letting login through", "account_id", acc.ID, "error", err)
+		return amr, true
+	}
+	if !verdict.Hold {
+		return amr, true
+	}
+
+	// The OTP stays valid so the client can repeat it with a recovery code
+	if recoveryCode == "" {
+		h.recordEvent(r, acc.ID, pgtype.UUID{}, EventLoginHeld, map[string]string{"reason": verdict.Reason})
+		h.logger.Warn("login held, number changed hands", "account_id", acc.ID, "reason", verdict.Reason)
+		json.WriteErrorCode(w, http.StatusForbidden, constants.CodeStepUpRequired, constants.ErrSIMSwapHold)
+		return nil, false
+	}
+	attempt, ok := h.reserveRecovery(ctx, w, phone)
+	if !ok {
+		return nil, false
+	}
+	confirmed, err := h.service.ConfirmPhoneOwner(ctx, acc.ID, h.hashRecoveryCode(acc.ID, recoveryCode))
+	if err != nil {
+		h.logger.Error("failed to confirm phone owner", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return nil, false
+	}
+	if !confirmed {
+		h.failRecovery(w, phone, attempt)
+		return nil, false
+	}
+	h.cache.Del(ctx, recoveryAttemptsKey(phone))
+	h.recordEvent(r, acc.ID, pgtype.UUID{}, EventPhoneOwnerConfirmed, map[string]string{"reason": verdict.Reason})
+	h.logger.Info("held login confirmed with a recovery code", "account_id", acc.ID, "reason", verdict.Reason)
+	return append(amr, auth.AMRRecoveryCode), true
+}
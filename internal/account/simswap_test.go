@@ -0,0 +1,156 @@
+package account
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/otp"
+	"github.com/yabeye/addis_verify_backend/pkg/simcheck"
+	"github.com/yabeye/addis_verify_backend/pkg/simcheck/simchecktest"
+)
+
+func TestHandler_VerifyOTP_SIMCheck(t *testing.T) {
+	accID := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	sessionID := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+	phone, code, pepper := "+251911223344", "123456", "test-pepper"
+	bound := time.Now().Add(-90 * 24 * time.Hour)
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+
+	setup := func(t *testing.T) (*handler, *mockService, *simchecktest.Server, *miniredis.Miniredis) {
+		mr := miniredis.RunT(t)
+		mr.Set("otp:"+phone, fmt.Sprintf("%x", sha256.Sum256([]byte(phone+code+pepper))))
+		operator := simchecktest.NewServer(t)
+		sims, err := simcheck.New(simcheck.Config{
+			Driver: simcheck.DriverCAMARA,
+			CAMARA: simcheck.CAMARAConfig{BaseURL: operator.URL, Token: simchecktest.Token},
+		})
+		require.NoError(t, err)
+
+		svc := new(mockService)
+		svc.On("GetAccountByPhone", mock.Anything, phone).Return(repo.Account{
+			ID: accID, Phone: phone, Status: repo.AccountStatusActive,
+			PhoneBoundAt: pgtype.Timestamptz{Time: bound, Valid: true},
+		}, nil).Maybe()
+		h := &handler{
+			service: svc, logger: logger, validate: validator.New(), hashPepper: pepper, policy: otp.DefaultPolicy(),
+			cache: redis.NewClient(&redis.Options{Addr: mr.Addr()}), sims: sims,
+		}
+		return h, svc, operator, mr
+	}
+	// signsIn expects a login carrying amr
+	signsIn := func(h *handler, svc *mockService, amr []string) {
+		authMgr := new(mockAuth)
+		svc.On("UpsertByPhone", mock.Anything, phone).Return(repo.Account{ID: accID, Phone: phone, Status: repo.AccountStatusActive}, nil)
+		svc.On("CreateSession", mock.Anything, mock.MatchedBy(func(p repo.CreateSessionParams) bool {
+			return assert.ObjectsAreEqual(amr, p.Amr)
+		})).Return(repo.Session{ID: sessionID, AccountID: accID, ClientType: auth.ClientMobile, Amr: amr}, nil)
+		svc.On("SaveRefreshToken", mock.Anything, sessionID, pgtype.UUID{}, "jti", mock.Anything).Return(nil)
+		svc.On("EnrollRecoveryCodes", mock.Anything, accID, mock.Anything).Return(false, nil)
+		svc.On("GetTOTP", mock.Anything, accID).Return(repo.AccountTotp{}, pgx.ErrNoRows)
+		authMgr.On("GenerateTokenPair", mock.Anything).Return(&auth.TokenDetails{AccessToken: "at", RefreshToken: "rt", RefreshTokenID: "jti"}, nil)
+		h.auth = authMgr
+	}
+	verify := func(h *handler, recoveryCode string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"phone": phone, "otp": code, "recovery_code": recoveryCode})
+		w := httptest.NewRecorder()
+		h.VerifyOTP(w, httptest.NewRequest(http.MethodPost, "/accounts/auth/verify", bytes.NewBuffer(body)))
+		return w
+	}
+
+	t.Run("A number with a clean history logs in as usual", func(t *testing.T) {
+		h, svc, operator, _ := setup(t)
+		signsIn(h, svc, []string{auth.AMROTP})
+
+		w := verify(h, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, 2, operator.Calls())
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("Holds the login after a recent SIM swap and keeps the code", func(t *testing.T) {
+		h, svc, operator, mr := setup(t)
+		operator.Swap(phone, time.Now().Add(-time.Hour))
+		svc.On("RecordSecurityEvent", mock.Anything, mock.MatchedBy(func(e repo.CreateSecurityEventParams) bool {
+			return e.EventType == EventLoginHeld && e.AccountID == accID
+		})).Return(nil)
+
+		w := verify(h, "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeStepUpRequired)
+		assert.True(t, mr.Exists("otp:"+phone))
+		svc.AssertNotCalled(t, "UpsertByPhone", mock.Anything, mock.Anything)
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("A recovery code releases the held login", func(t *testing.T) {
+		h, svc, operator, mr := setup(t)
+		operator.Recycle(phone, time.Now().Add(-24*time.Hour))
+		mr.Set(recoveryAttemptsKey(phone), "2")
+		svc.On("ConfirmPhoneOwner", mock.Anything, accID, h.hashRecoveryCode(accID, "k7m2p-x9qrt")).Return(true, nil)
+		svc.On("RecordSecurityEvent", mock.Anything, mock.MatchedBy(func(e repo.CreateSecurityEventParams) bool {
+			return e.EventType == EventPhoneOwnerConfirmed
+		})).Return(nil)
+		signsIn(h, svc, []string{auth.AMROTP, auth.AMRRecoveryCode})
+
+		w := verify(h, "K7M2P-X9QRT")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.False(t, mr.Exists("otp:"+phone))
+		assert.False(t, mr.Exists(recoveryAttemptsKey(phone)))
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("A wrong recovery code counts towards the lock", func(t *testing.T) {
+		h, svc, operator, mr := setup(t)
+		operator.Swap(phone, time.Now().Add(-time.Hour))
+		svc.On("ConfirmPhoneOwner", mock.Anything, accID, mock.Anything).Return(false, nil)
+
+		w := verify(h, "aaaaa-aaaaa")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeInvalidRecovery)
+		assert.True(t, mr.Exists(recoveryAttemptsKey(phone)))
+		assert.True(t, mr.Exists("otp:"+phone))
+		svc.AssertNotCalled(t, "UpsertByPhone", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Lets logins through while the operator is down", func(t *testing.T) {
+		h, svc, operator, _ := setup(t)
+		operator.Swap(phone, time.Now().Add(-time.Hour))
+		operator.Fail(http.StatusServiceUnavailable)
+		signsIn(h, svc, []string{auth.AMROTP})
+
+		w := verify(h, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("New numbers have no one to protect", func(t *testing.T) {
+		h, _, operator, _ := setup(t)
+		svc := new(mockService)
+		svc.On("GetAccountByPhone", mock.Anything, phone).Return(repo.Account{}, pgx.ErrNoRows)
+		h.service = svc
+		signsIn(h, svc, []string{auth.AMROTP})
+		operator.Swap(phone, time.Now().Add(-time.Hour))
+
+		w := verify(h, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Zero(t, operator.Calls())
+	})
+}
@@ -0,0 +1,126 @@
+package account
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+)
+
+// statusTransitions is the account status state machine: where an account may go
+// from each status. Deleted is final for support staff; only the holder can
+// restore a self-deleted account, within its restore window.
+var statusTransitions = map[repo.AccountStatus][]repo.AccountStatus{
+	repo.AccountStatusActive:        {repo.AccountStatusPendingReview, repo.AccountStatusSuspended, repo.AccountStatusDeleted},
+	repo.AccountStatusPendingReview: {repo.AccountStatusActive, repo.AccountStatusSuspended, repo.AccountStatusDeleted},
+	repo.AccountStatusSuspended:     {repo.AccountStatusActive, repo.AccountStatusDeleted},
+	repo.AccountStatusDeleted:       {},
+}
+
+// CanTransition reports whether an account may move from one status to another.
+func CanTransition(from, to repo.AccountStatus) bool {
+	return slices.Contains(statusTransitions[from], to)
+}
+
+// signsOut reports whether moving to status ends every session of the account.
+func signsOut(status repo.AccountStatus) bool {
+	return status == repo.AccountStatusSuspended || status == repo.AccountStatusDeleted
+}
+
+// setStatusRequest moves an account to another status
+// @Name SetAccountStatusRequest
+type setStatusRequest struct {
+	Status string `json:"status" validate:"required,oneof=active pending_review suspended deleted" example:"suspended"`
+	// Reason is kept in the account's security events
+	Reason string `json:"reason" validate:"required,max=500" example:"Chargeback fraud reported by Dashen Bank, ticket #4411"`
+}
+
+// setStatusResponse reports a status change
+type setStatusResponse struct {
+	Account AccountDTO `json:"account"`
+	// SessionsRevoked counts the devices signed out by the change
+	SessionsRevoked int64 `json:"sessions_revoked" example:"2"`
+}
+
+// SetStatus godoc
+// @Summary      Change an Account's Status
+// @Description  Moves an account along the status state machine (active, pending_review, suspended, deleted) and records the reason. Suspending or deleting an account signs out all of its sessions at once.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        X-Admin-Key  header    string            true  "Admin API key"
+// @Param        accountID    path      string            true  "Account ID"
+// @Param        request      body      setStatusRequest  true  "New status and reason"
+// @Success      200          {object}  setStatusResponse
+// @Failure      404          {object}  json.ErrorResponse
+// @Failure      409          {object}  json.ErrorResponse
+// @Router       /api/v1/admin/accounts/{accountID}/status [put]
+func (h *handler) SetStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var accID pgtype.UUID
+	if err := accID.Scan(chi.URLParam(r, "accountID")); err != nil {
+		json.WriteError(w, http.StatusNotFound, constants.ErrAccountNotFound)
+		return
+	}
+	var req setStatusRequest
+	if err := json.Read(r, &req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, constants.ErrInvalidJSON)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		json.WriteError(w, http.StatusUnprocessableEntity, "Validation failed: "+err.Error())
+		return
+	}
+
+	acc, err := h.service.GetAccountByID(ctx, accID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		json.WriteError(w, http.StatusNotFound, constants.ErrAccountNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to get account", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+
+	from, to := acc.Status, repo.AccountStatus(req.Status)
+	if !CanTransition(from, to) {
+		json.WriteErrorCode(w, http.StatusConflict, constants.CodeInvalidTransition, constants.ErrInvalidTransition)
+		return
+	}
+	// The update only applies if nobody changed the status since we read it
+	moved, err := h.service.TransitionStatus(ctx, accID, from, to)
+	if err != nil {
+		h.logger.Error("failed to change account status", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	if !moved {
+		json.WriteErrorCode(w, http.StatusConflict, constants.CodeInvalidTransition, constants.ErrInvalidTransition)
+		return
+	}
+
+	var revoked int64
+	if signsOut(to) {
+		revoked, err = h.service.RevokeAllSessions(ctx, accID, pgtype.UUID{})
+		if err != nil {
+			// The status alone already locks the account out; sessions are belt and braces
+			h.logger.Error("failed to revoke sessions after status change", "account_id", accID, "error", err)
+		}
+	}
+
+	h.recordEvent(r, accID, pgtype.UUID{}, EventStatusChanged, map[string]string{
+		"from": string(from), "to": string(to), "reason": req.Reason,
+	})
+
+	h.logger.Info("account status changed", "account_id", accID, "from", from, "to", to, "sessions_revoked", revoked)
+	acc.Status = to
+	json.Write(w, http.StatusOK, setStatusResponse{Account: MapAccountRow(acc), SessionsRevoked: revoked})
+}
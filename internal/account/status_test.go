@@ -0,0 +1,182 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/otp"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to repo.AccountStatus
+		want     bool
+	}{
+		{repo.AccountStatusActive, repo.AccountStatusSuspended, true},
+		{repo.AccountStatusActive, repo.AccountStatusPendingReview, true},
+		{repo.AccountStatusPendingReview, repo.AccountStatusActive, true},
+		{repo.AccountStatusSuspended, repo.AccountStatusActive, true},
+		{repo.AccountStatusSuspended, repo.AccountStatusDeleted, true},
+		{repo.AccountStatusSuspended, repo.AccountStatusPendingReview, false},
+		{repo.AccountStatusActive, repo.AccountStatusActive, false},
+		{repo.AccountStatusDeleted, repo.AccountStatusActive, false},
+		{repo.AccountStatus("bogus"), repo.AccountStatusActive, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, CanTransition(tt.from, tt.to), "%s -> %s", tt.from, tt.to)
+	}
+}
+
+func TestHandler_SetStatus(t *testing.T) {
+	accID := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+
+	setStatus := func(h *handler, id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/admin/accounts/"+id+"/status", bytes.NewBufferString(body))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("accountID", id)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		h.SetStatus(w, req)
+		return w
+	}
+
+	t.Run("Suspending signs out every session and records the reason", func(t *testing.T) {
+		svc := new(mockService)
+		h := &handler{service: svc, logger: logger, validate: validator.New()}
+		svc.On("GetAccountByID", mock.Anything, accID).Return(repo.Account{ID: accID, Status: repo.AccountStatusActive}, nil)
+		svc.On("TransitionStatus", mock.Anything, accID, repo.AccountStatusActive, repo.AccountStatusSuspended).Return(true, nil)
+		svc.On("RevokeAllSessions", mock.Anything, accID, pgtype.UUID{}).Return(int64(3), nil)
+		svc.On("RecordSecurityEvent", mock.Anything, mock.MatchedBy(func(e repo.CreateSecurityEventParams) bool {
+			var d map[string]string
+			_ = json.Unmarshal(e.Details, &d)
+			return e.EventType == EventStatusChanged && e.AccountID == accID &&
+				d["from"] == "active" && d["to"] == "suspended" && d["reason"] == "fraud ring"
+		})).Return(nil)
+
+		w := setStatus(h, accID.String(), `{"status":"suspended","reason":"fraud ring"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp setStatusResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "suspended", resp.Account.Status)
+		assert.Equal(t, int64(3), resp.SessionsRevoked)
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("Moving to review keeps sessions", func(t *testing.T) {
+		svc := new(mockService)
+		h := &handler{service: svc, logger: logger, validate: validator.New()}
+		svc.On("GetAccountByID", mock.Anything, accID).Return(repo.Account{ID: accID, Status: repo.AccountStatusActive}, nil)
+		svc.On("TransitionStatus", mock.Anything, accID, repo.AccountStatusActive, repo.AccountStatusPendingReview).Return(true, nil)
+		svc.On("RecordSecurityEvent", mock.Anything, mock.Anything).Return(nil)
+
+		w := setStatus(h, accID.String(), `{"status":"pending_review","reason":"KYC documents unclear"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		svc.AssertNotCalled(t, "RevokeAllSessions", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Refuses transitions the state machine forbids", func(t *testing.T) {
+		svc := new(mockService)
+		h := &handler{service: svc, logger: logger, validate: validator.New()}
+		svc.On("GetAccountByID", mock.Anything, accID).Return(repo.Account{ID: accID, Status: repo.AccountStatusDeleted}, nil)
+
+		w := setStatus(h, accID.String(), `{"status":"active","reason":"oops"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeInvalidTransition)
+		svc.AssertNotCalled(t, "TransitionStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Loses a race without side effects", func(t *testing.T) {
+		svc := new(mockService)
+		h := &handler{service: svc, logger: logger, validate: validator.New()}
+		svc.On("GetAccountByID", mock.Anything, accID).Return(repo.Account{ID: accID, Status: repo.AccountStatusActive}, nil)
+		svc.On("TransitionStatus", mock.Anything, accID, repo.AccountStatusActive, repo.AccountStatusSuspended).Return(false, nil)
+
+		w := setStatus(h, accID.String(), `{"status":"suspended","reason":"fraud ring"}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		svc.AssertNotCalled(t, "RevokeAllSessions", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Requires a reason", func(t *testing.T) {
+		h := &handler{service: new(mockService), logger: logger, validate: validator.New()}
+		w := setStatus(h, accID.String(), `{"status":"suspended"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+
+	t.Run("Unknown account", func(t *testing.T) {
+		svc := new(mockService)
+		h := &handler{service: svc, logger: logger, validate: validator.New()}
+		svc.On("GetAccountByID", mock.Anything, accID).Return(repo.Account{}, pgx.ErrNoRows)
+
+		w := setStatus(h, accID.String(), `{"status":"suspended","reason":"fraud ring"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestHandler_StatusEnforcement(t *testing.T) {
+	accID := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+
+	for status, code := range map[repo.AccountStatus]string{
+		repo.AccountStatusSuspended:     constants.CodeAccountSuspended,
+		repo.AccountStatusPendingReview: constants.CodeAccountInReview,
+		repo.AccountStatusDeleted:       constants.CodeAccountDeleted,
+	} {
+		t.Run("VerifyOTP refuses "+string(status), func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			phone, code6, pepper := "+251911223344", "123456", "test-pepper"
+			mr.Set("otp:"+phone, fmt.Sprintf("%x", sha256.Sum256([]byte(phone+code6+pepper))))
+
+			svc, authMgr := new(mockService), new(mockAuth)
+			svc.On("UpsertByPhone", mock.Anything, phone).Return(repo.Account{ID: accID, Phone: phone, Status: status}, nil)
+			h := &handler{service: svc, logger: logger, cache: rdb, validate: validator.New(), auth: authMgr, hashPepper: pepper, policy: otp.DefaultPolicy()}
+
+			body, _ := json.Marshal(map[string]string{"phone": phone, "otp": code6})
+			w := httptest.NewRecorder()
+			h.VerifyOTP(w, httptest.NewRequest(http.MethodPost, "/verify", bytes.NewBuffer(body)))
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+			assert.Contains(t, w.Body.String(), code)
+			assert.False(t, mr.Exists("otp:"+phone), "the code is spent either way")
+			svc.AssertNotCalled(t, "CreateSession", mock.Anything, mock.Anything)
+			authMgr.AssertNotCalled(t, "GenerateTokenPair", mock.Anything)
+		})
+	}
+
+	t.Run("RefreshToken refuses a suspended account before the session check", func(t *testing.T) {
+		svc, authMgr := new(mockService), new(mockAuth)
+		sessionID := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+		authMgr.On("VerifyToken", "refresh").Return(&auth.Claims{
+			AccountID: accID.String(), Type: "refresh", SessionID: sessionID.String(),
+		}, nil)
+		svc.On("GetAccountByID", mock.Anything, accID).Return(repo.Account{ID: accID, Status: repo.AccountStatusSuspended}, nil)
+		h := &handler{service: svc, auth: authMgr, logger: logger, validate: validator.New()}
+
+		w := httptest.NewRecorder()
+		h.RefreshToken(w, httptest.NewRequest(http.MethodPost, "/refresh", bytes.NewBufferString(`{"refresh_token":"refresh"}`)))
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeAccountSuspended)
+		svc.AssertNotCalled(t, "RefreshSession", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,537 @@
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	stdjson "encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+	"github.com/yabeye/addis_verify_backend/pkg/totp"
+)
+
+// An authenticator app (RFC 6238 TOTP) is an optional second factor on top of the
+// phone OTP. Once it is confirmed, verify-otp answers with a short-lived challenge
+// token instead of tokens, and the login finishes at /auth/totp.
+const (
+	totpIssuer = "AddisVerify"
+	// secondFactorTTL is how long a login that passed the phone OTP waits for its second factor
+	secondFactorTTL = 5 * time.Minute
+
+	// Wrong authenticator codes are counted per account
+	maxTOTPAttempts = 5
+	totpWindow      = 15 * time.Minute
+)
+
+func totpAttemptsKey(accountID pgtype.UUID) string { return "totp:attempts:" + accountID.String() }
+
+// secondFactorKey stores challenges under a hash so Redis never holds a usable token.
+func secondFactorKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "mfa:" + hex.EncodeToString(sum[:])
+}
+
+// secondFactorChallenge remembers a login that passed the phone OTP until its second factor arrives
+type secondFactorChallenge struct {
+	AccountID  pgtype.UUID `json:"account_id"`
+	DeviceName string      `json:"device_name"`
+	ClientType string      `json:"client_type"`
+	AMR        []string    `json:"amr"`
+}
+
+// secondFactorRequiredResponse is returned by verify-otp instead of tokens when the
+// account has an authenticator app
+// @Name SecondFactorRequiredResponse
+type secondFactorRequiredResponse struct {
+	Message string `json:"message" example:"Enter the code from your authenticator app to finish signing in"`
+	Code    string `json:"code" example:"SECOND_FACTOR_REQUIRED"`
+	// MFAToken goes to /auth/totp with the code
+	MFAToken string `json:"mfa_token" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	// Methods lists what /auth/totp accepts
+	Methods []string `json:"methods" example:"totp,recovery_code"`
+	// ExpiresIn is how many seconds the token stays valid
+	ExpiresIn int `json:"expires_in" example:"300"`
+}
+
+// completeTOTPLoginRequest finishes a login with the authenticator app, or a recovery
+// code when the app is lost
+// @Name CompleteTOTPLoginRequest
+type completeTOTPLoginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required,max=128" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	// Code is the current code shown by the authenticator app
+	Code string `json:"code" validate:"required_without=RecoveryCode,excluded_with=RecoveryCode,max=16" example:"492039"`
+	// RecoveryCode replaces Code when the authenticator app is lost
+	RecoveryCode string `json:"recovery_code,omitempty" validate:"omitempty,max=32" example:"k7m2p-x9qrt"`
+}
+
+// enrollTOTPResponse carries a new secret for the authenticator app
+type enrollTOTPResponse struct {
+	// Secret is for typing into the app by hand (base32)
+	Secret string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	// OTPAuthURI is the provisioning URI apps import
+	OTPAuthURI string `json:"otpauth_uri" example:"otpauth://totp/AddisVerify:%2B251911223344?algorithm=SHA1&digits=6&issuer=AddisVerify&period=30&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	// QRPayload is the text to render as a QR code for the app to scan
+	QRPayload string `json:"qr_payload" example:"otpauth://totp/AddisVerify:%2B251911223344?algorithm=SHA1&digits=6&issuer=AddisVerify&period=30&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	Digits    int    `json:"digits" example:"6"`
+	// Period is how many seconds each code is current
+	Period int `json:"period" example:"30"`
+}
+
+// confirmTOTPRequest turns the authenticator app on with its first code
+// @Name ConfirmTOTPRequest
+type confirmTOTPRequest struct {
+	Code string `json:"code" validate:"required,max=16" example:"492039"`
+}
+
+// disableTOTPRequest turns the authenticator app off
+// @Name DisableTOTPRequest
+type disableTOTPRequest struct {
+	// Code is the current code shown by the authenticator app
+	Code string `json:"code" validate:"required_without=RecoveryCode,excluded_with=RecoveryCode,max=16" example:"492039"`
+	// RecoveryCode replaces Code when the authenticator app is lost
+	RecoveryCode string `json:"recovery_code,omitempty" validate:"omitempty,max=32" example:"k7m2p-x9qrt"`
+}
+
+// EnrollTOTP godoc
+// @Summary      Start Authenticator App Enrollment
+// @Description  Generates a secret for an authenticator app (RFC 6238 TOTP: SHA-1, 6 digits, 30 seconds) and returns it with its otpauth:// provisioning URI to show as a QR code. Nothing changes for logins until the first code is confirmed; enrolling again before that replaces the secret.
+// @Tags         accounts
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  enrollTOTPResponse
+// @Failure      401  {object}  json.ErrorResponse
+// @Failure      409  {object}  json.ErrorResponse
+// @Router       /api/v1/accounts/me/totp [post]
+func (h *handler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accID, _, ok := currentSession(r)
+	if !ok {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrUnauthorizedError)
+		return
+	}
+	acc, err := h.service.GetAccountByID(ctx, accID)
+	if err != nil {
+		json.WriteError(w, http.StatusNotFound, constants.ErrAccountNotFound)
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		h.logger.Error("failed to generate totp secret", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	sealed, err := h.secrets.Seal(secret, accID.Bytes[:])
+	if err != nil {
+		h.logger.Error("failed to seal totp secret", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	enrolled, err := h.service.EnrollTOTP(ctx, accID, sealed)
+	if err != nil {
+		h.logger.Error("failed to enroll totp", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	if !enrolled {
+		json.WriteErrorCode(w, http.StatusConflict, constants.CodeTOTPEnabled, constants.ErrTOTPEnabled)
+		return
+	}
+
+	uri := totp.URI(totpIssuer, acc.Phone, secret)
+	json.Write(w, http.StatusOK, enrollTOTPResponse{
+		Secret:     totp.Encode(secret),
+		OTPAuthURI: uri,
+		QRPayload:  uri,
+		Digits:     totp.Digits,
+		Period:     int(totp.Period.Seconds()),
+	})
+}
+
+// ConfirmTOTP godoc
+// @Summary      Confirm Authenticator App
+// @Description  Turns the enrolled authenticator app on with the first code it shows. From then on every login needs a code from it after the phone OTP. Five wrong codes lock authenticator checks for 15 minutes.
+// @Tags         accounts
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      confirmTOTPRequest  true  "First code"
+// @Success      200      {object}  map[string]string
+// @Failure      401      {object}  json.ErrorResponse
+// @Failure      404      {object}  json.ErrorResponse
+// @Failure      409      {object}  json.ErrorResponse
+// @Failure      429      {object}  retryLaterResponse
+// @Router       /api/v1/accounts/me/totp/confirm [post]
+func (h *handler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accID, sessionID, ok := currentSession(r)
+	if !ok {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrUnauthorizedError)
+		return
+	}
+	var req confirmTOTPRequest
+	if err := json.Read(r, &req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, constants.ErrInvalidJSON)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, "Validation failed: "+err.Error())
+		return
+	}
+
+	rec, err := h.service.GetTOTP(ctx, accID)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		json.WriteError(w, http.StatusNotFound, constants.ErrTOTPNotEnrolled)
+		return
+	case err != nil:
+		h.logger.Error("failed to load totp", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	case rec.ConfirmedAt.Valid:
+		json.WriteErrorCode(w, http.StatusConflict, constants.CodeTOTPEnabled, constants.ErrTOTPEnabled)
+		return
+	}
+	attempt, ok := h.reserveTOTP(ctx, w, accID)
+	if !ok {
+		return
+	}
+	secret, ok := h.openTOTPSecret(w, rec)
+	if !ok {
+		return
+	}
+	step, valid := totp.Validate(secret, req.Code, time.Now())
+	if !valid {
+		h.failTOTP(w, accID, attempt)
+		return
+	}
+
+	confirmed, err := h.service.ConfirmTOTP(ctx, accID, step)
+	if err != nil {
+		h.logger.Error("failed to confirm totp", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	if !confirmed {
+		json.WriteErrorCode(w, http.StatusConflict, constants.CodeTOTPEnabled, constants.ErrTOTPEnabled)
+		return
+	}
+	h.cache.Del(ctx, totpAttemptsKey(accID))
+	h.recordEvent(r, accID, sessionID, EventTOTPEnabled, map[string]string{})
+	h.logger.Info("authenticator app enabled", "account_id", accID)
+	json.Write(w, http.StatusOK, map[string]string{"message": "Authenticator app enabled"})
+}
+
+// DisableTOTP godoc
+// @Summary      Turn Off Authenticator App
+// @Description  Removes the authenticator app, so logins need only the phone OTP again. Confirm with a current code from the app, or with a backup recovery code when the app is lost.
+// @Tags         accounts
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      disableTOTPRequest  true  "Current code"
+// @Success      200      {object}  map[string]string
+// @Failure      401      {object}  json.ErrorResponse
+// @Failure      404      {object}  json.ErrorResponse
+// @Failure      429      {object}  retryLaterResponse
+// @Router       /api/v1/accounts/me/totp [delete]
+func (h *handler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accID, sessionID, ok := currentSession(r)
+	if !ok {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrUnauthorizedError)
+		return
+	}
+	var req disableTOTPRequest
+	if err := json.Read(r, &req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, constants.ErrInvalidJSON)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, "Validation failed: "+err.Error())
+		return
+	}
+
+	acc, err := h.service.GetAccountByID(ctx, accID)
+	if err != nil {
+		json.WriteError(w, http.StatusNotFound, constants.ErrAccountNotFound)
+		return
+	}
+	rec, ok := h.enabledTOTP(ctx, w, accID)
+	if !ok {
+		return
+	}
+	if rec == nil {
+		json.WriteError(w, http.StatusNotFound, constants.ErrTOTPNotEnabled)
+		return
+	}
+	method, ok := h.checkSecondFactor(ctx, w, acc, *rec, req.Code, req.RecoveryCode)
+	if !ok {
+		return
+	}
+
+	if _, err := h.service.DisableTOTP(ctx, accID); err != nil {
+		h.logger.Error("failed to disable totp", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	h.recordEvent(r, accID, sessionID, EventTOTPDisabled, map[string]string{"verified_by": method})
+	h.logger.Info("authenticator app disabled", "account_id", accID, "verified_by", method)
+	json.Write(w, http.StatusOK, map[string]string{"message": "Authenticator app disabled"})
+}
+
+// CompleteTOTPLogin godoc
+// @Summary      Finish Login with Authenticator App
+// @Description  Exchanges the mfa_token from verify-otp and a current authenticator app code for an Access and Refresh token pair. A backup recovery code can stand in for a lost app. Each code works once, and five wrong codes lock authenticator checks for 15 minutes.
+// @Tags         accounts
+// @Accept       json
+// @Produce      json
+// @Param        request  body      completeTOTPLoginRequest  true  "Second factor"
+// @Success      200      {object}  authSuccessResponse
+// @Failure      400      {object}  json.ErrorResponse
+// @Failure      401      {object}  json.ErrorResponse
+// @Failure      403      {object}  json.ErrorResponse
+// @Failure      429      {object}  retryLaterResponse
+// @Router       /api/v1/accounts/auth/totp [post]
+func (h *handler) CompleteTOTPLogin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req completeTOTPLoginRequest
+	if err := json.Read(r, &req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, constants.ErrInvalidJSON)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, "Validation failed: "+err.Error())
+		return
+	}
+
+	// 1. The token proves the phone OTP was passed moments ago
+	key := secondFactorKey(req.MFAToken)
+	raw, err := h.cache.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrInvalidMFAToken)
+		return
+	}
+	if err != nil {
+		h.logger.Error("redis error", "error", err)
+		json.WriteError(w, http.StatusServiceUnavailable, constants.ErrServiceUnavailable)
+		return
+	}
+	var pending secondFactorChallenge
+	if err := stdjson.Unmarshal(raw, &pending); err != nil {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrInvalidMFAToken)
+		return
+	}
+
+	// 2. The account may have changed in the meantime
+	acc, err := h.service.GetAccountByID(ctx, pending.AccountID)
+	if err != nil {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrInvalidMFAToken)
+		return
+	}
+	if err := middlewares.CheckAccountStatus(acc.Status); err != nil {
+		middlewares.WriteAccountStatusError(w, acc.Status)
+		return
+	}
+	rec, ok := h.enabledTOTP(ctx, w, acc.ID)
+	if !ok {
+		return
+	}
+	if rec == nil {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrInvalidMFAToken)
+		return
+	}
+
+	// 3. Check the second factor, then spend the token: one challenge, one login
+	method, ok := h.checkSecondFactor(ctx, w, acc, *rec, req.Code, req.RecoveryCode)
+	if !ok {
+		return
+	}
+	if n, err := h.cache.Del(ctx, key).Result(); err != nil || n == 0 {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrInvalidMFAToken)
+		return
+	}
+
+	// 4. Open the session with both factors on record
+	resp, err := h.signIn(r, acc, pending.DeviceName, pending.ClientType, append(pending.AMR, method)...)
+	if err != nil {
+		h.logger.Error("failed to sign in", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	h.logger.Info("user logged in with second factor", "account_id", acc.ID, "session_id", resp.SessionID, "method", method)
+	resp.Message = "Signed in"
+	json.Write(w, http.StatusOK, resp)
+}
+
+// challengeSecondFactor answers verify-otp with a second factor challenge when acc has
+// an authenticator app, carrying what the login proved so far. It returns true once
+// it has answered.
+func (h *handler) challengeSecondFactor(w http.ResponseWriter, r *http.Request, acc repo.Account, deviceName, clientType string, amr []string) bool {
+	ctx := r.Context()
+	rec, ok := h.enabledTOTP(ctx, w, acc.ID)
+	if !ok {
+		return true
+	}
+	if rec == nil {
+		return false
+	}
+
+	token, err := newSecondFactorToken()
+	if err != nil {
+		h.logger.Error("failed to generate mfa token", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return true
+	}
+	raw, _ := stdjson.Marshal(secondFactorChallenge{
+		AccountID:  acc.ID,
+		DeviceName: deviceName,
+		ClientType: clientType,
+		AMR:        amr,
+	})
+	if err := h.cache.Set(ctx, secondFactorKey(token), raw, secondFactorTTL).Err(); err != nil {
+		h.logger.Error("failed to store mfa challenge", "error", err)
+		json.WriteError(w, http.StatusServiceUnavailable, constants.ErrServiceUnavailable)
+		return true
+	}
+	// The phone OTP did its part; the challenge token stands in for it from here
+	h.clearAttempts(ctx, acc.Phone)
+
+	h.logger.Info("second factor required", "account_id", acc.ID)
+	json.Write(w, http.StatusOK, secondFactorRequiredResponse{
+		Message:   constants.MsgSecondFactorRequired,
+		Code:      constants.CodeSecondFactor,
+		MFAToken:  token,
+		Methods:   []string{auth.AMRTOTP, auth.AMRRecoveryCode},
+		ExpiresIn: int(secondFactorTTL.Seconds()),
+	})
+	return true
+}
+
+// enabledTOTP returns the account's confirmed authenticator app, or nil when it has
+// none. It returns false once it has answered with an error.
+func (h *handler) enabledTOTP(ctx context.Context, w http.ResponseWriter, accountID pgtype.UUID) (*repo.AccountTotp, bool) {
+	rec, err := h.service.GetTOTP(ctx, accountID)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, true
+	case err != nil:
+		h.logger.Error("failed to load totp", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return nil, false
+	case !rec.ConfirmedAt.Valid:
+		return nil, true
+	}
+	return &rec, true
+}
+
+// checkSecondFactor checks a code from acc's authenticator app, or a recovery code in
+// its place, and spends it. It returns the amr value for the method used, or false
+// once it has answered.
+func (h *handler) checkSecondFactor(ctx context.Context, w http.ResponseWriter, acc repo.Account, rec repo.AccountTotp, code, recoveryCode string) (string, bool) {
+	if recoveryCode != "" {
+		attempt, ok := h.reserveRecovery(ctx, w, acc.Phone)
+		if !ok {
+			return "", false
+		}
+		used, err := h.service.UseRecoveryCode(ctx, acc.ID, h.hashRecoveryCode(acc.ID, recoveryCode))
+		if err != nil {
+			h.logger.Error("failed to use recovery code", "error", err)
+			json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+			return "", false
+		}
+		if !used {
+			h.failRecovery(w, acc.Phone, attempt)
+			return "", false
+		}
+		h.cache.Del(ctx, recoveryAttemptsKey(acc.Phone))
+		return auth.AMRRecoveryCode, true
+	}
+
+	attempt, ok := h.reserveTOTP(ctx, w, acc.ID)
+	if !ok {
+		return "", false
+	}
+	secret, ok := h.openTOTPSecret(w, rec)
+	if !ok {
+		return "", false
+	}
+	step, valid := totp.Validate(secret, code, time.Now())
+	if valid {
+		// A code seen before is refused even while it is still current
+		used, err := h.service.UseTOTPStep(ctx, acc.ID, step)
+		if err != nil {
+			h.logger.Error("failed to use totp step", "error", err)
+			json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+			return "", false
+		}
+		valid = used
+	}
+	if !valid {
+		h.failTOTP(w, acc.ID, attempt)
+		return "", false
+	}
+	h.cache.Del(ctx, totpAttemptsKey(acc.ID))
+	return auth.AMRTOTP, true
+}
+
+// openTOTPSecret decrypts the stored secret, answering 500 when it can't.
+func (h *handler) openTOTPSecret(w http.ResponseWriter, rec repo.AccountTotp) ([]byte, bool) {
+	secret, err := h.secrets.Open(rec.Secret, rec.AccountID.Bytes[:])
+	if err != nil {
+		h.logger.Error("failed to open totp secret", "account_id", rec.AccountID, "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return nil, false
+	}
+	return secret, true
+}
+
+// reserveTOTP takes one of the account's authenticator attempts before a code is
+// checked, so parallel guesses can't slip in under the limit. It returns the
+// attempt's number, or false once it has answered.
+func (h *handler) reserveTOTP(ctx context.Context, w http.ResponseWriter, accountID pgtype.UUID) (int64, bool) {
+	attempt, err := h.takeAttempt(ctx, totpAttemptsKey(accountID), totpWindow)
+	if err != nil {
+		h.logger.Error("failed to record totp attempt", "error", err)
+		json.WriteError(w, http.StatusServiceUnavailable, constants.ErrServiceUnavailable)
+		return 0, false
+	}
+	if attempt > maxTOTPAttempts {
+		remaining, _ := h.lockRemaining(ctx, totpAttemptsKey(accountID))
+		h.writeRetryLater(w, remaining, constants.CodeTOTPLocked, constants.ErrTOTPLocked)
+		return 0, false
+	}
+	return attempt, true
+}
+
+// failTOTP answers a wrong authenticator code with 401, or 429 when it was the
+// last attempt.
+func (h *handler) failTOTP(w http.ResponseWriter, accountID pgtype.UUID, attempt int64) {
+	if attempt >= maxTOTPAttempts {
+		h.logger.Warn("totp attempts exhausted, authenticator locked", "account_id", accountID)
+		h.writeRetryLater(w, totpWindow, constants.CodeTOTPLocked, constants.ErrTOTPLocked)
+		return
+	}
+	h.logger.Warn("invalid totp attempt", "account_id", accountID, "attempts_remaining", maxTOTPAttempts-attempt)
+	json.WriteErrorCode(w, http.StatusUnauthorized, constants.CodeInvalidTOTP, constants.ErrInvalidTOTP)
+}
+
+// newSecondFactorToken returns an unguessable challenge token.
+func newSecondFactorToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
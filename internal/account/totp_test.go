@@ -0,0 +1,272 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/otp"
+	"github.com/yabeye/addis_verify_backend/pkg/totp"
+)
+
+func TestHandler_TOTP(t *testing.T) {
+	accID := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	sessionID := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+	phone, code, pepper := "+251911223344", "123456", "test-pepper"
+	account := repo.Account{ID: accID, Phone: phone, Status: repo.AccountStatusActive}
+	logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+	secrets, err := totp.NewCipher("test-key")
+	require.NoError(t, err)
+	secret := []byte("12345678901234567890")
+
+	setup := func(t *testing.T) (*handler, *mockService, *miniredis.Miniredis) {
+		mr := miniredis.RunT(t)
+		svc := new(mockService)
+		svc.On("GetAccountByID", mock.Anything, accID).Return(account, nil).Maybe()
+		h := &handler{
+			service: svc, logger: logger, validate: validator.New(), hashPepper: pepper, policy: otp.DefaultPolicy(),
+			cache: redis.NewClient(&redis.Options{Addr: mr.Addr()}), secrets: secrets,
+		}
+		return h, svc, mr
+	}
+	// enabled stores a confirmed authenticator app for the account
+	enabled := func(svc *mockService) {
+		sealed, err := secrets.Seal(secret, accID.Bytes[:])
+		require.NoError(t, err)
+		svc.On("GetTOTP", mock.Anything, accID).Return(repo.AccountTotp{
+			AccountID: accID, Secret: sealed, ConfirmedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+		}, nil)
+	}
+	// challenge stores a login waiting for its second factor and returns its token
+	challenge := func(mr *miniredis.Miniredis) string {
+		raw, _ := json.Marshal(secondFactorChallenge{AccountID: accID, DeviceName: "Pixel 8", ClientType: auth.ClientMobile, AMR: []string{auth.AMROTP}})
+		mr.Set(secondFactorKey("mfa-token"), string(raw))
+		return "mfa-token"
+	}
+	complete := func(h *handler, body map[string]string) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		h.CompleteTOTPLogin(w, httptest.NewRequest(http.MethodPost, "/accounts/auth/totp", bytes.NewBuffer(raw)))
+		return w
+	}
+	// signsIn expects a login carrying amr
+	signsIn := func(h *handler, svc *mockService, amr []string) {
+		authMgr := new(mockAuth)
+		svc.On("CreateSession", mock.Anything, mock.MatchedBy(func(p repo.CreateSessionParams) bool {
+			return assert.ObjectsAreEqual(amr, p.Amr) && p.DeviceName.String == "Pixel 8"
+		})).Return(repo.Session{ID: sessionID, AccountID: accID, ClientType: auth.ClientMobile, Amr: amr}, nil)
+		svc.On("SaveRefreshToken", mock.Anything, sessionID, pgtype.UUID{}, "jti", mock.Anything).Return(nil)
+		authMgr.On("GenerateTokenPair", mock.Anything).Return(&auth.TokenDetails{AccessToken: "at", RefreshToken: "rt", RefreshTokenID: "jti"}, nil)
+		h.auth = authMgr
+	}
+
+	t.Run("Enrolls a secret the app can import", func(t *testing.T) {
+		h, svc, _ := setup(t)
+		var sealed []byte
+		svc.On("EnrollTOTP", mock.Anything, accID, mock.MatchedBy(func(b []byte) bool { sealed = b; return true })).Return(true, nil)
+
+		w := httptest.NewRecorder()
+		h.EnrollTOTP(w, withSession(httptest.NewRequest(http.MethodPost, "/me/totp", nil), accID, sessionID))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp enrollTOTPResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Contains(t, resp.OTPAuthURI, "otpauth://totp/AddisVerify:")
+		assert.Equal(t, resp.OTPAuthURI, resp.QRPayload)
+
+		// Only the sealed secret reaches the database
+		opened, err := secrets.Open(sealed, accID.Bytes[:])
+		require.NoError(t, err)
+		assert.Equal(t, resp.Secret, totp.Encode(opened))
+	})
+
+	t.Run("Won't enroll over an enabled app", func(t *testing.T) {
+		h, svc, _ := setup(t)
+		svc.On("EnrollTOTP", mock.Anything, accID, mock.Anything).Return(false, nil)
+
+		w := httptest.NewRecorder()
+		h.EnrollTOTP(w, withSession(httptest.NewRequest(http.MethodPost, "/me/totp", nil), accID, sessionID))
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeTOTPEnabled)
+	})
+
+	t.Run("The first code turns the app on", func(t *testing.T) {
+		h, svc, mr := setup(t)
+		sealed, _ := secrets.Seal(secret, accID.Bytes[:])
+		svc.On("GetTOTP", mock.Anything, accID).Return(repo.AccountTotp{AccountID: accID, Secret: sealed}, nil)
+		step := totp.Step(time.Now())
+		svc.On("ConfirmTOTP", mock.Anything, accID, step).Return(true, nil)
+		svc.On("RecordSecurityEvent", mock.Anything, mock.MatchedBy(func(e repo.CreateSecurityEventParams) bool {
+			return e.EventType == EventTOTPEnabled
+		})).Return(nil)
+		mr.Set(totpAttemptsKey(accID), "2")
+
+		body, _ := json.Marshal(map[string]string{"code": totp.Code(secret, step)})
+		w := httptest.NewRecorder()
+		h.ConfirmTOTP(w, withSession(httptest.NewRequest(http.MethodPost, "/me/totp/confirm", bytes.NewBuffer(body)), accID, sessionID))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.False(t, mr.Exists(totpAttemptsKey(accID)))
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("Verify-otp asks for the second factor instead of signing in", func(t *testing.T) {
+		h, svc, mr := setup(t)
+		mr.Set("otp:"+phone, fmt.Sprintf("%x", sha256.Sum256([]byte(phone+code+pepper))))
+		svc.On("UpsertByPhone", mock.Anything, phone).Return(account, nil)
+		enabled(svc)
+
+		body, _ := json.Marshal(map[string]string{"phone": phone, "otp": code, "device_name": "Pixel 8"})
+		w := httptest.NewRecorder()
+		h.VerifyOTP(w, httptest.NewRequest(http.MethodPost, "/accounts/auth/verify", bytes.NewBuffer(body)))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var resp secondFactorRequiredResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, constants.CodeSecondFactor, resp.Code)
+		assert.NotEmpty(t, resp.MFAToken)
+		assert.NotContains(t, w.Body.String(), "access_token")
+		assert.False(t, mr.Exists("otp:"+phone))
+		assert.True(t, mr.Exists(secondFactorKey(resp.MFAToken)))
+		svc.AssertNotCalled(t, "CreateSession", mock.Anything, mock.Anything)
+	})
+
+	t.Run("A current code finishes the login once", func(t *testing.T) {
+		h, svc, mr := setup(t)
+		enabled(svc)
+		step := totp.Step(time.Now())
+		svc.On("UseTOTPStep", mock.Anything, accID, step).Return(true, nil).Once()
+		signsIn(h, svc, []string{auth.AMROTP, auth.AMRTOTP})
+		token := challenge(mr)
+
+		w := complete(h, map[string]string{"mfa_token": token, "code": totp.Code(secret, step)})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"access_token":"at"`)
+		assert.False(t, mr.Exists(secondFactorKey(token)))
+
+		// The token is spent
+		w = complete(h, map[string]string{"mfa_token": token, "code": totp.Code(secret, step)})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("A wrong code is refused and counted", func(t *testing.T) {
+		h, svc, mr := setup(t)
+		enabled(svc)
+		token := challenge(mr)
+
+		w := complete(h, map[string]string{"mfa_token": token, "code": "000000"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeInvalidTOTP)
+		assert.True(t, mr.Exists(totpAttemptsKey(accID)))
+		assert.True(t, mr.Exists(secondFactorKey(token)))
+	})
+
+	t.Run("A code already used is refused", func(t *testing.T) {
+		h, svc, mr := setup(t)
+		enabled(svc)
+		step := totp.Step(time.Now())
+		svc.On("UseTOTPStep", mock.Anything, accID, step).Return(false, nil)
+		token := challenge(mr)
+
+		w := complete(h, map[string]string{"mfa_token": token, "code": totp.Code(secret, step)})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeInvalidTOTP)
+		svc.AssertNotCalled(t, "CreateSession", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Locks after too many wrong codes", func(t *testing.T) {
+		h, svc, mr := setup(t)
+		enabled(svc)
+		mr.Set(totpAttemptsKey(accID), fmt.Sprint(maxTOTPAttempts))
+
+		w := complete(h, map[string]string{"mfa_token": challenge(mr), "code": totp.Code(secret, totp.Step(time.Now()))})
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Contains(t, w.Body.String(), constants.CodeTOTPLocked)
+		svc.AssertNotCalled(t, "UseTOTPStep", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Parallel guesses can't outrun the limit", func(t *testing.T) {
+		h, _, _ := setup(t)
+
+		var wg sync.WaitGroup
+		var granted atomic.Int32
+		for range 3 * maxTOTPAttempts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, ok := h.reserveTOTP(context.Background(), httptest.NewRecorder(), accID); ok {
+					granted.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.EqualValues(t, maxTOTPAttempts, granted.Load())
+	})
+
+	t.Run("A recovery code stands in for a lost app", func(t *testing.T) {
+		h, svc, mr := setup(t)
+		enabled(svc)
+		svc.On("UseRecoveryCode", mock.Anything, accID, h.hashRecoveryCode(accID, "k7m2p-x9qrt")).Return(true, nil)
+		signsIn(h, svc, []string{auth.AMROTP, auth.AMRRecoveryCode})
+
+		w := complete(h, map[string]string{"mfa_token": challenge(mr), "recovery_code": "K7M2P-X9QRT"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("An unknown token is refused", func(t *testing.T) {
+		h, _, _ := setup(t)
+
+		w := complete(h, map[string]string{"mfa_token": "nope", "code": "123456"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), constants.ErrInvalidMFAToken)
+	})
+
+	t.Run("Turning the app off needs a current code", func(t *testing.T) {
+		h, svc, _ := setup(t)
+		enabled(svc)
+		step := totp.Step(time.Now())
+		svc.On("UseTOTPStep", mock.Anything, accID, step).Return(true, nil)
+		svc.On("DisableTOTP", mock.Anything, accID).Return(true, nil)
+		svc.On("RecordSecurityEvent", mock.Anything, mock.MatchedBy(func(e repo.CreateSecurityEventParams) bool {
+			return e.EventType == EventTOTPDisabled
+		})).Return(nil)
+
+		body, _ := json.Marshal(map[string]string{"code": totp.Code(secret, step)})
+		w := httptest.NewRecorder()
+		h.DisableTOTP(w, withSession(httptest.NewRequest(http.MethodDelete, "/me/totp", bytes.NewBuffer(body)), accID, sessionID))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		svc.AssertExpectations(t)
+	})
+
+	t.Run("Nothing to turn off without an app", func(t *testing.T) {
+		h, svc, _ := setup(t)
+		svc.On("GetTOTP", mock.Anything, accID).Return(repo.AccountTotp{}, pgx.ErrNoRows)
+
+		body, _ := json.Marshal(map[string]string{"code": "123456"})
+		w := httptest.NewRecorder()
+		h.DisableTOTP(w, withSession(httptest.NewRequest(http.MethodDelete, "/me/totp", bytes.NewBuffer(body)), accID, sessionID))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		svc.AssertNotCalled(t, "DisableTOTP", mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,246 @@
+// Package challenge makes risky clients prove they are worth an SMS before send-otp
+// goes through.
+//
+// Challenges are stateless: the token handed to the client is signed and carries
+// its own type, phone, difficulty and expiry. Only redemption touches Redis, to
+// make each token single-use. Two kinds exist:
+//
+//   - pow: a hashcash-style puzzle. The client finds a nonce such that
+//     SHA-256(token + ":" + nonce) starts with Difficulty zero bits (see Solve).
+//   - captcha: the client shows a CAPTCHA widget with SiteKey and sends back the
+//     widget's response, which is checked by a Verifier.
+package challenge
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Kinds of challenge.
+const (
+	KindPoW     = "pow"
+	KindCaptcha = "captcha"
+)
+
+const tokenVersion = "v1"
+
+var (
+	// ErrInvalid is returned for tampered, malformed or foreign tokens and wrong answers.
+	ErrInvalid = errors.New("challenge: invalid solution")
+	// ErrExpired is returned for tokens past their expiry.
+	ErrExpired = errors.New("challenge: expired")
+	// ErrReplayed is returned when a token has already been redeemed.
+	ErrReplayed = errors.New("challenge: already used")
+)
+
+// Config selects the challenge kind and its parameters.
+type Config struct {
+	// Secret signs tokens. It must be shared by every API instance and kept private:
+	// whoever holds it can sign solved challenges.
+	Secret []byte
+	Kind   string
+	// Difficulty is the number of leading zero bits a PoW hash needs (default 20,
+	// about a second on a mid-range phone).
+	Difficulty int
+	// TTL is how long a challenge may be solved for (default 2m).
+	TTL time.Duration
+	// SiteKey is the public CAPTCHA key the client renders the widget with.
+	SiteKey string
+}
+
+// Challenge is sent to the client.
+type Challenge struct {
+	Type       string `json:"type" example:"pow"`
+	Token      string `json:"token"`
+	Difficulty int    `json:"difficulty,omitempty" example:"20"`
+	SiteKey    string `json:"site_key,omitempty"`
+	ExpiresIn  int    `json:"expires_in" example:"120"`
+}
+
+// Solution is the client's answer to a Challenge.
+type Solution struct {
+	Token string `json:"token"`
+	// Nonce answers a pow challenge.
+	Nonce string `json:"nonce,omitempty"`
+	// Response is the CAPTCHA widget's response for a captcha challenge.
+	Response string `json:"response,omitempty"`
+}
+
+// claims is the signed content of a token.
+type claims struct {
+	Type       string `json:"t"`
+	Phone      string `json:"p"`
+	ID         string `json:"n"`
+	Difficulty int    `json:"d,omitempty"`
+	Expiry     int64  `json:"e"`
+}
+
+// Issuer creates and redeems challenges.
+type Issuer struct {
+	rdb      redis.Cmdable
+	cfg      Config
+	verifier Verifier
+	now      func() time.Time
+}
+
+// NewIssuer creates an issuer. verifier is only used for captcha challenges.
+func NewIssuer(rdb redis.Cmdable, cfg Config, verifier Verifier) (*Issuer, error) {
+	if len(cfg.Secret) == 0 {
+		return nil, errors.New("challenge: secret is required")
+	}
+	if len(cfg.Secret) < 32 {
+		return nil, errors.New("challenge: secret must be at least 32 bytes")
+	}
+	switch cfg.Kind {
+	case KindPoW:
+	case KindCaptcha:
+		if verifier == nil {
+			return nil, errors.New("challenge: captcha needs a verifier")
+		}
+	default:
+		return nil, errors.New("challenge: unknown kind " + strconv.Quote(cfg.Kind))
+	}
+	if cfg.Difficulty <= 0 {
+		cfg.Difficulty = 20
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 2 * time.Minute
+	}
+	return &Issuer{rdb: rdb, cfg: cfg, verifier: verifier, now: time.Now}, nil
+}
+
+func usedKey(id string) string { return "challenge:used:" + id }
+
+// Issue creates a challenge scoped to phone.
+func (i *Issuer) Issue(phone string) (Challenge, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Challenge{}, err
+	}
+
+	c := claims{
+		Type:   i.cfg.Kind,
+		Phone:  phone,
+		ID:     base64.RawURLEncoding.EncodeToString(id),
+		Expiry: i.now().Add(i.cfg.TTL).Unix(),
+	}
+	out := Challenge{Type: i.cfg.Kind, ExpiresIn: int(i.cfg.TTL.Seconds())}
+	if c.Type == KindPoW {
+		c.Difficulty = i.cfg.Difficulty
+		out.Difficulty = i.cfg.Difficulty
+	} else {
+		out.SiteKey = i.cfg.SiteKey
+	}
+
+	payload, _ := json.Marshal(c)
+	body := tokenVersion + "." + base64.RawURLEncoding.EncodeToString(payload)
+	out.Token = body + "." + base64.RawURLEncoding.EncodeToString(i.sign(body))
+	return out, nil
+}
+
+// Redeem checks sol against phone and burns its token. remoteIP is passed to the CAPTCHA verifier.
+func (i *Issuer) Redeem(ctx context.Context, phone string, sol Solution, remoteIP string) error {
+	c, err := i.parse(sol.Token)
+	if err != nil {
+		return err
+	}
+	if c.Phone != phone {
+		return ErrInvalid
+	}
+	expiry := time.Unix(c.Expiry, 0)
+	if !i.now().Before(expiry) {
+		return ErrExpired
+	}
+
+	switch c.Type {
+	case KindPoW:
+		if sol.Nonce == "" || leadingZeroBits(sol.Token, sol.Nonce) < c.Difficulty {
+			return ErrInvalid
+		}
+	case KindCaptcha:
+		if i.verifier == nil || sol.Response == "" {
+			return ErrInvalid
+		}
+		ok, err := i.verifier.Verify(ctx, sol.Response, remoteIP)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalid
+		}
+	default:
+		return ErrInvalid
+	}
+
+	// Burn the token last, so a wrong answer can be retried until it expires
+	fresh, err := i.rdb.SetNX(ctx, usedKey(c.ID), 1, time.Until(expiry)+time.Minute).Result()
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrReplayed
+	}
+	return nil
+}
+
+func (i *Issuer) parse(token string) (claims, error) {
+	version, rest, ok := strings.Cut(token, ".")
+	payload, sig, ok2 := strings.Cut(rest, ".")
+	if !ok || !ok2 || version != tokenVersion {
+		return claims{}, ErrInvalid
+	}
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotSig, i.sign(version+"."+payload)) {
+		return claims{}, ErrInvalid
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return claims{}, ErrInvalid
+	}
+	var c claims
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return claims{}, ErrInvalid
+	}
+	return c, nil
+}
+
+func (i *Issuer) sign(body string) []byte {
+	mac := hmac.New(sha256.New, i.cfg.Secret)
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
+
+// Solve brute-forces a pow challenge. It is the reference for client implementations
+// and is used in tests; the server never calls it.
+func Solve(token string, difficulty int) string {
+	for n := 0; ; n++ {
+		nonce := strconv.Itoa(n)
+		if leadingZeroBits(token, nonce) >= difficulty {
+			return nonce
+		}
+	}
+}
+
+// leadingZeroBits counts the zero bits at the start of SHA-256(token + ":" + nonce).
+func leadingZeroBits(token, nonce string) int {
+	sum := sha256.Sum256([]byte(token + ":" + nonce))
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
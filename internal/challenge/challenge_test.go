@@ -0,0 +1,112 @@
+package challenge
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+const phone = "+251911223344"
+
+func newTestIssuer(t *testing.T, cfg Config, v Verifier) *Issuer {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	cfg.Secret = secret
+	i, err := NewIssuer(redis.NewClient(&redis.Options{Addr: mr.Addr()}), cfg, v)
+	require.NoError(t, err)
+	return i
+}
+
+func TestProofOfWork(t *testing.T) {
+	i := newTestIssuer(t, Config{Kind: KindPoW, Difficulty: 8}, nil)
+	ctx := context.Background()
+
+	c, err := i.Issue(phone)
+	require.NoError(t, err)
+	assert.Equal(t, KindPoW, c.Type)
+	assert.Equal(t, 8, c.Difficulty)
+
+	nonce := Solve(c.Token, c.Difficulty)
+
+	// Bound to the phone it was issued for
+	assert.ErrorIs(t, i.Redeem(ctx, "+251911000000", Solution{Token: c.Token, Nonce: nonce}, ""), ErrInvalid)
+
+	// A wrong answer doesn't burn the token
+	wrong := nonce + "x"
+	if leadingZeroBits(c.Token, wrong) < 8 {
+		assert.ErrorIs(t, i.Redeem(ctx, phone, Solution{Token: c.Token, Nonce: wrong}, ""), ErrInvalid)
+	}
+
+	require.NoError(t, i.Redeem(ctx, phone, Solution{Token: c.Token, Nonce: nonce}, ""))
+	assert.ErrorIs(t, i.Redeem(ctx, phone, Solution{Token: c.Token, Nonce: nonce}, ""), ErrReplayed)
+}
+
+func TestRedeem_RejectsTamperedAndExpired(t *testing.T) {
+	i := newTestIssuer(t, Config{Kind: KindPoW, Difficulty: 1, TTL: time.Minute}, nil)
+	ctx := context.Background()
+
+	c, _ := i.Issue(phone)
+	parts := strings.Split(c.Token, ".")
+	forged := parts[0] + "." + parts[1] + "A." + parts[2]
+	assert.ErrorIs(t, i.Redeem(ctx, phone, Solution{Token: forged, Nonce: Solve(forged, 1)}, ""), ErrInvalid)
+	assert.ErrorIs(t, i.Redeem(ctx, phone, Solution{Token: "garbage", Nonce: "1"}, ""), ErrInvalid)
+
+	i.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	assert.ErrorIs(t, i.Redeem(ctx, phone, Solution{Token: c.Token, Nonce: Solve(c.Token, 1)}, ""), ErrExpired)
+}
+
+func TestCaptcha(t *testing.T) {
+	i := newTestIssuer(t, Config{Kind: KindCaptcha, SiteKey: "site"}, FakeVerifier{Pass: "ok"})
+	ctx := context.Background()
+
+	c, err := i.Issue(phone)
+	require.NoError(t, err)
+	assert.Equal(t, "site", c.SiteKey)
+	assert.Zero(t, c.Difficulty)
+
+	assert.ErrorIs(t, i.Redeem(ctx, phone, Solution{Token: c.Token, Response: "bot"}, ""), ErrInvalid)
+	assert.NoError(t, i.Redeem(ctx, phone, Solution{Token: c.Token, Response: "ok"}, ""))
+}
+
+func TestSiteVerifier(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "shh", r.PostForm.Get("secret"))
+		assert.Equal(t, "10.0.0.1", r.PostForm.Get("remoteip"))
+		if r.PostForm.Get("response") == "human" {
+			w.Write([]byte(`{"success":true}`))
+			return
+		}
+		w.Write([]byte(`{"success":false,"error-codes":["invalid-input-response"]}`))
+	}))
+	defer srv.Close()
+
+	v := NewSiteVerifier(srv.URL, "shh", time.Second)
+	ok, err := v.Verify(context.Background(), "human", "10.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = v.Verify(context.Background(), "bot", "10.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestNewIssuer_Validates(t *testing.T) {
+	_, err := NewIssuer(nil, Config{Kind: KindPoW}, nil)
+	assert.EqualError(t, err, "challenge: secret is required")
+	_, err = NewIssuer(nil, Config{Kind: KindPoW, Secret: []byte("short")}, nil)
+	assert.Error(t, err)
+	_, err = NewIssuer(nil, Config{Kind: KindCaptcha, Secret: secret}, nil)
+	assert.Error(t, err)
+	_, err = NewIssuer(nil, Config{Kind: "riddle", Secret: secret}, nil)
+	assert.Error(t, err)
+}
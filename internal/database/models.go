@@ -55,13 +55,69 @@ func (ns NullAccountStatus) Value() (driver.Value, error) {
 	return string(ns.AccountStatus), nil
 }
 
+type MessageStatus string
+
+const (
+	MessageStatusQueued    MessageStatus = "queued"
+	MessageStatusSent      MessageStatus = "sent"
+	MessageStatusDelivered MessageStatus = "delivered"
+	MessageStatusFailed    MessageStatus = "failed"
+)
+
+func (e *MessageStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = MessageStatus(s)
+	case string:
+		*e = MessageStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for MessageStatus: %T", src)
+	}
+	return nil
+}
+
+type NullMessageStatus struct {
+	MessageStatus MessageStatus `json:"message_status"`
+	Valid         bool          `json:"valid"` // Valid is true if MessageStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullMessageStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.MessageStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.MessageStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullMessageStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.MessageStatus), nil
+}
+
 type Account struct {
-	ID             pgtype.UUID        `json:"id"`
-	Phone          string             `json:"phone"`
-	Status         AccountStatus      `json:"status"`
-	TokenValidFrom pgtype.Timestamptz `json:"token_valid_from"`
-	CreatedAt      pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+	ID                pgtype.UUID        `json:"id"`
+	Phone             string             `json:"phone"`
+	Status            AccountStatus      `json:"status"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+	PreferredLanguage pgtype.Text        `json:"preferred_language"`
+	DeletedAt         pgtype.Timestamptz `json:"deleted_at"`
+	RestoreUntil      pgtype.Timestamptz `json:"restore_until"`
+	PurgedAt          pgtype.Timestamptz `json:"purged_at"`
+	PhoneBoundAt      pgtype.Timestamptz `json:"phone_bound_at"`
+}
+
+type AccountTotp struct {
+	AccountID    pgtype.UUID        `json:"account_id"`
+	Secret       []byte             `json:"secret"`
+	ConfirmedAt  pgtype.Timestamptz `json:"confirmed_at"`
+	LastUsedStep int64              `json:"last_used_step"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
 }
 
 type Address struct {
@@ -77,6 +133,77 @@ type Address struct {
 	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
 }
 
+type Message struct {
+	ID                pgtype.UUID        `json:"id"`
+	Phone             string             `json:"phone"`
+	Status            MessageStatus      `json:"status"`
+	Attempts          int32              `json:"attempts"`
+	Provider          pgtype.Text        `json:"provider"`
+	ProviderMessageID pgtype.Text        `json:"provider_message_id"`
+	ErrorCode         pgtype.Text        `json:"error_code"`
+	LastError         pgtype.Text        `json:"last_error"`
+	QueuedAt          pgtype.Timestamptz `json:"queued_at"`
+	SentAt            pgtype.Timestamptz `json:"sent_at"`
+	DeliveredAt       pgtype.Timestamptz `json:"delivered_at"`
+	FailedAt          pgtype.Timestamptz `json:"failed_at"`
+	UpdatedAt         pgtype.Timestamptz `json:"updated_at"`
+	Encoding          pgtype.Text        `json:"encoding"`
+	Segments          int32              `json:"segments"`
+	Channel           string             `json:"channel"`
+}
+
+type OauthClient struct {
+	ID           string             `json:"id"`
+	Name         string             `json:"name"`
+	SecretHash   pgtype.Text        `json:"secret_hash"`
+	RedirectUris []string           `json:"redirect_uris"`
+	Scopes       []string           `json:"scopes"`
+	LogoUri      pgtype.Text        `json:"logo_uri"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+}
+
+type RecoveryCode struct {
+	ID        pgtype.UUID        `json:"id"`
+	AccountID pgtype.UUID        `json:"account_id"`
+	CodeHash  string             `json:"code_hash"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type RefreshToken struct {
+	ID        pgtype.UUID        `json:"id"`
+	SessionID pgtype.UUID        `json:"session_id"`
+	ParentID  pgtype.UUID        `json:"parent_id"`
+	IssuedAt  pgtype.Timestamptz `json:"issued_at"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+}
+
+type SecurityEvent struct {
+	ID        pgtype.UUID        `json:"id"`
+	AccountID pgtype.UUID        `json:"account_id"`
+	SessionID pgtype.UUID        `json:"session_id"`
+	EventType string             `json:"event_type"`
+	IpAddress pgtype.Text        `json:"ip_address"`
+	UserAgent pgtype.Text        `json:"user_agent"`
+	Details   []byte             `json:"details"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type Session struct {
+	ID             pgtype.UUID        `json:"id"`
+	AccountID      pgtype.UUID        `json:"account_id"`
+	DeviceName     pgtype.Text        `json:"device_name"`
+	UserAgent      pgtype.Text        `json:"user_agent"`
+	IpAddress      pgtype.Text        `json:"ip_address"`
+	TokenValidFrom pgtype.Timestamptz `json:"token_valid_from"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	LastSeenAt     pgtype.Timestamptz `json:"last_seen_at"`
+	RevokedAt      pgtype.Timestamptz `json:"revoked_at"`
+	ClientType     string             `json:"client_type"`
+	Amr            []string           `json:"amr"`
+}
+
 type User struct {
 	ID                pgtype.UUID        `json:"id"`
 	AccountID         pgtype.UUID        `json:"account_id"`
@@ -11,24 +11,111 @@ import (
 )
 
 type Querier interface {
+	// Receipts can arrive late or out of order: a final state is never downgraded,
+	// except that carriers sometimes deliver after reporting a failure.
+	ApplyDeliveryReport(ctx context.Context, arg ApplyDeliveryReportParams) (int64, error)
+	// Moves an active account to a new login phone. Zero rows means the account is no
+	// longer active or its phone changed since it was verified.
+	ChangeAccountPhone(ctx context.Context, arg ChangeAccountPhoneParams) (int64, error)
+	// Spends a recovery code to show the holder of a number that changed hands still
+	// owns the account. Zero rows means the code is wrong or spent.
+	ConfirmPhoneOwner(ctx context.Context, arg ConfirmPhoneOwnerParams) (int64, error)
+	// Turns the authenticator on once the first code checks out.
+	ConfirmTOTP(ctx context.Context, arg ConfirmTOTPParams) (int64, error)
+	CountUnusedRecoveryCodes(ctx context.Context, accountID pgtype.UUID) (int64, error)
+	//**** MESSAGES ****
+	// Records a message as soon as it is put on the delivery outbox.
+	CreateMessage(ctx context.Context, arg CreateMessageParams) error
+	//**** OAUTH CLIENTS ****
+	// Registers an OpenID Connect relying party.
+	CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OauthClient, error)
+	//**** REFRESH TOKENS ****
+	// Remembers a refresh token's jti so its reuse can be detected.
+	CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) error
+	CreateSecurityEvent(ctx context.Context, arg CreateSecurityEventParams) error
+	//**** SESSIONS ****
+	// Opens a session for a device after a successful OTP login.
+	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
+	// The holder deletes their own account; it can be restored until 'restore_until'.
+	DeleteAccount(ctx context.Context, arg DeleteAccountParams) (int64, error)
+	DeleteAccountTOTP(ctx context.Context, accountID pgtype.UUID) (int64, error)
+	//**** RECOVERY CODES ****
+	// Issues an account's first codes. Zero rows means it already has some.
+	EnrollRecoveryCodes(ctx context.Context, arg EnrollRecoveryCodesParams) (int64, error)
+	//**** TOTP ****
+	// Starts (or restarts) enrollment with a new sealed secret. Zero rows means the
+	// account already has a confirmed authenticator.
+	EnrollTOTP(ctx context.Context, arg EnrollTOTPParams) (int64, error)
 	GetAccountByID(ctx context.Context, id pgtype.UUID) (Account, error)
 	GetAccountByPhone(ctx context.Context, phone string) (Account, error)
+	// Checked on every authenticated request, so it reads only the status.
+	GetAccountStatus(ctx context.Context, id pgtype.UUID) (AccountStatus, error)
+	GetAccountTOTP(ctx context.Context, accountID pgtype.UUID) (AccountTotp, error)
+	GetAddressByAccountID(ctx context.Context, accountID pgtype.UUID) (Address, error)
+	GetMessageByID(ctx context.Context, id pgtype.UUID) (Message, error)
+	GetOAuthClient(ctx context.Context, id string) (OauthClient, error)
+	GetRefreshToken(ctx context.Context, id pgtype.UUID) (RefreshToken, error)
+	GetSession(ctx context.Context, id pgtype.UUID) (Session, error)
+	GetUserByAccountID(ctx context.Context, accountID pgtype.UUID) (User, error)
 	//**** USERS & ADDRESS ****
 	// Retrieves the full user profile along with their primary address via JOIN.
 	GetUserWithAddressByAccountID(ctx context.Context, accountID pgtype.UUID) (GetUserWithAddressByAccountIDRow, error)
+	// Sessions that can still refresh: without a live refresh token they are as good as gone.
+	ListActiveSessions(ctx context.Context, accountID pgtype.UUID) ([]Session, error)
+	// Newest first, for support staff answering "I never got my code".
+	ListMessagesByPhone(ctx context.Context, arg ListMessagesByPhoneParams) ([]Message, error)
+	ListOAuthClients(ctx context.Context) ([]OauthClient, error)
+	// Deleted accounts not purged yet that were deleted before the cutoff, oldest first.
+	ListPurgeableAccounts(ctx context.Context, arg ListPurgeableAccountsParams) ([]pgtype.UUID, error)
+	ListSecurityEvents(ctx context.Context, accountID pgtype.UUID) ([]SecurityEvent, error)
+	// Every session the account ever had, signed out or not, for data exports.
+	ListSessionsByAccount(ctx context.Context, accountID pgtype.UUID) ([]Session, error)
+	// A provider accepted the message; receipts are matched on provider + provider_message_id.
+	MarkMessageSent(ctx context.Context, arg MarkMessageSentParams) error
+	// Erases everything that identifies the holder of a deleted account in one
+	// statement. The account row stays behind as an anonymized tombstone.
+	PurgeAccount(ctx context.Context, id pgtype.UUID) (int64, error)
+	// A send failed. Status only changes to 'failed' when the outbox gives up.
+	RecordMessageAttempt(ctx context.Context, arg RecordMessageAttemptParams) error
+	// Spends a recovery code and moves the account to a new phone in one statement.
+	// Zero rows means the code is wrong or spent, or the account is not active.
+	RecoverAccount(ctx context.Context, arg RecoverAccountParams) (int64, error)
+	// Regenerating voids every earlier code, used or not.
+	ReplaceRecoveryCodes(ctx context.Context, arg ReplaceRecoveryCodesParams) error
+	// Undoes a self-service deletion while the restore window is open.
+	RestoreAccount(ctx context.Context, id pgtype.UUID) (int64, error)
+	// Signs out every device, optionally keeping one (the caller's own).
+	RevokeAllSessions(ctx context.Context, arg RevokeAllSessionsParams) (int64, error)
+	RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error)
+	// Moves 'token_valid_from' forward on refresh so the spent refresh token stops working.
+	RotateSession(ctx context.Context, arg RotateSessionParams) (Session, error)
+	// Records activity at most once a minute so authenticated requests rarely write.
+	TouchSession(ctx context.Context, arg TouchSessionParams) error
+	// Moves an account along the status state machine. Zero rows means it was no
+	// longer in 'from_status' (someone else changed it first).
+	// Moving to 'deleted' starts the purge clock; no restore window is offered.
+	TransitionAccountStatus(ctx context.Context, arg TransitionAccountStatusParams) (int64, error)
+	// Sets the language OTP and notification SMS are sent in.
+	UpdateAccountLanguage(ctx context.Context, arg UpdateAccountLanguageParams) error
 	// This is for administrative or system changes.
-	// It does NOT touch token_valid_from, so the user stays logged in.
+	// It does NOT touch sessions, so the user stays logged in.
 	UpdateAccountStatus(ctx context.Context, arg UpdateAccountStatusParams) error
 	// Specifically for updating document or profile images.
 	UpdateUserImages(ctx context.Context, arg UpdateUserImagesParams) error
 	//**** ACCOUNTS ****
 	// This is used ONLY during the VerifyOTP flow.
-	// It moves the 'token_valid_from' forward to invalidate old sessions.
+	// Sessions are separate rows, so logging in leaves other devices signed in.
 	UpsertAccount(ctx context.Context, phone string) (Account, error)
 	// Creates or updates the address linked to an account.
 	UpsertAddress(ctx context.Context, arg UpsertAddressParams) (Address, error)
 	// Creates or updates the user profile linked to an account.
 	UpsertUser(ctx context.Context, arg UpsertUserParams) (User, error)
+	// Spends a recovery code in place of another factor. Zero rows means it is wrong or spent.
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error)
+	// Spends a refresh token. Zero rows means it is unknown, expired or already used.
+	UseRefreshToken(ctx context.Context, arg UseRefreshTokenParams) (int64, error)
+	// Accepts a code's time step once. Zero rows means it, or a later one, was already used.
+	UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -11,8 +11,359 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const applyDeliveryReport = `-- name: ApplyDeliveryReport :execrows
+UPDATE messages
+SET
+    status = $3,
+    error_code = $4,
+    delivered_at = CASE WHEN $3 = 'delivered'::message_status THEN $5 ELSE delivered_at END,
+    failed_at = CASE WHEN $3 = 'failed'::message_status THEN $5 ELSE failed_at END,
+    updated_at = CURRENT_TIMESTAMP
+WHERE provider = $1 AND provider_message_id = $2
+  AND (status IN ('queued', 'sent') OR (status = 'failed' AND $3 = 'delivered'::message_status))
+`
+
+type ApplyDeliveryReportParams struct {
+	Provider          pgtype.Text        `json:"provider"`
+	ProviderMessageID pgtype.Text        `json:"provider_message_id"`
+	Status            MessageStatus      `json:"status"`
+	ErrorCode         pgtype.Text        `json:"error_code"`
+	DeliveredAt       pgtype.Timestamptz `json:"delivered_at"`
+}
+
+// Receipts can arrive late or out of order: a final state is never downgraded,
+// except that carriers sometimes deliver after reporting a failure.
+func (q *Queries) ApplyDeliveryReport(ctx context.Context, arg ApplyDeliveryReportParams) (int64, error) {
+	result, err := q.db.Exec(ctx, applyDeliveryReport,
+		arg.Provider,
+		arg.ProviderMessageID,
+		arg.Status,
+		arg.ErrorCode,
+		arg.DeliveredAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const changeAccountPhone = `-- name: ChangeAccountPhone :execrows
+UPDATE accounts
+SET phone = $1, phone_bound_at = NOW(), updated_at = CURRENT_TIMESTAMP
+WHERE id = $2 AND phone = $3 AND status = 'active'
+`
+
+type ChangeAccountPhoneParams struct {
+	NewPhone string      `json:"new_phone"`
+	ID       pgtype.UUID `json:"id"`
+	OldPhone string      `json:"old_phone"`
+}
+
+// Moves an active account to a new login phone. Zero rows means the account is no
+// longer active or its phone changed since it was verified.
+func (q *Queries) ChangeAccountPhone(ctx context.Context, arg ChangeAccountPhoneParams) (int64, error) {
+	result, err := q.db.Exec(ctx, changeAccountPhone, arg.NewPhone, arg.ID, arg.OldPhone)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const confirmPhoneOwner = `-- name: ConfirmPhoneOwner :execrows
+WITH spent AS (
+    UPDATE recovery_codes SET used_at = NOW()
+    WHERE account_id = $1 AND code_hash = $2 AND used_at IS NULL
+    RETURNING account_id
+)
+UPDATE accounts
+SET phone_bound_at = NOW(), updated_at = CURRENT_TIMESTAMP
+WHERE id IN (SELECT account_id FROM spent)
+`
+
+type ConfirmPhoneOwnerParams struct {
+	ID       pgtype.UUID `json:"id"`
+	CodeHash string      `json:"code_hash"`
+}
+
+// Spends a recovery code to show the holder of a number that changed hands still
+// owns the account. Zero rows means the code is wrong or spent.
+func (q *Queries) ConfirmPhoneOwner(ctx context.Context, arg ConfirmPhoneOwnerParams) (int64, error) {
+	result, err := q.db.Exec(ctx, confirmPhoneOwner, arg.ID, arg.CodeHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const confirmTOTP = `-- name: ConfirmTOTP :execrows
+UPDATE account_totp SET confirmed_at = NOW(), last_used_step = $1
+WHERE account_id = $2 AND confirmed_at IS NULL
+`
+
+type ConfirmTOTPParams struct {
+	Step      int64       `json:"step"`
+	AccountID pgtype.UUID `json:"account_id"`
+}
+
+// Turns the authenticator on once the first code checks out.
+func (q *Queries) ConfirmTOTP(ctx context.Context, arg ConfirmTOTPParams) (int64, error) {
+	result, err := q.db.Exec(ctx, confirmTOTP, arg.Step, arg.AccountID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const countUnusedRecoveryCodes = `-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*) FROM recovery_codes WHERE account_id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) CountUnusedRecoveryCodes(ctx context.Context, accountID pgtype.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countUnusedRecoveryCodes, accountID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createMessage = `-- name: CreateMessage :exec
+
+INSERT INTO messages (id, phone, channel, encoding, segments) VALUES ($1, $2, $3, $4, $5)
+`
+
+type CreateMessageParams struct {
+	ID       pgtype.UUID `json:"id"`
+	Phone    string      `json:"phone"`
+	Channel  string      `json:"channel"`
+	Encoding pgtype.Text `json:"encoding"`
+	Segments int32       `json:"segments"`
+}
+
+// **** MESSAGES ****
+// Records a message as soon as it is put on the delivery outbox.
+func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) error {
+	_, err := q.db.Exec(ctx, createMessage,
+		arg.ID,
+		arg.Phone,
+		arg.Channel,
+		arg.Encoding,
+		arg.Segments,
+	)
+	return err
+}
+
+const createOAuthClient = `-- name: CreateOAuthClient :one
+
+INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, scopes, logo_uri)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, name, secret_hash, redirect_uris, scopes, logo_uri, created_at
+`
+
+type CreateOAuthClientParams struct {
+	ID           string      `json:"id"`
+	Name         string      `json:"name"`
+	SecretHash   pgtype.Text `json:"secret_hash"`
+	RedirectUris []string    `json:"redirect_uris"`
+	Scopes       []string    `json:"scopes"`
+	LogoUri      pgtype.Text `json:"logo_uri"`
+}
+
+// **** OAUTH CLIENTS ****
+// Registers an OpenID Connect relying party.
+func (q *Queries) CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OauthClient, error) {
+	row := q.db.QueryRow(ctx, createOAuthClient,
+		arg.ID,
+		arg.Name,
+		arg.SecretHash,
+		arg.RedirectUris,
+		arg.Scopes,
+		arg.LogoUri,
+	)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.SecretHash,
+		&i.RedirectUris,
+		&i.Scopes,
+		&i.LogoUri,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createRefreshToken = `-- name: CreateRefreshToken :exec
+
+INSERT INTO refresh_tokens (id, session_id, parent_id, expires_at) VALUES ($1, $2, $3, $4)
+`
+
+type CreateRefreshTokenParams struct {
+	ID        pgtype.UUID        `json:"id"`
+	SessionID pgtype.UUID        `json:"session_id"`
+	ParentID  pgtype.UUID        `json:"parent_id"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+// **** REFRESH TOKENS ****
+// Remembers a refresh token's jti so its reuse can be detected.
+func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) error {
+	_, err := q.db.Exec(ctx, createRefreshToken,
+		arg.ID,
+		arg.SessionID,
+		arg.ParentID,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createSecurityEvent = `-- name: CreateSecurityEvent :exec
+INSERT INTO security_events (account_id, session_id, event_type, ip_address, user_agent, details)
+VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+type CreateSecurityEventParams struct {
+	AccountID pgtype.UUID `json:"account_id"`
+	SessionID pgtype.UUID `json:"session_id"`
+	EventType string      `json:"event_type"`
+	IpAddress pgtype.Text `json:"ip_address"`
+	UserAgent pgtype.Text `json:"user_agent"`
+	Details   []byte      `json:"details"`
+}
+
+func (q *Queries) CreateSecurityEvent(ctx context.Context, arg CreateSecurityEventParams) error {
+	_, err := q.db.Exec(ctx, createSecurityEvent,
+		arg.AccountID,
+		arg.SessionID,
+		arg.EventType,
+		arg.IpAddress,
+		arg.UserAgent,
+		arg.Details,
+	)
+	return err
+}
+
+const createSession = `-- name: CreateSession :one
+
+INSERT INTO sessions (account_id, device_name, user_agent, ip_address, client_type, amr)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, account_id, device_name, user_agent, ip_address, token_valid_from, created_at, last_seen_at, revoked_at, client_type, amr
+`
+
+type CreateSessionParams struct {
+	AccountID  pgtype.UUID `json:"account_id"`
+	DeviceName pgtype.Text `json:"device_name"`
+	UserAgent  pgtype.Text `json:"user_agent"`
+	IpAddress  pgtype.Text `json:"ip_address"`
+	ClientType string      `json:"client_type"`
+	Amr        []string    `json:"amr"`
+}
+
+// **** SESSIONS ****
+// Opens a session for a device after a successful OTP login.
+func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error) {
+	row := q.db.QueryRow(ctx, createSession,
+		arg.AccountID,
+		arg.DeviceName,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.ClientType,
+		arg.Amr,
+	)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.AccountID,
+		&i.DeviceName,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.TokenValidFrom,
+		&i.CreatedAt,
+		&i.LastSeenAt,
+		&i.RevokedAt,
+		&i.ClientType,
+		&i.Amr,
+	)
+	return i, err
+}
+
+const deleteAccount = `-- name: DeleteAccount :execrows
+UPDATE accounts
+SET status = 'deleted', deleted_at = NOW(), restore_until = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND status = 'active'
+`
+
+type DeleteAccountParams struct {
+	ID           pgtype.UUID        `json:"id"`
+	RestoreUntil pgtype.Timestamptz `json:"restore_until"`
+}
+
+// The holder deletes their own account; it can be restored until 'restore_until'.
+func (q *Queries) DeleteAccount(ctx context.Context, arg DeleteAccountParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteAccount, arg.ID, arg.RestoreUntil)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteAccountTOTP = `-- name: DeleteAccountTOTP :execrows
+DELETE FROM account_totp WHERE account_id = $1
+`
+
+func (q *Queries) DeleteAccountTOTP(ctx context.Context, accountID pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteAccountTOTP, accountID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const enrollRecoveryCodes = `-- name: EnrollRecoveryCodes :execrows
+INSERT INTO recovery_codes (account_id, code_hash)
+SELECT $1::uuid, unnest($2::text[])
+WHERE NOT EXISTS (SELECT 1 FROM recovery_codes WHERE account_id = $1)
+`
+
+type EnrollRecoveryCodesParams struct {
+	AccountID  pgtype.UUID `json:"account_id"`
+	CodeHashes []string    `json:"code_hashes"`
+}
+
+// **** RECOVERY CODES ****
+// Issues an account's first codes. Zero rows means it already has some.
+func (q *Queries) EnrollRecoveryCodes(ctx context.Context, arg EnrollRecoveryCodesParams) (int64, error) {
+	result, err := q.db.Exec(ctx, enrollRecoveryCodes, arg.AccountID, arg.CodeHashes)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const enrollTOTP = `-- name: EnrollTOTP :execrows
+INSERT INTO account_totp (account_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (account_id) DO UPDATE
+SET secret = EXCLUDED.secret, last_used_step = 0, created_at = CURRENT_TIMESTAMP
+WHERE account_totp.confirmed_at IS NULL
+`
+
+type EnrollTOTPParams struct {
+	AccountID pgtype.UUID `json:"account_id"`
+	Secret    []byte      `json:"secret"`
+}
+
+// **** TOTP ****
+// Starts (or restarts) enrollment with a new sealed secret. Zero rows means the
+// account already has a confirmed authenticator.
+func (q *Queries) EnrollTOTP(ctx context.Context, arg EnrollTOTPParams) (int64, error) {
+	result, err := q.db.Exec(ctx, enrollTOTP, arg.AccountID, arg.Secret)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const getAccountByID = `-- name: GetAccountByID :one
-SELECT id, phone, status, token_valid_from, created_at, updated_at FROM accounts WHERE id = $1 LIMIT 1
+SELECT id, phone, status, created_at, updated_at, preferred_language, deleted_at, restore_until, purged_at, phone_bound_at FROM accounts WHERE id = $1 LIMIT 1
 `
 
 func (q *Queries) GetAccountByID(ctx context.Context, id pgtype.UUID) (Account, error) {
@@ -22,15 +373,19 @@ func (q *Queries) GetAccountByID(ctx context.Context, id pgtype.UUID) (Account,
 		&i.ID,
 		&i.Phone,
 		&i.Status,
-		&i.TokenValidFrom,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.PreferredLanguage,
+		&i.DeletedAt,
+		&i.RestoreUntil,
+		&i.PurgedAt,
+		&i.PhoneBoundAt,
 	)
 	return i, err
 }
 
 const getAccountByPhone = `-- name: GetAccountByPhone :one
-SELECT id, phone, status, token_valid_from, created_at, updated_at FROM accounts WHERE phone = $1 LIMIT 1
+SELECT id, phone, status, created_at, updated_at, preferred_language, deleted_at, restore_until, purged_at, phone_bound_at FROM accounts WHERE phone = $1 LIMIT 1
 `
 
 func (q *Queries) GetAccountByPhone(ctx context.Context, phone string) (Account, error) {
@@ -40,8 +395,178 @@ func (q *Queries) GetAccountByPhone(ctx context.Context, phone string) (Account,
 		&i.ID,
 		&i.Phone,
 		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PreferredLanguage,
+		&i.DeletedAt,
+		&i.RestoreUntil,
+		&i.PurgedAt,
+		&i.PhoneBoundAt,
+	)
+	return i, err
+}
+
+const getAccountStatus = `-- name: GetAccountStatus :one
+SELECT status FROM accounts WHERE id = $1
+`
+
+// Checked on every authenticated request, so it reads only the status.
+func (q *Queries) GetAccountStatus(ctx context.Context, id pgtype.UUID) (AccountStatus, error) {
+	row := q.db.QueryRow(ctx, getAccountStatus, id)
+	var status AccountStatus
+	err := row.Scan(&status)
+	return status, err
+}
+
+const getAccountTOTP = `-- name: GetAccountTOTP :one
+SELECT account_id, secret, confirmed_at, last_used_step, created_at FROM account_totp WHERE account_id = $1 LIMIT 1
+`
+
+func (q *Queries) GetAccountTOTP(ctx context.Context, accountID pgtype.UUID) (AccountTotp, error) {
+	row := q.db.QueryRow(ctx, getAccountTOTP, accountID)
+	var i AccountTotp
+	err := row.Scan(
+		&i.AccountID,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getAddressByAccountID = `-- name: GetAddressByAccountID :one
+SELECT id, account_id, country, region, city, zone, wereda, kebele, created_at, updated_at FROM address WHERE account_id = $1 LIMIT 1
+`
+
+func (q *Queries) GetAddressByAccountID(ctx context.Context, accountID pgtype.UUID) (Address, error) {
+	row := q.db.QueryRow(ctx, getAddressByAccountID, accountID)
+	var i Address
+	err := row.Scan(
+		&i.ID,
+		&i.AccountID,
+		&i.Country,
+		&i.Region,
+		&i.City,
+		&i.Zone,
+		&i.Wereda,
+		&i.Kebele,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getMessageByID = `-- name: GetMessageByID :one
+SELECT id, phone, status, attempts, provider, provider_message_id, error_code, last_error, queued_at, sent_at, delivered_at, failed_at, updated_at, encoding, segments, channel FROM messages WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetMessageByID(ctx context.Context, id pgtype.UUID) (Message, error) {
+	row := q.db.QueryRow(ctx, getMessageByID, id)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.Phone,
+		&i.Status,
+		&i.Attempts,
+		&i.Provider,
+		&i.ProviderMessageID,
+		&i.ErrorCode,
+		&i.LastError,
+		&i.QueuedAt,
+		&i.SentAt,
+		&i.DeliveredAt,
+		&i.FailedAt,
+		&i.UpdatedAt,
+		&i.Encoding,
+		&i.Segments,
+		&i.Channel,
+	)
+	return i, err
+}
+
+const getOAuthClient = `-- name: GetOAuthClient :one
+SELECT id, name, secret_hash, redirect_uris, scopes, logo_uri, created_at FROM oauth_clients WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetOAuthClient(ctx context.Context, id string) (OauthClient, error) {
+	row := q.db.QueryRow(ctx, getOAuthClient, id)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.SecretHash,
+		&i.RedirectUris,
+		&i.Scopes,
+		&i.LogoUri,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getRefreshToken = `-- name: GetRefreshToken :one
+SELECT id, session_id, parent_id, issued_at, expires_at, used_at FROM refresh_tokens WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetRefreshToken(ctx context.Context, id pgtype.UUID) (RefreshToken, error) {
+	row := q.db.QueryRow(ctx, getRefreshToken, id)
+	var i RefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.ParentID,
+		&i.IssuedAt,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
+
+const getSession = `-- name: GetSession :one
+SELECT id, account_id, device_name, user_agent, ip_address, token_valid_from, created_at, last_seen_at, revoked_at, client_type, amr FROM sessions WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetSession(ctx context.Context, id pgtype.UUID) (Session, error) {
+	row := q.db.QueryRow(ctx, getSession, id)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.AccountID,
+		&i.DeviceName,
+		&i.UserAgent,
+		&i.IpAddress,
 		&i.TokenValidFrom,
 		&i.CreatedAt,
+		&i.LastSeenAt,
+		&i.RevokedAt,
+		&i.ClientType,
+		&i.Amr,
+	)
+	return i, err
+}
+
+const getUserByAccountID = `-- name: GetUserByAccountID :one
+SELECT id, account_id, first_name, middle_name, last_name, alias_name, birthdate, gender, citizenship, email, user_head_shot_image, government_id_image, passport_image, created_at, updated_at FROM users WHERE account_id = $1 LIMIT 1
+`
+
+func (q *Queries) GetUserByAccountID(ctx context.Context, accountID pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByAccountID, accountID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.AccountID,
+		&i.FirstName,
+		&i.MiddleName,
+		&i.LastName,
+		&i.AliasName,
+		&i.Birthdate,
+		&i.Gender,
+		&i.Citizenship,
+		&i.Email,
+		&i.UserHeadShotImage,
+		&i.GovernmentIDImage,
+		&i.PassportImage,
+		&i.CreatedAt,
 		&i.UpdatedAt,
 	)
 	return i, err
@@ -110,6 +635,521 @@ func (q *Queries) GetUserWithAddressByAccountID(ctx context.Context, accountID p
 	return i, err
 }
 
+const listActiveSessions = `-- name: ListActiveSessions :many
+SELECT id, account_id, device_name, user_agent, ip_address, token_valid_from, created_at, last_seen_at, revoked_at, client_type, amr FROM sessions s
+WHERE s.account_id = $1 AND s.revoked_at IS NULL
+  AND EXISTS (
+    SELECT 1 FROM refresh_tokens rt
+    WHERE rt.session_id = s.id AND rt.used_at IS NULL AND rt.expires_at > NOW()
+  )
+ORDER BY s.last_seen_at DESC
+`
+
+// Sessions that can still refresh: without a live refresh token they are as good as gone.
+func (q *Queries) ListActiveSessions(ctx context.Context, accountID pgtype.UUID) ([]Session, error) {
+	rows, err := q.db.Query(ctx, listActiveSessions, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Session
+	for rows.Next() {
+		var i Session
+		if err := rows.Scan(
+			&i.ID,
+			&i.AccountID,
+			&i.DeviceName,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.TokenValidFrom,
+			&i.CreatedAt,
+			&i.LastSeenAt,
+			&i.RevokedAt,
+			&i.ClientType,
+			&i.Amr,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessagesByPhone = `-- name: ListMessagesByPhone :many
+SELECT id, phone, status, attempts, provider, provider_message_id, error_code, last_error, queued_at, sent_at, delivered_at, failed_at, updated_at, encoding, segments, channel FROM messages WHERE phone = $1 ORDER BY queued_at DESC LIMIT $2
+`
+
+type ListMessagesByPhoneParams struct {
+	Phone string `json:"phone"`
+	Limit int32  `json:"limit"`
+}
+
+// Newest first, for support staff answering "I never got my code".
+func (q *Queries) ListMessagesByPhone(ctx context.Context, arg ListMessagesByPhoneParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, listMessagesByPhone, arg.Phone, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.Phone,
+			&i.Status,
+			&i.Attempts,
+			&i.Provider,
+			&i.ProviderMessageID,
+			&i.ErrorCode,
+			&i.LastError,
+			&i.QueuedAt,
+			&i.SentAt,
+			&i.DeliveredAt,
+			&i.FailedAt,
+			&i.UpdatedAt,
+			&i.Encoding,
+			&i.Segments,
+			&i.Channel,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOAuthClients = `-- name: ListOAuthClients :many
+SELECT id, name, secret_hash, redirect_uris, scopes, logo_uri, created_at FROM oauth_clients ORDER BY created_at DESC
+`
+
+func (q *Queries) ListOAuthClients(ctx context.Context) ([]OauthClient, error) {
+	rows, err := q.db.Query(ctx, listOAuthClients)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []OauthClient
+	for rows.Next() {
+		var i OauthClient
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.SecretHash,
+			&i.RedirectUris,
+			&i.Scopes,
+			&i.LogoUri,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPurgeableAccounts = `-- name: ListPurgeableAccounts :many
+SELECT id FROM accounts
+WHERE status = 'deleted' AND purged_at IS NULL AND deleted_at < $1
+ORDER BY deleted_at
+LIMIT $2
+`
+
+type ListPurgeableAccountsParams struct {
+	DeletedAt pgtype.Timestamptz `json:"deleted_at"`
+	Limit     int32              `json:"limit"`
+}
+
+// Deleted accounts not purged yet that were deleted before the cutoff, oldest first.
+func (q *Queries) ListPurgeableAccounts(ctx context.Context, arg ListPurgeableAccountsParams) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, listPurgeableAccounts, arg.DeletedAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []pgtype.UUID
+	for rows.Next() {
+		var id pgtype.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSecurityEvents = `-- name: ListSecurityEvents :many
+SELECT id, account_id, session_id, event_type, ip_address, user_agent, details, created_at FROM security_events WHERE account_id = $1 ORDER BY created_at DESC
+`
+
+func (q *Queries) ListSecurityEvents(ctx context.Context, accountID pgtype.UUID) ([]SecurityEvent, error) {
+	rows, err := q.db.Query(ctx, listSecurityEvents, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SecurityEvent
+	for rows.Next() {
+		var i SecurityEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.AccountID,
+			&i.SessionID,
+			&i.EventType,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.Details,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSessionsByAccount = `-- name: ListSessionsByAccount :many
+SELECT id, account_id, device_name, user_agent, ip_address, token_valid_from, created_at, last_seen_at, revoked_at, client_type, amr FROM sessions WHERE account_id = $1 ORDER BY created_at DESC
+`
+
+// Every session the account ever had, signed out or not, for data exports.
+func (q *Queries) ListSessionsByAccount(ctx context.Context, accountID pgtype.UUID) ([]Session, error) {
+	rows, err := q.db.Query(ctx, listSessionsByAccount, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Session
+	for rows.Next() {
+		var i Session
+		if err := rows.Scan(
+			&i.ID,
+			&i.AccountID,
+			&i.DeviceName,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.TokenValidFrom,
+			&i.CreatedAt,
+			&i.LastSeenAt,
+			&i.RevokedAt,
+			&i.ClientType,
+			&i.Amr,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markMessageSent = `-- name: MarkMessageSent :exec
+UPDATE messages
+SET
+    status = 'sent',
+    attempts = $2,
+    provider = $3,
+    provider_message_id = $4,
+    last_error = NULL,
+    sent_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND status = 'queued'
+`
+
+type MarkMessageSentParams struct {
+	ID                pgtype.UUID `json:"id"`
+	Attempts          int32       `json:"attempts"`
+	Provider          pgtype.Text `json:"provider"`
+	ProviderMessageID pgtype.Text `json:"provider_message_id"`
+}
+
+// A provider accepted the message; receipts are matched on provider + provider_message_id.
+func (q *Queries) MarkMessageSent(ctx context.Context, arg MarkMessageSentParams) error {
+	_, err := q.db.Exec(ctx, markMessageSent,
+		arg.ID,
+		arg.Attempts,
+		arg.Provider,
+		arg.ProviderMessageID,
+	)
+	return err
+}
+
+const purgeAccount = `-- name: PurgeAccount :execrows
+WITH target AS (
+    SELECT id, phone FROM accounts
+    WHERE id = $1 AND status = 'deleted' AND purged_at IS NULL
+), deleted_users AS (
+    DELETE FROM users WHERE account_id IN (SELECT id FROM target)
+), deleted_address AS (
+    DELETE FROM address WHERE account_id IN (SELECT id FROM target)
+), deleted_sessions AS (
+    DELETE FROM sessions WHERE account_id IN (SELECT id FROM target)
+), deleted_messages AS (
+    DELETE FROM messages WHERE phone IN (SELECT phone FROM target)
+), deleted_recovery_codes AS (
+    DELETE FROM recovery_codes WHERE account_id IN (SELECT id FROM target)
+), deleted_totp AS (
+    DELETE FROM account_totp WHERE account_id IN (SELECT id FROM target)
+), anonymized_events AS (
+    UPDATE security_events SET ip_address = NULL, user_agent = NULL, session_id = NULL
+    WHERE account_id IN (SELECT id FROM target)
+)
+UPDATE accounts a
+SET phone = 'deleted:' || a.id::text, preferred_language = NULL,
+    restore_until = NULL, purged_at = NOW(), updated_at = CURRENT_TIMESTAMP
+FROM target
+WHERE a.id = target.id
+`
+
+// Erases everything that identifies the holder of a deleted account in one
+// statement. The account row stays behind as an anonymized tombstone.
+func (q *Queries) PurgeAccount(ctx context.Context, id pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeAccount, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const recordMessageAttempt = `-- name: RecordMessageAttempt :exec
+UPDATE messages
+SET
+    status = $2,
+    attempts = $3,
+    last_error = $4,
+    failed_at = CASE WHEN $2 = 'failed'::message_status THEN CURRENT_TIMESTAMP ELSE failed_at END,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND status = 'queued'
+`
+
+type RecordMessageAttemptParams struct {
+	ID        pgtype.UUID   `json:"id"`
+	Status    MessageStatus `json:"status"`
+	Attempts  int32         `json:"attempts"`
+	LastError pgtype.Text   `json:"last_error"`
+}
+
+// A send failed. Status only changes to 'failed' when the outbox gives up.
+func (q *Queries) RecordMessageAttempt(ctx context.Context, arg RecordMessageAttemptParams) error {
+	_, err := q.db.Exec(ctx, recordMessageAttempt,
+		arg.ID,
+		arg.Status,
+		arg.Attempts,
+		arg.LastError,
+	)
+	return err
+}
+
+const recoverAccount = `-- name: RecoverAccount :execrows
+WITH spent AS (
+    UPDATE recovery_codes SET used_at = NOW()
+    WHERE account_id = $1 AND code_hash = $2 AND used_at IS NULL
+      AND EXISTS (SELECT 1 FROM accounts WHERE id = $1 AND status = 'active')
+    RETURNING account_id
+)
+UPDATE accounts
+SET phone = $3, phone_bound_at = NOW(), updated_at = CURRENT_TIMESTAMP
+WHERE id IN (SELECT account_id FROM spent)
+`
+
+type RecoverAccountParams struct {
+	ID       pgtype.UUID `json:"id"`
+	CodeHash string      `json:"code_hash"`
+	NewPhone string      `json:"new_phone"`
+}
+
+// Spends a recovery code and moves the account to a new phone in one statement.
+// Zero rows means the code is wrong or spent, or the account is not active.
+func (q *Queries) RecoverAccount(ctx context.Context, arg RecoverAccountParams) (int64, error) {
+	result, err := q.db.Exec(ctx, recoverAccount, arg.ID, arg.CodeHash, arg.NewPhone)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const replaceRecoveryCodes = `-- name: ReplaceRecoveryCodes :exec
+WITH cleared AS (
+    DELETE FROM recovery_codes WHERE account_id = $1
+)
+INSERT INTO recovery_codes (account_id, code_hash)
+SELECT $1::uuid, unnest($2::text[])
+`
+
+type ReplaceRecoveryCodesParams struct {
+	AccountID  pgtype.UUID `json:"account_id"`
+	CodeHashes []string    `json:"code_hashes"`
+}
+
+// Regenerating voids every earlier code, used or not.
+func (q *Queries) ReplaceRecoveryCodes(ctx context.Context, arg ReplaceRecoveryCodesParams) error {
+	_, err := q.db.Exec(ctx, replaceRecoveryCodes, arg.AccountID, arg.CodeHashes)
+	return err
+}
+
+const restoreAccount = `-- name: RestoreAccount :execrows
+UPDATE accounts
+SET status = 'active', deleted_at = NULL, restore_until = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND status = 'deleted' AND restore_until > NOW()
+`
+
+// Undoes a self-service deletion while the restore window is open.
+func (q *Queries) RestoreAccount(ctx context.Context, id pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, restoreAccount, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeAllSessions = `-- name: RevokeAllSessions :execrows
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE account_id = $1 AND revoked_at IS NULL AND id IS DISTINCT FROM $2
+`
+
+type RevokeAllSessionsParams struct {
+	AccountID pgtype.UUID `json:"account_id"`
+	KeepID    pgtype.UUID `json:"keep_id"`
+}
+
+// Signs out every device, optionally keeping one (the caller's own).
+func (q *Queries) RevokeAllSessions(ctx context.Context, arg RevokeAllSessionsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeAllSessions, arg.AccountID, arg.KeepID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeSession = `-- name: RevokeSession :execrows
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE id = $1 AND account_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeSessionParams struct {
+	ID        pgtype.UUID `json:"id"`
+	AccountID pgtype.UUID `json:"account_id"`
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeSession, arg.ID, arg.AccountID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const rotateSession = `-- name: RotateSession :one
+UPDATE sessions
+SET token_valid_from = NOW(), last_seen_at = NOW(), ip_address = $2
+WHERE id = $1 AND revoked_at IS NULL
+RETURNING id, account_id, device_name, user_agent, ip_address, token_valid_from, created_at, last_seen_at, revoked_at, client_type, amr
+`
+
+type RotateSessionParams struct {
+	ID        pgtype.UUID `json:"id"`
+	IpAddress pgtype.Text `json:"ip_address"`
+}
+
+// Moves 'token_valid_from' forward on refresh so the spent refresh token stops working.
+func (q *Queries) RotateSession(ctx context.Context, arg RotateSessionParams) (Session, error) {
+	row := q.db.QueryRow(ctx, rotateSession, arg.ID, arg.IpAddress)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.AccountID,
+		&i.DeviceName,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.TokenValidFrom,
+		&i.CreatedAt,
+		&i.LastSeenAt,
+		&i.RevokedAt,
+		&i.ClientType,
+		&i.Amr,
+	)
+	return i, err
+}
+
+const touchSession = `-- name: TouchSession :exec
+UPDATE sessions
+SET last_seen_at = NOW(), ip_address = $2
+WHERE id = $1 AND revoked_at IS NULL AND last_seen_at < NOW() - INTERVAL '1 minute'
+`
+
+type TouchSessionParams struct {
+	ID        pgtype.UUID `json:"id"`
+	IpAddress pgtype.Text `json:"ip_address"`
+}
+
+// Records activity at most once a minute so authenticated requests rarely write.
+func (q *Queries) TouchSession(ctx context.Context, arg TouchSessionParams) error {
+	_, err := q.db.Exec(ctx, touchSession, arg.ID, arg.IpAddress)
+	return err
+}
+
+const transitionAccountStatus = `-- name: TransitionAccountStatus :execrows
+UPDATE accounts
+SET status = $1,
+    deleted_at = CASE WHEN $1 = 'deleted' THEN NOW() END,
+    restore_until = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $2 AND status = $3
+`
+
+type TransitionAccountStatusParams struct {
+	ToStatus   AccountStatus `json:"to_status"`
+	ID         pgtype.UUID   `json:"id"`
+	FromStatus AccountStatus `json:"from_status"`
+}
+
+// Moves an account along the status state machine. Zero rows means it was no
+// longer in 'from_status' (someone else changed it first).
+// Moving to 'deleted' starts the purge clock; no restore window is offered.
+func (q *Queries) TransitionAccountStatus(ctx context.Context, arg TransitionAccountStatusParams) (int64, error) {
+	result, err := q.db.Exec(ctx, transitionAccountStatus, arg.ToStatus, arg.ID, arg.FromStatus)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateAccountLanguage = `-- name: UpdateAccountLanguage :exec
+UPDATE accounts
+SET preferred_language = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type UpdateAccountLanguageParams struct {
+	ID                pgtype.UUID `json:"id"`
+	PreferredLanguage pgtype.Text `json:"preferred_language"`
+}
+
+// Sets the language OTP and notification SMS are sent in.
+func (q *Queries) UpdateAccountLanguage(ctx context.Context, arg UpdateAccountLanguageParams) error {
+	_, err := q.db.Exec(ctx, updateAccountLanguage, arg.ID, arg.PreferredLanguage)
+	return err
+}
+
 const updateAccountStatus = `-- name: UpdateAccountStatus :exec
 UPDATE accounts 
 SET status = $2, updated_at = CURRENT_TIMESTAMP 
@@ -122,7 +1162,7 @@ type UpdateAccountStatusParams struct {
 }
 
 // This is for administrative or system changes.
-// It does NOT touch token_valid_from, so the user stays logged in.
+// It does NOT touch sessions, so the user stays logged in.
 func (q *Queries) UpdateAccountStatus(ctx context.Context, arg UpdateAccountStatusParams) error {
 	_, err := q.db.Exec(ctx, updateAccountStatus, arg.ID, arg.Status)
 	return err
@@ -158,18 +1198,17 @@ func (q *Queries) UpdateUserImages(ctx context.Context, arg UpdateUserImagesPara
 
 const upsertAccount = `-- name: UpsertAccount :one
 
-INSERT INTO accounts (phone, token_valid_from)
-VALUES ($1, NOW())
+INSERT INTO accounts (phone)
+VALUES ($1)
 ON CONFLICT (phone) DO UPDATE 
 SET 
-    token_valid_from = EXCLUDED.token_valid_from,
     updated_at = CURRENT_TIMESTAMP
-RETURNING id, phone, status, token_valid_from, created_at, updated_at
+RETURNING id, phone, status, created_at, updated_at, preferred_language, deleted_at, restore_until, purged_at, phone_bound_at
 `
 
 // **** ACCOUNTS ****
 // This is used ONLY during the VerifyOTP flow.
-// It moves the 'token_valid_from' forward to invalidate old sessions.
+// Sessions are separate rows, so logging in leaves other devices signed in.
 func (q *Queries) UpsertAccount(ctx context.Context, phone string) (Account, error) {
 	row := q.db.QueryRow(ctx, upsertAccount, phone)
 	var i Account
@@ -177,9 +1216,13 @@ func (q *Queries) UpsertAccount(ctx context.Context, phone string) (Account, err
 		&i.ID,
 		&i.Phone,
 		&i.Status,
-		&i.TokenValidFrom,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.PreferredLanguage,
+		&i.DeletedAt,
+		&i.RestoreUntil,
+		&i.PurgedAt,
+		&i.PhoneBoundAt,
 	)
 	return i, err
 }
@@ -315,3 +1358,61 @@ func (q *Queries) UpsertUser(ctx context.Context, arg UpsertUserParams) (User, e
 	)
 	return i, err
 }
+
+const useRecoveryCode = `-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes SET used_at = NOW()
+WHERE account_id = $1 AND code_hash = $2 AND used_at IS NULL
+`
+
+type UseRecoveryCodeParams struct {
+	AccountID pgtype.UUID `json:"account_id"`
+	CodeHash  string      `json:"code_hash"`
+}
+
+// Spends a recovery code in place of another factor. Zero rows means it is wrong or spent.
+func (q *Queries) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error) {
+	result, err := q.db.Exec(ctx, useRecoveryCode, arg.AccountID, arg.CodeHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const useRefreshToken = `-- name: UseRefreshToken :execrows
+UPDATE refresh_tokens
+SET used_at = NOW()
+WHERE id = $1 AND session_id = $2 AND used_at IS NULL AND expires_at > NOW()
+`
+
+type UseRefreshTokenParams struct {
+	ID        pgtype.UUID `json:"id"`
+	SessionID pgtype.UUID `json:"session_id"`
+}
+
+// Spends a refresh token. Zero rows means it is unknown, expired or already used.
+func (q *Queries) UseRefreshToken(ctx context.Context, arg UseRefreshTokenParams) (int64, error) {
+	result, err := q.db.Exec(ctx, useRefreshToken, arg.ID, arg.SessionID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+UPDATE account_totp SET last_used_step = $1
+WHERE account_id = $2 AND confirmed_at IS NOT NULL AND last_used_step < $1
+`
+
+type UseTOTPStepParams struct {
+	Step      int64       `json:"step"`
+	AccountID pgtype.UUID `json:"account_id"`
+}
+
+// Accepts a code's time step once. Zero rows means it, or a later one, was already used.
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.Exec(ctx, useTOTPStep, arg.Step, arg.AccountID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,198 @@
+package delivery
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+	"github.com/yabeye/addis_verify_backend/pkg/messenger"
+	"github.com/yabeye/addis_verify_backend/pkg/phone"
+)
+
+// Handler exposes outbox state and provider callbacks over HTTP.
+type Handler interface {
+	GetStatus(w http.ResponseWriter, r *http.Request)
+	HandleReceipt(w http.ResponseWriter, r *http.Request)
+	ListByPhone(w http.ResponseWriter, r *http.Request)
+}
+
+type handler struct {
+	queue        *Queue
+	parsers      map[string]messenger.ReceiptParser
+	webhookToken string
+	logger       *slog.Logger
+}
+
+// NewHandler ensures the struct implements the Handler interface.
+// When webhookToken is set, receipt callbacks must carry it as the "token" query parameter.
+func NewHandler(q *Queue, parsers map[string]messenger.ReceiptParser, webhookToken string, l *slog.Logger) Handler {
+	return &handler{
+		queue:        q,
+		parsers:      parsers,
+		webhookToken: webhookToken,
+		logger:       l,
+	}
+}
+
+// GetStatus godoc
+// @Summary      Message delivery status
+// @Description  Returns the delivery state of a message queued by send-otp (queued, sent, delivered or failed).
+// @Tags         messages
+// @Produce      json
+// @Param        messageID  path      string  true  "Message ID returned by send-otp"
+// @Success      200        {object}  Status
+// @Failure      404        {object}  json.ErrorResponse
+// @Router       /api/v1/messages/{messageID} [get]
+func (h *handler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "messageID")
+
+	status, err := h.queue.Status(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		json.WriteError(w, http.StatusNotFound, constants.ErrMessageNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to load message status", "error", err, "id", id)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+
+	json.Write(w, http.StatusOK, status)
+}
+
+// HandleReceipt godoc
+// @Summary      SMS delivery receipt callback
+// @Description  Called by SMS providers (twilio, africastalking or the configured gateway name) to report delivery status.
+// @Tags         webhooks
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        provider  path      string  true   "Provider name"
+// @Param        token     query     string  false  "Shared webhook secret; required for providers that don't sign callbacks"
+// @Success      200       {object}  map[string]string
+// @Failure      400       {object}  json.ErrorResponse
+// @Failure      403       {object}  json.ErrorResponse
+// @Failure      404       {object}  json.ErrorResponse
+// @Router       /api/v1/webhooks/sms/{provider} [post]
+func (h *handler) HandleReceipt(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+
+	if h.webhookToken != "" &&
+		subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(h.webhookToken)) != 1 {
+		json.WriteError(w, http.StatusForbidden, constants.ErrUnauthorizedError)
+		return
+	}
+
+	parse, ok := h.parsers[provider]
+	if !ok {
+		json.WriteError(w, http.StatusNotFound, constants.ErrUnknownProvider)
+		return
+	}
+
+	report, err := parse(r)
+	if errors.Is(err, messenger.ErrInvalidSignature) {
+		h.logger.Warn("rejected receipt with bad signature", "provider", provider)
+		json.WriteError(w, http.StatusForbidden, constants.ErrUnauthorizedError)
+		return
+	}
+	if err != nil {
+		h.logger.Warn("malformed delivery receipt", "provider", provider, "error", err)
+		json.WriteError(w, http.StatusBadRequest, constants.ErrInvalidJSON)
+		return
+	}
+
+	h.applyReport(r, report)
+	json.Write(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// applyReport stores a receipt. Unknown or stale receipts are only logged: answering
+// with an error would make the provider retry something that can never succeed.
+func (h *handler) applyReport(r *http.Request, report messenger.DeliveryReport) {
+	err := h.queue.ApplyReport(r.Context(), report)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		h.logger.Warn("receipt matched no pending message", "provider", report.Provider, "message_id", report.MessageID, "status", report.Status)
+	case err != nil:
+		h.logger.Error("failed to store delivery receipt", "provider", report.Provider, "message_id", report.MessageID, "error", err)
+	default:
+		h.logger.Info("delivery receipt stored", "provider", report.Provider, "message_id", report.MessageID, "status", report.Status)
+	}
+}
+
+// messageRecord is the support view of a message, including provider details.
+type messageRecord struct {
+	ID                string     `json:"id"`
+	Phone             string     `json:"phone"`
+	Channel           string     `json:"channel"`
+	Status            string     `json:"status"`
+	Attempts          int        `json:"attempts"`
+	Encoding          string     `json:"encoding,omitempty"`
+	Segments          int        `json:"segments"`
+	Provider          string     `json:"provider,omitempty"`
+	ProviderMessageID string     `json:"provider_message_id,omitempty"`
+	ErrorCode         string     `json:"error_code,omitempty"`
+	LastError         string     `json:"last_error,omitempty"`
+	QueuedAt          time.Time  `json:"queued_at"`
+	SentAt            *time.Time `json:"sent_at,omitempty"`
+	DeliveredAt       *time.Time `json:"delivered_at,omitempty"`
+	FailedAt          *time.Time `json:"failed_at,omitempty"`
+}
+
+// ListByPhone godoc
+// @Summary      Message history for a phone (support)
+// @Description  Lists the latest messages sent to a phone with provider IDs and receipts. Requires the admin API key.
+// @Tags         admin
+// @Produce      json
+// @Param        phone  query     string  true   "Phone number, local or E.164"
+// @Param        limit  query     int     false  "Max results (default 20, max 100)"
+// @Success      200    {array}   messageRecord
+// @Failure      400    {object}  json.ErrorResponse
+// @Security     AdminKey
+// @Router       /api/v1/admin/messages [get]
+func (h *handler) ListByPhone(w http.ResponseWriter, r *http.Request) {
+	number, err := phone.Normalize(r.URL.Query().Get("phone"))
+	if err != nil {
+		json.WriteError(w, http.StatusBadRequest, constants.ErrInvalidPhone)
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	limit = min(limit, 100)
+
+	msgs, err := h.queue.History(r.Context(), number, limit)
+	if err != nil {
+		h.logger.Error("failed to list messages", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+
+	records := make([]messageRecord, 0, len(msgs))
+	for _, m := range msgs {
+		records = append(records, messageRecord{
+			ID:                m.ID.String(),
+			Phone:             m.Phone,
+			Status:            string(m.Status),
+			Attempts:          int(m.Attempts),
+			Encoding:          m.Encoding.String,
+			Segments:          int(m.Segments),
+			Provider:          m.Provider.String,
+			ProviderMessageID: m.ProviderMessageID.String,
+			ErrorCode:         m.ErrorCode.String,
+			LastError:         m.LastError.String,
+			QueuedAt:          m.QueuedAt.Time,
+			SentAt:            timePtr(m.SentAt),
+			DeliveredAt:       timePtr(m.DeliveredAt),
+			FailedAt:          timePtr(m.FailedAt),
+		})
+	}
+
+	json.Write(w, http.StatusOK, records)
+}
@@ -0,0 +1,253 @@
+// Package delivery moves outbound messages off the request path: handlers enqueue
+// into a Redis stream (the outbox) and a Worker delivers with retries and dead-lettering.
+// Every message is also recorded in Postgres, where provider delivery receipts land.
+package delivery
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/pkg/messenger"
+)
+
+const (
+	streamKey = "sms:outbox"
+	retryKey  = "sms:outbox:retry" // ZSET of message IDs scored by next attempt (unix ms)
+	deadKey   = "sms:outbox:dead"
+	groupName = "sms-workers"
+
+	// pendingTTL bounds how long an undelivered message body may sit in Redis.
+	// Messages carrying a code live no longer than the code.
+	pendingTTL = 24 * time.Hour
+)
+
+// ErrNotFound is returned for unknown message IDs and receipts that match no message.
+var ErrNotFound = errors.New("delivery: message not found")
+
+func messageKey(id string) string { return "sms:msg:" + id }
+
+// Store is the slice of the database the outbox needs.
+type Store interface {
+	CreateMessage(ctx context.Context, arg repo.CreateMessageParams) error
+	MarkMessageSent(ctx context.Context, arg repo.MarkMessageSentParams) error
+	RecordMessageAttempt(ctx context.Context, arg repo.RecordMessageAttemptParams) error
+	ApplyDeliveryReport(ctx context.Context, arg repo.ApplyDeliveryReportParams) (int64, error)
+	GetMessageByID(ctx context.Context, id pgtype.UUID) (repo.Message, error)
+	ListMessagesByPhone(ctx context.Context, arg repo.ListMessagesByPhoneParams) ([]repo.Message, error)
+}
+
+// Status is the publicly queryable state of an outbound message.
+type Status struct {
+	ID          string                   `json:"id"`
+	Channel     string                   `json:"channel"`
+	Status      messenger.DeliveryStatus `json:"status"`
+	Attempts    int                      `json:"attempts"`
+	Provider    string                   `json:"provider,omitempty"`
+	QueuedAt    time.Time                `json:"queued_at"`
+	SentAt      *time.Time               `json:"sent_at,omitempty"`
+	DeliveredAt *time.Time               `json:"delivered_at,omitempty"`
+	FailedAt    *time.Time               `json:"failed_at,omitempty"`
+}
+
+// Queue is the outbox. It implements messenger.Provider so it can stand in
+// for a real provider anywhere a message needs sending.
+type Queue struct {
+	rdb     redis.Cmdable
+	store   Store
+	codeTTL time.Duration
+	now     func() time.Time
+}
+
+// NewQueue creates an outbox backed by rdb that records messages in store. A message
+// carrying a code is dropped if it isn't sent within codeTTL, the code's lifetime.
+func NewQueue(rdb redis.Cmdable, store Store, codeTTL time.Duration) *Queue {
+	if codeTTL <= 0 || codeTTL > pendingTTL {
+		codeTTL = pendingTTL
+	}
+	return &Queue{rdb: rdb, store: store, codeTTL: codeTTL, now: time.Now}
+}
+
+// Send records msg and appends it to the outbox stream.
+// The receipt's MessageID is the outbox ID to query with Status.
+func (q *Queue) Send(ctx context.Context, msg messenger.Message) (messenger.Receipt, error) {
+	id, channel, err := q.create(ctx, msg)
+	if err != nil {
+		return messenger.Receipt{}, err
+	}
+
+	fields := []any{"to", msg.To, "channel", string(channel), "attempts", 0}
+	// Keep only the copy of the code the channel reads: Telegram sends the bare code,
+	// WhatsApp templates may take either and everything else reads the body
+	switch channel {
+	case messenger.ChannelTelegram:
+		fields = append(fields, "code", msg.Code)
+	case messenger.ChannelWhatsApp:
+		fields = append(fields, "body", msg.Body, "code", msg.Code)
+	default:
+		fields = append(fields, "body", msg.Body)
+	}
+	ttl := pendingTTL
+	if msg.Code != "" {
+		ttl = q.codeTTL
+	}
+
+	pipe := q.rdb.TxPipeline()
+	pipe.HSet(ctx, messageKey(id.String()), fields...)
+	pipe.Expire(ctx, messageKey(id.String()), ttl)
+	pipe.XAdd(ctx, &redis.XAddArgs{Stream: streamKey, Values: map[string]any{"id": id.String()}})
+	if _, err := pipe.Exec(ctx); err != nil {
+		// Don't leave a row that claims to be queued forever
+		q.recordAttempt(ctx, id.String(), repo.MessageStatusFailed, 0, err)
+		return messenger.Receipt{}, err
+	}
+
+	return messenger.Receipt{Provider: "outbox", MessageID: id.String()}, nil
+}
+
+// Suppress records msg without sending it, for sends refused by fraud screening. The
+// row stays queued, so Status answers for it like for any fresh send; support staff
+// see the reason as its last error.
+func (q *Queue) Suppress(ctx context.Context, msg messenger.Message, reason string) (messenger.Receipt, error) {
+	id, _, err := q.create(ctx, msg)
+	if err != nil {
+		return messenger.Receipt{}, err
+	}
+	if err := q.recordAttempt(ctx, id.String(), repo.MessageStatusQueued, 0, errors.New("suppressed: "+reason)); err != nil {
+		return messenger.Receipt{}, err
+	}
+	return messenger.Receipt{Provider: "outbox", MessageID: id.String()}, nil
+}
+
+// create records msg as queued and returns its ID and channel.
+func (q *Queue) create(ctx context.Context, msg messenger.Message) (uuid.UUID, messenger.Channel, error) {
+	id := uuid.New()
+	channel := msg.Channel
+	if channel == "" {
+		channel = messenger.ChannelSMS
+	}
+
+	params := repo.CreateMessageParams{
+		ID:      pgtype.UUID{Bytes: id, Valid: true},
+		Phone:   msg.To,
+		Channel: string(channel),
+	}
+	// Only SMS is billed per segment
+	if channel == messenger.ChannelSMS {
+		segments := messenger.CountSegments(msg.Body)
+		params.Encoding = pgtype.Text{String: segments.Encoding, Valid: true}
+		params.Segments = int32(segments.Count)
+	}
+	return id, channel, q.store.CreateMessage(ctx, params)
+}
+
+// Status returns the current delivery state of a queued message.
+func (q *Queue) Status(ctx context.Context, id string) (*Status, error) {
+	msg, err := q.message(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Status{
+		ID:          id,
+		Channel:     msg.Channel,
+		Status:      messenger.DeliveryStatus(msg.Status),
+		Attempts:    int(msg.Attempts),
+		Provider:    msg.Provider.String,
+		QueuedAt:    msg.QueuedAt.Time,
+		SentAt:      timePtr(msg.SentAt),
+		DeliveredAt: timePtr(msg.DeliveredAt),
+		FailedAt:    timePtr(msg.FailedAt),
+	}, nil
+}
+
+// Delivered reports whether the handset confirmed receipt of a queued message.
+func (q *Queue) Delivered(ctx context.Context, id string) (bool, error) {
+	msg, err := q.message(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return msg.Status == repo.MessageStatusDelivered, nil
+}
+
+// History lists the latest messages sent to phone, newest first.
+func (q *Queue) History(ctx context.Context, phone string, limit int) ([]repo.Message, error) {
+	return q.store.ListMessagesByPhone(ctx, repo.ListMessagesByPhoneParams{
+		Phone: phone,
+		Limit: int32(limit),
+	})
+}
+
+// ApplyReport records a provider delivery receipt against the matching message.
+// It returns ErrNotFound when no message matches, or the report is older than what we know.
+func (q *Queue) ApplyReport(ctx context.Context, report messenger.DeliveryReport) error {
+	// Intermediate "queued at the provider" callbacks carry no new information
+	if report.Status == messenger.StatusQueued {
+		return nil
+	}
+
+	at := report.At
+	if at.IsZero() {
+		at = q.now()
+	}
+	rows, err := q.store.ApplyDeliveryReport(ctx, repo.ApplyDeliveryReportParams{
+		Provider:          pgtype.Text{String: report.Provider, Valid: true},
+		ProviderMessageID: pgtype.Text{String: report.MessageID, Valid: true},
+		Status:            repo.MessageStatus(report.Status),
+		ErrorCode:         pgtype.Text{String: report.ErrorCode, Valid: report.ErrorCode != ""},
+		DeliveredAt:       pgtype.Timestamptz{Time: at, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (q *Queue) message(ctx context.Context, id string) (repo.Message, error) {
+	var dbID pgtype.UUID
+	if err := dbID.Scan(id); err != nil {
+		return repo.Message{}, ErrNotFound
+	}
+
+	msg, err := q.store.GetMessageByID(ctx, dbID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repo.Message{}, ErrNotFound
+	}
+	return msg, err
+}
+
+// recordAttempt stores the outcome of a failed send.
+func (q *Queue) recordAttempt(ctx context.Context, id string, status repo.MessageStatus, attempts int, sendErr error) error {
+	var dbID pgtype.UUID
+	if err := dbID.Scan(id); err != nil {
+		return err
+	}
+	return q.store.RecordMessageAttempt(ctx, repo.RecordMessageAttemptParams{
+		ID:        dbID,
+		Status:    status,
+		Attempts:  int32(attempts),
+		LastError: pgtype.Text{String: sendErr.Error(), Valid: true},
+	})
+}
+
+func timePtr(ts pgtype.Timestamptz) *time.Time {
+	if !ts.Valid {
+		return nil
+	}
+	return &ts.Time
+}
+
+// attemptsOf reads the attempt counter stored with a pending message.
+func attemptsOf(fields map[string]string) int {
+	n, _ := strconv.Atoi(fields["attempts"])
+	return n
+}
@@ -0,0 +1,261 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/pkg/messenger"
+)
+
+// WorkerConfig tunes retries for the delivery worker.
+type WorkerConfig struct {
+	// Consumer names this worker inside the consumer group. Must be unique per process.
+	Consumer string
+	// MaxAttempts before a message is dead-lettered. Defaults to 5.
+	MaxAttempts int
+	// BaseBackoff doubles after every failed attempt, capped at MaxBackoff. Defaults 2s and 5m.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// SendTimeout bounds a single provider call. Defaults to 15s.
+	SendTimeout time.Duration
+	// ClaimIdle is how long a message may sit unacknowledged (e.g. a crashed worker)
+	// before another worker takes it over. Defaults to 1m.
+	ClaimIdle time.Duration
+	// Block is how long XREADGROUP waits for new entries. Defaults to 1s.
+	Block time.Duration
+}
+
+// errExpired is recorded for messages that outlived their pending copy, e.g. a code
+// whose retries ran past the OTP's lifetime.
+var errExpired = errors.New("expired before it could be sent")
+
+// Worker drains the outbox, delivering through provider.
+type Worker struct {
+	q        *Queue
+	provider messenger.Provider
+	cfg      WorkerConfig
+	logger   *slog.Logger
+}
+
+// NewWorker creates a worker for q that delivers with provider.
+func NewWorker(q *Queue, provider messenger.Provider, cfg WorkerConfig, logger *slog.Logger) *Worker {
+	if cfg.Consumer == "" {
+		cfg.Consumer = "worker-1"
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = 2 * time.Second
+	}
+	if cfg.MaxBackoff < cfg.BaseBackoff {
+		cfg.MaxBackoff = 5 * time.Minute
+	}
+	if cfg.SendTimeout <= 0 {
+		cfg.SendTimeout = 15 * time.Second
+	}
+	if cfg.ClaimIdle <= 0 {
+		cfg.ClaimIdle = time.Minute
+	}
+	if cfg.Block <= 0 {
+		cfg.Block = time.Second
+	}
+	return &Worker{q: q, provider: provider, cfg: cfg, logger: logger.With("component", "delivery_worker", "consumer", cfg.Consumer)}
+}
+
+// Run processes the outbox until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) error {
+	err := w.q.rdb.XGroupCreateMkStream(ctx, streamKey, groupName, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	for ctx.Err() == nil {
+		if err := w.poll(ctx); err != nil && ctx.Err() == nil {
+			w.logger.Error("outbox poll failed", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}
+	return nil
+}
+
+// poll runs one cycle: promote due retries, reclaim stale entries, read new ones.
+func (w *Worker) poll(ctx context.Context) error {
+	if err := w.promoteRetries(ctx); err != nil {
+		return err
+	}
+
+	claimed, _, err := w.q.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   streamKey,
+		Group:    groupName,
+		Consumer: w.cfg.Consumer,
+		MinIdle:  w.cfg.ClaimIdle,
+		Start:    "0-0",
+		Count:    10,
+	}).Result()
+	if err != nil {
+		return err
+	}
+	w.processAll(ctx, claimed)
+
+	streams, err := w.q.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    groupName,
+		Consumer: w.cfg.Consumer,
+		Streams:  []string{streamKey, ">"},
+		Count:    10,
+		Block:    w.cfg.Block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, s := range streams {
+		w.processAll(ctx, s.Messages)
+	}
+	return nil
+}
+
+func (w *Worker) processAll(ctx context.Context, entries []redis.XMessage) {
+	for _, entry := range entries {
+		id, _ := entry.Values["id"].(string)
+		if id != "" {
+			if err := w.process(ctx, id); err != nil {
+				// Left pending, the entry is claimed again after ClaimIdle
+				w.logger.Error("failed to load outbox message", "id", id, "error", err)
+				continue
+			}
+		}
+		// The entry is done: retries are re-added to the stream when due
+		w.q.rdb.XAck(ctx, streamKey, groupName, entry.ID)
+		w.q.rdb.XDel(ctx, streamKey, entry.ID)
+	}
+}
+
+// promoteRetries moves messages whose backoff has elapsed back onto the stream.
+func (w *Worker) promoteRetries(ctx context.Context) error {
+	due, err := w.q.rdb.ZRangeByScore(ctx, retryKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(w.q.now().UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return err
+	}
+	for _, id := range due {
+		// ZREM decides which worker owns the promotion when several race
+		if removed, _ := w.q.rdb.ZRem(ctx, retryKey, id).Result(); removed == 1 {
+			w.q.rdb.XAdd(ctx, &redis.XAddArgs{Stream: streamKey, Values: map[string]any{"id": id}})
+		}
+	}
+	return nil
+}
+
+// process makes one delivery attempt for message id. It only returns an error when
+// the message could not be read, so the stream entry should be kept.
+func (w *Worker) process(ctx context.Context, id string) error {
+	key := messageKey(id)
+	fields, err := w.q.rdb.HGetAll(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if fields["to"] == "" {
+		// Expired, unknown or already finished
+		w.expire(ctx, id)
+		return nil
+	}
+
+	attempts := attemptsOf(fields) + 1
+
+	sendCtx, cancel := context.WithTimeout(ctx, w.cfg.SendTimeout)
+	receipt, sendErr := w.provider.Send(sendCtx, messenger.Message{
+		To:      fields["to"],
+		Body:    fields["body"],
+		Channel: messenger.Channel(fields["channel"]),
+		Code:    fields["code"],
+	})
+	cancel()
+
+	if sendErr == nil {
+		// The message carries the OTP: drop it as soon as it is no longer needed
+		w.q.rdb.Del(ctx, key)
+		var dbID pgtype.UUID
+		dbID.Scan(id)
+		if err := w.q.store.MarkMessageSent(ctx, repo.MarkMessageSentParams{
+			ID:                dbID,
+			Attempts:          int32(attempts),
+			Provider:          pgtype.Text{String: receipt.Provider, Valid: receipt.Provider != ""},
+			ProviderMessageID: pgtype.Text{String: receipt.MessageID, Valid: receipt.MessageID != ""},
+		}); err != nil {
+			w.logger.Error("failed to record sent message", "id", id, "error", err)
+		}
+		w.logger.Info("message delivered to provider", "id", id, "provider", receipt.Provider, "attempts", attempts)
+		return nil
+	}
+
+	// Open circuits clear up on their own, so a router with no healthy provider is worth retrying
+	retryable := messenger.IsRetryable(sendErr) || errors.Is(sendErr, messenger.ErrNoProvider)
+	if attempts >= w.cfg.MaxAttempts || !retryable {
+		pipe := w.q.rdb.TxPipeline()
+		pipe.Del(ctx, key)
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: deadKey, Values: map[string]any{
+			"id": id, "to": fields["to"], "error": sendErr.Error(), "attempts": attempts,
+		}})
+		pipe.Exec(ctx)
+		if err := w.q.recordAttempt(ctx, id, repo.MessageStatusFailed, attempts, sendErr); err != nil {
+			w.logger.Error("failed to record failed message", "id", id, "error", err)
+		}
+		w.logger.Error("message dead-lettered", "id", id, "attempts", attempts, "error", sendErr)
+		return nil
+	}
+
+	next := w.q.now().Add(w.backoff(attempts))
+	pipe := w.q.rdb.TxPipeline()
+	pipe.HSet(ctx, key, "attempts", attempts)
+	pipe.ZAdd(ctx, retryKey, redis.Z{Score: float64(next.UnixMilli()), Member: id})
+	pipe.Exec(ctx)
+	if err := w.q.recordAttempt(ctx, id, repo.MessageStatusQueued, attempts, sendErr); err != nil {
+		w.logger.Error("failed to record message attempt", "id", id, "error", err)
+	}
+	w.logger.Warn("message delivery failed, will retry", "id", id, "attempts", attempts, "next_attempt", next, "error", sendErr)
+	return nil
+}
+
+// expire fails a message whose pending copy is gone before it could be sent, so its
+// row doesn't stay queued. Rows that already left 'queued' are not touched.
+func (w *Worker) expire(ctx context.Context, id string) {
+	msg, err := w.q.message(ctx, id)
+	if errors.Is(err, ErrNotFound) || (err == nil && msg.Status != repo.MessageStatusQueued) {
+		return
+	}
+	if err == nil {
+		err = w.q.recordAttempt(ctx, id, repo.MessageStatusFailed, int(msg.Attempts), errExpired)
+	}
+	if err != nil {
+		w.logger.Error("failed to record expired message", "id", id, "error", err)
+		return
+	}
+	w.logger.Warn("message expired before it was sent", "id", id, "attempts", msg.Attempts)
+}
+
+// backoff returns BaseBackoff * 2^(attempts-1), capped at MaxBackoff.
+func (w *Worker) backoff(attempts int) time.Duration {
+	d := w.cfg.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= w.cfg.MaxBackoff {
+			return w.cfg.MaxBackoff
+		}
+	}
+	return d
+}
@@ -0,0 +1,366 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/pkg/messenger"
+)
+
+// memStore is an in-memory Store mirroring the SQL in sql/query.sql.
+type memStore struct {
+	mu   sync.Mutex
+	msgs map[pgtype.UUID]*repo.Message
+}
+
+func newMemStore() *memStore { return &memStore{msgs: map[pgtype.UUID]*repo.Message{}} }
+
+func (s *memStore) CreateMessage(ctx context.Context, arg repo.CreateMessageParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs[arg.ID] = &repo.Message{
+		ID:       arg.ID,
+		Phone:    arg.Phone,
+		Channel:  arg.Channel,
+		Status:   repo.MessageStatusQueued,
+		Encoding: arg.Encoding,
+		Segments: arg.Segments,
+		QueuedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+	}
+	return nil
+}
+
+func (s *memStore) MarkMessageSent(ctx context.Context, arg repo.MarkMessageSentParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := s.msgs[arg.ID]; ok && m.Status == repo.MessageStatusQueued {
+		m.Status = repo.MessageStatusSent
+		m.Attempts = arg.Attempts
+		m.Provider = arg.Provider
+		m.ProviderMessageID = arg.ProviderMessageID
+		m.SentAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	}
+	return nil
+}
+
+func (s *memStore) RecordMessageAttempt(ctx context.Context, arg repo.RecordMessageAttemptParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := s.msgs[arg.ID]; ok && m.Status == repo.MessageStatusQueued {
+		m.Status = arg.Status
+		m.Attempts = arg.Attempts
+		m.LastError = arg.LastError
+		if arg.Status == repo.MessageStatusFailed {
+			m.FailedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (s *memStore) ApplyDeliveryReport(ctx context.Context, arg repo.ApplyDeliveryReportParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.msgs {
+		if m.Provider != arg.Provider || m.ProviderMessageID != arg.ProviderMessageID {
+			continue
+		}
+		if m.Status == repo.MessageStatusDelivered || (m.Status == repo.MessageStatusFailed && arg.Status != repo.MessageStatusDelivered) {
+			return 0, nil
+		}
+		m.Status = arg.Status
+		m.ErrorCode = arg.ErrorCode
+		if arg.Status == repo.MessageStatusDelivered {
+			m.DeliveredAt = arg.DeliveredAt
+		}
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (s *memStore) GetMessageByID(ctx context.Context, id pgtype.UUID) (repo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := s.msgs[id]; ok {
+		return *m, nil
+	}
+	return repo.Message{}, pgx.ErrNoRows
+}
+
+func (s *memStore) ListMessagesByPhone(ctx context.Context, arg repo.ListMessagesByPhoneParams) ([]repo.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []repo.Message
+	for _, m := range s.msgs {
+		if m.Phone == arg.Phone {
+			out = append(out, *m)
+		}
+	}
+	return out, nil
+}
+
+type providerFunc func(ctx context.Context, msg messenger.Message) (messenger.Receipt, error)
+
+func (f providerFunc) Send(ctx context.Context, msg messenger.Message) (messenger.Receipt, error) {
+	return f(ctx, msg)
+}
+
+func newTestWorker(t *testing.T, p messenger.Provider) (*Worker, *redis.Client, *time.Time) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	now := time.Unix(1_700_000_000, 0)
+	q := NewQueue(rdb, newMemStore(), 5*time.Minute)
+	q.now = func() time.Time { return now }
+
+	w := NewWorker(q, p, WorkerConfig{
+		Consumer:    "test",
+		MaxAttempts: 3,
+		BaseBackoff: time.Second,
+		MaxBackoff:  4 * time.Second,
+		Block:       10 * time.Millisecond,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, rdb.XGroupCreateMkStream(context.Background(), streamKey, groupName, "0").Err())
+	return w, rdb, &now
+}
+
+func TestWorker_DeliversQueuedMessage(t *testing.T) {
+	var sent []messenger.Message
+	w, rdb, _ := newTestWorker(t, providerFunc(func(ctx context.Context, msg messenger.Message) (messenger.Receipt, error) {
+		sent = append(sent, msg)
+		return messenger.Receipt{Provider: "twilio", MessageID: "SM1"}, nil
+	}))
+	ctx := context.Background()
+
+	receipt, err := w.q.Send(ctx, messenger.Message{To: "+251911223344", Body: "code 123456"})
+	require.NoError(t, err)
+
+	st, err := w.q.Status(ctx, receipt.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, messenger.StatusQueued, st.Status)
+
+	require.NoError(t, w.poll(ctx))
+
+	require.Len(t, sent, 1)
+	assert.Equal(t, "+251911223344", sent[0].To)
+
+	st, err = w.q.Status(ctx, receipt.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, messenger.StatusSent, st.Status)
+	assert.Equal(t, 1, st.Attempts)
+	assert.Equal(t, "twilio", st.Provider)
+	assert.NotNil(t, st.SentAt)
+
+	// The OTP text must not outlive delivery, and the stream entry is consumed
+	assert.Zero(t, rdb.Exists(ctx, messageKey(receipt.MessageID)).Val())
+	assert.Zero(t, rdb.XLen(ctx, streamKey).Val())
+
+	// A late "sent" receipt must not undo "delivered"
+	require.NoError(t, w.q.ApplyReport(ctx, messenger.DeliveryReport{Provider: "twilio", MessageID: "SM1", Status: messenger.StatusDelivered}))
+	assert.ErrorIs(t, w.q.ApplyReport(ctx, messenger.DeliveryReport{Provider: "twilio", MessageID: "SM1", Status: messenger.StatusSent}), ErrNotFound)
+
+	st, err = w.q.Status(ctx, receipt.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, messenger.StatusDelivered, st.Status)
+	assert.NotNil(t, st.DeliveredAt)
+
+	assert.ErrorIs(t, w.q.ApplyReport(ctx, messenger.DeliveryReport{Provider: "twilio", MessageID: "unknown", Status: messenger.StatusDelivered}), ErrNotFound)
+}
+
+func TestWorker_RetriesWithBackoffThenDeadLetters(t *testing.T) {
+	calls := 0
+	w, rdb, now := newTestWorker(t, providerFunc(func(ctx context.Context, msg messenger.Message) (messenger.Receipt, error) {
+		calls++
+		return messenger.Receipt{}, &messenger.SendError{Provider: "twilio", StatusCode: 503, Retryable: true, Err: errors.New("unavailable")}
+	}))
+	ctx := context.Background()
+
+	receipt, err := w.q.Send(ctx, messenger.Message{To: "+251911223344", Body: "code 123456"})
+	require.NoError(t, err)
+	id := receipt.MessageID
+
+	require.NoError(t, w.poll(ctx))
+	assert.Equal(t, 1, calls)
+	score := rdb.ZScore(ctx, retryKey, id).Val()
+	assert.Equal(t, float64(now.Add(time.Second).UnixMilli()), score, "first retry after BaseBackoff")
+
+	// Not due yet: nothing happens
+	require.NoError(t, w.poll(ctx))
+	assert.Equal(t, 1, calls)
+
+	*now = now.Add(time.Second)
+	require.NoError(t, w.poll(ctx))
+	assert.Equal(t, 2, calls)
+	score = rdb.ZScore(ctx, retryKey, id).Val()
+	assert.Equal(t, float64(now.Add(2*time.Second).UnixMilli()), score, "backoff doubles")
+
+	*now = now.Add(2 * time.Second)
+	require.NoError(t, w.poll(ctx))
+	assert.Equal(t, 3, calls)
+
+	st, err := w.q.Status(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, messenger.StatusFailed, st.Status)
+	assert.Equal(t, 3, st.Attempts)
+	assert.NotNil(t, st.FailedAt)
+	assert.Equal(t, int64(1), rdb.XLen(ctx, deadKey).Val())
+	assert.Zero(t, rdb.ZCard(ctx, retryKey).Val())
+}
+
+func TestWorker_PermanentFailureSkipsRetries(t *testing.T) {
+	calls := 0
+	w, rdb, _ := newTestWorker(t, providerFunc(func(ctx context.Context, msg messenger.Message) (messenger.Receipt, error) {
+		calls++
+		return messenger.Receipt{}, &messenger.SendError{Provider: "twilio", StatusCode: 400, Err: errors.New("invalid number")}
+	}))
+	ctx := context.Background()
+
+	receipt, err := w.q.Send(ctx, messenger.Message{To: "+251911223344", Body: "code 123456"})
+	require.NoError(t, err)
+
+	require.NoError(t, w.poll(ctx))
+	assert.Equal(t, 1, calls)
+
+	st, err := w.q.Status(ctx, receipt.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, messenger.StatusFailed, st.Status)
+	assert.Equal(t, int64(1), rdb.XLen(ctx, deadKey).Val())
+}
+
+func TestQueue_CodesDoNotOutliveTheOTP(t *testing.T) {
+	w, rdb, _ := newTestWorker(t, nil)
+	ctx := context.Background()
+
+	sms, err := w.q.Send(ctx, messenger.Message{To: "+251911223344", Body: "code 123456", Code: "123456"})
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, rdb.TTL(ctx, messageKey(sms.MessageID)).Val())
+	fields := rdb.HGetAll(ctx, messageKey(sms.MessageID)).Val()
+	assert.Equal(t, "code 123456", fields["body"])
+	assert.NotContains(t, fields, "code")
+
+	telegram, err := w.q.Send(ctx, messenger.Message{To: "+251911223344", Body: "code 123456", Code: "123456", Channel: messenger.ChannelTelegram})
+	require.NoError(t, err)
+	fields = rdb.HGetAll(ctx, messageKey(telegram.MessageID)).Val()
+	assert.Equal(t, "123456", fields["code"])
+	assert.NotContains(t, fields, "body")
+
+	// Notices without a code may wait longer for a provider to recover
+	notice, err := w.q.Send(ctx, messenger.Message{To: "+251911223344", Body: "Your number was changed"})
+	require.NoError(t, err)
+	assert.Equal(t, pendingTTL, rdb.TTL(ctx, messageKey(notice.MessageID)).Val())
+}
+
+func TestWorker_FailsMessagesThatExpireBeforeSending(t *testing.T) {
+	calls := 0
+	w, rdb, now := newTestWorker(t, providerFunc(func(ctx context.Context, msg messenger.Message) (messenger.Receipt, error) {
+		calls++
+		return messenger.Receipt{}, &messenger.SendError{Provider: "twilio", StatusCode: 503, Retryable: true, Err: errors.New("unavailable")}
+	}))
+	ctx := context.Background()
+
+	receipt, err := w.q.Send(ctx, messenger.Message{To: "+251911223344", Body: "code 123456", Code: "123456"})
+	require.NoError(t, err)
+	require.NoError(t, w.poll(ctx))
+
+	// The code's lifetime runs out while the retry waits
+	rdb.Del(ctx, messageKey(receipt.MessageID))
+	*now = now.Add(time.Second)
+	require.NoError(t, w.poll(ctx))
+	assert.Equal(t, 1, calls)
+
+	st, err := w.q.Status(ctx, receipt.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, messenger.StatusFailed, st.Status)
+	assert.Equal(t, 1, st.Attempts)
+	assert.NotNil(t, st.FailedAt)
+}
+
+func TestWorker_KeepsEntryWhenTheMessageCannotBeRead(t *testing.T) {
+	w, rdb, _ := newTestWorker(t, providerFunc(func(ctx context.Context, msg messenger.Message) (messenger.Receipt, error) {
+		t.Fatal("nothing should be sent")
+		return messenger.Receipt{}, nil
+	}))
+	ctx := context.Background()
+
+	receipt, err := w.q.Send(ctx, messenger.Message{To: "+251911223344", Body: "code 123456"})
+	require.NoError(t, err)
+	// HGETALL fails with WRONGTYPE, standing in for any Redis error
+	rdb.Set(ctx, messageKey(receipt.MessageID), "x", 0)
+
+	require.NoError(t, w.poll(ctx))
+	pending := rdb.XPending(ctx, streamKey, groupName).Val()
+	assert.Equal(t, int64(1), pending.Count)
+	assert.Equal(t, int64(1), rdb.XLen(ctx, streamKey).Val())
+
+	st, err := w.q.Status(ctx, receipt.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, messenger.StatusQueued, st.Status)
+}
+
+func TestQueue_SuppressedSendsLookLikeFreshOnes(t *testing.T) {
+	w, rdb, _ := newTestWorker(t, nil)
+	ctx := context.Background()
+	r := chi.NewRouter()
+	r.Get("/messages/{messageID}", NewHandler(w.q, nil, "", slog.New(slog.NewTextHandler(io.Discard, nil))).GetStatus)
+	lookup := func(id string) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/messages/"+id, nil))
+		var body map[string]any
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		delete(body, "id")
+		delete(body, "queued_at")
+		return rec.Code, body
+	}
+
+	sent, err := w.q.Send(ctx, messenger.Message{To: "+251911223344", Body: "code 123456", Code: "123456"})
+	require.NoError(t, err)
+	suppressed, err := w.q.Suppress(ctx, messenger.Message{To: "+251911223355", Channel: messenger.ChannelSMS}, "sequential_numbers")
+	require.NoError(t, err)
+	assert.Equal(t, sent.Provider, suppressed.Provider)
+
+	sentCode, sentBody := lookup(sent.MessageID)
+	suppressedCode, suppressedBody := lookup(suppressed.MessageID)
+	assert.Equal(t, http.StatusOK, sentCode)
+	assert.Equal(t, sentCode, suppressedCode)
+	assert.Equal(t, sentBody, suppressedBody)
+
+	// Nothing was queued for the worker, and support staff can see why
+	assert.Zero(t, rdb.Exists(ctx, messageKey(suppressed.MessageID)).Val())
+	assert.Equal(t, int64(1), rdb.XLen(ctx, streamKey).Val())
+	msg, err := w.q.message(ctx, suppressed.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, "suppressed: sequential_numbers", msg.LastError.String)
+}
+
+func TestQueue_StatusNotFound(t *testing.T) {
+	w, _, _ := newTestWorker(t, nil)
+	_, err := w.q.Status(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = w.q.Status(context.Background(), "0b9f6c1e-5d0e-4c39-9b7e-2f4a8c1d3e55")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestWorker_Backoff(t *testing.T) {
+	w := NewWorker(nil, nil, WorkerConfig{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second}, slog.Default())
+	assert.Equal(t, time.Second, w.backoff(1))
+	assert.Equal(t, 2*time.Second, w.backoff(2))
+	assert.Equal(t, 4*time.Second, w.backoff(3))
+	assert.Equal(t, 5*time.Second, w.backoff(4))
+}
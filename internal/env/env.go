@@ -1,6 +1,11 @@
 package env
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // GetString : Gets the value from env
 func GetString(key string, fallback string) string {
@@ -10,3 +15,69 @@ func GetString(key string, fallback string) string {
 
 	return fallback
 }
+
+// GetInt : Gets an integer from env, falling back when unset or malformed
+func GetInt(key string, fallback int) int {
+	val, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+
+	return val
+}
+
+// GetDuration : Gets a time.Duration (e.g. "90s", "5m") from env
+func GetDuration(key string, fallback time.Duration) time.Duration {
+	val, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+
+	return val
+}
+
+// GetDurations : Gets a comma separated list of durations (e.g. "60s,2m,5m") from env.
+// The fallback is returned if any element is malformed.
+func GetDurations(key string, fallback []time.Duration) []time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+
+	var out []time.Duration
+	for _, part := range strings.Split(raw, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil {
+			return fallback
+		}
+		out = append(out, d)
+	}
+
+	return out
+}
+
+// GetList : Gets a comma separated list of strings from env, skipping empty entries
+func GetList(key string) []string {
+	var out []string
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+
+	return out
+}
+
+// GetMap : Gets a comma separated list of key=value pairs (e.g. "X-Api-Key=abc,X-Tenant=av") from env
+func GetMap(key string) map[string]string {
+	out := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			continue
+		}
+		out[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	return out
+}
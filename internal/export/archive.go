@@ -0,0 +1,164 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+)
+
+// securityEvent shows an event's details as JSON rather than base64.
+type securityEvent struct {
+	repo.SecurityEvent
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+// manifest is the archive's table of contents.
+type manifest struct {
+	AccountID   string    `json:"account_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Files       []string  `json:"files"`
+}
+
+// WriteArchive writes everything held about the account to w as a ZIP: the account
+// record, profile, address, sessions, security events and uploaded documents.
+// Entries are streamed one by one, so memory use doesn't grow with the archive.
+func WriteArchive(ctx context.Context, w io.Writer, store Store, mediaDir string, accountID pgtype.UUID) error {
+	zw := zip.NewWriter(w)
+	var files []string
+	add := func(name string, v any) error {
+		entry, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		files = append(files, name)
+		enc := json.NewEncoder(entry)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	acc, err := store.GetAccountByID(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if err := add("account.json", acc); err != nil {
+		return err
+	}
+
+	// Accounts that never filled in their profile have no rows here
+	user, err := store.GetUserByAccountID(ctx, accountID)
+	switch {
+	case err == nil:
+		if err := add("profile.json", user); err != nil {
+			return err
+		}
+	case !errors.Is(err, pgx.ErrNoRows):
+		return err
+	}
+	address, err := store.GetAddressByAccountID(ctx, accountID)
+	switch {
+	case err == nil:
+		if err := add("address.json", address); err != nil {
+			return err
+		}
+	case !errors.Is(err, pgx.ErrNoRows):
+		return err
+	}
+
+	sessions, err := store.ListSessionsByAccount(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if err := add("sessions.json", nonNil(sessions)); err != nil {
+		return err
+	}
+	events, err := store.ListSecurityEvents(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	out := make([]securityEvent, len(events))
+	for i, e := range events {
+		out[i] = securityEvent{SecurityEvent: e, Details: e.Details}
+	}
+	if err := add("security_events.json", out); err != nil {
+		return err
+	}
+
+	media, err := addMedia(ctx, zw, filepath.Join(mediaDir, accountID.String()))
+	if err != nil {
+		return err
+	}
+	files = append(files, media...)
+
+	if err := add("manifest.json", manifest{
+		AccountID:   accountID.String(),
+		GeneratedAt: time.Now().UTC(),
+		Files:       files,
+	}); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// addMedia copies the files under dir into the archive's media/ folder. Images are
+// already compressed, so they are stored as they are.
+func addMedia(ctx context.Context, zw *zip.Writer, dir string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == dir {
+			return fs.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Only regular files: a symlink must not smuggle other files into the archive
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join("media", filepath.ToSlash(rel))
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: info.ModTime()})
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.Copy(entry, f); err != nil {
+			return err
+		}
+		names = append(names, name)
+		return nil
+	})
+	return names, err
+}
+
+// nonNil makes empty lists encode as [] rather than null.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
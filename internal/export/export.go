@@ -0,0 +1,219 @@
+// Package export builds "download my data" archives. Handlers only queue a job in
+// Redis; a Worker writes the ZIP to disk and hands out a short-lived download link.
+package export
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+)
+
+const (
+	queueKey = "export:queue"
+
+	// DownloadPath is where download links point, relative to the public URL.
+	DownloadPath = "/api/v1/exports/"
+)
+
+// ErrNotFound is returned for unknown, expired or someone else's exports.
+var ErrNotFound = errors.New("export: not found")
+
+func jobKey(id string) string            { return "export:job:" + id }
+func accountKey(accountID string) string { return "export:account:" + accountID }
+func linkKey(token string) string        { return "export:link:" + token }
+
+// Store is the slice of the database an archive is built from.
+type Store interface {
+	GetAccountByID(ctx context.Context, id pgtype.UUID) (repo.Account, error)
+	GetUserByAccountID(ctx context.Context, accountID pgtype.UUID) (repo.User, error)
+	GetAddressByAccountID(ctx context.Context, accountID pgtype.UUID) (repo.Address, error)
+	ListSessionsByAccount(ctx context.Context, accountID pgtype.UUID) ([]repo.Session, error)
+	ListSecurityEvents(ctx context.Context, accountID pgtype.UUID) ([]repo.SecurityEvent, error)
+}
+
+// Config tunes where archives live and for how long.
+type Config struct {
+	// Dir holds finished archives. Defaults to store/exports.
+	Dir string
+	// MediaDir holds each account's uploads under <MediaDir>/<accountID>. Defaults to store/media.
+	MediaDir string
+	// PublicURL prefixes download links, e.g. https://api.addisverify.et. Empty gives relative links.
+	PublicURL string
+	// LinkTTL is how long a download link works. The archive is deleted after it. Defaults to 15m.
+	LinkTTL time.Duration
+	// JobTTL bounds how long a job may stay pending, e.g. after a worker crashed,
+	// before the account can ask again. Defaults to 1h.
+	JobTTL time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.Dir == "" {
+		c.Dir = "store/exports"
+	}
+	if c.MediaDir == "" {
+		c.MediaDir = "store/media"
+	}
+	if c.LinkTTL <= 0 {
+		c.LinkTTL = 15 * time.Minute
+	}
+	if c.JobTTL <= 0 {
+		c.JobTTL = time.Hour
+	}
+	return c
+}
+
+// Status is where a job is at.
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusReady   Status = "ready"
+	StatusFailed  Status = "failed"
+)
+
+// Job is an export request and, once ready, its download link.
+type Job struct {
+	ID          string     `json:"id" example:"3f1c2a5e-8d4b-4f6a-9c2e-1b7d0e9a4c33"`
+	Status      Status     `json:"status" example:"ready"`
+	RequestedAt time.Time  `json:"requested_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// DownloadURL works without a bearer token until ExpiresAt, so it can be opened in a browser
+	DownloadURL string     `json:"download_url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	// Size of the archive in bytes
+	Size int64 `json:"size,omitempty" example:"5242880"`
+}
+
+// storedJob is a Job as kept in Redis, with what the API doesn't show.
+type storedJob struct {
+	Job
+	AccountID string `json:"account_id"`
+	Token     string `json:"token,omitempty"`
+}
+
+// Exporter queues export jobs and serves finished archives.
+type Exporter struct {
+	rdb redis.Cmdable
+	cfg Config
+	now func() time.Time
+}
+
+// New creates an Exporter backed by rdb.
+func New(rdb redis.Cmdable, cfg Config) *Exporter {
+	return &Exporter{rdb: rdb, cfg: cfg.withDefaults(), now: time.Now}
+}
+
+// Request queues an export for the account. While an earlier job is still pending
+// or its link still works, that job is returned instead of building another archive.
+func (e *Exporter) Request(ctx context.Context, accountID string) (Job, error) {
+	if id, err := e.rdb.Get(ctx, accountKey(accountID)).Result(); err == nil {
+		if job, err := e.load(ctx, id); err == nil && job.Status != StatusFailed {
+			return job.Job, nil
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		return Job{}, err
+	}
+
+	job := storedJob{
+		Job:       Job{ID: uuid.NewString(), Status: StatusPending, RequestedAt: e.now().UTC()},
+		AccountID: accountID,
+	}
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return Job{}, err
+	}
+	pipe := e.rdb.TxPipeline()
+	pipe.Set(ctx, jobKey(job.ID), raw, e.cfg.JobTTL)
+	pipe.Set(ctx, accountKey(accountID), job.ID, e.cfg.JobTTL)
+	pipe.LPush(ctx, queueKey, job.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Job{}, err
+	}
+	return job.Job, nil
+}
+
+// Get returns job id, as long as it belongs to the account.
+func (e *Exporter) Get(ctx context.Context, accountID, id string) (Job, error) {
+	job, err := e.load(ctx, id)
+	if err != nil {
+		return Job{}, err
+	}
+	if job.AccountID != accountID {
+		return Job{}, ErrNotFound
+	}
+	return job.Job, nil
+}
+
+// Open resolves a download token to its archive. The caller closes the file.
+func (e *Exporter) Open(ctx context.Context, token string) (Job, *os.File, error) {
+	id, err := e.rdb.Get(ctx, linkKey(token)).Result()
+	if errors.Is(err, redis.Nil) {
+		return Job{}, nil, ErrNotFound
+	}
+	if err != nil {
+		return Job{}, nil, err
+	}
+	job, err := e.load(ctx, id)
+	if err != nil {
+		return Job{}, nil, err
+	}
+	f, err := os.Open(e.archivePath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Job{}, nil, ErrNotFound
+	}
+	return job.Job, f, err
+}
+
+func (e *Exporter) load(ctx context.Context, id string) (storedJob, error) {
+	raw, err := e.rdb.Get(ctx, jobKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return storedJob{}, ErrNotFound
+	}
+	if err != nil {
+		return storedJob{}, err
+	}
+	var job storedJob
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return storedJob{}, err
+	}
+	return job, nil
+}
+
+// save overwrites a job and its account pointer, both living for ttl.
+func (e *Exporter) save(ctx context.Context, job storedJob, ttl time.Duration) error {
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	pipe := e.rdb.TxPipeline()
+	pipe.Set(ctx, jobKey(job.ID), raw, ttl)
+	pipe.Set(ctx, accountKey(job.AccountID), job.ID, ttl)
+	if job.Token != "" {
+		pipe.Set(ctx, linkKey(job.Token), job.ID, ttl)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (e *Exporter) archivePath(id string) string {
+	return filepath.Join(e.cfg.Dir, id+".zip")
+}
+
+// newToken returns an unguessable download token.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
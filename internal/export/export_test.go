@@ -0,0 +1,281 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+)
+
+var accID = pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+
+type fakeStore struct {
+	user    *repo.User
+	events  []repo.SecurityEvent
+	failing bool
+}
+
+func (s *fakeStore) GetAccountByID(_ context.Context, id pgtype.UUID) (repo.Account, error) {
+	if s.failing {
+		return repo.Account{}, errors.New("connection reset")
+	}
+	return repo.Account{ID: id, Phone: "+251911223344", Status: repo.AccountStatusActive}, nil
+}
+
+func (s *fakeStore) GetUserByAccountID(_ context.Context, id pgtype.UUID) (repo.User, error) {
+	if s.user == nil {
+		return repo.User{}, pgx.ErrNoRows
+	}
+	return *s.user, nil
+}
+
+func (s *fakeStore) GetAddressByAccountID(context.Context, pgtype.UUID) (repo.Address, error) {
+	return repo.Address{}, pgx.ErrNoRows
+}
+
+func (s *fakeStore) ListSessionsByAccount(context.Context, pgtype.UUID) ([]repo.Session, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) ListSecurityEvents(context.Context, pgtype.UUID) ([]repo.SecurityEvent, error) {
+	return s.events, nil
+}
+
+type fixture struct {
+	mr     *miniredis.Miniredis
+	e      *Exporter
+	worker *Worker
+	store  *fakeStore
+	media  string
+}
+
+func newFixture(t *testing.T) *fixture {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	store := &fakeStore{
+		user: &repo.User{AccountID: accID, FirstName: "Abebe", LastName: "Kebede"},
+		events: []repo.SecurityEvent{
+			{AccountID: accID, EventType: "refresh_token_reuse", Details: []byte(`{"jti":"abc"}`)},
+		},
+	}
+	media := t.TempDir()
+	e := New(rdb, Config{Dir: t.TempDir(), MediaDir: media, PublicURL: "https://api.example.com"})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return &fixture{mr: mr, e: e, worker: NewWorker(e, store, logger), store: store, media: media}
+}
+
+// runQueued builds whatever is on the queue, as the worker loop would.
+func (f *fixture) runQueued(t *testing.T) {
+	for {
+		id, err := f.e.rdb.RPop(context.Background(), queueKey).Result()
+		if errors.Is(err, redis.Nil) {
+			return
+		}
+		require.NoError(t, err)
+		f.worker.process(context.Background(), id)
+	}
+}
+
+func readZip(t *testing.T, b []byte) map[string][]byte {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		files[f.Name], err = io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+	}
+	return files
+}
+
+func TestExport_EndToEnd(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	require.NoError(t, os.MkdirAll(filepath.Join(f.media, accID.String()), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(f.media, accID.String(), "gov_id_1.jpg"), []byte("jpeg bytes"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(f.media, "someone-else.jpg"), []byte("not yours"), 0o644))
+
+	job, err := f.e.Request(ctx, accID.String())
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, job.Status)
+	assert.Empty(t, job.DownloadURL)
+
+	again, err := f.e.Request(ctx, accID.String())
+	require.NoError(t, err)
+	assert.Equal(t, job.ID, again.ID, "a pending job is not queued twice")
+
+	f.runQueued(t)
+	job, err = f.e.Get(ctx, accID.String(), job.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusReady, job.Status)
+	require.True(t, strings.HasPrefix(job.DownloadURL, "https://api.example.com"+DownloadPath))
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), *job.ExpiresAt, time.Minute)
+	assert.Positive(t, job.Size)
+
+	// The link alone is enough to download
+	token := strings.TrimPrefix(job.DownloadURL, "https://api.example.com"+DownloadPath)
+	h := NewHandler(f.e, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	r := chi.NewRouter()
+	r.Get(DownloadPath+"{token}", h.Download)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, DownloadPath+token, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+	files := readZip(t, w.Body.Bytes())
+	assert.Contains(t, files, "account.json")
+	assert.Contains(t, files, "profile.json")
+	assert.NotContains(t, files, "address.json", "no address was ever saved")
+	assert.JSONEq(t, "[]", string(files["sessions.json"]))
+	assert.Equal(t, "jpeg bytes", string(files["media/gov_id_1.jpg"]))
+	assert.Len(t, files, 6, "account, profile, sessions, events, one image, manifest")
+
+	var events []map[string]any
+	require.NoError(t, json.Unmarshal(files["security_events.json"], &events))
+	assert.Equal(t, map[string]any{"jti": "abc"}, events[0]["details"], "details stay JSON")
+
+	var m manifest
+	require.NoError(t, json.Unmarshal(files["manifest.json"], &m))
+	assert.Equal(t, accID.String(), m.AccountID)
+	assert.Contains(t, m.Files, "media/gov_id_1.jpg")
+
+	// Once the link expires, so does the download
+	f.mr.FastForward(16 * time.Minute)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, DownloadPath+token, nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestExport_DownloadOutlivesServerWriteTimeout(t *testing.T) {
+	f := newFixture(t)
+	job, err := f.e.Request(context.Background(), accID.String())
+	require.NoError(t, err)
+	f.runQueued(t)
+	job, err = f.e.Get(context.Background(), accID.String(), job.ID)
+	require.NoError(t, err)
+	token := strings.TrimPrefix(job.DownloadURL, "https://api.example.com"+DownloadPath)
+
+	h := NewHandler(f.e, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	r := chi.NewRouter()
+	r.Get(DownloadPath+"{token}", func(w http.ResponseWriter, r *http.Request) {
+		// A slow link: by the time the archive is written the server's deadline has passed
+		time.Sleep(200 * time.Millisecond)
+		h.Download(w, r)
+	})
+	srv := httptest.NewUnstartedServer(r)
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + DownloadPath + token)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, readZip(t, body), "manifest.json")
+}
+
+func TestExport_FailedJobCanBeRetried(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	f.store.failing = true
+
+	job, err := f.e.Request(ctx, accID.String())
+	require.NoError(t, err)
+	f.runQueued(t)
+	job, err = f.e.Get(ctx, accID.String(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, job.Status)
+
+	entries, _ := os.ReadDir(f.e.cfg.Dir)
+	assert.Empty(t, entries, "no partial archive is left behind")
+
+	retry, err := f.e.Request(ctx, accID.String())
+	require.NoError(t, err)
+	assert.NotEqual(t, job.ID, retry.ID)
+}
+
+func TestExport_OnlyTheOwnerSeesAJob(t *testing.T) {
+	f := newFixture(t)
+	job, err := f.e.Request(context.Background(), accID.String())
+	require.NoError(t, err)
+
+	other := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+	h := NewHandler(f.e, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	get := func(id pgtype.UUID) int {
+		req := httptest.NewRequest(http.MethodGet, "/accounts/me/export/"+job.ID, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("exportID", job.ID)
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		ctx = context.WithValue(ctx, middlewares.UserIDKey, id)
+		w := httptest.NewRecorder()
+		h.GetStatus(w, req.WithContext(ctx))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, get(accID))
+	assert.Equal(t, http.StatusNotFound, get(other))
+}
+
+func TestWorker_Sweep(t *testing.T) {
+	f := newFixture(t)
+	dir := f.e.cfg.Dir
+	old, fresh := filepath.Join(dir, "old.zip"), filepath.Join(dir, "fresh.zip")
+	require.NoError(t, os.WriteFile(old, []byte("zip"), 0o600))
+	require.NoError(t, os.WriteFile(fresh, []byte("zip"), 0o600))
+	stale := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(old, stale, stale))
+
+	f.worker.sweep()
+	assert.NoFileExists(t, old)
+	assert.FileExists(t, fresh)
+}
+
+func TestWorker_SweepsWhileBusy(t *testing.T) {
+	f := newFixture(t)
+	f.worker.sweepEvery = 10 * time.Millisecond
+	old := filepath.Join(f.e.cfg.Dir, "old.zip")
+	require.NoError(t, os.WriteFile(old, []byte("zip"), 0o600))
+	stale := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(old, stale, stale))
+
+	// Keep the queue from ever running dry
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for ctx.Err() == nil {
+			f.e.rdb.RPush(ctx, queueKey, "unknown-job")
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	go f.worker.Run(ctx)
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(old)
+		return errors.Is(err, os.ErrNotExist)
+	}, time.Second, 10*time.Millisecond)
+}
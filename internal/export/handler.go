@@ -0,0 +1,131 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+)
+
+// Handler exposes data exports over HTTP.
+type Handler interface {
+	Request(w http.ResponseWriter, r *http.Request)
+	GetStatus(w http.ResponseWriter, r *http.Request)
+	Download(w http.ResponseWriter, r *http.Request)
+}
+
+// downloadWriteTimeout replaces the server's short write timeout for archive
+// downloads, which may carry uploaded media over slow mobile links.
+const downloadWriteTimeout = 30 * time.Minute
+
+type handler struct {
+	exporter *Exporter
+	logger   *slog.Logger
+}
+
+// NewHandler ensures the struct implements the Handler interface.
+func NewHandler(e *Exporter, l *slog.Logger) Handler {
+	return &handler{exporter: e, logger: l}
+}
+
+// Request godoc
+// @Summary      Request a Data Export
+// @Description  Starts building a ZIP of everything held about the account: account record, profile, address, sessions, security events and uploaded documents. Poll the job until it is ready, then open its download link, which works for 15 minutes. Asking again while a job is pending or its link still works returns the same job.
+// @Tags         accounts
+// @Security     BearerAuth
+// @Produce      json
+// @Success      202  {object}  Job
+// @Failure      401  {object}  json.ErrorResponse
+// @Router       /api/v1/accounts/me/export [post]
+func (h *handler) Request(w http.ResponseWriter, r *http.Request) {
+	accID, ok := r.Context().Value(middlewares.UserIDKey).(pgtype.UUID)
+	if !ok || !accID.Valid {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrUnauthorizedError)
+		return
+	}
+
+	job, err := h.exporter.Request(r.Context(), accID.String())
+	if err != nil {
+		h.logger.Error("failed to queue export", "error", err)
+		json.WriteError(w, http.StatusServiceUnavailable, constants.ErrServiceUnavailable)
+		return
+	}
+	h.logger.Info("export requested", "account_id", accID, "export_id", job.ID, "status", job.Status)
+	json.Write(w, http.StatusAccepted, job)
+}
+
+// GetStatus godoc
+// @Summary      Data Export Status
+// @Description  Returns an export job; once ready it carries the download link and when it expires.
+// @Tags         accounts
+// @Security     BearerAuth
+// @Produce      json
+// @Param        exportID  path      string  true  "Export ID"
+// @Success      200       {object}  Job
+// @Failure      404       {object}  json.ErrorResponse
+// @Router       /api/v1/accounts/me/export/{exportID} [get]
+func (h *handler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	accID, ok := r.Context().Value(middlewares.UserIDKey).(pgtype.UUID)
+	if !ok || !accID.Valid {
+		json.WriteError(w, http.StatusUnauthorized, constants.ErrUnauthorizedError)
+		return
+	}
+
+	job, err := h.exporter.Get(r.Context(), accID.String(), chi.URLParam(r, "exportID"))
+	if errors.Is(err, ErrNotFound) {
+		json.WriteError(w, http.StatusNotFound, constants.ErrExportNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to load export", "error", err)
+		json.WriteError(w, http.StatusServiceUnavailable, constants.ErrServiceUnavailable)
+		return
+	}
+	json.Write(w, http.StatusOK, job)
+}
+
+// Download godoc
+// @Summary      Download a Data Export
+// @Description  Streams the export archive. The token in the link is the only credential, so the link can be opened in a browser; it stops working after 15 minutes. Range requests are supported for resuming.
+// @Tags         accounts
+// @Produce      application/zip
+// @Param        token  path  string  true  "Download token from the export job"
+// @Success      200    {file}    binary
+// @Failure      404    {object}  json.ErrorResponse
+// @Router       /api/v1/exports/{token} [get]
+func (h *handler) Download(w http.ResponseWriter, r *http.Request) {
+	job, f, err := h.exporter.Open(r.Context(), chi.URLParam(r, "token"))
+	if errors.Is(err, ErrNotFound) {
+		json.WriteError(w, http.StatusNotFound, constants.ErrExportNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to open export", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		h.logger.Error("failed to stat export", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+	name := fmt.Sprintf("addisverify-export-%s.zip", job.RequestedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Cache-Control", "no-store")
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(downloadWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		h.logger.Warn("failed to extend export download deadline", "error", err)
+	}
+	// ServeContent streams from disk and handles Range, so the archive never sits in memory
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
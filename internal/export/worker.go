@@ -0,0 +1,171 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+)
+
+// Worker builds queued archives.
+type Worker struct {
+	e      *Exporter
+	store  Store
+	logger *slog.Logger
+	// block is how long BLPOP waits for a job before checking for cancellation
+	block time.Duration
+	// sweepEvery is how often expired archives are deleted, however busy the queue is
+	sweepEvery time.Duration
+}
+
+// NewWorker creates a worker that builds e's jobs from store.
+func NewWorker(e *Exporter, store Store, logger *slog.Logger) *Worker {
+	return &Worker{
+		e:          e,
+		store:      store,
+		logger:     logger.With("component", "export_worker"),
+		block:      5 * time.Second,
+		sweepEvery: time.Minute,
+	}
+}
+
+// Run builds archives until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) error {
+	if err := os.MkdirAll(w.e.cfg.Dir, 0o700); err != nil {
+		return err
+	}
+	go w.sweepLoop(ctx)
+
+	for ctx.Err() == nil {
+		res, err := w.e.rdb.BLPop(ctx, w.block, queueKey).Result()
+		switch {
+		case errors.Is(err, redis.Nil):
+		case err != nil:
+			if ctx.Err() == nil {
+				w.logger.Error("export queue poll failed", "error", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+			}
+		default:
+			// BLPOP answers [key, value]
+			w.process(ctx, res[1])
+		}
+	}
+	return nil
+}
+
+// process builds one job's archive and publishes its download link. Failures mark
+// the job failed so the account can ask again.
+func (w *Worker) process(ctx context.Context, id string) {
+	job, err := w.e.load(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return
+	}
+	if err != nil {
+		w.logger.Error("failed to load export job", "export_id", id, "error", err)
+		return
+	}
+
+	size, err := w.build(ctx, job)
+	if err != nil {
+		w.logger.Error("failed to build export", "export_id", id, "error", err)
+		job.Status = StatusFailed
+		if err := w.e.save(ctx, job, w.e.cfg.JobTTL); err != nil {
+			w.logger.Error("failed to mark export failed", "export_id", id, "error", err)
+		}
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		w.logger.Error("failed to create download token", "error", err)
+		return
+	}
+	now := w.e.now().UTC()
+	expires := now.Add(w.e.cfg.LinkTTL)
+	job.Status = StatusReady
+	job.Token = token
+	job.Size = size
+	job.CompletedAt = &now
+	job.ExpiresAt = &expires
+	job.DownloadURL = w.e.cfg.PublicURL + DownloadPath + token
+	if err := w.e.save(ctx, job, w.e.cfg.LinkTTL); err != nil {
+		w.logger.Error("failed to publish export", "export_id", id, "error", err)
+		return
+	}
+	w.logger.Info("export ready", "export_id", id, "account_id", job.AccountID, "bytes", size)
+}
+
+// build writes the archive next to its final name and renames it once complete,
+// so a download never sees half an archive.
+func (w *Worker) build(ctx context.Context, job storedJob) (int64, error) {
+	var accID pgtype.UUID
+	if err := accID.Scan(job.AccountID); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(w.e.cfg.Dir, job.ID+"-*.part")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := WriteArchive(ctx, tmp, w.store, w.e.cfg.MediaDir, accID); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return info.Size(), os.Rename(tmp.Name(), w.e.archivePath(job.ID))
+}
+
+// sweepLoop sweeps every sweepEvery until ctx is cancelled.
+func (w *Worker) sweepLoop(ctx context.Context) {
+	ticker := time.NewTicker(w.sweepEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.sweep()
+		}
+	}
+}
+
+// sweep deletes archives whose download link has expired, and leftovers from builds
+// a crash interrupted.
+func (w *Worker) sweep() {
+	entries, err := os.ReadDir(w.e.cfg.Dir)
+	if err != nil {
+		w.logger.Error("failed to list exports", "error", err)
+		return
+	}
+	cutoff := w.e.now().Add(-w.e.cfg.LinkTTL)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".zip") && !strings.HasSuffix(name, ".part") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(w.e.cfg.Dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			w.logger.Error("failed to delete expired export", "file", name, "error", err)
+		}
+	}
+}
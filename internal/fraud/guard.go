@@ -0,0 +1,355 @@
+// Package fraud screens OTP sends for SMS pumping (toll fraud): scripted requests
+// that make us pay for messages to number ranges whose operator shares the revenue.
+//
+// The Guard keeps Redis counters per country prefix, number range, client IP and
+// ASN, and learns the usual hourly volume per prefix to spot spikes. Clients over
+// their budget are blocked; ranges over theirs, ranges walked sequentially and
+// spiking prefixes only make sends to them need a challenge, since the numbers are
+// the attacker's pick but the subscribers on them are real. Blocked requests should
+// be answered exactly like successful ones so attackers can't tell which of their
+// numbers were dropped.
+package fraud
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Block reasons reported in a Verdict.
+const (
+	ReasonBlocked       = "blocked"
+	ReasonCountryBudget = "country_budget"
+	ReasonIPBudget      = "ip_budget"
+	ReasonASNBudget     = "asn_budget"
+)
+
+const (
+	dailyWindow = 24 * time.Hour
+	// baselineHours is how much history a prefix's normal hourly volume is learned from.
+	baselineHours = 24
+)
+
+// Config sets the budgets and detectors. A zero budget or threshold disables that check.
+type Config struct {
+	// CountryDailyBudget caps sends per country calling code per day.
+	CountryDailyBudget int
+	// Past RangeDailyBudget sends a day to a block of 1000 numbers, every send to it
+	// needs a challenge. Ranges are never blocked: the numbers are the attacker's
+	// choice, the subscribers on them are real.
+	RangeDailyBudget int
+	IPDailyBudget    int
+	ASNDailyBudget   int
+
+	// Past these daily counts (below the budgets) a client must solve a challenge
+	// before each send.
+	IPChallengeAfter  int
+	ASNChallengeAfter int
+
+	// A prefix spikes when its sends this hour reach SpikeMin and exceed SpikeFactor
+	// times its average hourly volume over the last day. Sends to it then need a
+	// challenge; prefixes are never blocked, as that would lock out everyone on an
+	// operator. Prefixes we rarely send to have a baseline near zero, so SpikeMin
+	// alone decides for them.
+	SpikeFactor int
+	SpikeMin    int
+	// ServedPrefixes exempts E.164 prefixes (e.g. "+2519") from spike detection and
+	// leaves them to the budgets. Empty by default: every prefix is watched, busy ones
+	// against their own baseline.
+	ServedPrefixes []string
+
+	// SequentialRun numbers in a row (…340, …341, …342) requested within
+	// SequentialWindow get their range challenged for BlockTTL.
+	SequentialRun    int
+	SequentialWindow time.Duration
+
+	// BlockTTL is how long a tripped IP or ASN stays blocked.
+	BlockTTL time.Duration
+
+	// ASNHeader names the header the edge proxy puts the client's ASN in. Empty disables ASN budgets.
+	ASNHeader string
+}
+
+// DefaultConfig returns budgets suitable for a single-country deployment.
+func DefaultConfig() Config {
+	return Config{
+		CountryDailyBudget: 50000,
+		RangeDailyBudget:   20,
+		IPDailyBudget:      30,
+		ASNDailyBudget:     5000,
+		IPChallengeAfter:   5,
+		ASNChallengeAfter:  1000,
+		SpikeFactor:        5,
+		SpikeMin:           100,
+		SequentialRun:      4,
+		SequentialWindow:   time.Hour,
+		BlockTTL:           24 * time.Hour,
+	}
+}
+
+// Request describes one send-otp call.
+type Request struct {
+	// Phone is the canonical E.164 number.
+	Phone string
+	IP    string
+	// ASN is the client's autonomous system number when the edge proxy provides it.
+	ASN string
+}
+
+// Verdict is the outcome of a Check.
+type Verdict struct {
+	Allowed bool
+	// Challenge asks for proof of a human (or a paying CPU) before sending.
+	Challenge bool
+	// Reason is one of the Reason constants when the request is refused.
+	Reason string
+}
+
+// Guard evaluates requests against the Config.
+type Guard struct {
+	rdb    redis.Cmdable
+	cfg    Config
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+// NewGuard creates a guard that keeps its counters in rdb.
+func NewGuard(rdb redis.Cmdable, cfg Config, logger *slog.Logger) *Guard {
+	return &Guard{rdb: rdb, cfg: cfg, logger: logger.With("component", "fraud_guard"), now: time.Now}
+}
+
+func countKey(kind, value string) string { return "fraud:count:" + kind + ":" + value }
+func blockKey(kind, value string) string { return "fraud:block:" + kind + ":" + value }
+func flagKey(rangeID string) string      { return "fraud:flag:range:" + rangeID }
+func hourKey(prefix string, hour int64) string {
+	return "fraud:hour:" + prefix + ":" + strconv.FormatInt(hour, 10)
+}
+func sequenceKey(rangeID string) string { return "fraud:seq:" + rangeID }
+
+// Screen runs Check for an HTTP request, taking the client IP and ASN from it.
+func (g *Guard) Screen(r *http.Request, phone string) (Verdict, error) {
+	req := Request{Phone: phone, IP: ClientIP(r)}
+	if g.cfg.ASNHeader != "" {
+		req.ASN = r.Header.Get(g.cfg.ASNHeader)
+	}
+	return g.Check(r.Context(), req)
+}
+
+// ClientIP returns the caller's IP. RemoteAddr is a bare IP when the RealIP
+// middleware found a forwarding header, host:port otherwise.
+func ClientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// Check counts the request and decides whether the OTP may be sent.
+// On Redis errors it returns the error with an allowing verdict: fraud screening
+// must not take logins down.
+func (g *Guard) Check(ctx context.Context, req Request) (Verdict, error) {
+	allow := Verdict{Allowed: true}
+	country, prefix, rangeID := CountryOf(req.Phone), PrefixOf(req.Phone), RangeOf(req.Phone)
+
+	// 1. A client already blocked
+	var blocks []string
+	if req.IP != "" {
+		blocks = append(blocks, blockKey("ip", req.IP))
+	}
+	if req.ASN != "" {
+		blocks = append(blocks, blockKey("asn", req.ASN))
+	}
+	if len(blocks) > 0 {
+		n, err := g.rdb.Exists(ctx, blocks...).Result()
+		if err != nil {
+			return allow, err
+		}
+		if n > 0 {
+			return Verdict{Reason: ReasonBlocked}, nil
+		}
+	}
+
+	// 2. Count this request everywhere it matters
+	now := g.now()
+	hour := now.Unix() / int64(time.Hour.Seconds())
+	pipe := g.rdb.Pipeline()
+	countryN := incrDaily(ctx, pipe, countKey("country", country))
+	rangeN := incrDaily(ctx, pipe, countKey("range", rangeID))
+	var ipN, asnN *redis.IntCmd
+	if req.IP != "" {
+		ipN = incrDaily(ctx, pipe, countKey("ip", req.IP))
+	}
+	if req.ASN != "" {
+		asnN = incrDaily(ctx, pipe, countKey("asn", req.ASN))
+	}
+	flagged := pipe.Exists(ctx, flagKey(rangeID))
+	hourN := pipe.Incr(ctx, hourKey(prefix, hour))
+	pipe.Expire(ctx, hourKey(prefix, hour), (baselineHours+2)*time.Hour)
+	if g.cfg.SequentialRun > 0 {
+		pipe.ZAdd(ctx, sequenceKey(rangeID), redis.Z{Score: float64(now.Unix()), Member: req.Phone})
+		pipe.ZRemRangeByScore(ctx, sequenceKey(rangeID), "-inf", strconv.FormatInt(now.Add(-g.cfg.SequentialWindow).Unix(), 10))
+		pipe.Expire(ctx, sequenceKey(rangeID), g.cfg.SequentialWindow)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return allow, err
+	}
+
+	// 3. Daily budgets. Exhausted IPs and ASNs are blocked outright so the attacker
+	// keeps burning requests on a dead end; an exhausted range only asks for a challenge.
+	switch {
+	case over(countryN, g.cfg.CountryDailyBudget):
+		// Never block a whole country: that is an outage, not a defence
+		return g.refuse(ctx, req, ReasonCountryBudget, "", "")
+	case ipN != nil && over(ipN, g.cfg.IPDailyBudget):
+		return g.refuse(ctx, req, ReasonIPBudget, "ip", req.IP)
+	case asnN != nil && over(asnN, g.cfg.ASNDailyBudget):
+		return g.refuse(ctx, req, ReasonASNBudget, "asn", req.ASN)
+	}
+	rangeOver := over(rangeN, g.cfg.RangeDailyBudget)
+	if rangeOver && int(rangeN.Val()) == g.cfg.RangeDailyBudget+1 {
+		g.logger.Warn("range over its daily budget, challenging sends", "range", rangeID)
+	}
+
+	// 4. Traffic spikes to a prefix are flagged for a challenge
+	var spike bool
+	if g.cfg.SpikeMin > 0 && int(hourN.Val()) >= g.cfg.SpikeMin && !g.served(req.Phone) {
+		baseline, err := g.baseline(ctx, prefix, hour)
+		if err != nil {
+			return allow, err
+		}
+		if float64(hourN.Val()) > float64(g.cfg.SpikeFactor)*baseline {
+			g.logger.Warn("traffic spike to prefix, challenging sends", "prefix", prefix, "this_hour", hourN.Val(), "hourly_baseline", baseline)
+			spike = true
+		}
+	}
+
+	// 5. Numbers walked in sequence keep their range challenged
+	var sequential bool
+	if g.cfg.SequentialRun > 0 {
+		recent, err := g.rdb.ZRange(ctx, sequenceKey(rangeID), 0, -1).Result()
+		if err != nil {
+			return allow, err
+		}
+		if longestRun(recent) >= g.cfg.SequentialRun {
+			g.logger.Warn("range walked sequentially, challenging sends", "range", rangeID, "ip", req.IP, "asn", req.ASN)
+			sequential = true
+			if g.cfg.BlockTTL > 0 {
+				if err := g.rdb.Set(ctx, flagKey(rangeID), "sequential", g.cfg.BlockTTL).Err(); err != nil {
+					return allow, err
+				}
+			}
+		}
+	}
+
+	allow.Challenge = spike || rangeOver || sequential || flagged.Val() > 0 ||
+		(ipN != nil && over(ipN, g.cfg.IPChallengeAfter)) ||
+		(asnN != nil && over(asnN, g.cfg.ASNChallengeAfter))
+	return allow, nil
+}
+
+// refuse blocks kind/value (when kind is set) and returns a refusing verdict.
+func (g *Guard) refuse(ctx context.Context, req Request, reason, kind, value string) (Verdict, error) {
+	g.logger.Warn("otp send blocked", "reason", reason, "phone", req.Phone, "ip", req.IP, "asn", req.ASN)
+	if kind != "" && g.cfg.BlockTTL > 0 {
+		if err := g.rdb.Set(ctx, blockKey(kind, value), reason, g.cfg.BlockTTL).Err(); err != nil {
+			return Verdict{Reason: reason}, err
+		}
+	}
+	return Verdict{Reason: reason}, nil
+}
+
+// served reports whether phone is on a network listed in ServedPrefixes.
+func (g *Guard) served(phone string) bool {
+	return slices.ContainsFunc(g.cfg.ServedPrefixes, func(p string) bool {
+		return strings.HasPrefix(phone, p)
+	})
+}
+
+// baseline is the average hourly volume to prefix over the previous baselineHours.
+func (g *Guard) baseline(ctx context.Context, prefix string, hour int64) (float64, error) {
+	keys := make([]string, baselineHours)
+	for i := range keys {
+		keys[i] = hourKey(prefix, hour-int64(i)-1)
+	}
+	vals, err := g.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return 0, err
+	}
+	var sum int
+	for _, v := range vals {
+		if s, ok := v.(string); ok {
+			n, _ := strconv.Atoi(s)
+			sum += n
+		}
+	}
+	return float64(sum) / baselineHours, nil
+}
+
+// incrDaily increments a counter that resets 24h after its first hit.
+func incrDaily(ctx context.Context, pipe redis.Pipeliner, key string) *redis.IntCmd {
+	n := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, dailyWindow)
+	return n
+}
+
+func over(n *redis.IntCmd, budget int) bool {
+	return budget > 0 && int(n.Val()) > budget
+}
+
+// longestRun returns the length of the longest run of consecutive numbers in phones.
+func longestRun(phones []string) int {
+	nums := make([]int, 0, len(phones))
+	for _, p := range phones {
+		if len(p) < 3 {
+			continue
+		}
+		n, err := strconv.Atoi(p[len(p)-3:])
+		if err == nil {
+			nums = append(nums, n)
+		}
+	}
+	slices.Sort(nums)
+	nums = slices.Compact(nums)
+
+	best, run := 0, 0
+	for i, n := range nums {
+		if i > 0 && n == nums[i-1]+1 {
+			run++
+		} else {
+			run = 1
+		}
+		best = max(best, run)
+	}
+	return best
+}
+
+// CountryOf returns the calling code of an E.164 number. Ethiopian numbers are
+// what we serve; anything else is grouped by its first three digits.
+func CountryOf(e164 string) string {
+	return cut(e164, 4)
+}
+
+// PrefixOf returns the operator prefix spikes are tracked on: the calling code
+// plus two digits, e.g. +25191.
+func PrefixOf(e164 string) string {
+	return cut(e164, 6)
+}
+
+// RangeOf returns the 1000-number block a number belongs to, e.g. +251911223.
+func RangeOf(e164 string) string {
+	return cut(e164, len(e164)-3)
+}
+
+func cut(s string, n int) string {
+	if n < 0 || n > len(s) {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,160 @@
+package fraud
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGuard(t *testing.T, cfg Config) (*Guard, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	return NewGuard(rdb, cfg, slog.New(slog.NewTextHandler(io.Discard, nil))), mr
+}
+
+func check(t *testing.T, g *Guard, phone, ip string) Verdict {
+	t.Helper()
+	v, err := g.Check(context.Background(), Request{Phone: phone, IP: ip})
+	require.NoError(t, err)
+	return v
+}
+
+func TestGuard_RangeBudget(t *testing.T) {
+	g, mr := newTestGuard(t, Config{RangeDailyBudget: 3, BlockTTL: time.Hour})
+
+	// Spread out so the numbers aren't sequential
+	for _, phone := range []string{"+251911223100", "+251911223150", "+251911223199"} {
+		v := check(t, g, phone, "")
+		assert.True(t, v.Allowed)
+		assert.False(t, v.Challenge)
+	}
+
+	// Past the budget every send to the range needs a challenge, whoever asks,
+	// but nobody on it loses their codes; neighbouring ranges are untouched
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		v := check(t, g, "+251911223400", ip)
+		assert.True(t, v.Allowed)
+		assert.True(t, v.Challenge)
+	}
+	assert.False(t, mr.Exists("fraud:block:range:+251911223"))
+	assert.False(t, check(t, g, "+251911224000", "").Challenge)
+}
+
+func TestGuard_IPBudget(t *testing.T) {
+	g, mr := newTestGuard(t, Config{IPDailyBudget: 2, BlockTTL: time.Hour})
+
+	assert.True(t, check(t, g, "+251911000001", "10.0.0.1").Allowed)
+	assert.Equal(t, dailyWindow, mr.TTL("fraud:count:ip:10.0.0.1"))
+	assert.True(t, check(t, g, "+251922000001", "10.0.0.1").Allowed)
+	assert.Equal(t, ReasonIPBudget, check(t, g, "+251933000001", "10.0.0.1").Reason)
+	assert.Equal(t, ReasonBlocked, check(t, g, "+251944000001", "10.0.0.1").Reason)
+	assert.True(t, check(t, g, "+251944000001", "10.0.0.2").Allowed)
+}
+
+func TestGuard_Sequential(t *testing.T) {
+	g, mr := newTestGuard(t, Config{SequentialRun: 4, SequentialWindow: time.Hour, BlockTTL: time.Hour})
+
+	for _, phone := range []string{"+251911223342", "+251911223340", "+251911223341"} {
+		assert.False(t, check(t, g, phone, "").Challenge)
+	}
+	v := check(t, g, "+251911223343", "")
+	assert.True(t, v.Allowed)
+	assert.True(t, v.Challenge)
+
+	// The range stays challenged after the run leaves the window
+	mr.Del("fraud:seq:+251911223")
+	v = check(t, g, "+251911223900", "10.0.0.9")
+	assert.True(t, v.Allowed)
+	assert.True(t, v.Challenge)
+	assert.Equal(t, time.Hour, mr.TTL("fraud:flag:range:+251911223"))
+}
+
+func TestGuard_PrefixSpike(t *testing.T) {
+	g, mr := newTestGuard(t, Config{SpikeFactor: 5, SpikeMin: 10, ServedPrefixes: []string{"+2519"}, BlockTTL: time.Hour})
+	hour := time.Now().Unix() / 3600
+
+	// +25191 normally sees ~48 sends an hour: 10 more is nothing unusual
+	for i := int64(1); i <= baselineHours; i++ {
+		mr.Set(hourKey("+25191", hour-i), "48")
+	}
+	for i := 0; i < 12; i++ {
+		v := check(t, g, fmt.Sprintf("+2519100%02d000", i), "")
+		assert.True(t, v.Allowed)
+		assert.False(t, v.Challenge)
+	}
+
+	// +25170 is a range we don't serve: from the 10th send in an hour it needs a challenge
+	var last Verdict
+	for i := 0; i < 10; i++ {
+		last = check(t, g, "+25170"+strconv.Itoa(1000000+i*1000), "")
+	}
+	assert.True(t, last.Allowed)
+	assert.True(t, last.Challenge)
+	assert.False(t, mr.Exists("fraud:block:prefix:+25170"))
+}
+
+func TestGuard_SpikeWithDefaults(t *testing.T) {
+	g, mr := newTestGuard(t, DefaultConfig())
+	hour := time.Now().Unix() / 3600
+
+	// +25191 is busy, ~48 sends an hour: 100 more in this one is ordinary
+	for i := int64(1); i <= baselineHours; i++ {
+		mr.Set(hourKey("+25191", hour-i), "48")
+	}
+	// +25170 is quiet: its 100th send this hour needs a challenge. Each number is in
+	// its own range from its own IP, so no budget or sequence rule is what trips.
+	for i := 0; i < 100; i++ {
+		busy := check(t, g, fmt.Sprintf("+25191%04d500", i), fmt.Sprintf("10.0.%d.%d", i/250, i%250))
+		assert.False(t, busy.Challenge)
+		quiet := check(t, g, fmt.Sprintf("+25170%04d500", i), fmt.Sprintf("10.1.%d.%d", i/250, i%250))
+		assert.True(t, quiet.Allowed)
+		assert.Equal(t, i == 99, quiet.Challenge, "send %d", i+1)
+	}
+}
+
+func TestGuard_SpikeToServedPrefixIsNeverBlocked(t *testing.T) {
+	g, mr := newTestGuard(t, Config{SpikeFactor: 5, SpikeMin: 10, ServedPrefixes: []string{"+2519"}, BlockTTL: time.Hour})
+
+	// A burst to a quiet served prefix is left to the budgets
+	for i := 0; i < 20; i++ {
+		v := check(t, g, "+25192"+strconv.Itoa(1000000+i*1000), "")
+		assert.True(t, v.Allowed)
+		assert.False(t, v.Challenge)
+	}
+	assert.False(t, mr.Exists("fraud:block:prefix:+25192"))
+}
+
+func TestGuard_CountryBudgetDoesNotBlockCountry(t *testing.T) {
+	g, mr := newTestGuard(t, Config{CountryDailyBudget: 1, BlockTTL: time.Hour})
+
+	assert.True(t, check(t, g, "+251911000001", "").Allowed)
+	assert.Equal(t, ReasonCountryBudget, check(t, g, "+251922000001", "").Reason)
+	assert.False(t, mr.Exists("fraud:block:range:+251922000"))
+}
+
+func TestLongestRun(t *testing.T) {
+	assert.Equal(t, 0, longestRun(nil))
+	assert.Equal(t, 3, longestRun([]string{"+251911223005", "+251911223003", "+251911223004", "+251911223009"}))
+	assert.Equal(t, 1, longestRun([]string{"+251911223005", "+251911223005"}))
+}
+
+func TestGuard_ChallengeThreshold(t *testing.T) {
+	g, _ := newTestGuard(t, Config{IPDailyBudget: 10, IPChallengeAfter: 2})
+
+	assert.False(t, check(t, g, "+251911000001", "10.0.0.1").Challenge)
+	assert.False(t, check(t, g, "+251922000001", "10.0.0.1").Challenge)
+	v := check(t, g, "+251933000001", "10.0.0.1")
+	assert.True(t, v.Allowed)
+	assert.True(t, v.Challenge)
+	assert.False(t, check(t, g, "+251933000001", "10.0.0.2").Challenge)
+}
@@ -0,0 +1,40 @@
+package middlewares
+
+import (
+	"net/http"
+
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+)
+
+// AccountStatusError refuses a login or a token because of the account's status.
+type AccountStatusError struct {
+	Status repo.AccountStatus
+}
+
+func (e *AccountStatusError) Error() string {
+	return "middlewares: account is " + string(e.Status)
+}
+
+// CheckAccountStatus returns an *AccountStatusError unless an account in status may
+// sign in and use its tokens. Only active accounts may.
+func CheckAccountStatus(status repo.AccountStatus) error {
+	if status != repo.AccountStatusActive {
+		return &AccountStatusError{Status: status}
+	}
+	return nil
+}
+
+// WriteAccountStatusError tells the client why the account can't be used, with a
+// distinct code per status so apps can show the right screen.
+func WriteAccountStatusError(w http.ResponseWriter, status repo.AccountStatus) {
+	switch status {
+	case repo.AccountStatusSuspended:
+		json.WriteErrorCode(w, http.StatusForbidden, constants.CodeAccountSuspended, constants.ErrAccountSuspended)
+	case repo.AccountStatusPendingReview:
+		json.WriteErrorCode(w, http.StatusForbidden, constants.CodeAccountInReview, constants.ErrAccountInReview)
+	default:
+		json.WriteErrorCode(w, http.StatusForbidden, constants.CodeAccountDeleted, constants.ErrAccountDeleted)
+	}
+}
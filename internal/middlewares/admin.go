@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+)
+
+// AdminKeyHeader carries the shared secret for support and back-office endpoints.
+const AdminKeyHeader = "X-Admin-Key"
+
+// AdminKey guards internal endpoints with a static API key.
+// An empty key disables the routes entirely rather than leaving them open.
+func AdminKey(key string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key == "" {
+				http.NotFound(w, r)
+				return
+			}
+
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get(AdminKeyHeader)), []byte(key)) != 1 {
+				json.WriteError(w, http.StatusUnauthorized, "Missing or invalid admin key")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
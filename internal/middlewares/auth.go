@@ -2,6 +2,8 @@ package middlewares
 
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
 	"strings"
 
@@ -14,10 +16,78 @@ import (
 // Define a custom type for context keys to prevent collisions
 type contextKey string
 
-const UserIDKey contextKey = "user_id"
+const (
+	UserIDKey    contextKey = "user_id"
+	SessionIDKey contextKey = "session_id"
+	// ClaimsKey holds the verified *auth.Claims
+	ClaimsKey contextKey = "claims"
+)
+
+// Reasons CheckSession refuses a token.
+var (
+	ErrMissingIAT       = errors.New("middlewares: token has no iat")
+	ErrMalformedAccount = errors.New("middlewares: malformed account ID in token")
+	ErrMalformedSession = errors.New("middlewares: malformed session ID in token")
+	ErrSessionRevoked   = errors.New("middlewares: session has been signed out")
+	ErrTokenSuperseded  = errors.New("middlewares: token has been replaced by a newer one")
+)
 
-// AuthMiddleware validates the JWT and checks if the session is still valid in the DB.
-func AuthMiddleware(tokenManager auth.TokenManager, db repo.Querier) func(http.Handler) http.Handler {
+// SessionStore is what CheckSession reads sessions from.
+type SessionStore interface {
+	GetSession(ctx context.Context, id pgtype.UUID) (repo.Session, error)
+	GetAccountStatus(ctx context.Context, id pgtype.UUID) (repo.AccountStatus, error)
+}
+
+// CheckSession confirms that a token which passed VerifyToken still stands: its
+// session exists, belongs to the token's account and hasn't been revoked, and the
+// token is the session's latest. Tokens of accounts that aren't active fail with an
+// *AccountStatusError. Every consumer of tokens goes through it so a
+// revocation takes effect everywhere at once.
+func CheckSession(ctx context.Context, db SessionStore, claims *auth.Claims) (repo.Session, error) {
+	if claims.IssuedAt == nil {
+		return repo.Session{}, ErrMissingIAT
+	}
+
+	// Convert string IDs from token to pgtype.UUID immediately
+	var dbID, sessionID pgtype.UUID
+	if err := dbID.Scan(claims.AccountID); err != nil {
+		return repo.Session{}, ErrMalformedAccount
+	}
+	if err := sessionID.Scan(claims.SessionID); err != nil {
+		return repo.Session{}, ErrMalformedSession
+	}
+
+	// Fetch the session to check it belongs to the account and is still live
+	session, err := db.GetSession(ctx, sessionID)
+	if err != nil || session.AccountID != dbID {
+		return repo.Session{}, ErrSessionRevoked
+	}
+
+	// Checked before revocation: suspending an account also signs it out, and the
+	// client should hear why
+	status, err := db.GetAccountStatus(ctx, dbID)
+	if err != nil {
+		return repo.Session{}, ErrSessionRevoked
+	}
+	if err := CheckAccountStatus(status); err != nil {
+		return repo.Session{}, err
+	}
+	if session.RevokedAt.Valid {
+		return repo.Session{}, ErrSessionRevoked
+	}
+
+	// If the token was issued BEFORE the session's latest refresh, it has been
+	// replaced by a newer pair.
+	if claims.IssuedAt.Time.Unix() < session.TokenValidFrom.Time.Unix() {
+		return repo.Session{}, ErrTokenSuperseded
+	}
+	return session, nil
+}
+
+// AuthMiddleware validates the JWT and checks that its device session is still valid in the DB.
+// Tokens must have been issued for one of audiences; with none, any audience the
+// TokenManager accepts will do.
+func AuthMiddleware(tokenManager auth.TokenManager, db repo.Querier, audiences ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// 1. SAFE Extraction of the token
@@ -43,39 +113,73 @@ func AuthMiddleware(tokenManager auth.TokenManager, db repo.Querier) func(http.H
 				return
 			}
 
-			// 3. Robust Single Session Check
-			if claims.IssuedAt == nil {
-				json.WriteError(w, http.StatusUnauthorized, "Invalid token payload: missing iat")
+			// A token meant for another API (e.g. a partner's) doesn't open this one
+			if len(audiences) > 0 && !claims.HasAudience(audiences...) {
+				json.WriteError(w, http.StatusForbidden, "Token is not valid for this API")
 				return
 			}
 
-			// Convert string ID from token to pgtype.UUID immediately
-			var dbID pgtype.UUID
-			if err := dbID.Scan(claims.AccountID); err != nil {
+			// 3. Per-device session check
+			session, err := CheckSession(r.Context(), db, claims)
+			var statusErr *AccountStatusError
+			switch {
+			case errors.As(err, &statusErr):
+				WriteAccountStatusError(w, statusErr.Status)
+				return
+			case errors.Is(err, ErrMissingIAT):
+				json.WriteError(w, http.StatusUnauthorized, "Invalid token payload: missing iat")
+				return
+			case errors.Is(err, ErrMalformedAccount):
 				json.WriteError(w, http.StatusUnauthorized, "Malformed account ID in token")
 				return
-			}
-
-			// Fetch the account from DB to check TokenValidFrom
-			acc, err := db.GetAccountByID(r.Context(), dbID)
-			if err != nil {
-				// If account doesn't exist anymore
-				json.WriteError(w, http.StatusUnauthorized, "User account not found")
+			case errors.Is(err, ErrSessionRevoked):
+				json.WriteError(w, http.StatusUnauthorized, "Session has been signed out")
+				return
+			case errors.Is(err, ErrTokenSuperseded):
+				json.WriteError(w, http.StatusUnauthorized, "Session has been invalidated by a newer token")
+				return
+			case err != nil:
+				// Tokens from before sessions existed carry no sid
+				json.WriteError(w, http.StatusUnauthorized, "Session expired or invalid token")
 				return
 			}
+			dbID, sessionID := session.AccountID, session.ID
 
-			// If the token was issued BEFORE the latest 'token_valid_from' (e.g. after a new login/logout)
-			// we invalidate the old token.
-			if claims.IssuedAt.Time.Unix() < acc.TokenValidFrom.Time.Unix() {
-				json.WriteError(w, http.StatusUnauthorized, "Session has been invalidated by a newer login")
-				return
+			// Keep "last active" fresh for the device list; a failure here must not block the request
+			ip := r.RemoteAddr
+			if host, _, err := net.SplitHostPort(ip); err == nil {
+				ip = host
 			}
+			_ = db.TouchSession(r.Context(), repo.TouchSessionParams{
+				ID:        sessionID,
+				IpAddress: pgtype.Text{String: ip, Valid: ip != ""},
+			})
 
-			// 4. Set the scanned UUID into context
+			// 4. Set the scanned UUIDs into context
 			// Storing the object directly saves work for your handlers
 			ctx := context.WithValue(r.Context(), UserIDKey, dbID)
+			ctx = context.WithValue(ctx, SessionIDKey, sessionID)
+			ctx = context.WithValue(ctx, ClaimsKey, claims)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// RequireScope refuses tokens without scope. It must run after AuthMiddleware.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(ClaimsKey).(*auth.Claims)
+			if !ok {
+				json.WriteError(w, http.StatusUnauthorized, "Missing or invalid Authorization header")
+				return
+			}
+			if !claims.HasScope(scope) {
+				json.WriteError(w, http.StatusForbidden, "Token lacks the "+scope+" scope")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
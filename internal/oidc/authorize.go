@@ -0,0 +1,264 @@
+package oidc
+
+import (
+	"context"
+	stdjson "encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/fraud"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+)
+
+// maxUserAgent matches the sessions.user_agent column.
+const maxUserAgent = 255
+
+// authRequest is an authorization request (RFC 6749 section 4.1.1) with PKCE (RFC 7636)
+// @Name AuthorizationRequest
+type authRequest struct {
+	ClientID     string `json:"client_id" validate:"required,max=64" example:"q8Ukp3Yb0l2dUxTq7m1n5A"`
+	RedirectURI  string `json:"redirect_uri" validate:"required,max=2000" example:"https://app.dashenbank.com/oidc/callback"`
+	ResponseType string `json:"response_type" example:"code"`
+	Scope        string `json:"scope" validate:"max=200" example:"openid profile phone"`
+	State        string `json:"state" validate:"max=500" example:"af0ifjsldkj"`
+	Nonce        string `json:"nonce" validate:"max=500" example:"n-0S6_WzA2Mj"`
+	// CodeChallenge is BASE64URL(SHA256(code_verifier))
+	CodeChallenge       string `json:"code_challenge" example:"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"`
+	CodeChallengeMethod string `json:"code_challenge_method" example:"S256"`
+}
+
+func authRequestFromQuery(q url.Values) authRequest {
+	return authRequest{
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		ResponseType:        q.Get("response_type"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		Nonce:               q.Get("nonce"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+	}
+}
+
+// approveRequest carries the user's decision on an authorization request
+// @Name AuthorizationDecision
+type approveRequest struct {
+	authRequest
+	Approve bool `json:"approve" example:"true"`
+}
+
+// consentResponse is what the consent screen shows
+// @Name ConsentResponse
+type consentResponse struct {
+	Client ClientDTO  `json:"client"`
+	Scopes []ScopeDTO `json:"scopes"`
+}
+
+// ScopeDTO explains one requested scope to the user
+type ScopeDTO struct {
+	Name        string   `json:"name" example:"phone"`
+	Description string   `json:"description" example:"Your verified phone number"`
+	Claims      []string `json:"claims" example:"phone_number,phone_number_verified"`
+}
+
+// redirectResponse tells the web app where to send the user's browser
+type redirectResponse struct {
+	RedirectTo string `json:"redirect_to" example:"https://app.dashenbank.com/oidc/callback?code=SplxlOBeZQQYbYS6WxSbIA&state=af0ifjsldkj"`
+}
+
+// authCode is what an authorization code stands for until it is exchanged.
+type authCode struct {
+	ClientID      string   `json:"client_id"`
+	RedirectURI   string   `json:"redirect_uri"`
+	AccountID     string   `json:"account_id"`
+	Scopes        []string `json:"scopes"`
+	Nonce         string   `json:"nonce,omitempty"`
+	CodeChallenge string   `json:"code_challenge"`
+	AuthTime      int64    `json:"auth_time"`
+	AMR           []string `json:"amr"`
+	// The browser the user approved from, recorded on the session
+	UserAgent string `json:"user_agent,omitempty"`
+	IP        string `json:"ip,omitempty"`
+}
+
+func codeKey(code string) string { return "oidc:code:" + hashSecret(code) }
+
+// check validates an authorization request and returns the client and the scopes
+// that can be granted. Errors carry a redirect back to the client once the client
+// and redirect URI are known to be genuine.
+func (h *handler) check(ctx context.Context, req authRequest) (repo.OauthClient, []string, *oauthError, error) {
+	if err := h.validate.Struct(req); err != nil {
+		return repo.OauthClient{}, nil, &oauthError{Code: errInvalidRequest, Description: "client_id and redirect_uri are required"}, nil
+	}
+
+	client, err := h.service.GetClient(ctx, req.ClientID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return client, nil, &oauthError{Code: errInvalidClient, Description: "unknown client_id"}, nil
+	}
+	if err != nil {
+		return client, nil, nil, err
+	}
+	// Exact match only: prefix or pattern matching is how codes get stolen
+	if !slices.Contains(client.RedirectUris, req.RedirectURI) {
+		return client, nil, &oauthError{Code: errInvalidRequest, Description: "redirect_uri is not registered for this client"}, nil
+	}
+
+	fail := func(code, description string) (repo.OauthClient, []string, *oauthError, error) {
+		e := &oauthError{Code: code, Description: description}
+		e.RedirectTo = h.redirect(req.RedirectURI, url.Values{
+			"error":             {code},
+			"error_description": {description},
+			"state":             {req.State},
+		})
+		return client, nil, e, nil
+	}
+
+	if req.ResponseType != "code" {
+		return fail(errUnsupportedResponseType, "only the authorization code flow is supported")
+	}
+	if req.CodeChallengeMethod != "S256" || len(req.CodeChallenge) != 43 {
+		return fail(errInvalidRequest, "PKCE with code_challenge_method=S256 is required")
+	}
+
+	// Scopes the client isn't registered for are dropped rather than refused
+	requested := strings.Fields(req.Scope)
+	if !slices.Contains(requested, auth.ScopeOpenID) {
+		return fail(errInvalidScope, "the openid scope is required")
+	}
+	var scopes []string
+	for _, s := range supportedScopes {
+		if slices.Contains(requested, s) && slices.Contains(client.Scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return client, scopes, nil, nil
+}
+
+// redirect adds params (and our issuer, RFC 9207) to a registered redirect URI.
+func (h *handler) redirect(redirectURI string, params url.Values) string {
+	u, _ := url.Parse(redirectURI)
+	q := u.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			q.Set(k, v[0])
+		}
+	}
+	q.Set("iss", h.cfg.Issuer)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (h *handler) writeCheckError(w http.ResponseWriter, e *oauthError, err error) {
+	if err != nil {
+		h.logger.Error("failed to check authorization request", "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+	json.Write(w, http.StatusBadRequest, e)
+}
+
+// Authorize godoc
+// @Summary      Authorization Request Details
+// @Description  Validates a relying party's authorization request (its query string, passed through unchanged) and returns what the consent screen should show. On errors that can go back to the client, redirect_to is set.
+// @Tags         oauth
+// @Produce      json
+// @Param        client_id              query     string  true  "Client ID"
+// @Param        redirect_uri           query     string  true  "Registered redirect URI"
+// @Param        response_type          query     string  true  "Must be code"
+// @Param        scope                  query     string  true  "Space-separated scopes, including openid"
+// @Param        state                  query     string  false "Opaque client state"
+// @Param        nonce                  query     string  false "Echoed in the ID token"
+// @Param        code_challenge         query     string  true  "PKCE challenge"
+// @Param        code_challenge_method  query     string  true  "Must be S256"
+// @Success      200  {object}  consentResponse
+// @Failure      400  {object}  oauthError
+// @Router       /api/v1/oauth/authorize [get]
+func (h *handler) Authorize(w http.ResponseWriter, r *http.Request) {
+	client, scopes, e, err := h.check(r.Context(), authRequestFromQuery(r.URL.Query()))
+	if e != nil || err != nil {
+		h.writeCheckError(w, e, err)
+		return
+	}
+
+	resp := consentResponse{Client: MapClientRow(client)}
+	for _, s := range scopes {
+		info := scopeInfo[s]
+		resp.Scopes = append(resp.Scopes, ScopeDTO{Name: s, Description: info.description, Claims: info.claims})
+	}
+	json.Write(w, http.StatusOK, resp)
+}
+
+// Approve godoc
+// @Summary      Approve or Deny an Authorization Request
+// @Description  Records the signed-in user's consent. Returns where to send the browser: back to the client with an authorization code, or with error=access_denied.
+// @Tags         oauth
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        request  body      approveRequest  true  "The authorization request and the user's decision"
+// @Success      200      {object}  redirectResponse
+// @Failure      400      {object}  oauthError
+// @Router       /api/v1/oauth/authorize [post]
+func (h *handler) Approve(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ClaimsKey).(*auth.Claims)
+	accID, ok2 := r.Context().Value(middlewares.UserIDKey).(pgtype.UUID)
+	if !ok || !ok2 {
+		writeOAuthError(w, http.StatusUnauthorized, errAccessDenied, "sign in first")
+		return
+	}
+
+	var req approveRequest
+	if err := json.Read(r, &req); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, errInvalidRequest, "invalid request body")
+		return
+	}
+	client, scopes, e, err := h.check(r.Context(), req.authRequest)
+	if e != nil || err != nil {
+		h.writeCheckError(w, e, err)
+		return
+	}
+
+	if !req.Approve {
+		h.logger.Info("oauth consent denied", "account_id", accID, "client_id", client.ID)
+		json.Write(w, http.StatusOK, redirectResponse{RedirectTo: h.redirect(req.RedirectURI, url.Values{
+			"error": {errAccessDenied}, "state": {req.State},
+		})})
+		return
+	}
+
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgent {
+		ua = ua[:maxUserAgent]
+	}
+	grant, _ := stdjson.Marshal(authCode{
+		ClientID:      client.ID,
+		RedirectURI:   req.RedirectURI,
+		AccountID:     accID.String(),
+		Scopes:        scopes,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      claims.AuthTime,
+		AMR:           claims.AMR,
+		UserAgent:     ua,
+		IP:            fraud.ClientIP(r),
+	})
+	code := randomToken(32)
+	if err := h.cache.Set(r.Context(), codeKey(code), grant, codeTTL).Err(); err != nil {
+		h.logger.Error("failed to store authorization code", "error", err)
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+
+	h.logger.Info("oauth consent granted", "account_id", accID, "client_id", client.ID, "scopes", scopes)
+	json.Write(w, http.StatusOK, redirectResponse{RedirectTo: h.redirect(req.RedirectURI, url.Values{
+		"code": {code}, "state": {req.State},
+	})})
+}
@@ -0,0 +1,167 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+)
+
+// supportedScopes are the scopes a client can be registered for, in the order they
+// are shown on the consent screen.
+var supportedScopes = []string{auth.ScopeOpenID, auth.ScopeProfile, auth.ScopeEmail, auth.ScopePhone, auth.ScopeAddress}
+
+// scopeInfo explains each scope on the consent screen.
+var scopeInfo = map[string]struct {
+	description string
+	claims      []string
+}{
+	auth.ScopeOpenID:  {"Know who you are on AddisVerify", []string{"sub"}},
+	auth.ScopeProfile: {"Your name, date of birth and gender as you entered them", []string{"name", "given_name", "middle_name", "family_name", "nickname", "birthdate", "gender", "locale"}},
+	auth.ScopeEmail:   {"Your email address", []string{"email", "email_verified"}},
+	auth.ScopePhone:   {"Your verified phone number", []string{"phone_number", "phone_number_verified"}},
+	auth.ScopeAddress: {"Your address", []string{"address"}},
+}
+
+func supportedClaims() []string {
+	var out []string
+	for _, s := range supportedScopes {
+		out = append(out, scopeInfo[s].claims...)
+	}
+	return out
+}
+
+// UserClaims are the standard claims about the user (OpenID Connect Core 5.1),
+// filled in according to the granted scopes.
+type UserClaims struct {
+	// profile: self-declared in the user's profile, not checked against any ID
+	Name       string `json:"name,omitempty"`
+	GivenName  string `json:"given_name,omitempty"`
+	MiddleName string `json:"middle_name,omitempty"`
+	FamilyName string `json:"family_name,omitempty"`
+	Nickname   string `json:"nickname,omitempty"`
+	Birthdate  string `json:"birthdate,omitempty"`
+	Gender     string `json:"gender,omitempty"`
+	Locale     string `json:"locale,omitempty"`
+
+	// email: addresses are self-declared, never verified
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+
+	// phone: the number the user proves they hold at every login
+	PhoneNumber         string `json:"phone_number,omitempty"`
+	PhoneNumberVerified *bool  `json:"phone_number_verified,omitempty"`
+
+	Address *AddressClaim `json:"address,omitempty"`
+}
+
+// AddressClaim is the address claim (OpenID Connect Core 5.1.1). Zone, wereda and
+// kebele have no standard member, so they make up the street address.
+type AddressClaim struct {
+	Formatted     string `json:"formatted,omitempty"`
+	StreetAddress string `json:"street_address,omitempty"`
+	Locality      string `json:"locality,omitempty"`
+	Region        string `json:"region,omitempty"`
+	Country       string `json:"country,omitempty"`
+}
+
+// userClaims looks up what scopes lets the client see about accountID.
+func (h *handler) userClaims(ctx context.Context, accountID pgtype.UUID, scopes []string) (UserClaims, error) {
+	var c UserClaims
+	has := func(s string) bool { return slices.Contains(scopes, s) }
+	verified, unverified := true, false
+
+	if has(auth.ScopePhone) || has(auth.ScopeProfile) {
+		acc, err := h.service.GetAccount(ctx, accountID)
+		if err != nil {
+			return c, err
+		}
+		if has(auth.ScopePhone) {
+			c.PhoneNumber, c.PhoneNumberVerified = acc.Phone, &verified
+		}
+		if has(auth.ScopeProfile) {
+			c.Locale = acc.PreferredLanguage.String
+		}
+	}
+
+	if !has(auth.ScopeProfile) && !has(auth.ScopeEmail) && !has(auth.ScopeAddress) {
+		return c, nil
+	}
+	p, err := h.service.GetProfile(ctx, accountID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Nothing on file yet: share nothing rather than fail the login
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+
+	if has(auth.ScopeProfile) {
+		c.GivenName, c.MiddleName, c.FamilyName = p.FirstName, p.MiddleName.String, p.LastName
+		c.Name = joinNonEmpty(" ", p.FirstName, p.MiddleName.String, p.LastName)
+		c.Nickname = p.AliasName.String
+		c.Gender = p.Gender.String
+		if p.Birthdate.Valid {
+			c.Birthdate = p.Birthdate.Time.Format("2006-01-02")
+		}
+	}
+	if has(auth.ScopeEmail) && p.Email.Valid {
+		c.Email, c.EmailVerified = p.Email.String, &unverified
+	}
+	if has(auth.ScopeAddress) && p.AddressID.Valid {
+		street := joinNonEmpty(", ", p.Kebele.String, p.Wereda.String, p.Zone.String)
+		c.Address = &AddressClaim{
+			Formatted:     joinNonEmpty(", ", street, p.City.String, p.Region.String, p.Country.String),
+			StreetAddress: street,
+			Locality:      p.City.String,
+			Region:        p.Region.String,
+			Country:       p.Country.String,
+		}
+	}
+	return c, nil
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	return strings.Join(slices.DeleteFunc(parts, func(s string) bool { return s == "" }), sep)
+}
+
+// userInfoResponse is the userinfo endpoint's answer
+type userInfoResponse struct {
+	Subject string `json:"sub"`
+	UserClaims
+}
+
+// UserInfo godoc
+// @Summary      OpenID Connect UserInfo
+// @Description  Returns the claims the user agreed to share with the relying party the access token was issued to.
+// @Tags         oauth
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  userInfoResponse
+// @Router       /api/v1/oauth/userinfo [get]
+func (h *handler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	// The AuthMiddleware checked the token and its session
+	claims, ok := r.Context().Value(middlewares.ClaimsKey).(*auth.Claims)
+	accID, ok2 := r.Context().Value(middlewares.UserIDKey).(pgtype.UUID)
+	if !ok || !ok2 {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_token", "")
+		return
+	}
+
+	c, err := h.userClaims(r.Context(), accID, strings.Fields(claims.Scope))
+	if err != nil {
+		h.logger.Error("failed to load userinfo claims", "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	json.Write(w, http.StatusOK, userInfoResponse{Subject: claims.AccountID, UserClaims: c})
+}
@@ -0,0 +1,208 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/constants"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+)
+
+// createClientRequest registers a relying party
+// @Name CreateOAuthClientRequest
+type createClientRequest struct {
+	Name         string   `json:"name" validate:"required,max=100" example:"Dashen Bank"`
+	RedirectURIs []string `json:"redirect_uris" validate:"required,min=1,max=10,dive,required,max=2000" example:"https://app.dashenbank.com/oidc/callback"`
+	// Scopes caps what users can be asked to share; defaults to all of them
+	Scopes  []string `json:"scopes" validate:"omitempty,dive,oneof=openid profile email phone address" example:"openid,profile,phone"`
+	LogoURI string   `json:"logo_uri" validate:"omitempty,url,max=255" example:"https://dashenbank.com/logo.png"`
+	// Public clients (mobile and single-page apps) can't keep a secret and get none
+	Public bool `json:"public" example:"false"`
+}
+
+// ClientDTO describes a registered relying party
+// @Name OAuthClientDTO
+type ClientDTO struct {
+	ID           string   `json:"client_id" example:"q8Ukp3Yb0l2dUxTq7m1n5A"`
+	Name         string   `json:"name" example:"Dashen Bank"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes" example:"openid,profile,phone"`
+	LogoURI      string   `json:"logo_uri,omitempty" example:"https://dashenbank.com/logo.png"`
+	Public       bool     `json:"public" example:"false"`
+	// Secret is only ever shown in the registration response
+	Secret    string `json:"client_secret,omitempty" example:"cHtQ0n0nZ8x2..."`
+	CreatedAt string `json:"created_at" example:"2023-10-27T10:00:00Z"`
+}
+
+// MapClientRow translates a client record into its API form, without the secret
+func MapClientRow(c repo.OauthClient) ClientDTO {
+	return ClientDTO{
+		ID:           c.ID,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectUris,
+		Scopes:       c.Scopes,
+		LogoURI:      c.LogoUri.String,
+		Public:       !c.SecretHash.Valid,
+		CreatedAt:    c.CreatedAt.Time.Format(time.RFC3339),
+	}
+}
+
+// CreateClient godoc
+// @Summary      Register a Relying Party
+// @Description  Registers an app that may offer "Log in with AddisVerify". The client secret is returned once and only its hash is stored.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        X-Admin-Key  header    string                   true  "Admin API key"
+// @Param        request      body      createClientRequest      true  "Client"
+// @Success      201          {object}  ClientDTO
+// @Failure      422          {object}  json.ErrorResponse
+// @Router       /api/v1/admin/oauth/clients [post]
+func (h *handler) CreateClient(w http.ResponseWriter, r *http.Request) {
+	var req createClientRequest
+	if err := json.Read(r, &req); err != nil {
+		json.WriteError(w, http.StatusBadRequest, constants.ErrInvalidJSON)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		json.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	for _, uri := range req.RedirectURIs {
+		if err := checkRedirectURI(uri); err != nil {
+			json.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+	}
+
+	// openid is what makes it a login; the rest keep the consent screen's order
+	scopes := slices.DeleteFunc(slices.Clone(supportedScopes), func(s string) bool {
+		return s != auth.ScopeOpenID && len(req.Scopes) > 0 && !slices.Contains(req.Scopes, s)
+	})
+
+	arg := repo.CreateOAuthClientParams{
+		ID:           randomToken(16),
+		Name:         req.Name,
+		RedirectUris: req.RedirectURIs,
+		Scopes:       scopes,
+		LogoUri:      pgtype.Text{String: req.LogoURI, Valid: req.LogoURI != ""},
+	}
+	var secret string
+	if !req.Public {
+		secret = randomToken(32)
+		arg.SecretHash = pgtype.Text{String: hashSecret(secret), Valid: true}
+	}
+
+	client, err := h.service.CreateClient(r.Context(), arg)
+	if err != nil {
+		h.logger.Error("failed to register oauth client", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+
+	h.logger.Info("oauth client registered", "client_id", client.ID, "name", client.Name, "public", req.Public)
+	out := MapClientRow(client)
+	out.Secret = secret
+	json.Write(w, http.StatusCreated, out)
+}
+
+// ListClients godoc
+// @Summary      List Relying Parties
+// @Description  Lists the apps registered for "Log in with AddisVerify", newest first.
+// @Tags         admin
+// @Produce      json
+// @Param        X-Admin-Key  header    string  true  "Admin API key"
+// @Success      200          {array}   ClientDTO
+// @Router       /api/v1/admin/oauth/clients [get]
+func (h *handler) ListClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.service.ListClients(r.Context())
+	if err != nil {
+		h.logger.Error("failed to list oauth clients", "error", err)
+		json.WriteError(w, http.StatusInternalServerError, constants.ErrInternalServerError)
+		return
+	}
+
+	out := make([]ClientDTO, 0, len(clients))
+	for _, c := range clients {
+		out = append(out, MapClientRow(c))
+	}
+	json.Write(w, http.StatusOK, out)
+}
+
+// checkRedirectURI accepts https URLs, http only on the loopback interface, and
+// custom schemes for native apps (RFC 8252). Fragments are never allowed.
+func checkRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return fmt.Errorf("redirect_uri %q is not an absolute URL", raw)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect_uri %q must not have a fragment", raw)
+	}
+	switch u.Scheme {
+	case "https":
+		if u.Host == "" {
+			return fmt.Errorf("redirect_uri %q has no host", raw)
+		}
+	case "http":
+		if h := u.Hostname(); h != "localhost" && h != "127.0.0.1" && h != "::1" {
+			return fmt.Errorf("redirect_uri %q must use https", raw)
+		}
+	case "javascript", "data", "file":
+		return fmt.Errorf("redirect_uri %q has a forbidden scheme", raw)
+	}
+	return nil
+}
+
+// authenticateClient identifies the client calling the token endpoint by HTTP Basic
+// credentials or the client_id and client_secret form fields. Public clients send
+// only their client_id. It returns false when the credentials don't check out.
+func (h *handler) authenticateClient(r *http.Request) (repo.OauthClient, bool) {
+	id, secret, basic := r.BasicAuth()
+	if basic {
+		// Basic credentials are form-encoded (RFC 6749 section 2.3.1)
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id == "" {
+		return repo.OauthClient{}, false
+	}
+
+	client, err := h.service.GetClient(r.Context(), id)
+	if err != nil {
+		return repo.OauthClient{}, false
+	}
+	if !client.SecretHash.Valid {
+		// Public clients prove themselves with PKCE instead
+		return client, secret == ""
+	}
+	ok := subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(client.SecretHash.String)) == 1
+	return client, ok
+}
+
+// hashSecret hashes a client secret or authorization code. Both are long random
+// strings, so a fast unsalted hash is enough to keep them out of storage.
+func hashSecret(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomToken returns n random bytes, base64url-encoded.
+func randomToken(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,182 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+)
+
+// introspectionResponse describes a token (RFC 7662 section 2.2). Inactive tokens
+// get {"active": false} and nothing else, whatever the reason.
+type introspectionResponse struct {
+	Active    bool     `json:"active" example:"true"`
+	Scope     string   `json:"scope,omitempty" example:"openid profile phone"`
+	ClientID  string   `json:"client_id,omitempty" example:"q8Ukp3Yb0l2dUxTq7m1n5A"`
+	TokenType string   `json:"token_type,omitempty" example:"Bearer"`
+	Exp       int64    `json:"exp,omitempty" example:"1698400800"`
+	Iat       int64    `json:"iat,omitempty" example:"1698400200"`
+	Subject   string   `json:"sub,omitempty" example:"0b8f5e3c-3f0e-4c55-9b5e-6d8a1f0f3c21"`
+	Audience  []string `json:"aud,omitempty" example:"addis_verify.userinfo"`
+	Issuer    string   `json:"iss,omitempty" example:"addis_verify"`
+	JTI       string   `json:"jti,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	AuthTime  int64    `json:"auth_time,omitempty"`
+	AMR       []string `json:"amr,omitempty" example:"otp"`
+}
+
+// inspect decides whether token is still good, with the same checks AuthMiddleware
+// and the refresh endpoint apply. It returns nil claims for inactive tokens; err is
+// only set when the database couldn't answer.
+func (h *handler) inspect(ctx context.Context, token string) (*auth.Claims, repo.Session, error) {
+	claims, err := h.auth.VerifyToken(token)
+	if err != nil {
+		return nil, repo.Session{}, nil
+	}
+	session, err := middlewares.CheckSession(ctx, h.service, claims)
+	if err != nil {
+		return nil, repo.Session{}, nil
+	}
+	if claims.Type != "refresh" {
+		return claims, session, nil
+	}
+
+	// A refresh token is spent the moment it is used, even when the session lives on
+	var jti pgtype.UUID
+	if err := jti.Scan(claims.ID); err != nil {
+		return nil, repo.Session{}, nil
+	}
+	rt, err := h.service.GetRefreshToken(ctx, jti)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, repo.Session{}, nil
+	}
+	if err != nil {
+		return nil, repo.Session{}, err
+	}
+	if rt.SessionID != session.ID || rt.UsedAt.Valid || !rt.ExpiresAt.Time.After(time.Now()) {
+		return nil, repo.Session{}, nil
+	}
+	return claims, session, nil
+}
+
+// Introspect godoc
+// @Summary      Token Introspection
+// @Description  Tells a partner back end whether an AddisVerify access or refresh token is still valid, including whether its session was signed out or replaced (RFC 7662). Only confidential clients may call it.
+// @Tags         oauth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        token            formData  string  true   "The token to check"
+// @Param        token_type_hint  formData  string  false  "access_token or refresh_token (tokens identify themselves, so it is ignored)"
+// @Success      200  {object}  introspectionResponse
+// @Failure      401  {object}  oauthError
+// @Router       /api/v1/oauth/introspect [post]
+func (h *handler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, errInvalidRequest, "invalid form body")
+		return
+	}
+	// Public clients can't prove who they are, so they can't be told about tokens
+	client, ok := h.authenticateClient(r)
+	if !ok || !client.SecretHash.Valid {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		writeOAuthError(w, http.StatusUnauthorized, errInvalidClient, "client authentication failed")
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, http.StatusBadRequest, errInvalidRequest, "token is required")
+		return
+	}
+
+	claims, session, err := h.inspect(r.Context(), token)
+	if err != nil {
+		h.logger.Error("failed to introspect token", "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if claims == nil {
+		json.Write(w, http.StatusOK, introspectionResponse{Active: false})
+		return
+	}
+	tokenType := "Bearer"
+	if claims.Type == "refresh" {
+		tokenType = "refresh_token"
+	}
+	json.Write(w, http.StatusOK, introspectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		TokenType: tokenType,
+		Exp:       claims.ExpiresAt.Unix(),
+		Iat:       claims.IssuedAt.Unix(),
+		Subject:   claims.AccountID,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		JTI:       claims.ID,
+		SessionID: session.ID.String(),
+		AuthTime:  claims.AuthTime,
+		AMR:       claims.AMR,
+	})
+}
+
+// Revoke godoc
+// @Summary      Token Revocation
+// @Description  Revokes a token issued to the calling client (RFC 7009). Access and refresh tokens alike end their whole session, so every token from the same login stops working at once, for every consumer. Unknown, expired and other clients' tokens are ignored.
+// @Tags         oauth
+// @Accept       x-www-form-urlencoded
+// @Param        token            formData  string  true   "The token to revoke"
+// @Param        token_type_hint  formData  string  false  "access_token or refresh_token (ignored)"
+// @Success      200  "Revoked, or nothing to revoke"
+// @Failure      401  {object}  oauthError
+// @Router       /api/v1/oauth/revoke [post]
+func (h *handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, errInvalidRequest, "invalid form body")
+		return
+	}
+	client, ok := h.authenticateClient(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		writeOAuthError(w, http.StatusUnauthorized, errInvalidClient, "client authentication failed")
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, http.StatusBadRequest, errInvalidRequest, "token is required")
+		return
+	}
+
+	claims, session, err := h.inspect(r.Context(), token)
+	if err != nil {
+		h.logger.Error("failed to check token for revocation", "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+	// Nothing to do for dead tokens; a client can't sign users out of other apps
+	if claims == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if claims.ClientID != client.ID {
+		h.logger.Warn("client tried to revoke another client's token", "client_id", client.ID, "token_client_id", claims.ClientID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := h.service.RevokeSession(r.Context(), session.AccountID, session.ID); err != nil {
+		h.logger.Error("failed to revoke session", "error", err)
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+	h.logger.Info("token revoked", "client_id", client.ID, "account_id", session.AccountID, "session_id", session.ID)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,177 @@
+// Package oidc makes AddisVerify an OpenID Connect provider, so third-party apps
+// can offer "Log in with AddisVerify".
+//
+// Users sign in with the usual phone OTP. A relying party sends them to the
+// authorization endpoint; the AddisVerify web app shows the consent data from
+// GET /oauth/authorize and, once the signed-in user approves, posts the decision
+// back and follows the returned redirect. The relying party then exchanges the
+// code (authorization code flow, PKCE required) for an ID token and an access
+// token for the userinfo endpoint. Both are signed by the TokenManager and can be
+// checked against the published JWKS.
+package oidc
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/redis/go-redis/v9"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+)
+
+// Paths of the endpoints, relative to the issuer.
+const (
+	DiscoveryPath = "/.well-known/openid-configuration"
+	JWKSPath      = "/.well-known/jwks.json"
+	AuthorizePath = "/api/v1/oauth/authorize"
+	TokenPath     = "/api/v1/oauth/token"
+	UserInfoPath  = "/api/v1/oauth/userinfo"
+	// Partner back ends check and revoke tokens here
+	IntrospectionPath = "/api/v1/oauth/introspect"
+	RevocationPath    = "/api/v1/oauth/revoke"
+)
+
+// codeTTL bounds how long an authorization code can wait to be exchanged.
+const codeTTL = time.Minute
+
+// Config describes the provider.
+type Config struct {
+	// Issuer is the public base URL, e.g. https://id.addisverify.et. It is the iss
+	// of every ID token, and discovery is served under it.
+	Issuer string
+	// ConsentPageURL is the web page users are sent to for signing in and consenting.
+	// It receives the authorization request's query string. Defaults to the
+	// authorize API itself.
+	ConsentPageURL string
+}
+
+// Cache abstracts Redis for testability
+type Cache interface {
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	GetDel(ctx context.Context, key string) *redis.StringCmd
+}
+
+type Handler interface {
+	Discovery(w http.ResponseWriter, r *http.Request)
+	Authorize(w http.ResponseWriter, r *http.Request)
+	Approve(w http.ResponseWriter, r *http.Request)
+	Token(w http.ResponseWriter, r *http.Request)
+	UserInfo(w http.ResponseWriter, r *http.Request)
+	Introspect(w http.ResponseWriter, r *http.Request)
+	Revoke(w http.ResponseWriter, r *http.Request)
+
+	CreateClient(w http.ResponseWriter, r *http.Request)
+	ListClients(w http.ResponseWriter, r *http.Request)
+}
+
+type handler struct {
+	service  Service
+	cache    Cache
+	auth     auth.TokenManager
+	cfg      Config
+	logger   *slog.Logger
+	validate *validator.Validate
+}
+
+// NewHandler creates the OpenID Connect provider endpoints
+func NewHandler(service Service, cache Cache, tokenManager auth.TokenManager, cfg Config, logger *slog.Logger) Handler {
+	return &handler{
+		service:  service,
+		cache:    cache,
+		auth:     tokenManager,
+		cfg:      cfg,
+		logger:   logger,
+		validate: validator.New(),
+	}
+}
+
+// discoveryDocument is the provider metadata (OpenID Connect Discovery 1.0)
+type discoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	// The authorization response names the issuer (RFC 9207)
+	AuthorizationResponseIssParameterSupported bool `json:"authorization_response_iss_parameter_supported"`
+}
+
+// Discovery godoc
+// @Summary      OpenID Connect Discovery
+// @Description  Provider metadata for "Log in with AddisVerify": endpoints, supported scopes and claims, and signing algorithms.
+// @Tags         oauth
+// @Produce      json
+// @Success      200  {object}  discoveryDocument
+// @Router       /.well-known/openid-configuration [get]
+func (h *handler) Discovery(w http.ResponseWriter, r *http.Request) {
+	// The current key signs ID tokens; list it first
+	var algs []string
+	for _, k := range h.auth.JWKS().Keys {
+		algs = append(algs, k.Alg)
+	}
+
+	authorize := h.cfg.ConsentPageURL
+	if authorize == "" {
+		authorize = h.cfg.Issuer + AuthorizePath
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.Write(w, http.StatusOK, discoveryDocument{
+		Issuer:                            h.cfg.Issuer,
+		AuthorizationEndpoint:             authorize,
+		TokenEndpoint:                     h.cfg.Issuer + TokenPath,
+		UserInfoEndpoint:                  h.cfg.Issuer + UserInfoPath,
+		JWKSURI:                           h.cfg.Issuer + JWKSPath,
+		ScopesSupported:                   supportedScopes,
+		ClaimsSupported:                   supportedClaims(),
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  algs,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		IntrospectionEndpoint:             h.cfg.Issuer + IntrospectionPath,
+		RevocationEndpoint:                h.cfg.Issuer + RevocationPath,
+
+		AuthorizationResponseIssParameterSupported: true,
+	})
+}
+
+// oauthError is an OAuth 2.0 error response (RFC 6749 section 5.2)
+type oauthError struct {
+	Code        string `json:"error" example:"invalid_request"`
+	Description string `json:"error_description,omitempty" example:"redirect_uri is not registered for this client"`
+	// RedirectTo sends the user back to the client with the error. It is empty when
+	// the client or redirect URI can't be trusted: the user must not be sent there.
+	RedirectTo string `json:"redirect_to,omitempty"`
+}
+
+// OAuth error codes.
+const (
+	errInvalidRequest          = "invalid_request"
+	errInvalidClient           = "invalid_client"
+	errInvalidGrant            = "invalid_grant"
+	errInvalidScope            = "invalid_scope"
+	errAccessDenied            = "access_denied"
+	errUnsupportedResponseType = "unsupported_response_type"
+	errUnsupportedGrantType    = "unsupported_grant_type"
+	errServerError             = "server_error"
+)
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	json.Write(w, status, oauthError{Code: code, Description: description})
+}
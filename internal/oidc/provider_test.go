@@ -0,0 +1,579 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+)
+
+// fakeService keeps one account, its profile and the registered clients in memory.
+type fakeService struct {
+	account  repo.Account
+	profile  *repo.GetUserWithAddressByAccountIDRow
+	clients  map[string]repo.OauthClient
+	sessions []repo.Session
+	refresh  map[pgtype.UUID]repo.RefreshToken
+}
+
+func (f *fakeService) CreateClient(_ context.Context, arg repo.CreateOAuthClientParams) (repo.OauthClient, error) {
+	c := repo.OauthClient{ID: arg.ID, Name: arg.Name, SecretHash: arg.SecretHash, RedirectUris: arg.RedirectUris, Scopes: arg.Scopes, LogoUri: arg.LogoUri}
+	f.clients[c.ID] = c
+	return c, nil
+}
+func (f *fakeService) GetClient(_ context.Context, id string) (repo.OauthClient, error) {
+	c, ok := f.clients[id]
+	if !ok {
+		return c, pgx.ErrNoRows
+	}
+	return c, nil
+}
+func (f *fakeService) ListClients(context.Context) ([]repo.OauthClient, error) {
+	var out []repo.OauthClient
+	for _, c := range f.clients {
+		out = append(out, c)
+	}
+	return out, nil
+}
+func (f *fakeService) GetAccount(context.Context, pgtype.UUID) (repo.Account, error) {
+	return f.account, nil
+}
+func (f *fakeService) GetAccountStatus(context.Context, pgtype.UUID) (repo.AccountStatus, error) {
+	return f.account.Status, nil
+}
+func (f *fakeService) GetProfile(context.Context, pgtype.UUID) (repo.GetUserWithAddressByAccountIDRow, error) {
+	if f.profile == nil {
+		return repo.GetUserWithAddressByAccountIDRow{}, pgx.ErrNoRows
+	}
+	return *f.profile, nil
+}
+func (f *fakeService) CreateSession(_ context.Context, arg repo.CreateSessionParams) (repo.Session, error) {
+	s := repo.Session{
+		ID:             pgtype.UUID{Bytes: [16]byte{byte(len(f.sessions) + 10)}, Valid: true},
+		AccountID:      arg.AccountID,
+		DeviceName:     arg.DeviceName,
+		ClientType:     arg.ClientType,
+		Amr:            arg.Amr,
+		TokenValidFrom: pgtype.Timestamptz{Time: time.Now().Truncate(time.Second), Valid: true},
+	}
+	f.sessions = append(f.sessions, s)
+	return s, nil
+}
+func (f *fakeService) GetSession(_ context.Context, id pgtype.UUID) (repo.Session, error) {
+	for _, s := range f.sessions {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return repo.Session{}, pgx.ErrNoRows
+}
+func (f *fakeService) RevokeSession(_ context.Context, accountID, id pgtype.UUID) error {
+	for i, s := range f.sessions {
+		if s.ID == id && s.AccountID == accountID {
+			f.sessions[i].RevokedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+func (f *fakeService) GetRefreshToken(_ context.Context, jti pgtype.UUID) (repo.RefreshToken, error) {
+	rt, ok := f.refresh[jti]
+	if !ok {
+		return rt, pgx.ErrNoRows
+	}
+	return rt, nil
+}
+
+// provider runs the OpenID Connect endpoints the way routes.go mounts them. A user
+// signed in to AddisVerify is simulated by the X-Test-User header, and bearer tokens
+// are checked with the TokenManager alone.
+type provider struct {
+	*httptest.Server
+	svc   *fakeService
+	tm    auth.TokenManager
+	cache *miniredis.Miniredis
+	user  pgtype.UUID
+	login time.Time
+}
+
+func newProvider(t *testing.T) *provider {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := auth.NewKey(priv, pub)
+	require.NoError(t, err)
+	tm, err := auth.NewJWTManager(auth.DefaultConfig(), key)
+	require.NoError(t, err)
+
+	p := &provider{
+		svc:   &fakeService{clients: map[string]repo.OauthClient{}, refresh: map[pgtype.UUID]repo.RefreshToken{}},
+		tm:    tm,
+		cache: miniredis.RunT(t),
+		user:  pgtype.UUID{Bytes: [16]byte{1}, Valid: true},
+		login: time.Now().Add(-time.Hour).Truncate(time.Second),
+	}
+	p.svc.account = repo.Account{ID: p.user, Status: repo.AccountStatusActive, Phone: "+251911223344", PreferredLanguage: pgtype.Text{String: "am", Valid: true}}
+
+	r := chi.NewRouter()
+	p.Server = httptest.NewServer(r)
+	t.Cleanup(p.Close)
+
+	rdb := redis.NewClient(&redis.Options{Addr: p.cache.Addr()})
+	h := NewHandler(p.svc, rdb, tm, Config{Issuer: p.URL}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	signedIn := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Test-User") == "" {
+				http.Error(w, "not signed in", http.StatusUnauthorized)
+				return
+			}
+			ctx := context.WithValue(r.Context(), middlewares.UserIDKey, p.user)
+			ctx = context.WithValue(ctx, middlewares.ClaimsKey, &auth.Claims{AuthTime: p.login.Unix(), AMR: []string{auth.AMROTP}})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+	bearer := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := tm.VerifyToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+			if err != nil || !claims.HasAudience(auth.AudienceUserInfo) {
+				http.Error(w, "bad token", http.StatusUnauthorized)
+				return
+			}
+			var id pgtype.UUID
+			_ = id.Scan(claims.AccountID)
+			ctx := context.WithValue(r.Context(), middlewares.UserIDKey, id)
+			ctx = context.WithValue(ctx, middlewares.ClaimsKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+
+	r.Get(DiscoveryPath, h.Discovery)
+	r.Get(JWKSPath, func(w http.ResponseWriter, r *http.Request) { _ = json.NewEncoder(w).Encode(tm.JWKS()) })
+	r.Get(AuthorizePath, h.Authorize)
+	r.With(signedIn).Post(AuthorizePath, h.Approve)
+	r.Post(TokenPath, h.Token)
+	r.Post(IntrospectionPath, h.Introspect)
+	r.Post(RevocationPath, h.Revoke)
+	r.With(bearer).Get(UserInfoPath, h.UserInfo)
+	r.Post("/admin/clients", h.CreateClient)
+	return p
+}
+
+// register signs up a relying party through the admin API.
+func (p *provider) register(t *testing.T, body string) ClientDTO {
+	t.Helper()
+	resp, err := http.Post(p.URL+"/admin/clients", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var c ClientDTO
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&c))
+	return c
+}
+
+// relyingParty is a minimal OpenID Connect client, as a partner would write it.
+type relyingParty struct {
+	t           *testing.T
+	client      ClientDTO
+	redirectURI string
+	discovery   discoveryDocument
+	verifier    string
+	state       string
+	nonce       string
+}
+
+func newRelyingParty(t *testing.T, issuer string, client ClientDTO) *relyingParty {
+	rp := &relyingParty{t: t, client: client, redirectURI: client.RedirectURIs[0]}
+	rp.getJSON(issuer+DiscoveryPath, &rp.discovery)
+	require.Equal(t, issuer, rp.discovery.Issuer)
+	return rp
+}
+
+func (rp *relyingParty) getJSON(u string, out any) int {
+	rp.t.Helper()
+	resp, err := http.Get(u)
+	require.NoError(rp.t, err)
+	defer resp.Body.Close()
+	require.NoError(rp.t, json.NewDecoder(resp.Body).Decode(out))
+	return resp.StatusCode
+}
+
+// authorizeURL starts a login with a fresh PKCE verifier, state and nonce.
+func (rp *relyingParty) authorizeURL(scope string) string {
+	rp.verifier, rp.state, rp.nonce = randomToken(32), randomToken(8), randomToken(8)
+	sum := sha256.Sum256([]byte(rp.verifier))
+	q := url.Values{
+		"client_id":             {rp.client.ID},
+		"redirect_uri":          {rp.redirectURI},
+		"response_type":         {"code"},
+		"scope":                 {scope},
+		"state":                 {rp.state},
+		"nonce":                 {rp.nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	return rp.discovery.AuthorizationEndpoint + "?" + q.Encode()
+}
+
+// post calls one of the provider's back-channel endpoints as the client.
+func (rp *relyingParty) post(endpoint string, form url.Values) *http.Response {
+	rp.t.Helper()
+	if rp.client.Public {
+		form.Set("client_id", rp.client.ID)
+	}
+	req, _ := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if !rp.client.Public {
+		req.SetBasicAuth(url.QueryEscape(rp.client.ID), url.QueryEscape(rp.client.Secret))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(rp.t, err)
+	rp.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// exchange redeems a code at the token endpoint.
+func (rp *relyingParty) exchange(code, verifier string) (*http.Response, tokenResponse) {
+	rp.t.Helper()
+	resp := rp.post(rp.discovery.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {rp.redirectURI},
+		"code_verifier": {verifier},
+	})
+	var tokens tokenResponse
+	_ = json.NewDecoder(resp.Body).Decode(&tokens)
+	return resp, tokens
+}
+
+// introspect asks whether token is still good.
+func (rp *relyingParty) introspect(token string) (*http.Response, introspectionResponse) {
+	rp.t.Helper()
+	resp := rp.post(rp.discovery.IntrospectionEndpoint, url.Values{"token": {token}})
+	var out introspectionResponse
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	return resp, out
+}
+
+// login runs the whole authorization code flow and returns the client's tokens.
+func (rp *relyingParty) login(p *provider, scope string) tokenResponse {
+	rp.t.Helper()
+	back := approve(rp.t, p, rp.authorizeURL(scope), true)
+	resp, tokens := rp.exchange(back.Get("code"), rp.verifier)
+	require.Equal(rp.t, http.StatusOK, resp.StatusCode)
+	return tokens
+}
+
+// verifyIDToken checks an ID token with nothing but the published JWKS.
+func (rp *relyingParty) verifyIDToken(raw string) map[string]any {
+	rp.t.Helper()
+	var jwks auth.JWKS
+	rp.getJSON(rp.discovery.JWKSURI, &jwks)
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.NewParser(
+		jwt.WithIssuer(rp.discovery.Issuer),
+		jwt.WithAudience(rp.client.ID),
+		jwt.WithValidMethods(rp.discovery.IDTokenSigningAlgValuesSupported),
+	).ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		for _, k := range jwks.Keys {
+			if k.Kid == t.Header["kid"] {
+				x, err := base64.RawURLEncoding.DecodeString(k.X)
+				return ed25519.PublicKey(x), err
+			}
+		}
+		return nil, jwt.ErrTokenUnverifiable
+	})
+	require.NoError(rp.t, err)
+	require.Equal(rp.t, rp.nonce, claims["nonce"])
+	return claims
+}
+
+// approve plays the AddisVerify web app: the signed-in user consents and the
+// browser follows the redirect back to the relying party.
+func approve(t *testing.T, p *provider, authorizeURL string, allow bool) url.Values {
+	t.Helper()
+	u, _ := url.Parse(authorizeURL)
+	q := u.Query()
+	body, _ := json.Marshal(map[string]any{
+		"client_id": q.Get("client_id"), "redirect_uri": q.Get("redirect_uri"), "response_type": q.Get("response_type"),
+		"scope": q.Get("scope"), "state": q.Get("state"), "nonce": q.Get("nonce"),
+		"code_challenge": q.Get("code_challenge"), "code_challenge_method": q.Get("code_challenge_method"),
+		"approve": allow,
+	})
+	req, _ := http.NewRequest(http.MethodPost, p.URL+AuthorizePath, strings.NewReader(string(body)))
+	req.Header.Set("X-Test-User", "yes")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var out redirectResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+	back, err := url.Parse(out.RedirectTo)
+	require.NoError(t, err)
+	return back.Query()
+}
+
+func TestProvider_AuthorizationCodeFlow(t *testing.T) {
+	p := newProvider(t)
+	p.svc.profile = &repo.GetUserWithAddressByAccountIDRow{
+		UserID:     pgtype.UUID{Bytes: [16]byte{9}, Valid: true},
+		FirstName:  "Abebe",
+		MiddleName: pgtype.Text{String: "Kebede", Valid: true},
+		LastName:   "Bikila",
+		Birthdate:  pgtype.Date{Time: time.Date(1990, 8, 7, 0, 0, 0, 0, time.UTC), Valid: true},
+		Email:      pgtype.Text{String: "abebe@example.com", Valid: true},
+		AddressID:  pgtype.UUID{Bytes: [16]byte{8}, Valid: true},
+		Country:    pgtype.Text{String: "Ethiopia", Valid: true},
+		City:       pgtype.Text{String: "Addis Ababa", Valid: true},
+		Wereda:     pgtype.Text{String: "Wereda 03", Valid: true},
+	}
+	client := p.register(t, `{"name":"Dashen Bank","redirect_uris":["https://bank.example/cb"],"scopes":["profile","phone"]}`)
+	require.NotEmpty(t, client.Secret)
+	rp := newRelyingParty(t, p.URL, client)
+
+	// 1. The consent screen names the client and only the scopes it may ask for
+	authorize := rp.authorizeURL("openid profile phone address")
+	var consent consentResponse
+	require.Equal(t, http.StatusOK, rp.getJSON(authorize, &consent))
+	assert.Equal(t, "Dashen Bank", consent.Client.Name)
+	var names []string
+	for _, s := range consent.Scopes {
+		names = append(names, s.Name)
+		// Only the phone number is proven; the profile is what the user typed in
+		if s.Name == "profile" {
+			assert.NotContains(t, s.Description, "verified")
+		}
+	}
+	assert.Equal(t, []string{"openid", "profile", "phone"}, names)
+
+	// 2. The user approves; the code comes back with the state and our issuer
+	back := approve(t, p, authorize, true)
+	assert.Equal(t, rp.state, back.Get("state"))
+	assert.Equal(t, p.URL, back.Get("iss"))
+	code := back.Get("code")
+	require.NotEmpty(t, code)
+
+	// 3. Code for tokens
+	resp, tokens := rp.exchange(code, rp.verifier)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, "openid profile phone", tokens.Scope)
+
+	id := rp.verifyIDToken(tokens.IDToken)
+	assert.Equal(t, p.user.String(), id["sub"])
+	assert.Equal(t, client.ID, id["azp"])
+	assert.Equal(t, float64(p.login.Unix()), id["auth_time"])
+	assert.Equal(t, "Abebe Kebede Bikila", id["name"])
+	assert.Equal(t, "1990-08-07", id["birthdate"])
+	assert.Equal(t, "+251911223344", id["phone_number"])
+	assert.Equal(t, true, id["phone_number_verified"])
+	assert.Nil(t, id["email"], "email wasn't granted")
+	assert.Nil(t, id["address"], "address isn't allowed for this client")
+
+	// The client's tokens live in their own session, named after it
+	require.Len(t, p.svc.sessions, 1)
+	assert.Equal(t, "Dashen Bank", p.svc.sessions[0].DeviceName.String)
+	assert.Equal(t, auth.ClientOIDC, p.svc.sessions[0].ClientType)
+	assert.Equal(t, p.svc.sessions[0].ID.String(), id["sid"])
+
+	// 4. Userinfo with the access token
+	req, _ := http.NewRequest(http.MethodGet, rp.discovery.UserInfoEndpoint, nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	uiResp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer uiResp.Body.Close()
+	require.Equal(t, http.StatusOK, uiResp.StatusCode)
+	var info map[string]any
+	require.NoError(t, json.NewDecoder(uiResp.Body).Decode(&info))
+	assert.Equal(t, id["sub"], info["sub"])
+	assert.Equal(t, "Abebe", info["given_name"])
+	assert.Equal(t, "am", info["locale"])
+
+	// 5. Codes are single-use
+	resp, _ = rp.exchange(code, rp.verifier)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestProvider_PublicClientNeedsPKCE(t *testing.T) {
+	p := newProvider(t)
+	client := p.register(t, `{"name":"Mobile App","redirect_uris":["com.example.app:/oauth"],"public":true}`)
+	assert.Empty(t, client.Secret)
+	rp := newRelyingParty(t, p.URL, client)
+
+	back := approve(t, p, rp.authorizeURL("openid"), true)
+	resp, _ := rp.exchange(back.Get("code"), randomToken(32))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "a stolen code is useless without the verifier")
+
+	claims := rp.verifyIDToken(rp.login(p, "openid").IDToken)
+	assert.Nil(t, claims["name"], "no profile without the profile scope")
+}
+
+func TestProvider_RejectsBadRequests(t *testing.T) {
+	p := newProvider(t)
+	client := p.register(t, `{"name":"Dashen Bank","redirect_uris":["https://bank.example/cb"]}`)
+	rp := newRelyingParty(t, p.URL, client)
+
+	t.Run("Unregistered redirect URI is never redirected to", func(t *testing.T) {
+		rp.redirectURI = "https://evil.example/cb"
+		defer func() { rp.redirectURI = client.RedirectURIs[0] }()
+		var e oauthError
+		assert.Equal(t, http.StatusBadRequest, rp.getJSON(rp.authorizeURL("openid"), &e))
+		assert.Equal(t, errInvalidRequest, e.Code)
+		assert.Empty(t, e.RedirectTo)
+	})
+
+	t.Run("Missing openid goes back to the client", func(t *testing.T) {
+		var e oauthError
+		assert.Equal(t, http.StatusBadRequest, rp.getJSON(rp.authorizeURL("profile"), &e))
+		assert.Equal(t, errInvalidScope, e.Code)
+		assert.True(t, strings.HasPrefix(e.RedirectTo, "https://bank.example/cb?"))
+	})
+
+	t.Run("Plain PKCE is refused", func(t *testing.T) {
+		u := strings.Replace(rp.authorizeURL("openid"), "code_challenge_method=S256", "code_challenge_method=plain", 1)
+		var e oauthError
+		assert.Equal(t, http.StatusBadRequest, rp.getJSON(u, &e))
+		assert.Equal(t, errInvalidRequest, e.Code)
+	})
+
+	t.Run("Denied consent", func(t *testing.T) {
+		back := approve(t, p, rp.authorizeURL("openid"), false)
+		assert.Equal(t, errAccessDenied, back.Get("error"))
+		assert.Empty(t, back.Get("code"))
+	})
+
+	t.Run("Wrong client secret", func(t *testing.T) {
+		back := approve(t, p, rp.authorizeURL("openid"), true)
+		good := rp.client.Secret
+		rp.client.Secret = "nope"
+		defer func() { rp.client.Secret = good }()
+		resp, _ := rp.exchange(back.Get("code"), rp.verifier)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
+
+func TestProvider_Introspection(t *testing.T) {
+	p := newProvider(t)
+	bank := newRelyingParty(t, p.URL, p.register(t, `{"name":"Dashen Bank","redirect_uris":["https://bank.example/cb"]}`))
+	tokens := bank.login(p, "openid phone")
+
+	t.Run("Live access token", func(t *testing.T) {
+		resp, out := bank.introspect(tokens.AccessToken)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+		assert.True(t, out.Active)
+		assert.Equal(t, bank.client.ID, out.ClientID)
+		assert.Equal(t, "openid phone", out.Scope)
+		assert.Equal(t, p.user.String(), out.Subject)
+		assert.Equal(t, "Bearer", out.TokenType)
+		assert.Equal(t, p.svc.sessions[0].ID.String(), out.SessionID)
+	})
+
+	t.Run("Garbage is inactive", func(t *testing.T) {
+		_, out := bank.introspect("not-a-token")
+		assert.False(t, out.Active)
+		assert.Empty(t, out.Subject)
+	})
+
+	t.Run("Refresh tokens are inactive once spent", func(t *testing.T) {
+		session, _ := p.svc.CreateSession(context.Background(), repo.CreateSessionParams{AccountID: p.user, ClientType: auth.ClientMobile})
+		pair, err := p.tm.GenerateTokenPair(auth.Grant{
+			AccountID: p.user.String(), SessionID: session.ID.String(), Client: auth.ClientMobile, IssuedAt: session.TokenValidFrom.Time,
+		})
+		require.NoError(t, err)
+		var jti pgtype.UUID
+		require.NoError(t, jti.Scan(pair.RefreshTokenID))
+		p.svc.refresh[jti] = repo.RefreshToken{ID: jti, SessionID: session.ID, ExpiresAt: pgtype.Timestamptz{Time: time.Unix(pair.RtExpires, 0), Valid: true}}
+
+		_, out := bank.introspect(pair.RefreshToken)
+		assert.True(t, out.Active)
+		assert.Equal(t, "refresh_token", out.TokenType)
+		assert.Equal(t, auth.ClientMobile, out.ClientID)
+
+		rt := p.svc.refresh[jti]
+		rt.UsedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		p.svc.refresh[jti] = rt
+		_, out = bank.introspect(pair.RefreshToken)
+		assert.False(t, out.Active)
+	})
+
+	t.Run("Public clients may not introspect", func(t *testing.T) {
+		app := newRelyingParty(t, p.URL, p.register(t, `{"name":"Mobile App","redirect_uris":["com.example.app:/oauth"],"public":true}`))
+		resp, _ := app.introspect(tokens.AccessToken)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("Suspended accounts' tokens are inactive", func(t *testing.T) {
+		p.svc.account.Status = repo.AccountStatusSuspended
+		defer func() { p.svc.account.Status = repo.AccountStatusActive }()
+		_, out := bank.introspect(tokens.AccessToken)
+		assert.False(t, out.Active)
+	})
+
+	t.Run("Wrong secret", func(t *testing.T) {
+		impostor := *bank
+		impostor.client.Secret = "nope"
+		resp, _ := impostor.introspect(tokens.AccessToken)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
+
+func TestProvider_Revocation(t *testing.T) {
+	p := newProvider(t)
+	bank := newRelyingParty(t, p.URL, p.register(t, `{"name":"Dashen Bank","redirect_uris":["https://bank.example/cb"]}`))
+	other := newRelyingParty(t, p.URL, p.register(t, `{"name":"Telebirr","redirect_uris":["https://tele.example/cb"]}`))
+	tokens := bank.login(p, "openid")
+
+	// Another client can't sign the user out of the bank
+	resp := other.post(other.discovery.RevocationEndpoint, url.Values{"token": {tokens.AccessToken}})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, p.svc.sessions[0].RevokedAt.Valid)
+
+	// The bank can, and every consumer sees it at once
+	resp = bank.post(bank.discovery.RevocationEndpoint, url.Values{"token": {tokens.AccessToken}, "token_type_hint": {"access_token"}})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, p.svc.sessions[0].RevokedAt.Valid)
+
+	_, out := other.introspect(tokens.AccessToken)
+	assert.False(t, out.Active)
+
+	// Revoking again, or revoking garbage, is not an error
+	resp = bank.post(bank.discovery.RevocationEndpoint, url.Values{"token": {tokens.AccessToken}})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = bank.post(bank.discovery.RevocationEndpoint, url.Values{"token": {"garbage"}})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestCheckRedirectURI(t *testing.T) {
+	for _, ok := range []string{"https://bank.example/cb", "http://localhost:8080/cb", "http://127.0.0.1/cb", "com.example.app:/oauth"} {
+		assert.NoError(t, checkRedirectURI(ok), ok)
+	}
+	for _, bad := range []string{"http://bank.example/cb", "https://bank.example/cb#x", "/relative", "javascript:alert(1)"} {
+		assert.Error(t, checkRedirectURI(bad), bad)
+	}
+}
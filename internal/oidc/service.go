@@ -0,0 +1,79 @@
+package oidc
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+)
+
+// Service is what the provider needs from the database
+type Service interface {
+	CreateClient(ctx context.Context, arg repo.CreateOAuthClientParams) (repo.OauthClient, error)
+	GetClient(ctx context.Context, id string) (repo.OauthClient, error)
+	ListClients(ctx context.Context) ([]repo.OauthClient, error)
+
+	GetAccount(ctx context.Context, id pgtype.UUID) (repo.Account, error)
+	GetAccountStatus(ctx context.Context, id pgtype.UUID) (repo.AccountStatus, error)
+	// GetProfile returns pgx.ErrNoRows for accounts that never filled in their profile.
+	GetProfile(ctx context.Context, accountID pgtype.UUID) (repo.GetUserWithAddressByAccountIDRow, error)
+	// CreateSession opens the session a relying party's tokens belong to, so signing
+	// the user out everywhere also cuts off the apps they logged into.
+	CreateSession(ctx context.Context, arg repo.CreateSessionParams) (repo.Session, error)
+	GetSession(ctx context.Context, id pgtype.UUID) (repo.Session, error)
+	RevokeSession(ctx context.Context, accountID, id pgtype.UUID) error
+	// GetRefreshToken returns pgx.ErrNoRows for refresh tokens that were never issued.
+	GetRefreshToken(ctx context.Context, jti pgtype.UUID) (repo.RefreshToken, error)
+}
+
+type svc struct {
+	repo repo.Querier
+}
+
+// New creates a new OpenID Connect service implementation
+func New(repo repo.Querier) Service {
+	return &svc{
+		repo: repo,
+	}
+}
+
+func (s *svc) CreateClient(ctx context.Context, arg repo.CreateOAuthClientParams) (repo.OauthClient, error) {
+	return s.repo.CreateOAuthClient(ctx, arg)
+}
+
+func (s *svc) GetClient(ctx context.Context, id string) (repo.OauthClient, error) {
+	return s.repo.GetOAuthClient(ctx, id)
+}
+
+func (s *svc) ListClients(ctx context.Context) ([]repo.OauthClient, error) {
+	return s.repo.ListOAuthClients(ctx)
+}
+
+func (s *svc) GetAccount(ctx context.Context, id pgtype.UUID) (repo.Account, error) {
+	return s.repo.GetAccountByID(ctx, id)
+}
+
+func (s *svc) GetAccountStatus(ctx context.Context, id pgtype.UUID) (repo.AccountStatus, error) {
+	return s.repo.GetAccountStatus(ctx, id)
+}
+
+func (s *svc) GetProfile(ctx context.Context, accountID pgtype.UUID) (repo.GetUserWithAddressByAccountIDRow, error) {
+	return s.repo.GetUserWithAddressByAccountID(ctx, accountID)
+}
+
+func (s *svc) CreateSession(ctx context.Context, arg repo.CreateSessionParams) (repo.Session, error) {
+	return s.repo.CreateSession(ctx, arg)
+}
+
+func (s *svc) GetSession(ctx context.Context, id pgtype.UUID) (repo.Session, error) {
+	return s.repo.GetSession(ctx, id)
+}
+
+func (s *svc) RevokeSession(ctx context.Context, accountID, id pgtype.UUID) error {
+	_, err := s.repo.RevokeSession(ctx, repo.RevokeSessionParams{ID: id, AccountID: accountID})
+	return err
+}
+
+func (s *svc) GetRefreshToken(ctx context.Context, jti pgtype.UUID) (repo.RefreshToken, error) {
+	return s.repo.GetRefreshToken(ctx, jti)
+}
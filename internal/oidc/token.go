@@ -0,0 +1,195 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	stdjson "encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	repo "github.com/yabeye/addis_verify_backend/internal/database"
+	"github.com/yabeye/addis_verify_backend/internal/middlewares"
+	"github.com/yabeye/addis_verify_backend/pkg/auth"
+	"github.com/yabeye/addis_verify_backend/pkg/json"
+)
+
+// tokenResponse is a successful token response (OpenID Connect Core 3.1.3.3)
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type" example:"Bearer"`
+	ExpiresIn   int64  `json:"expires_in" example:"600"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope" example:"openid profile phone"`
+}
+
+// IDTokenClaims are the claims of an ID token (OpenID Connect Core 2).
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce    string   `json:"nonce,omitempty"`
+	AuthTime int64    `json:"auth_time,omitempty"`
+	AMR      []string `json:"amr,omitempty"`
+	// AuthorizedParty is the client the token was issued to
+	AuthorizedParty string `json:"azp"`
+	SessionID       string `json:"sid"`
+	UserClaims
+}
+
+// Token godoc
+// @Summary      Token Endpoint
+// @Description  Exchanges an authorization code and its PKCE code_verifier for an ID token and a userinfo access token. Confidential clients authenticate with HTTP Basic or client_secret in the form.
+// @Tags         oauth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        grant_type     formData  string  true   "Must be authorization_code"
+// @Param        code           formData  string  true   "The authorization code"
+// @Param        redirect_uri   formData  string  true   "The redirect URI the code was sent to"
+// @Param        code_verifier  formData  string  true   "PKCE verifier"
+// @Param        client_id      formData  string  false  "Required without HTTP Basic"
+// @Param        client_secret  formData  string  false  "For client_secret_post"
+// @Success      200  {object}  tokenResponse
+// @Failure      400  {object}  oauthError
+// @Failure      401  {object}  oauthError
+// @Router       /api/v1/oauth/token [post]
+func (h *handler) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, errInvalidRequest, "invalid form body")
+		return
+	}
+	if gt := r.PostForm.Get("grant_type"); gt != "authorization_code" {
+		writeOAuthError(w, http.StatusBadRequest, errUnsupportedGrantType, "only authorization_code is supported")
+		return
+	}
+
+	client, ok := h.authenticateClient(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		writeOAuthError(w, http.StatusUnauthorized, errInvalidClient, "client authentication failed")
+		return
+	}
+
+	// 1. Redeem the code: GETDEL makes it single-use even under concurrent requests
+	code := r.PostForm.Get("code")
+	raw, err := h.cache.GetDel(r.Context(), codeKey(code)).Bytes()
+	if err != nil || code == "" {
+		writeOAuthError(w, http.StatusBadRequest, errInvalidGrant, "the code is invalid, expired or already used")
+		return
+	}
+	var grant authCode
+	if err := stdjson.Unmarshal(raw, &grant); err != nil {
+		h.logger.Error("failed to decode authorization code", "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	// 2. It must come back from the client it was issued to, for the same redirect URI,
+	// with the verifier only that client knows
+	if grant.ClientID != client.ID || grant.RedirectURI != r.PostForm.Get("redirect_uri") {
+		writeOAuthError(w, http.StatusBadRequest, errInvalidGrant, "the code was issued to another client or redirect_uri")
+		return
+	}
+	if !verifyPKCE(r.PostForm.Get("code_verifier"), grant.CodeChallenge) {
+		writeOAuthError(w, http.StatusBadRequest, errInvalidGrant, "code_verifier does not match the code_challenge")
+		return
+	}
+
+	// 3. Open a session for the client's tokens
+	var accID pgtype.UUID
+	if err := accID.Scan(grant.AccountID); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, errInvalidGrant, "")
+		return
+	}
+	// The account may have been suspended since the user approved
+	status, err := h.service.GetAccountStatus(r.Context(), accID)
+	if err != nil {
+		h.logger.Error("failed to read account status", "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+	if middlewares.CheckAccountStatus(status) != nil {
+		writeOAuthError(w, http.StatusBadRequest, errInvalidGrant, "the account is not active")
+		return
+	}
+	session, err := h.service.CreateSession(r.Context(), repo.CreateSessionParams{
+		AccountID:  accID,
+		DeviceName: pgtype.Text{String: client.Name, Valid: true},
+		UserAgent:  pgtype.Text{String: grant.UserAgent, Valid: grant.UserAgent != ""},
+		IpAddress:  pgtype.Text{String: grant.IP, Valid: grant.IP != ""},
+		ClientType: auth.ClientOIDC,
+		Amr:        grant.AMR,
+	})
+	if err != nil {
+		h.logger.Error("failed to create oidc session", "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	authTime := time.Unix(grant.AuthTime, 0)
+	tokens, err := h.auth.GenerateTokenPair(auth.Grant{
+		AccountID: grant.AccountID,
+		SessionID: session.ID.String(),
+		Client:    auth.ClientOIDC,
+		ClientID:  client.ID,
+		Scopes:    grant.Scopes,
+		AuthTime:  authTime,
+		AMR:       grant.AMR,
+		IssuedAt:  session.TokenValidFrom.Time,
+	})
+	if err != nil {
+		h.logger.Error("failed to generate oidc access token", "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	// 4. The ID token carries the consented claims directly
+	userClaims, err := h.userClaims(r.Context(), accID, grant.Scopes)
+	if err != nil {
+		h.logger.Error("failed to load id token claims", "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+	now := time.Now()
+	idToken, err := h.auth.Sign(&IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    h.cfg.Issuer,
+			Subject:   grant.AccountID,
+			Audience:  jwt.ClaimStrings{client.ID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(time.Unix(tokens.AtExpires, 0)),
+		},
+		Nonce:           grant.Nonce,
+		AuthTime:        grant.AuthTime,
+		AMR:             grant.AMR,
+		AuthorizedParty: client.ID,
+		SessionID:       session.ID.String(),
+		UserClaims:      userClaims,
+	})
+	if err != nil {
+		h.logger.Error("failed to sign id token", "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, errServerError, "")
+		return
+	}
+
+	h.logger.Info("oidc login", "account_id", grant.AccountID, "client_id", client.ID, "session_id", session.ID)
+	w.Header().Set("Cache-Control", "no-store")
+	json.Write(w, http.StatusOK, tokenResponse{
+		AccessToken: tokens.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   tokens.AtExpires - now.Unix(),
+		IDToken:     idToken,
+		Scope:       strings.Join(grant.Scopes, " "),
+	})
+}
+
+// verifyPKCE checks a code_verifier against an S256 code_challenge (RFC 7636 section 4.6).
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
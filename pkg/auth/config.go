@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Client types. Each has its own token lifetimes, audience and scopes.
+const (
+	ClientMobile  = "mobile"
+	ClientWeb     = "web"
+	ClientPartner = "partner"
+	// ClientOIDC is a third-party app using "Log in with AddisVerify". Its tokens
+	// only read the userinfo endpoint.
+	ClientOIDC = "oidc"
+)
+
+// Audiences name the APIs a token may be presented to.
+const (
+	// AudienceAPI is our own first-party API.
+	AudienceAPI = "addis_verify.api"
+	// AudiencePartner is for partner services that verify tokens against the JWKS.
+	AudiencePartner = "addis_verify.partner"
+	// AudienceUserInfo is the OpenID Connect userinfo endpoint.
+	AudienceUserInfo = "addis_verify.userinfo"
+)
+
+// Scopes grant access to route groups.
+const (
+	// ScopeAccount manages the account itself: language, devices, logout.
+	ScopeAccount = "account"
+	// ScopeProfile reads and edits the user's profile and documents. For relying
+	// parties it is the OpenID Connect profile scope: name, birthdate, gender.
+	ScopeProfile = "profile"
+
+	// OpenID Connect scopes, granted to relying parties only.
+	ScopeOpenID  = "openid"
+	ScopeEmail   = "email"
+	ScopePhone   = "phone"
+	ScopeAddress = "address"
+)
+
+// Authentication methods reported in the amr claim (RFC 8176).
+const (
+	AMROTP = "otp"
+	// AMRRecoveryCode marks a login that proved ownership with a backup recovery code.
+	AMRRecoveryCode = "recovery_code"
+	// AMRTOTP marks a login that also passed an authenticator app (RFC 6238) code.
+	AMRTOTP = "totp"
+)
+
+// ClientPolicy sets what tokens issued to a client type look like.
+type ClientPolicy struct {
+	AccessTTL time.Duration
+	// RefreshTTL of zero issues no refresh tokens
+	RefreshTTL time.Duration
+	Audience   []string
+	// Scopes are granted when the Grant doesn't ask for specific ones
+	Scopes []string
+}
+
+// Config configures a TokenManager.
+type Config struct {
+	Issuer  string
+	Clients map[string]ClientPolicy
+}
+
+// DefaultConfig returns short-lived access tokens for every client, with mobile
+// sessions lasting longest between refreshes.
+func DefaultConfig() Config {
+	firstParty := []string{ScopeAccount, ScopeProfile}
+	return Config{
+		Issuer: "addis_verify",
+		Clients: map[string]ClientPolicy{
+			ClientMobile: {
+				AccessTTL:  15 * time.Minute,
+				RefreshTTL: 30 * 24 * time.Hour,
+				Audience:   []string{AudienceAPI},
+				Scopes:     firstParty,
+			},
+			ClientWeb: {
+				AccessTTL:  15 * time.Minute,
+				RefreshTTL: 7 * 24 * time.Hour,
+				Audience:   []string{AudienceAPI},
+				Scopes:     firstParty,
+			},
+			ClientPartner: {
+				AccessTTL:  5 * time.Minute,
+				RefreshTTL: 24 * time.Hour,
+				Audience:   []string{AudiencePartner},
+				Scopes:     []string{ScopeProfile},
+			},
+			// Relying parties log the user in again rather than refresh
+			ClientOIDC: {
+				AccessTTL: 10 * time.Minute,
+				Audience:  []string{AudienceUserInfo},
+				Scopes:    []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopePhone, ScopeAddress},
+			},
+		},
+	}
+}
+
+// Validate checks every client has usable lifetimes and an audience.
+func (c Config) Validate() error {
+	if c.Issuer == "" {
+		return errors.New("auth: issuer is required")
+	}
+	if len(c.Clients) == 0 {
+		return errors.New("auth: at least one client is required")
+	}
+	for name, p := range c.Clients {
+		if p.AccessTTL <= 0 || p.RefreshTTL < 0 {
+			return fmt.Errorf("auth: client %q needs positive token lifetimes", name)
+		}
+		if p.RefreshTTL > 0 && p.AccessTTL > p.RefreshTTL {
+			return fmt.Errorf("auth: client %q access tokens outlive its refresh tokens", name)
+		}
+		if len(p.Audience) == 0 {
+			return fmt.Errorf("auth: client %q has no audience", name)
+		}
+	}
+	return nil
+}
+
+// audiences lists every audience tokens are issued for.
+func (c Config) audiences() []string {
+	var out []string
+	for _, p := range c.Clients {
+		for _, aud := range p.Audience {
+			if !slices.Contains(out, aud) {
+				out = append(out, aud)
+			}
+		}
+	}
+	return out
+}
+
+// Grant describes the tokens to issue.
+type Grant struct {
+	AccountID string
+	SessionID string
+	// Client is the client type; it picks lifetimes, audience and default scopes.
+	Client string
+	// ClientID goes in the client_id claim when it isn't the client type itself,
+	// e.g. a relying party's registered client_id.
+	ClientID string
+	// Scopes narrows the client's default scopes. Scopes the client doesn't have are dropped.
+	Scopes []string
+	// AuthTime is when the user last actively authenticated (the login, not a refresh).
+	AuthTime time.Time
+	// AMR lists how they authenticated, e.g. [otp].
+	AMR []string
+	// IssuedAt must match the session's token_valid_from.
+	IssuedAt time.Time
+}
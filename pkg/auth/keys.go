@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms a Key can use.
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	// AlgHS256 is the shared-secret algorithm tokens were signed with before
+	// asymmetric keys. Its keys are never published.
+	AlgHS256 = "HS256"
+)
+
+// Key is a token signing or verification key.
+type Key struct {
+	// ID is the "kid" header of tokens signed with the key: the RFC 7638 thumbprint
+	// of the public key, or empty for HS256 secrets.
+	ID        string
+	Algorithm string
+	// private signs (nil for verification-only keys), public verifies.
+	// Both are the same []byte for HS256.
+	private any
+	public  any
+}
+
+// NewHMACKey wraps a shared HS256 secret of at least 32 bytes.
+func NewHMACKey(secret []byte) (Key, error) {
+	if len(secret) < 32 {
+		return Key{}, errors.New("auth: HS256 secret must be at least 32 bytes")
+	}
+	return Key{Algorithm: AlgHS256, private: secret, public: secret}, nil
+}
+
+// LoadKeyFile reads a PEM key from disk (see ParseKeyPEM).
+func LoadKeyFile(path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+	k, err := ParseKeyPEM(data)
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return k, nil
+}
+
+// ParseKeyPEM parses an Ed25519, RSA or P-256 ECDSA key. Private keys (PKCS#8,
+// PKCS#1 or SEC 1) can sign; public keys (PKIX) only verify.
+func ParseKeyPEM(data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, errors.New("auth: no PEM block found")
+	}
+
+	var private, public any
+	switch block.Type {
+	case "PRIVATE KEY":
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		private = k
+	case "RSA PRIVATE KEY":
+		k, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		private = k
+	case "EC PRIVATE KEY":
+		k, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		private = k
+	case "PUBLIC KEY":
+		k, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		public = k
+	default:
+		return Key{}, fmt.Errorf("auth: unsupported PEM block %q", block.Type)
+	}
+
+	if private != nil {
+		switch k := private.(type) {
+		case ed25519.PrivateKey:
+			public = k.Public()
+		case *rsa.PrivateKey:
+			public = &k.PublicKey
+		case *ecdsa.PrivateKey:
+			public = &k.PublicKey
+		default:
+			return Key{}, fmt.Errorf("auth: unsupported private key %T", private)
+		}
+	}
+	return NewKey(private, public)
+}
+
+// NewKey builds a Key from a public key and, for signing keys, its private key.
+func NewKey(private, public any) (Key, error) {
+	k := Key{private: private, public: public}
+	switch pub := public.(type) {
+	case ed25519.PublicKey:
+		k.Algorithm = AlgEdDSA
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return Key{}, errors.New("auth: RSA keys must be at least 2048 bits")
+		}
+		k.Algorithm = AlgRS256
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return Key{}, errors.New("auth: only P-256 ECDSA keys are supported")
+		}
+		k.Algorithm = AlgES256
+	default:
+		return Key{}, fmt.Errorf("auth: unsupported public key %T", public)
+	}
+
+	jwk, _ := k.JWK()
+	k.ID = jwk.thumbprint()
+	return k, nil
+}
+
+// CanSign reports whether the key holds private material.
+func (k Key) CanSign() bool {
+	return k.private != nil
+}
+
+func (k Key) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// JWK is a public key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public half of k. ok is false for HS256 secrets, which must never be published.
+func (k Key) JWK() (jwk JWK, ok bool) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := k.public.(type) {
+	case ed25519.PublicKey:
+		jwk = JWK{Kty: "OKP", Crv: "Ed25519", X: b64(pub)}
+	case *rsa.PublicKey:
+		jwk = JWK{Kty: "RSA", N: b64(pub.N.Bytes()), E: b64(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		// Coordinates are fixed-width: 32 bytes for P-256
+		x, y := make([]byte, 32), make([]byte, 32)
+		jwk = JWK{Kty: "EC", Crv: "P-256", X: b64(pub.X.FillBytes(x)), Y: b64(pub.Y.FillBytes(y))}
+	default:
+		return JWK{}, false
+	}
+	jwk.Use, jwk.Alg, jwk.Kid = "sig", k.Algorithm, k.ID
+	return jwk, true
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint: SHA-256 over the required members
+// in lexicographic order.
+func (j JWK) thumbprint() string {
+	var members any
+	switch j.Kty {
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Crv, j.Kty, j.X}
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.Kty, j.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{j.Crv, j.Kty, j.X, j.Y}
+	default:
+		return ""
+	}
+	raw, _ := json.Marshal(members)
+	sum := sha256.Sum256(raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
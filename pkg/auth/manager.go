@@ -1,11 +1,15 @@
 package auth
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 var (
@@ -13,77 +17,150 @@ var (
 	ErrExpiredToken = errors.New("token has expired")
 )
 
-// Claims extends standard JWT claims with our custom fields
+// Claims extends standard JWT claims with our custom fields. Access tokens follow
+// the JWT access token profile (RFC 9068).
 type Claims struct {
 	AccountID string `json:"sub"`
 	Type      string `json:"typ"` // "access" or "refresh"
+	SessionID string `json:"sid"` // The device session both tokens belong to
+	// ClientID is the client type the tokens were issued to (mobile, web, partner),
+	// or the registered client_id of an OpenID Connect relying party
+	ClientID string `json:"client_id,omitempty"`
+	// Scope is a space-separated list of granted scopes
+	Scope    string   `json:"scope,omitempty"`
+	AuthTime int64    `json:"auth_time,omitempty"`
+	AMR      []string `json:"amr,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// HasScope reports whether scope was granted.
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(strings.Fields(c.Scope), scope)
+}
+
+// HasAudience reports whether the token was issued for any of audiences.
+func (c *Claims) HasAudience(audiences ...string) bool {
+	for _, aud := range c.Audience {
+		if slices.Contains(audiences, aud) {
+			return true
+		}
+	}
+	return false
+}
+
 type TokenDetails struct {
 	AccessToken  string
 	RefreshToken string
 	AtExpires    int64
-	RtExpires    int64
+	// RtExpires is zero when the client gets no refresh token
+	RtExpires int64
+	// RefreshTokenID is the refresh token's jti, recorded to detect reuse
+	RefreshTokenID string
 }
 
 type TokenManager interface {
-	GenerateTokenPair(id string, iat time.Time) (*TokenDetails, error)
+	GenerateTokenPair(g Grant) (*TokenDetails, error)
 	VerifyToken(token string) (*Claims, error)
+	// Sign signs other JWTs, such as OpenID Connect ID tokens, with the current key.
+	Sign(claims jwt.Claims) (string, error)
+	// JWKS lists the public verification keys for other services.
+	JWKS() JWKS
 }
 
 type jwtManager struct {
-	secretKey []byte
-	issuer    string
+	cfg     Config
+	signing Key
+	// keys holds every key tokens are accepted from, by kid
+	keys map[string]Key
+	// parser checks signature, expiry, issuer and audience
+	parser *jwt.Parser
 }
 
-func NewJWTManager(secret string) TokenManager {
-	return &jwtManager{
-		secretKey: []byte(secret),
-		issuer:    "addis_verify",
+// NewJWTManager creates a TokenManager that signs with signing and accepts tokens
+// signed by it or by any of verify. During a key rotation, verify holds the old
+// keys until the tokens they signed have expired.
+func NewJWTManager(cfg Config, signing Key, verify ...Key) (TokenManager, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
+	if !signing.CanSign() {
+		return nil, errors.New("auth: signing key has no private key")
+	}
+	m := &jwtManager{
+		cfg:     cfg,
+		signing: signing,
+		keys:    map[string]Key{signing.ID: signing},
+		parser: jwt.NewParser(
+			jwt.WithIssuer(cfg.Issuer),
+			jwt.WithAudience(cfg.audiences()...),
+			jwt.WithExpirationRequired(),
+		),
+	}
+	for _, k := range verify {
+		if _, dup := m.keys[k.ID]; dup {
+			return nil, fmt.Errorf("auth: duplicate key id %q", k.ID)
+		}
+		m.keys[k.ID] = k
+	}
+	return m, nil
 }
 
-func (m *jwtManager) GenerateTokenPair(accountID string, iat time.Time) (*TokenDetails, error) {
+func (m *jwtManager) GenerateTokenPair(g Grant) (*TokenDetails, error) {
+	policy, ok := m.cfg.Clients[g.Client]
+	if !ok {
+		return nil, fmt.Errorf("auth: unknown client %q", g.Client)
+	}
+	scopes := policy.Scopes
+	if len(g.Scopes) > 0 {
+		scopes = slices.DeleteFunc(slices.Clone(g.Scopes), func(s string) bool {
+			return !slices.Contains(policy.Scopes, s)
+		})
+	}
+
 	td := &TokenDetails{}
 
-	// 1. Set Expiry Times
-	// Access Token: 15 minutes (Short-lived for security)
-	td.AtExpires = time.Now().Add(time.Hour * 15).Unix() //TODO: temporary bring it back to minute 
-	// Refresh Token: 7 days (Long-lived for UX)
-	td.RtExpires = time.Now().Add(time.Hour * 24 * 7).Unix()
+	// 1. Set Expiry Times from the client's policy
+	now := time.Now()
+	td.AtExpires = now.Add(policy.AccessTTL).Unix()
+
+	claims := func(typ string, expires int64) *Claims {
+		c := &Claims{
+			AccountID: g.AccountID,
+			Type:      typ,
+			SessionID: g.SessionID,
+			ClientID:  cmp.Or(g.ClientID, g.Client),
+			Scope:     strings.Join(scopes, " "),
+			AMR:       g.AMR,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   g.AccountID,
+				Issuer:    m.cfg.Issuer,
+				Audience:  policy.Audience,
+				ExpiresAt: jwt.NewNumericDate(time.Unix(expires, 0)),
+				IssuedAt:  jwt.NewNumericDate(g.IssuedAt), // Must match the session's token_valid_from
+			},
+		}
+		if !g.AuthTime.IsZero() {
+			c.AuthTime = g.AuthTime.Unix()
+		}
+		return c
+	}
 
 	// 2. Create Access Token
-	atClaims := &Claims{
-		AccountID: accountID,
-		Type:      "access",
-		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   accountID,
-			Issuer:    m.issuer,
-			ExpiresAt: jwt.NewNumericDate(time.Unix(td.AtExpires, 0)),
-			IssuedAt:  jwt.NewNumericDate(iat), // Must match DB token_valid_from
-		},
-	}
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
 	var err error
-	td.AccessToken, err = at.SignedString(m.secretKey)
+	td.AccessToken, err = m.Sign(claims("access", td.AtExpires))
 	if err != nil {
 		return nil, err
 	}
 
-	// 3. Create Refresh Token
-	rtClaims := &Claims{
-		AccountID: accountID,
-		Type:      "refresh",
-		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   accountID,
-			Issuer:    m.issuer,
-			ExpiresAt: jwt.NewNumericDate(time.Unix(td.RtExpires, 0)),
-			IssuedAt:  jwt.NewNumericDate(iat), // Also tied to the login version
-		},
+	// 3. Create Refresh Token, if the client gets one
+	if policy.RefreshTTL == 0 {
+		return td, nil
 	}
-	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, rtClaims)
-	td.RefreshToken, err = rt.SignedString(m.secretKey)
+	td.RtExpires = now.Add(policy.RefreshTTL).Unix()
+	td.RefreshTokenID = uuid.NewString()
+	rtClaims := claims("refresh", td.RtExpires)
+	rtClaims.ID = td.RefreshTokenID
+	td.RefreshToken, err = m.Sign(rtClaims)
 	if err != nil {
 		return nil, err
 	}
@@ -91,12 +168,29 @@ func (m *jwtManager) GenerateTokenPair(accountID string, iat time.Time) (*TokenD
 	return td, nil
 }
 
+// Sign signs claims with the current key, naming it in the kid header.
+func (m *jwtManager) Sign(claims jwt.Claims) (string, error) {
+	t := jwt.NewWithClaims(m.signing.method(), claims)
+	if m.signing.ID != "" {
+		t.Header["kid"] = m.signing.ID
+	}
+	return t.SignedString(m.signing.private)
+}
+
 func (m *jwtManager) VerifyToken(tokenStr string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+	token, err := m.parser.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		// Tokens without a kid predate key rotation and can only be HS256
+		kid, _ := token.Header["kid"].(string)
+		key, ok := m.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		// The key decides the algorithm, never the token: otherwise a public key
+		// could be passed off as an HMAC secret
+		if token.Method.Alg() != key.Algorithm {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return m.secretKey, nil
+		return key.public, nil
 	})
 
 	if err != nil {
@@ -109,3 +203,23 @@ func (m *jwtManager) VerifyToken(tokenStr string) (*Claims, error) {
 
 	return nil, ErrInvalidToken
 }
+
+func (m *jwtManager) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range m.keys {
+		if jwk, ok := k.JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	// Stable output: current key first, then by kid
+	slices.SortFunc(set.Keys, func(a, b JWK) int {
+		switch {
+		case a.Kid == m.signing.ID:
+			return -1
+		case b.Kid == m.signing.ID:
+			return 1
+		}
+		return strings.Compare(a.Kid, b.Kid)
+	})
+	return set
+}
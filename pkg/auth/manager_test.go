@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEd25519Key(t *testing.T) Key {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	k, err := NewKey(priv, pub)
+	require.NoError(t, err)
+	return k
+}
+
+var grant = Grant{AccountID: "acc", SessionID: "sess", Client: ClientMobile, IssuedAt: time.Now()}
+
+func header(t *testing.T, token string) map[string]any {
+	t.Helper()
+	tok, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	require.NoError(t, err)
+	return tok.Header
+}
+
+func TestManager_SignsWithKid(t *testing.T) {
+	for name, gen := range map[string]func() (any, any){
+		"EdDSA": func() (any, any) { pub, priv, _ := ed25519.GenerateKey(rand.Reader); return priv, pub },
+		"RS256": func() (any, any) { k, _ := rsa.GenerateKey(rand.Reader, 2048); return k, &k.PublicKey },
+		"ES256": func() (any, any) { k, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader); return k, &k.PublicKey },
+	} {
+		t.Run(name, func(t *testing.T) {
+			priv, pub := gen()
+			key, err := NewKey(priv, pub)
+			require.NoError(t, err)
+			m, err := NewJWTManager(DefaultConfig(), key)
+			require.NoError(t, err)
+
+			td, err := m.GenerateTokenPair(grant)
+			require.NoError(t, err)
+			h := header(t, td.AccessToken)
+			assert.Equal(t, name, h["alg"])
+			assert.Equal(t, key.ID, h["kid"])
+
+			claims, err := m.VerifyToken(td.RefreshToken)
+			require.NoError(t, err)
+			assert.Equal(t, "refresh", claims.Type)
+			assert.Equal(t, td.RefreshTokenID, claims.ID)
+
+			jwks := m.JWKS()
+			require.Len(t, jwks.Keys, 1)
+			assert.Equal(t, key.ID, jwks.Keys[0].Kid)
+			assert.Equal(t, name, jwks.Keys[0].Alg)
+		})
+	}
+}
+
+func TestManager_Rotation(t *testing.T) {
+	oldKey, newKey := newEd25519Key(t), newEd25519Key(t)
+	before, err := NewJWTManager(DefaultConfig(), oldKey)
+	require.NoError(t, err)
+	old, err := before.GenerateTokenPair(grant)
+	require.NoError(t, err)
+
+	// The old key is kept for verification only
+	verifyOnly, err := NewKey(nil, oldKey.public)
+	require.NoError(t, err)
+	after, err := NewJWTManager(DefaultConfig(), newKey, verifyOnly)
+	require.NoError(t, err)
+
+	_, err = after.VerifyToken(old.AccessToken)
+	assert.NoError(t, err)
+	fresh, err := after.GenerateTokenPair(grant)
+	require.NoError(t, err)
+	assert.Equal(t, newKey.ID, header(t, fresh.AccessToken)["kid"])
+
+	jwks := after.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, newKey.ID, jwks.Keys[0].Kid, "current key is listed first")
+
+	// Once dropped, the old key's tokens are refused
+	dropped, err := NewJWTManager(DefaultConfig(), newKey)
+	require.NoError(t, err)
+	_, err = dropped.VerifyToken(old.AccessToken)
+	assert.Error(t, err)
+
+	_, err = NewJWTManager(DefaultConfig(), verifyOnly)
+	assert.Error(t, err, "a public key can't sign")
+}
+
+func TestManager_RejectsAlgorithmConfusion(t *testing.T) {
+	key := newEd25519Key(t)
+	m, err := NewJWTManager(DefaultConfig(), key)
+	require.NoError(t, err)
+
+	// An HS256 token "signed" with the public key and naming our kid
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		AccountID: "acc",
+		Type:      "access",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "addis_verify",
+			Audience:  jwt.ClaimStrings{AudienceAPI},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	forged.Header["kid"] = key.ID
+	token, err := forged.SignedString([]byte(key.public.(ed25519.PublicKey)))
+	require.NoError(t, err)
+
+	_, err = m.VerifyToken(token)
+	assert.Error(t, err)
+}
+
+func TestManager_LegacyHMAC(t *testing.T) {
+	secret, err := NewHMACKey([]byte(strings.Repeat("s", 32)))
+	require.NoError(t, err)
+	legacy, err := NewJWTManager(DefaultConfig(), secret)
+	require.NoError(t, err)
+	td, err := legacy.GenerateTokenPair(grant)
+	require.NoError(t, err)
+	assert.Nil(t, header(t, td.AccessToken)["kid"])
+	assert.Empty(t, legacy.JWKS().Keys, "secrets are never published")
+
+	// After moving to a key pair, HS256 tokens stay valid while the secret is configured
+	m, err := NewJWTManager(DefaultConfig(), newEd25519Key(t), secret)
+	require.NoError(t, err)
+	_, err = m.VerifyToken(td.AccessToken)
+	assert.NoError(t, err)
+	assert.Len(t, m.JWKS().Keys, 1)
+
+	_, err = NewHMACKey(nil)
+	assert.Error(t, err, "an empty secret is refused")
+}
+
+func TestParseKeyPEM(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	k, err := ParseKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	assert.Equal(t, AlgEdDSA, k.Algorithm)
+	assert.True(t, k.CanSign())
+
+	pubDER, err := x509.MarshalPKIXPublicKey(priv.Public())
+	require.NoError(t, err)
+	pub, err := ParseKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	require.NoError(t, err)
+	assert.False(t, pub.CanSign())
+	assert.Equal(t, k.ID, pub.ID, "kid depends on the public key only")
+
+	_, err = ParseKeyPEM([]byte("not a key"))
+	assert.Error(t, err)
+
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, err = NewKey(p384, &p384.PublicKey)
+	assert.Error(t, err)
+}
+
+func TestThumbprint_RFC7638(t *testing.T) {
+	// The example key from RFC 7638 section 3.1
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	require.NoError(t, err)
+	k, err := NewKey(nil, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537})
+	require.NoError(t, err)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", k.ID)
+}
+
+func TestManager_ClientPolicy(t *testing.T) {
+	m, err := NewJWTManager(DefaultConfig(), newEd25519Key(t))
+	require.NoError(t, err)
+	login := time.Now().Add(-time.Hour)
+
+	td, err := m.GenerateTokenPair(Grant{
+		AccountID: "acc", SessionID: "sess", Client: ClientWeb,
+		AuthTime: login, AMR: []string{AMROTP}, IssuedAt: time.Now(),
+	})
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().Add(15*time.Minute).Unix(), td.AtExpires, 2)
+	assert.InDelta(t, time.Now().Add(7*24*time.Hour).Unix(), td.RtExpires, 2)
+
+	c, err := m.VerifyToken(td.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, ClientWeb, c.ClientID)
+	assert.Equal(t, login.Unix(), c.AuthTime)
+	assert.Equal(t, []string{AMROTP}, c.AMR)
+	assert.True(t, c.HasAudience(AudienceAPI))
+	assert.True(t, c.HasScope(ScopeAccount))
+	assert.True(t, c.HasScope(ScopeProfile))
+
+	// Partners get their own audience and can't be granted scopes they don't have
+	td, err = m.GenerateTokenPair(Grant{AccountID: "acc", Client: ClientPartner, Scopes: []string{ScopeAccount, ScopeProfile}, IssuedAt: time.Now()})
+	require.NoError(t, err)
+	c, err = m.VerifyToken(td.AccessToken)
+	require.NoError(t, err)
+	assert.False(t, c.HasAudience(AudienceAPI))
+	assert.Equal(t, ScopeProfile, c.Scope)
+
+	_, err = m.GenerateTokenPair(Grant{AccountID: "acc", Client: "smart-fridge", IssuedAt: time.Now()})
+	assert.Error(t, err)
+}
+
+func TestManager_ValidatesIssuerAndAudience(t *testing.T) {
+	key := newEd25519Key(t)
+	m, err := NewJWTManager(DefaultConfig(), key)
+	require.NoError(t, err)
+
+	other := DefaultConfig()
+	other.Issuer = "someone_else"
+	foreign, err := NewJWTManager(other, key)
+	require.NoError(t, err)
+	td, err := foreign.GenerateTokenPair(grant)
+	require.NoError(t, err)
+	_, err = m.VerifyToken(td.AccessToken)
+	assert.ErrorIs(t, err, jwt.ErrTokenInvalidIssuer)
+
+	// A token for an audience we don't serve
+	cfg := DefaultConfig()
+	cfg.Clients = map[string]ClientPolicy{ClientMobile: {AccessTTL: time.Minute, RefreshTTL: time.Hour, Audience: []string{"billing"}}}
+	billing, err := NewJWTManager(cfg, key)
+	require.NoError(t, err)
+	td, err = billing.GenerateTokenPair(grant)
+	require.NoError(t, err)
+	_, err = m.VerifyToken(td.AccessToken)
+	assert.ErrorIs(t, err, jwt.ErrTokenInvalidAudience)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, DefaultConfig().Validate())
+
+	cfg := DefaultConfig()
+	cfg.Clients[ClientWeb] = ClientPolicy{AccessTTL: time.Hour, RefreshTTL: time.Minute, Audience: []string{AudienceAPI}}
+	assert.Error(t, cfg.Validate())
+
+	cfg = DefaultConfig()
+	cfg.Clients[ClientWeb] = ClientPolicy{AccessTTL: time.Minute, RefreshTTL: time.Hour}
+	assert.Error(t, cfg.Validate())
+}
@@ -4,22 +4,75 @@ package constants
 const (
 	MsgOTPSent     = "OTP sent successfully"
 	MsgOTPVerified = "OTP verified successfully"
+
+	MsgSecondFactorRequired = "Enter the code from your authenticator app to finish signing in"
 )
 
 // Error Messages
 const (
 	// auth errors
 	ErrInvalidJSON           = "Invalid request body"
-	ErrInvalidPhone          = "A valid phone number in E.164 format (e.g. +251...) is required"
+	ErrInvalidPhone          = "A valid phone number (e.g. 0911223344 or +251911223344) is required"
+	ErrNotMobile             = "Only Ethiopian mobile numbers (09... or 07...) can receive codes"
 	ErrInvalidPhoneOrCode    = "Invalid phone number or OTP code"
-	ErrRateLimit             = "Please wait 60 seconds before requesting a new code"
+	ErrRateLimit             = "Please wait before requesting a new code"
+	ErrOTPDailyCap           = "Daily code limit reached. Please try again later"
 	ErrInvalidOTP            = "Invalid or Expired OTP code"
 	ErrFailedToSendSMS       = "Failed to send SMS"
+	ErrChannelUnavailable    = "This delivery channel is not available"
+	ErrChallengeRequired     = "Please complete the challenge to continue"
+	ErrChallengeFailed       = "Challenge failed. Please try again"
 	ErrInvalidOrExpiredToken = "Invalid or expired refresh token"
+	ErrTooManyOTPAttempts    = "Too many incorrect codes. Please wait before trying again"
+	ErrInvalidRecoveryCode   = "Invalid phone number or recovery code"
+	ErrRecoveryLocked        = "Too many failed recovery attempts. Please try again tomorrow"
+	ErrSamePhone             = "The new phone number must differ from the current one"
+	ErrPhoneInUse            = "This phone number already belongs to another account"
+	ErrSIMSwapHold           = "This number changed hands recently. Confirm with one of your recovery codes to continue"
+	ErrInvalidTOTP           = "Invalid authenticator code"
+	ErrTOTPLocked            = "Too many incorrect authenticator codes. Please wait before trying again"
+	ErrTOTPEnabled           = "An authenticator app is already enabled"
+	ErrTOTPNotEnrolled       = "No authenticator app enrollment is pending"
+	ErrTOTPNotEnabled        = "No authenticator app is enabled"
+	ErrInvalidMFAToken       = "Invalid or expired sign-in token. Please start again"
 
 	ErrAccountSuspended    = "Your account has been suspended"
+	ErrAccountInReview     = "Your account is under review"
+	ErrAccountDeleted      = "This account has been deleted"
+	ErrAccountRestorable   = "This account is scheduled for deletion. Verify again with restore to keep it"
+	ErrInvalidTransition   = "The account can't move to that status"
+	ErrPhoneChangeConflict = "The account changed while verifying. Please try again"
 	ErrAccountNotFound     = "Account not found"
-	ErrUnauthorizedError       = "Not authorized"
+	ErrMessageNotFound     = "Message not found"
+	ErrSessionNotFound     = "Session not found"
+	ErrExportNotFound      = "Export not found or link expired"
+	ErrUnknownProvider     = "Unknown provider"
+	ErrUnsupportedLanguage = "Unsupported language"
+	ErrUnauthorizedError   = "Not authorized"
 	ErrServiceUnavailable  = "Service unavailable"
 	ErrInternalServerError = "Internal server error"
 )
+
+// Error Codes (machine-readable, returned alongside the message)
+const (
+	CodeInvalidOTP        = "INVALID_OTP"
+	CodeInvalidPhone      = "INVALID_PHONE"
+	CodeChallengeRequired = "CHALLENGE_REQUIRED"
+	CodeChallengeFailed   = "CHALLENGE_FAILED"
+	CodeOTPLocked         = "OTP_LOCKED"
+	CodeOTPCooldown       = "OTP_COOLDOWN"
+	CodeOTPDailyCap       = "OTP_DAILY_CAP"
+	CodeAccountSuspended  = "ACCOUNT_SUSPENDED"
+	CodeAccountInReview   = "ACCOUNT_PENDING_REVIEW"
+	CodeInvalidTransition = "INVALID_STATUS_TRANSITION"
+	CodeAccountDeleted    = "ACCOUNT_DELETED"
+	CodeAccountRestorable = "ACCOUNT_RESTORABLE"
+	CodeInvalidRecovery   = "INVALID_RECOVERY_CODE"
+	CodeRecoveryLocked    = "RECOVERY_LOCKED"
+	CodePhoneInUse        = "PHONE_IN_USE"
+	CodeStepUpRequired    = "STEP_UP_REQUIRED"
+	CodeSecondFactor      = "SECOND_FACTOR_REQUIRED"
+	CodeInvalidTOTP       = "INVALID_TOTP"
+	CodeTOTPLocked        = "TOTP_LOCKED"
+	CodeTOTPEnabled       = "TOTP_ALREADY_ENABLED"
+)
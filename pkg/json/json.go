@@ -8,6 +8,7 @@ import (
 // ErrorResponse represents the standard error format for AddisVerify.
 type ErrorResponse struct {
 	Error string `json:"error" example:"invalid request body"`
+	Code  string `json:"code,omitempty" example:"OTP_LOCKED"`
 }
 
 // Write encodes data as JSON and sends it to the client.
@@ -22,6 +23,12 @@ func WriteError(w http.ResponseWriter, code int, msg string) {
 	Write(w, code, ErrorResponse{Error: msg})
 }
 
+// WriteErrorCode sends a structured error response carrying a machine-readable code
+// so clients can react to specific failures without parsing the message.
+func WriteErrorCode(w http.ResponseWriter, code int, errCode string, msg string) {
+	Write(w, code, ErrorResponse{Error: msg, Code: errCode})
+}
+
 // Read decodes a JSON request body into dst.
 // We renamed this from Decode to Read to match your handler's "req.Bind" call.
 func Read(r *http.Request, dst any) error {
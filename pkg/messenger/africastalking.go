@@ -0,0 +1,120 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	africasTalkingDefaultBaseURL = "https://api.africastalking.com"
+	africasTalkingSandboxBaseURL = "https://api.sandbox.africastalking.com"
+)
+
+// AfricasTalkingConfig configures the Africa's Talking bulk SMS adapter.
+type AfricasTalkingConfig struct {
+	Username string
+	APIKey   string
+	// From is the registered sender ID or short code. Empty uses the account default.
+	From string
+	// BaseURL overrides the API host. Defaults to the live API, or the sandbox
+	// when Username is "sandbox".
+	BaseURL string
+	Timeout time.Duration
+}
+
+type africasTalkingProvider struct {
+	cfg    AfricasTalkingConfig
+	client *http.Client
+}
+
+// NewAfricasTalkingProvider creates a provider that sends through Africa's Talking.
+func NewAfricasTalkingProvider(cfg AfricasTalkingConfig) (Provider, error) {
+	if cfg.Username == "" || cfg.APIKey == "" {
+		return nil, errors.New("africastalking: username and api key are required")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = africasTalkingDefaultBaseURL
+		if cfg.Username == "sandbox" {
+			cfg.BaseURL = africasTalkingSandboxBaseURL
+		}
+	}
+	return &africasTalkingProvider{cfg: cfg, client: newHTTPClient(cfg.Timeout)}, nil
+}
+
+type africasTalkingResponse struct {
+	SMSMessageData struct {
+		Message    string `json:"Message"`
+		Recipients []struct {
+			StatusCode int    `json:"statusCode"`
+			Number     string `json:"number"`
+			Status     string `json:"status"`
+			MessageID  string `json:"messageId"`
+		} `json:"Recipients"`
+	} `json:"SMSMessageData"`
+}
+
+// Recipient status codes documented by Africa's Talking.
+// 100-102 mean the message was accepted; 500-502 are gateway side and worth retrying.
+func africasTalkingAccepted(code int) bool  { return code >= 100 && code <= 102 }
+func africasTalkingRetryable(code int) bool { return code >= 500 && code <= 502 }
+
+func (p *africasTalkingProvider) Send(ctx context.Context, msg Message) (Receipt, error) {
+	form := url.Values{}
+	form.Set("username", p.cfg.Username)
+	form.Set("to", msg.To)
+	form.Set("message", msg.Body)
+	if p.cfg.From != "" {
+		form.Set("from", p.cfg.From)
+	}
+
+	endpoint := strings.TrimRight(p.cfg.BaseURL, "/") + "/version1/messaging"
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Receipt{}, &SendError{Provider: "africastalking", Err: err}
+	}
+	req.Header.Set("apiKey", p.cfg.APIKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	status, body, err := do(ctx, p.client, "africastalking", req)
+	if err != nil {
+		return Receipt{}, err
+	}
+	if status < 200 || status >= 300 {
+		return Receipt{}, &SendError{
+			Provider:   "africastalking",
+			StatusCode: status,
+			Retryable:  retryableStatus(status),
+			Err:        errors.New(strings.TrimSpace(string(body))),
+		}
+	}
+
+	var resp africasTalkingResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return Receipt{}, &SendError{Provider: "africastalking", StatusCode: status, Err: fmt.Errorf("decode response: %w", err)}
+	}
+	if len(resp.SMSMessageData.Recipients) == 0 {
+		// No recipients means the whole request was rejected (e.g. invalid sender ID)
+		return Receipt{}, &SendError{Provider: "africastalking", StatusCode: status, Err: errors.New(resp.SMSMessageData.Message)}
+	}
+
+	rcpt := resp.SMSMessageData.Recipients[0]
+	if !africasTalkingAccepted(rcpt.StatusCode) {
+		return Receipt{}, &SendError{
+			Provider:   "africastalking",
+			StatusCode: status,
+			Code:       strconv.Itoa(rcpt.StatusCode),
+			Retryable:  africasTalkingRetryable(rcpt.StatusCode),
+			Err:        errors.New(rcpt.Status),
+		}
+	}
+
+	return Receipt{Provider: "africastalking", MessageID: rcpt.MessageID}, nil
+}
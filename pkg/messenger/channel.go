@@ -0,0 +1,106 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Channel is the medium an OTP travels over.
+type Channel string
+
+const (
+	ChannelSMS      Channel = "sms"
+	ChannelVoice    Channel = "voice"
+	ChannelWhatsApp Channel = "whatsapp"
+	ChannelTelegram Channel = "telegram"
+)
+
+// ErrChannelUnavailable is returned when no provider is configured for a message's channel.
+var ErrChannelUnavailable = errors.New("messenger: channel not configured")
+
+// Registry dispatches messages to the provider configured for their channel.
+// It implements Provider, so it can be used wherever a single provider is expected.
+type Registry struct {
+	providers map[Channel]Provider
+}
+
+// NewRegistry creates a registry from per-channel providers. SMS is required.
+func NewRegistry(providers map[Channel]Provider) (*Registry, error) {
+	if providers[ChannelSMS] == nil {
+		return nil, errors.New("messenger: an sms provider is required")
+	}
+	return &Registry{providers: providers}, nil
+}
+
+// Send delivers msg through the provider for msg.Channel.
+func (r *Registry) Send(ctx context.Context, msg Message) (Receipt, error) {
+	channel := msg.Channel
+	if channel == "" {
+		channel = ChannelSMS
+	}
+	p, ok := r.providers[channel]
+	if !ok {
+		return Receipt{}, fmt.Errorf("%w: %s", ErrChannelUnavailable, channel)
+	}
+	return p.Send(ctx, msg)
+}
+
+// Provider returns the provider for channel, if configured.
+func (r *Registry) Provider(channel Channel) (Provider, bool) {
+	p, ok := r.providers[channel]
+	return p, ok
+}
+
+// Channels lists the configured channels in a stable order, SMS first.
+func (r *Registry) Channels() []Channel {
+	channels := make([]Channel, 0, len(r.providers))
+	for c := range r.providers {
+		channels = append(channels, c)
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		if channels[i] == ChannelSMS || channels[j] == ChannelSMS {
+			return channels[i] == ChannelSMS
+		}
+		return channels[i] < channels[j]
+	})
+	return channels
+}
+
+// Close closes every provider that holds connections.
+func (r *Registry) Close() error {
+	var errs []error
+	for _, p := range r.providers {
+		if c, ok := p.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseChannels parses "channel=driver,channel=driver" (e.g. "voice=twilio,telegram=telegram").
+// SMS is configured through the SMS provider settings and cannot be listed here.
+func ParseChannels(s string) (map[Channel]string, error) {
+	channels := map[Channel]string{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, driver, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(driver) == "" {
+			return nil, fmt.Errorf("messenger: malformed channel %q", entry)
+		}
+		channel := Channel(strings.TrimSpace(name))
+		switch channel {
+		case ChannelVoice, ChannelWhatsApp, ChannelTelegram:
+		default:
+			return nil, fmt.Errorf("messenger: unknown channel %q", name)
+		}
+		channels[channel] = strings.TrimSpace(driver)
+	}
+	return channels, nil
+}
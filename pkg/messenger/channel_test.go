@@ -0,0 +1,133 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_DispatchesByChannel(t *testing.T) {
+	sms, voice := &stubProvider{}, &stubProvider{}
+	r, err := NewRegistry(map[Channel]Provider{ChannelSMS: sms, ChannelVoice: voice})
+	require.NoError(t, err)
+
+	_, err = r.Send(context.Background(), testMsg)
+	require.NoError(t, err)
+	_, err = r.Send(context.Background(), Message{To: testMsg.To, Channel: ChannelVoice})
+	require.NoError(t, err)
+	assert.Equal(t, 1, sms.count(), "empty channel means sms")
+	assert.Equal(t, 1, voice.count())
+
+	_, err = r.Send(context.Background(), Message{To: testMsg.To, Channel: ChannelTelegram})
+	assert.ErrorIs(t, err, ErrChannelUnavailable)
+	assert.False(t, IsRetryable(err))
+
+	assert.Equal(t, []Channel{ChannelSMS, ChannelVoice}, r.Channels())
+
+	_, err = NewRegistry(map[Channel]Provider{ChannelVoice: voice})
+	assert.Error(t, err, "sms is required")
+}
+
+func TestParseChannels(t *testing.T) {
+	channels, err := ParseChannels("voice=twilio, telegram=telegram")
+	require.NoError(t, err)
+	assert.Equal(t, map[Channel]string{ChannelVoice: DriverTwilio, ChannelTelegram: DriverTelegram}, channels)
+
+	_, err = ParseChannels("sms=twilio")
+	assert.Error(t, err)
+	_, err = ParseChannels("voice")
+	assert.Error(t, err)
+
+	_, err = NewChannels(Config{Channels: map[Channel]string{ChannelTelegram: DriverTwilio}}, NewMockProvider())
+	assert.Error(t, err, "twilio cannot deliver telegram")
+}
+
+func TestTwilioVoiceAndWhatsApp(t *testing.T) {
+	var form map[string]string
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		path = r.URL.Path
+		form = map[string]string{}
+		for k := range r.PostForm {
+			form[k] = r.PostForm.Get(k)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid":"CA42","status":"queued"}`))
+	}))
+	defer srv.Close()
+
+	cfg := TwilioConfig{
+		AccountSID: "AC123", AuthToken: "secret", BaseURL: srv.URL,
+		VoiceFrom: "+15005550006", WhatsAppFrom: "+14155238886", WhatsAppContentSID: "HX99",
+	}
+
+	voice, err := NewTwilioVoiceProvider(cfg)
+	require.NoError(t, err)
+	receipt, err := voice.Send(context.Background(), Message{To: testMsg.To, Body: "Code: 1, 2 & 3"})
+	require.NoError(t, err)
+	assert.Equal(t, "CA42", receipt.MessageID)
+	assert.Equal(t, "/2010-04-01/Accounts/AC123/Calls.json", path)
+	assert.Equal(t, "+15005550006", form["From"])
+	assert.Contains(t, form["Twiml"], "<Say>Code: 1, 2 &amp; 3</Say>")
+
+	whatsapp, err := NewTwilioWhatsAppProvider(cfg)
+	require.NoError(t, err)
+	_, err = whatsapp.Send(context.Background(), Message{To: testMsg.To, Body: testMsg.Body, Code: "123456"})
+	require.NoError(t, err)
+	assert.Equal(t, "/2010-04-01/Accounts/AC123/Messages.json", path)
+	assert.Equal(t, "whatsapp:"+testMsg.To, form["To"])
+	assert.Equal(t, "whatsapp:+14155238886", form["From"])
+	assert.Equal(t, "HX99", form["ContentSid"])
+	assert.JSONEq(t, `{"1":"123456"}`, form["ContentVariables"])
+	assert.Empty(t, form["Body"])
+
+	_, err = NewTwilioVoiceProvider(TwilioConfig{AccountSID: "AC123", AuthToken: "secret"})
+	assert.Error(t, err, "caller id is required")
+}
+
+func TestTelegramProvider(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/sendVerificationMessage", r.URL.Path)
+			assert.Equal(t, "Bearer tg-token", r.Header.Get("Authorization"))
+			var body map[string]any
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, testMsg.To, body["phone_number"])
+			assert.Equal(t, "123456", body["code"])
+
+			w.Write([]byte(`{"ok":true,"result":{"request_id":"tg-1"}}`))
+		}))
+		defer srv.Close()
+
+		p, err := NewTelegramProvider(TelegramConfig{Token: "tg-token", BaseURL: srv.URL})
+		require.NoError(t, err)
+		receipt, err := p.Send(context.Background(), Message{To: testMsg.To, Code: "123456"})
+		require.NoError(t, err)
+		assert.Equal(t, Receipt{Provider: "telegram", MessageID: "tg-1"}, receipt)
+	})
+
+	t.Run("Flood wait is retryable, unknown number is not", func(t *testing.T) {
+		reply := `{"ok":false,"error":"FLOOD_WAIT_30"}`
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(reply))
+		}))
+		defer srv.Close()
+
+		p, _ := NewTelegramProvider(TelegramConfig{Token: "tg-token", BaseURL: srv.URL})
+		_, err := p.Send(context.Background(), Message{To: testMsg.To, Code: "123456"})
+		assert.True(t, IsRetryable(err))
+
+		reply = `{"ok":false,"error":"PHONE_NUMBER_INVALID"}`
+		_, err = p.Send(context.Background(), Message{To: testMsg.To, Code: "123456"})
+		var sendErr *SendError
+		require.ErrorAs(t, err, &sendErr)
+		assert.Equal(t, "PHONE_NUMBER_INVALID", sendErr.Code)
+		assert.False(t, IsRetryable(err))
+	})
+}
@@ -0,0 +1,117 @@
+package messenger
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Supported values for Config.Driver.
+const (
+	DriverMock           = "mock"
+	DriverTwilio         = "twilio"
+	DriverAfricasTalking = "africastalking"
+	DriverGateway        = "gateway"
+	DriverSMPP           = "smpp"
+	DriverTelegram       = "telegram"
+)
+
+// Config selects and configures the active SMS provider.
+// With Providers set, every listed driver is built and wrapped in a Router using Routes;
+// otherwise the single Driver is used directly.
+type Config struct {
+	Driver         string
+	Twilio         TwilioConfig
+	AfricasTalking AfricasTalkingConfig
+	Gateway        GatewayConfig
+	SMPP           SMPPConfig
+	Telegram       TelegramConfig
+
+	// Channels maps non-SMS channels to the driver that delivers them, e.g. voice=twilio.
+	Channels map[Channel]string
+
+	Providers []string
+	Routes    []Route
+	Breaker   BreakerConfig
+	Logger    *slog.Logger
+}
+
+// New builds the provider selected by cfg.Driver, or a Router when cfg.Providers is set.
+// Providers holding connections (SMPP) implement io.Closer and should be closed on shutdown.
+func New(cfg Config) (Provider, error) {
+	if len(cfg.Providers) == 0 {
+		return newDriver(cfg.Driver, cfg)
+	}
+
+	providers := make(map[string]Provider, len(cfg.Providers))
+	for _, name := range cfg.Providers {
+		var p Provider
+		var err error
+		if _, dup := providers[name]; dup {
+			err = fmt.Errorf("messenger: provider %q listed twice", name)
+		} else {
+			p, err = newDriver(name, cfg)
+		}
+		if err != nil {
+			for _, built := range providers {
+				if c, ok := built.(io.Closer); ok {
+					c.Close()
+				}
+			}
+			return nil, err
+		}
+		providers[name] = p
+	}
+
+	routes := cfg.Routes
+	if len(routes) == 0 {
+		// Without explicit routes, send everything through the providers in the listed order
+		routes = []Route{{Prefix: "", Providers: cfg.Providers}}
+	}
+	return NewRouter(providers, routes, cfg.Breaker, cfg.Logger)
+}
+
+func newDriver(driver string, cfg Config) (Provider, error) {
+	switch driver {
+	case "", DriverMock:
+		return NewMockProvider(), nil
+	case DriverTwilio:
+		return NewTwilioProvider(cfg.Twilio)
+	case DriverAfricasTalking:
+		return NewAfricasTalkingProvider(cfg.AfricasTalking)
+	case DriverGateway:
+		return NewGatewayProvider(cfg.Gateway)
+	case DriverSMPP:
+		return NewSMPPProvider(cfg.SMPP)
+	default:
+		return nil, fmt.Errorf("messenger: unknown driver %q", driver)
+	}
+}
+
+// NewChannels builds a Registry with sms for SMS and a provider for each entry in cfg.Channels.
+func NewChannels(cfg Config, sms Provider) (*Registry, error) {
+	providers := map[Channel]Provider{ChannelSMS: sms}
+	for channel, driver := range cfg.Channels {
+		p, err := newChannelDriver(channel, driver, cfg)
+		if err != nil {
+			return nil, err
+		}
+		providers[channel] = p
+	}
+	return NewRegistry(providers)
+}
+
+func newChannelDriver(channel Channel, driver string, cfg Config) (Provider, error) {
+	switch {
+	case driver == DriverMock:
+		return NewMockProvider(), nil
+	case channel == ChannelVoice && driver == DriverTwilio:
+		return NewTwilioVoiceProvider(cfg.Twilio)
+	case channel == ChannelWhatsApp && driver == DriverTwilio:
+		return NewTwilioWhatsAppProvider(cfg.Twilio)
+	case channel == ChannelTelegram && driver == DriverTelegram:
+		return NewTelegramProvider(cfg.Telegram)
+	default:
+		return nil, fmt.Errorf("messenger: driver %q cannot deliver %s", driver, channel)
+	}
+}
@@ -0,0 +1,171 @@
+package messenger
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// SMS data codings as used by SMPP's data_coding field.
+const (
+	CodingGSM7 byte = 0x00
+	CodingUCS2 byte = 0x08
+)
+
+// gsm7Basic is the GSM 03.38 default alphabet indexed by septet value.
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension holds characters reachable through the escape (0x1B) septet.
+var gsm7Extension = map[rune]byte{
+	'\f': 0x0A, '^': 0x14, '{': 0x28, '}': 0x29, '\\': 0x2F,
+	'[': 0x3C, '~': 0x3D, ']': 0x3E, '|': 0x40, '€': 0x65,
+}
+
+var gsm7Index = func() map[rune]byte {
+	m := make(map[rune]byte, 128)
+	i := 0
+	for _, r := range gsm7Basic {
+		if r != 0x1B {
+			m[r] = byte(i)
+		}
+		i++
+	}
+	return m
+}()
+
+// encodeGSM7 returns each rune of s as unpacked GSM septets.
+// ok is false when s contains a character outside the GSM alphabet.
+func encodeGSM7(s string) (chars [][]byte, ok bool) {
+	for _, r := range s {
+		if b, found := gsm7Index[r]; found {
+			chars = append(chars, []byte{b})
+			continue
+		}
+		if b, found := gsm7Extension[r]; found {
+			chars = append(chars, []byte{0x1B, b})
+			continue
+		}
+		return nil, false
+	}
+	return chars, true
+}
+
+// encodeUCS2 returns each rune of s as big-endian UTF-16 (surrogate pairs stay together).
+func encodeUCS2(s string) [][]byte {
+	var chars [][]byte
+	for _, r := range s {
+		units := utf16.Encode([]rune{r})
+		b := make([]byte, 0, 2*len(units))
+		for _, u := range units {
+			b = append(b, byte(u>>8), byte(u))
+		}
+		chars = append(chars, b)
+	}
+	return chars
+}
+
+// encodeSMS picks GSM-7 when possible and UCS-2 otherwise (e.g. Amharic),
+// returning the data coding and the per-character encoded bytes.
+func encodeSMS(s string) (byte, [][]byte) {
+	if chars, ok := encodeGSM7(s); ok {
+		return CodingGSM7, chars
+	}
+	return CodingUCS2, encodeUCS2(s)
+}
+
+// decodeSMS turns a short_message payload back into text.
+func decodeSMS(coding byte, b []byte) string {
+	if coding == CodingUCS2 {
+		units := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+
+	var sb strings.Builder
+	basic := []rune(gsm7Basic)
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		if c == 0x1B && i+1 < len(b) {
+			i++
+			for r, e := range gsm7Extension {
+				if e == b[i] {
+					sb.WriteRune(r)
+					break
+				}
+			}
+			continue
+		}
+		if int(c) < len(basic) {
+			sb.WriteRune(basic[c])
+		}
+	}
+	return sb.String()
+}
+
+// splitChars packs encoded characters greedily into parts of at most max bytes,
+// never splitting a character (escape sequence or surrogate pair) across parts.
+func splitChars(chars [][]byte, max int) [][]byte {
+	var parts [][]byte
+	var cur []byte
+	for _, c := range chars {
+		if len(cur)+len(c) > max {
+			parts = append(parts, cur)
+			cur = nil
+		}
+		cur = append(cur, c...)
+	}
+	if len(cur) > 0 || len(parts) == 0 {
+		parts = append(parts, cur)
+	}
+	return parts
+}
+
+// partSizes returns how many short_message bytes one SMS in coding holds alone and as
+// part of a concatenated message, where the UDH takes room: 160 and 153 GSM septets,
+// or 70 and 67 UCS-2 units.
+func partSizes(coding byte) (single, multi int) {
+	if coding == CodingUCS2 {
+		return 140, 134
+	}
+	return 160, 153
+}
+
+// Encoding names reported by CountSegments.
+const (
+	EncodingGSM7 = "GSM-7"
+	EncodingUCS2 = "UCS-2"
+)
+
+// Segments describes how a text is split into billable SMS parts.
+type Segments struct {
+	Encoding string
+	// Units is the length in GSM septets (escaped characters count twice) or UTF-16 code units.
+	Units int
+	Count int
+}
+
+// CountSegments reports the encoding and number of SMS parts text needs.
+// A single GSM-7 message holds 160 septets and a single UCS-2 message 70 units;
+// concatenated parts lose room to the UDH and hold 153 and 67.
+func CountSegments(text string) Segments {
+	coding, chars := encodeSMS(text)
+
+	single, multi := partSizes(coding)
+	unit, name := 1, EncodingGSM7
+	if coding == CodingUCS2 {
+		unit, name = 2, EncodingUCS2
+	}
+
+	size := 0
+	for _, c := range chars {
+		size += len(c)
+	}
+
+	seg := Segments{Encoding: name, Units: size / unit, Count: 1}
+	if size > single {
+		seg.Count = len(splitChars(chars, multi))
+	}
+	return seg
+}
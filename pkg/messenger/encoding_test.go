@@ -0,0 +1,29 @@
+package messenger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountSegments(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want Segments
+	}{
+		{"ShortLatin", "Your code is 123456", Segments{EncodingGSM7, 19, 1}},
+		{"FullGSM", strings.Repeat("a", 160), Segments{EncodingGSM7, 160, 1}},
+		{"ConcatenatedGSM", strings.Repeat("a", 161), Segments{EncodingGSM7, 161, 2}},
+		{"EscapesCountTwice", strings.Repeat("€", 80), Segments{EncodingGSM7, 160, 1}},
+		{"Amharic", "ኮድዎ 123456 ነው", Segments{EncodingUCS2, 13, 1}},
+		{"FullUCS2", strings.Repeat("ሀ", 70), Segments{EncodingUCS2, 70, 1}},
+		{"ConcatenatedUCS2", strings.Repeat("ሀ", 135), Segments{EncodingUCS2, 135, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, CountSegments(tt.text))
+		})
+	}
+}
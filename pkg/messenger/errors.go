@@ -0,0 +1,62 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// SendError is returned by provider adapters when a message could not be handed over.
+// Retryable tells callers whether trying again later (or on another provider) may succeed.
+type SendError struct {
+	Provider   string
+	StatusCode int    // HTTP status, 0 when the request never got a response
+	Code       string // provider specific error code, if any
+	Retryable  bool
+	Err        error
+}
+
+func (e *SendError) Error() string {
+	msg := fmt.Sprintf("%s: send failed", e.Provider)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (status %d)", e.StatusCode)
+	}
+	if e.Code != "" {
+		msg += fmt.Sprintf(" [code %s]", e.Code)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *SendError) Unwrap() error { return e.Err }
+
+// IsRetryable reports whether err is a transient failure.
+// Timeouts and connection errors are retryable; a cancelled context is not.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var sendErr *SendError
+	if errors.As(err, &sendErr) {
+		return sendErr.Retryable
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// retryableStatus classifies HTTP status codes returned by SMS gateways:
+// throttling and server-side failures are worth retrying, other 4xx are not.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+		return true
+	}
+	return code >= 500
+}
@@ -0,0 +1,143 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultGatewayTemplate is used when GatewayConfig.BodyTemplate is empty.
+const defaultGatewayTemplate = `{"to":{{json .To}},"from":{{json .From}},"message":{{json .Body}}}`
+
+// GatewayConfig describes a generic HTTP SMS gateway, as exposed by most local aggregators.
+// The request body is rendered from BodyTemplate with the fields To, From and Body;
+// the "json" and "urlquery" functions are available for escaping.
+type GatewayConfig struct {
+	// Name identifies the gateway in logs and receipts. Defaults to "gateway".
+	Name        string
+	URL         string
+	Method      string // defaults to POST
+	ContentType string // defaults to application/json
+	Headers     map[string]string
+
+	// Auth: either basic credentials, a bearer token, or custom Headers.
+	Username    string
+	Password    string
+	BearerToken string
+
+	From         string
+	BodyTemplate string
+	// MessageIDField is a dot separated path to the message ID in a JSON response (e.g. "data.id").
+	MessageIDField string
+	Timeout        time.Duration
+}
+
+type gatewayProvider struct {
+	cfg    GatewayConfig
+	tmpl   *template.Template
+	client *http.Client
+}
+
+// NewGatewayProvider creates a provider for a configurable HTTP gateway.
+func NewGatewayProvider(cfg GatewayConfig) (Provider, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("gateway: url is required")
+	}
+	if cfg.Name == "" {
+		cfg.Name = "gateway"
+	}
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	if cfg.ContentType == "" {
+		cfg.ContentType = "application/json"
+	}
+	if cfg.BodyTemplate == "" {
+		cfg.BodyTemplate = defaultGatewayTemplate
+	}
+
+	tmpl, err := template.New(cfg.Name).Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(cfg.BodyTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("gateway: parse body template: %w", err)
+	}
+
+	return &gatewayProvider{cfg: cfg, tmpl: tmpl, client: newHTTPClient(cfg.Timeout)}, nil
+}
+
+func (p *gatewayProvider) Send(ctx context.Context, msg Message) (Receipt, error) {
+	var body bytes.Buffer
+	data := struct{ To, From, Body string }{To: msg.To, From: p.cfg.From, Body: msg.Body}
+	if err := p.tmpl.Execute(&body, data); err != nil {
+		return Receipt{}, &SendError{Provider: p.cfg.Name, Err: fmt.Errorf("render body: %w", err)}
+	}
+
+	req, err := http.NewRequest(p.cfg.Method, p.cfg.URL, &body)
+	if err != nil {
+		return Receipt{}, &SendError{Provider: p.cfg.Name, Err: err}
+	}
+	req.Header.Set("Content-Type", p.cfg.ContentType)
+	for k, v := range p.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	switch {
+	case p.cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+p.cfg.BearerToken)
+	case p.cfg.Username != "":
+		req.SetBasicAuth(p.cfg.Username, p.cfg.Password)
+	}
+
+	status, respBody, err := do(ctx, p.client, p.cfg.Name, req)
+	if err != nil {
+		return Receipt{}, err
+	}
+	if status < 200 || status >= 300 {
+		return Receipt{}, &SendError{
+			Provider:   p.cfg.Name,
+			StatusCode: status,
+			Retryable:  retryableStatus(status),
+			Err:        errors.New(strings.TrimSpace(string(respBody))),
+		}
+	}
+
+	return Receipt{Provider: p.cfg.Name, MessageID: lookupField(respBody, p.cfg.MessageIDField)}, nil
+}
+
+// lookupField walks a dot separated path through a JSON object and returns the value as a string.
+// It returns "" when the path is empty or does not resolve.
+func lookupField(body []byte, path string) string {
+	if path == "" {
+		return ""
+	}
+	var node any
+	if err := json.Unmarshal(body, &node); err != nil {
+		return ""
+	}
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := node.(map[string]any)
+		if !ok {
+			return ""
+		}
+		node = obj[key]
+	}
+	switch v := node.(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
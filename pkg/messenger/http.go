@@ -0,0 +1,37 @@
+package messenger
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	// maxResponseBody caps how much of a gateway response we read.
+	maxResponseBody = 64 * 1024
+)
+
+func newHTTPClient(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// do executes req and returns the status code and (bounded) body.
+// Transport failures are wrapped in a retryable SendError.
+func do(ctx context.Context, client *http.Client, provider string, req *http.Request) (int, []byte, error) {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, nil, &SendError{Provider: provider, Retryable: ctx.Err() != context.Canceled, Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return resp.StatusCode, nil, &SendError{Provider: provider, StatusCode: resp.StatusCode, Retryable: true, Err: err}
+	}
+	return resp.StatusCode, body, nil
+}
@@ -8,10 +8,23 @@ import (
 type Message struct {
 	To   string
 	Body string
+	// Channel selects how the message travels. Empty means SMS.
+	Channel Channel
+	// Code is the bare OTP, for channels that deliver it natively (e.g. Telegram's
+	// verification API or WhatsApp authentication templates) rather than in Body.
+	Code string
+}
+
+// Receipt identifies an accepted message on the provider side.
+type Receipt struct {
+	// Provider is the name of the adapter that accepted the message (e.g. "twilio").
+	Provider string
+	// MessageID is the provider's reference for the message, used to match delivery reports.
+	MessageID string
 }
 
 type Provider interface {
-	Send(ctx context.Context, msg Message) error
+	Send(ctx context.Context, msg Message) (Receipt, error)
 }
 
 // 1. The struct must be exported (starts with capital M) or
@@ -23,7 +36,7 @@ func NewMockProvider() Provider {
 	return &mockProvider{}
 }
 
-func (m *mockProvider) Send(ctx context.Context, msg Message) error {
+func (m *mockProvider) Send(ctx context.Context, msg Message) (Receipt, error) {
 	fmt.Printf("\n--- [MOCK SMS] ---\nTo: %s\nBody: %s\n------------------\n\n", msg.To, msg.Body)
-	return nil
+	return Receipt{Provider: "mock"}, nil
 }
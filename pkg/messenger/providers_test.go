@@ -0,0 +1,201 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testMsg = Message{To: "+251911223344", Body: "Your Addis Verify code is: 123456"}
+
+func TestTwilioProvider(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/2010-04-01/Accounts/AC123/Messages.json", r.URL.Path)
+			user, pass, ok := r.BasicAuth()
+			assert.True(t, ok)
+			assert.Equal(t, "AC123", user)
+			assert.Equal(t, "secret", pass)
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, testMsg.To, r.PostForm.Get("To"))
+			assert.Equal(t, "+15005550006", r.PostForm.Get("From"))
+			assert.Equal(t, testMsg.Body, r.PostForm.Get("Body"))
+
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"sid":"SM42","status":"queued"}`))
+		}))
+		defer srv.Close()
+
+		p, err := NewTwilioProvider(TwilioConfig{AccountSID: "AC123", AuthToken: "secret", From: "+15005550006", BaseURL: srv.URL})
+		require.NoError(t, err)
+
+		receipt, err := p.Send(context.Background(), testMsg)
+		require.NoError(t, err)
+		assert.Equal(t, Receipt{Provider: "twilio", MessageID: "SM42"}, receipt)
+	})
+
+	t.Run("Invalid number is permanent", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":21211,"message":"Invalid 'To' Phone Number","status":400}`))
+		}))
+		defer srv.Close()
+
+		p, _ := NewTwilioProvider(TwilioConfig{AccountSID: "AC123", AuthToken: "secret", From: "+1", BaseURL: srv.URL})
+		_, err := p.Send(context.Background(), testMsg)
+
+		var sendErr *SendError
+		require.ErrorAs(t, err, &sendErr)
+		assert.Equal(t, "21211", sendErr.Code)
+		assert.False(t, IsRetryable(err))
+	})
+
+	t.Run("Throttling is retryable", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer srv.Close()
+
+		p, _ := NewTwilioProvider(TwilioConfig{AccountSID: "AC123", AuthToken: "secret", From: "+1", BaseURL: srv.URL})
+		_, err := p.Send(context.Background(), testMsg)
+		assert.True(t, IsRetryable(err))
+	})
+
+	t.Run("Timeout is retryable", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer srv.Close()
+
+		p, _ := NewTwilioProvider(TwilioConfig{AccountSID: "AC123", AuthToken: "secret", From: "+1", BaseURL: srv.URL, Timeout: 20 * time.Millisecond})
+		_, err := p.Send(context.Background(), testMsg)
+		assert.Error(t, err)
+		assert.True(t, IsRetryable(err))
+	})
+}
+
+func TestAfricasTalkingProvider(t *testing.T) {
+	respond := func(status int, body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/version1/messaging", r.URL.Path)
+			assert.Equal(t, "at-key", r.Header.Get("apiKey"))
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, "addis", r.PostForm.Get("username"))
+			assert.Equal(t, testMsg.To, r.PostForm.Get("to"))
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		srv := respond(http.StatusCreated, `{"SMSMessageData":{"Message":"Sent to 1/1","Recipients":[{"statusCode":101,"number":"+251911223344","status":"Success","messageId":"ATXid_1"}]}}`)
+		defer srv.Close()
+
+		p, err := NewAfricasTalkingProvider(AfricasTalkingConfig{Username: "addis", APIKey: "at-key", BaseURL: srv.URL})
+		require.NoError(t, err)
+
+		receipt, err := p.Send(context.Background(), testMsg)
+		require.NoError(t, err)
+		assert.Equal(t, "ATXid_1", receipt.MessageID)
+	})
+
+	t.Run("Recipient rejection is classified by status code", func(t *testing.T) {
+		srv := respond(http.StatusCreated, `{"SMSMessageData":{"Message":"Sent to 0/1","Recipients":[{"statusCode":403,"number":"+251911223344","status":"InvalidPhoneNumber","messageId":"None"}]}}`)
+		defer srv.Close()
+
+		p, _ := NewAfricasTalkingProvider(AfricasTalkingConfig{Username: "addis", APIKey: "at-key", BaseURL: srv.URL})
+		_, err := p.Send(context.Background(), testMsg)
+
+		var sendErr *SendError
+		require.ErrorAs(t, err, &sendErr)
+		assert.Equal(t, "403", sendErr.Code)
+		assert.False(t, sendErr.Retryable)
+	})
+
+	t.Run("Gateway error is retryable", func(t *testing.T) {
+		srv := respond(http.StatusCreated, `{"SMSMessageData":{"Message":"Sent to 0/1","Recipients":[{"statusCode":501,"number":"+251911223344","status":"GatewayError","messageId":"None"}]}}`)
+		defer srv.Close()
+
+		p, _ := NewAfricasTalkingProvider(AfricasTalkingConfig{Username: "addis", APIKey: "at-key", BaseURL: srv.URL})
+		_, err := p.Send(context.Background(), testMsg)
+		assert.True(t, IsRetryable(err))
+	})
+}
+
+func TestGatewayProvider(t *testing.T) {
+	t.Run("Default JSON body with bearer auth", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "Bearer tok", r.Header.Get("Authorization"))
+			assert.Equal(t, "av", r.Header.Get("X-Tenant"))
+
+			var body map[string]string
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, testMsg.To, body["to"])
+			assert.Equal(t, "AddisVerify", body["from"])
+			assert.Equal(t, testMsg.Body, body["message"])
+
+			w.Write([]byte(`{"data":{"id":98765}}`))
+		}))
+		defer srv.Close()
+
+		p, err := NewGatewayProvider(GatewayConfig{
+			URL:            srv.URL,
+			BearerToken:    "tok",
+			Headers:        map[string]string{"X-Tenant": "av"},
+			From:           "AddisVerify",
+			MessageIDField: "data.id",
+		})
+		require.NoError(t, err)
+
+		receipt, err := p.Send(context.Background(), testMsg)
+		require.NoError(t, err)
+		assert.Equal(t, Receipt{Provider: "gateway", MessageID: "98765"}, receipt)
+	})
+
+	t.Run("Custom form template", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw, _ := io.ReadAll(r.Body)
+			assert.Equal(t, "msisdn=%2B251911223344&text=hi+there", string(raw))
+			user, _, _ := r.BasicAuth()
+			assert.Equal(t, "u", user)
+		}))
+		defer srv.Close()
+
+		p, err := NewGatewayProvider(GatewayConfig{
+			Name:         "ethio-agg",
+			URL:          srv.URL,
+			ContentType:  "application/x-www-form-urlencoded",
+			Username:     "u",
+			Password:     "p",
+			BodyTemplate: `msisdn={{urlquery .To}}&text={{urlquery .Body}}`,
+		})
+		require.NoError(t, err)
+
+		receipt, err := p.Send(context.Background(), Message{To: "+251911223344", Body: "hi there"})
+		require.NoError(t, err)
+		assert.Equal(t, "ethio-agg", receipt.Provider)
+	})
+
+	t.Run("Server error is retryable", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer srv.Close()
+
+		p, _ := NewGatewayProvider(GatewayConfig{URL: srv.URL})
+		_, err := p.Send(context.Background(), testMsg)
+		assert.True(t, IsRetryable(err))
+	})
+}
+
+func TestNew_UnknownDriver(t *testing.T) {
+	_, err := New(Config{Driver: "pigeon"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,23 @@
+package messenger
+
+import "time"
+
+// DeliveryStatus is the normalized lifecycle state of an outbound message.
+type DeliveryStatus string
+
+const (
+	StatusQueued    DeliveryStatus = "queued"
+	StatusSent      DeliveryStatus = "sent"
+	StatusDelivered DeliveryStatus = "delivered"
+	StatusFailed    DeliveryStatus = "failed"
+)
+
+// DeliveryReport is a provider's statement about what happened to a message after it was accepted.
+type DeliveryReport struct {
+	Provider  string
+	MessageID string
+	Status    DeliveryStatus
+	// ErrorCode is the provider specific failure reason, if any.
+	ErrorCode string
+	At        time.Time
+}
@@ -0,0 +1,239 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoProvider is returned when every provider for a route is unavailable.
+var ErrNoProvider = errors.New("messenger: no provider available for route")
+
+// Route sends numbers starting with Prefix through Providers, in priority order.
+// An empty Prefix is the default route.
+type Route struct {
+	Prefix    string   `json:"prefix"`
+	Providers []string `json:"providers"`
+}
+
+// ProviderStatus is a snapshot of one routed provider's health.
+type ProviderStatus struct {
+	Name    string       `json:"name"`
+	Breaker BreakerState `json:"breaker"`
+}
+
+// Router is a composite Provider that picks providers by phone prefix,
+// fails over down the priority list and trips a circuit breaker on providers
+// that keep failing. Routes can be replaced at runtime with SetRoutes.
+type Router struct {
+	providers map[string]Provider
+	breakers  map[string]*breaker
+	logger    *slog.Logger
+
+	mu     sync.RWMutex
+	routes []Route // longest prefix first
+}
+
+// NewRouter creates a router over the named providers.
+func NewRouter(providers map[string]Provider, routes []Route, cfg BreakerConfig, logger *slog.Logger) (*Router, error) {
+	if len(providers) == 0 {
+		return nil, errors.New("messenger: router needs at least one provider")
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	r := &Router{
+		providers: providers,
+		breakers:  make(map[string]*breaker, len(providers)),
+		logger:    logger.With("component", "sms_router"),
+	}
+	for name := range providers {
+		r.breakers[name] = newBreaker(cfg)
+	}
+	if err := r.SetRoutes(routes); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetRoutes atomically replaces the routing table.
+// Every route must reference known providers.
+func (r *Router) SetRoutes(routes []Route) error {
+	sorted := make([]Route, 0, len(routes))
+	for _, rt := range routes {
+		if len(rt.Providers) == 0 {
+			return fmt.Errorf("messenger: route %q has no providers", rt.Prefix)
+		}
+		for _, name := range rt.Providers {
+			if _, ok := r.providers[name]; !ok {
+				return fmt.Errorf("messenger: route %q references unknown provider %q", rt.Prefix, name)
+			}
+		}
+		sorted = append(sorted, Route{Prefix: rt.Prefix, Providers: append([]string(nil), rt.Providers...)})
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i].Prefix) > len(sorted[j].Prefix) })
+
+	r.mu.Lock()
+	r.routes = sorted
+	r.mu.Unlock()
+	return nil
+}
+
+// Routes returns the active routing table.
+func (r *Router) Routes() []Route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Route(nil), r.routes...)
+}
+
+// Status reports the breaker state of every provider.
+func (r *Router) Status() []ProviderStatus {
+	out := make([]ProviderStatus, 0, len(r.breakers))
+	for name, b := range r.breakers {
+		out = append(out, ProviderStatus{Name: name, Breaker: b.current()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (r *Router) route(to string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, rt := range r.routes {
+		if strings.HasPrefix(to, rt.Prefix) {
+			return rt.Providers
+		}
+	}
+	return nil
+}
+
+// Send tries each provider on the matching route until one accepts the message.
+// The returned receipt names the provider that took it.
+func (r *Router) Send(ctx context.Context, msg Message) (Receipt, error) {
+	candidates := r.route(msg.To)
+	if len(candidates) == 0 {
+		return Receipt{}, fmt.Errorf("%w: %s", ErrNoProvider, msg.To)
+	}
+
+	var errs []error
+	for _, name := range candidates {
+		b := r.breakers[name]
+		if !b.allow() {
+			continue
+		}
+
+		receipt, err := r.providers[name].Send(ctx, msg)
+		if err == nil {
+			b.success()
+			// Keep the provider's own name (e.g. a custom gateway's), which its receipts carry
+			if receipt.Provider == "" {
+				receipt.Provider = name
+			}
+			return receipt, nil
+		}
+
+		if countsAgainstProvider(err) {
+			b.failure()
+			if b.current() == BreakerOpen {
+				r.logger.Warn("circuit opened for provider", "provider", name, "error", err)
+			}
+		} else {
+			// The provider answered; don't hold its circuit in half-open
+			b.success()
+		}
+		errs = append(errs, err)
+
+		if ctx.Err() != nil {
+			break
+		}
+		r.logger.Warn("provider failed, trying next", "provider", name, "error", err)
+	}
+
+	if len(errs) == 0 {
+		return Receipt{}, fmt.Errorf("%w: all circuits open for %s", ErrNoProvider, msg.To)
+	}
+	return Receipt{}, errors.Join(errs...)
+}
+
+// countsAgainstProvider reports whether err says something about the provider's health
+// (outage, throttling, bad credentials) rather than about the message.
+func countsAgainstProvider(err error) bool {
+	if IsRetryable(err) {
+		return true
+	}
+	var sendErr *SendError
+	if errors.As(err, &sendErr) {
+		return sendErr.StatusCode == http.StatusUnauthorized || sendErr.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// Watch reloads the routing table from load every interval until ctx is done.
+// A nil result from load keeps the current routes, so a missing key is not an outage.
+func (r *Router) Watch(ctx context.Context, interval time.Duration, load func(context.Context) ([]Route, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		routes, err := load(ctx)
+		switch {
+		case err != nil:
+			r.logger.Error("failed to load sms routes", "error", err)
+		case routes != nil:
+			if err := r.SetRoutes(routes); err != nil {
+				r.logger.Error("rejected sms routes", "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes every provider that holds resources (e.g. SMPP sessions).
+func (r *Router) Close() error {
+	var errs []error
+	for _, p := range r.providers {
+		if c, ok := p.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseRoutes parses "prefix=provider|provider;prefix=provider" into routes.
+// Use "*" or an empty prefix for the default route, e.g. "+2519=smpp|africastalking;*=twilio".
+func ParseRoutes(s string) ([]Route, error) {
+	var routes []Route
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefix, list, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("messenger: malformed route %q", entry)
+		}
+		prefix = strings.TrimSpace(prefix)
+		if prefix == "*" {
+			prefix = ""
+		}
+		var providers []string
+		for _, name := range strings.Split(list, "|") {
+			if name = strings.TrimSpace(name); name != "" {
+				providers = append(providers, name)
+			}
+		}
+		routes = append(routes, Route{Prefix: prefix, Providers: providers})
+	}
+	return routes, nil
+}
@@ -0,0 +1,165 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubProvider returns queued errors (nil = success) and counts calls.
+type stubProvider struct {
+	mu    sync.Mutex
+	errs  []error
+	calls int
+}
+
+func (s *stubProvider) Send(ctx context.Context, msg Message) (Receipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	var err error
+	if len(s.errs) > 0 {
+		err, s.errs = s.errs[0], s.errs[1:]
+	}
+	if err != nil {
+		return Receipt{}, err
+	}
+	return Receipt{MessageID: "id"}, nil
+}
+
+func (s *stubProvider) fail(n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.errs = append(s.errs, err)
+	}
+}
+
+func (s *stubProvider) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+var (
+	outage   = &SendError{Provider: "x", StatusCode: 503, Retryable: true}
+	badPhone = &SendError{Provider: "x", StatusCode: 400, Code: "21211"}
+	quiet    = slog.New(slog.NewTextHandler(io.Discard, nil))
+)
+
+func newTestRouter(t *testing.T, routes []Route, providers map[string]Provider) *Router {
+	r, err := NewRouter(providers, routes, BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute}, quiet)
+	require.NoError(t, err)
+	return r
+}
+
+func TestRouter_RoutesByPrefix(t *testing.T) {
+	ethio, safaricom, intl := &stubProvider{}, &stubProvider{}, &stubProvider{}
+	r := newTestRouter(t, []Route{
+		{Prefix: "+2519", Providers: []string{"ethio"}},
+		{Prefix: "+2517", Providers: []string{"safaricom"}},
+		{Prefix: "", Providers: []string{"intl"}},
+	}, map[string]Provider{"ethio": ethio, "safaricom": safaricom, "intl": intl})
+
+	receipt, err := r.Send(context.Background(), Message{To: "+251911223344"})
+	require.NoError(t, err)
+	assert.Equal(t, "ethio", receipt.Provider)
+
+	receipt, _ = r.Send(context.Background(), Message{To: "+251711223344"})
+	assert.Equal(t, "safaricom", receipt.Provider)
+
+	receipt, _ = r.Send(context.Background(), Message{To: "+254711223344"})
+	assert.Equal(t, "intl", receipt.Provider)
+}
+
+func TestRouter_FailoverAndBreaker(t *testing.T) {
+	primary, backup := &stubProvider{}, &stubProvider{}
+	r := newTestRouter(t, []Route{{Prefix: "+251", Providers: []string{"primary", "backup"}}},
+		map[string]Provider{"primary": primary, "backup": backup})
+
+	now := time.Now()
+	r.breakers["primary"].now = func() time.Time { return now }
+
+	primary.fail(2, outage)
+	for i := 0; i < 2; i++ {
+		receipt, err := r.Send(context.Background(), Message{To: "+251911223344"})
+		require.NoError(t, err)
+		assert.Equal(t, "backup", receipt.Provider)
+	}
+	assert.Equal(t, BreakerOpen, r.breakers["primary"].current())
+
+	// Open circuit: primary is skipped entirely
+	r.Send(context.Background(), Message{To: "+251911223344"})
+	assert.Equal(t, 2, primary.count())
+	assert.Equal(t, 3, backup.count())
+
+	// After the timeout a single trial goes through and closes the circuit
+	now = now.Add(2 * time.Minute)
+	receipt, err := r.Send(context.Background(), Message{To: "+251911223344"})
+	require.NoError(t, err)
+	assert.Equal(t, "primary", receipt.Provider)
+	assert.Equal(t, BreakerClosed, r.breakers["primary"].current())
+}
+
+func TestRouter_MessageErrorsDoNotTripBreaker(t *testing.T) {
+	primary, backup := &stubProvider{}, &stubProvider{}
+	r := newTestRouter(t, []Route{{Prefix: "", Providers: []string{"primary", "backup"}}},
+		map[string]Provider{"primary": primary, "backup": backup})
+
+	primary.fail(5, badPhone)
+	backup.fail(5, badPhone)
+	for i := 0; i < 5; i++ {
+		_, err := r.Send(context.Background(), Message{To: "+251900000000"})
+		assert.Error(t, err)
+	}
+	assert.Equal(t, BreakerClosed, r.breakers["primary"].current())
+}
+
+func TestRouter_AllCircuitsOpen(t *testing.T) {
+	only := &stubProvider{}
+	r := newTestRouter(t, []Route{{Prefix: "", Providers: []string{"only"}}}, map[string]Provider{"only": only})
+
+	only.fail(2, outage)
+	r.Send(context.Background(), Message{To: "+251911223344"})
+	r.Send(context.Background(), Message{To: "+251911223344"})
+
+	_, err := r.Send(context.Background(), Message{To: "+251911223344"})
+	assert.True(t, errors.Is(err, ErrNoProvider))
+}
+
+func TestRouter_SetRoutesAndWatch(t *testing.T) {
+	a, b := &stubProvider{}, &stubProvider{}
+	r := newTestRouter(t, []Route{{Prefix: "", Providers: []string{"a"}}}, map[string]Provider{"a": a, "b": b})
+
+	assert.Error(t, r.SetRoutes([]Route{{Prefix: "", Providers: []string{"nope"}}}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond, func(context.Context) ([]Route, error) {
+		return []Route{{Prefix: "", Providers: []string{"b", "a"}}}, nil
+	})
+
+	require.Eventually(t, func() bool { return r.Routes()[0].Providers[0] == "b" }, time.Second, 5*time.Millisecond)
+	receipt, _ := r.Send(context.Background(), Message{To: "+251911223344"})
+	assert.Equal(t, "b", receipt.Provider)
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes("+2519=smpp|africastalking; +2517=africastalking ;*=twilio")
+	require.NoError(t, err)
+	assert.Equal(t, []Route{
+		{Prefix: "+2519", Providers: []string{"smpp", "africastalking"}},
+		{Prefix: "+2517", Providers: []string{"africastalking"}},
+		{Prefix: "", Providers: []string{"twilio"}},
+	}, routes)
+
+	_, err = ParseRoutes("+2519")
+	assert.Error(t, err)
+}
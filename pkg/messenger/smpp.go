@@ -0,0 +1,500 @@
+package messenger
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SMPPConfig configures a bound SMPP 3.4 transceiver session with an operator SMSC.
+type SMPPConfig struct {
+	Addr       string
+	SystemID   string
+	Password   string
+	SystemType string
+
+	// SourceAddr is the sender shown on the handset (short code or alphanumeric ID).
+	SourceAddr string
+	SourceTON  byte
+	SourceNPI  byte
+
+	// EnquireLinkInterval is how often the session is probed. Defaults to 30s.
+	EnquireLinkInterval time.Duration
+	// ResponseTimeout bounds every request/response exchange. Defaults to 10s.
+	ResponseTimeout time.Duration
+	// ReconnectMin and ReconnectMax bound the exponential reconnect backoff. Default 1s and 1m.
+	ReconnectMin time.Duration
+	ReconnectMax time.Duration
+
+	// OnReceipt is called for every delivery receipt pushed by the SMSC via deliver_sm.
+	// It runs on its own goroutine, so a slow OnReceipt never holds up the session.
+	OnReceipt func(DeliveryReport)
+	// ReceiptBuffer is how many receipts may wait for OnReceipt; more are dropped.
+	// Defaults to 1024.
+	ReceiptBuffer int
+	Logger        *slog.Logger
+}
+
+// SMPPProvider keeps a transceiver session alive in the background and submits messages over it.
+type SMPPProvider struct {
+	cfg    SMPPConfig
+	logger *slog.Logger
+	seq    atomic.Uint32
+
+	mu      sync.Mutex
+	session *smppSession
+	changed chan struct{} // closed and replaced whenever session changes
+
+	receipts chan DeliveryReport // waiting for OnReceipt
+
+	stop      context.CancelFunc
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSMPPProvider validates cfg and starts connecting in the background.
+// Call Close to unbind and stop reconnecting.
+func NewSMPPProvider(cfg SMPPConfig) (*SMPPProvider, error) {
+	if cfg.Addr == "" || cfg.SystemID == "" {
+		return nil, errors.New("smpp: addr and system id are required")
+	}
+	if cfg.EnquireLinkInterval <= 0 {
+		cfg.EnquireLinkInterval = 30 * time.Second
+	}
+	if cfg.ResponseTimeout <= 0 {
+		cfg.ResponseTimeout = 10 * time.Second
+	}
+	if cfg.ReconnectMin <= 0 {
+		cfg.ReconnectMin = time.Second
+	}
+	if cfg.ReconnectMax < cfg.ReconnectMin {
+		cfg.ReconnectMax = time.Minute
+	}
+	if cfg.ReceiptBuffer <= 0 {
+		cfg.ReceiptBuffer = 1024
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &SMPPProvider{
+		cfg:     cfg,
+		logger:  cfg.Logger.With("provider", "smpp", "addr", cfg.Addr),
+		changed: make(chan struct{}),
+		stop:    cancel,
+		stopped: make(chan struct{}),
+	}
+	if cfg.OnReceipt != nil {
+		p.receipts = make(chan DeliveryReport, cfg.ReceiptBuffer)
+		go p.deliverReceipts(ctx)
+	}
+	go p.run(ctx)
+	return p, nil
+}
+
+// deliverReceipts hands queued receipts to OnReceipt until ctx is cancelled.
+func (p *SMPPProvider) deliverReceipts(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case r := <-p.receipts:
+			p.cfg.OnReceipt(r)
+		}
+	}
+}
+
+// Close unbinds the current session and stops reconnecting.
+func (p *SMPPProvider) Close() error {
+	p.closeOnce.Do(func() {
+		p.stop()
+		<-p.stopped
+	})
+	return nil
+}
+
+// Bound reports whether a session is currently bound.
+func (p *SMPPProvider) Bound() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.session != nil
+}
+
+func (p *SMPPProvider) setSession(s *smppSession) {
+	p.mu.Lock()
+	p.session = s
+	close(p.changed)
+	p.changed = make(chan struct{})
+	p.mu.Unlock()
+}
+
+// run dials, binds and serves sessions until ctx is cancelled, backing off between failures.
+func (p *SMPPProvider) run(ctx context.Context) {
+	defer close(p.stopped)
+
+	backoff := p.cfg.ReconnectMin
+	for {
+		s, err := p.connect(ctx)
+		if err == nil {
+			backoff = p.cfg.ReconnectMin
+			p.logger.Info("smpp session bound")
+			p.setSession(s)
+			err = s.serve(ctx, p.cfg.EnquireLinkInterval)
+			p.setSession(nil)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		p.logger.Warn("smpp session lost, reconnecting", "error", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, p.cfg.ReconnectMax)
+	}
+}
+
+func (p *SMPPProvider) connect(ctx context.Context) (*smppSession, error) {
+	dialer := net.Dialer{Timeout: p.cfg.ResponseTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", p.cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newSMPPSession(conn, p, p.cfg.ResponseTimeout)
+	go s.readLoop()
+
+	var b pduBuilder
+	b.cstring(p.cfg.SystemID)
+	b.cstring(p.cfg.Password)
+	b.cstring(p.cfg.SystemType)
+	b.octet(smppVersion34)
+	b.octet(0)    // addr_ton
+	b.octet(0)    // addr_npi
+	b.cstring("") // address_range
+
+	resp, err := s.request(ctx, smppBindTransceiver, b.Bytes())
+	if err != nil {
+		s.close()
+		return nil, fmt.Errorf("smpp: bind: %w", err)
+	}
+	if resp.status != smppStatusOK {
+		s.close()
+		return nil, fmt.Errorf("smpp: bind rejected with status 0x%08X", resp.status)
+	}
+	return s, nil
+}
+
+// waitSession blocks until a session is bound, ctx is done or the response timeout elapses.
+func (p *SMPPProvider) waitSession(ctx context.Context) (*smppSession, error) {
+	timer := time.NewTimer(p.cfg.ResponseTimeout)
+	defer timer.Stop()
+	for {
+		p.mu.Lock()
+		s, changed := p.session, p.changed
+		p.mu.Unlock()
+		if s != nil {
+			return s, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			return nil, errors.New("no bound session")
+		}
+	}
+}
+
+// Send submits msg, splitting it into concatenated parts when it does not fit one SMS.
+// Text outside the GSM alphabet (e.g. Amharic) is sent as UCS-2.
+func (p *SMPPProvider) Send(ctx context.Context, msg Message) (Receipt, error) {
+	s, err := p.waitSession(ctx)
+	if err != nil {
+		return Receipt{}, &SendError{Provider: "smpp", Retryable: true, Err: err}
+	}
+
+	coding, chars := encodeSMS(msg.Body)
+	single, multi := partSizes(coding)
+	parts := splitChars(chars, single)
+	if len(parts) > 1 {
+		// Leave room for the 6 byte concatenation header
+		parts = splitChars(chars, multi)
+	}
+	if len(parts) > 255 {
+		return Receipt{}, &SendError{Provider: "smpp", Err: errors.New("message too long")}
+	}
+
+	ref := make([]byte, 1)
+	rand.Read(ref)
+
+	var receipt Receipt
+	for i, part := range parts {
+		sm := &smMessage{
+			sourceTON:          p.cfg.SourceTON,
+			sourceNPI:          p.cfg.SourceNPI,
+			source:             p.cfg.SourceAddr,
+			destTON:            1, // international
+			destNPI:            1, // E.164
+			dest:               strings.TrimPrefix(msg.To, "+"),
+			registeredDelivery: 1, // request a receipt for success and failure
+			dataCoding:         coding,
+			shortMessage:       part,
+		}
+		if len(parts) > 1 {
+			sm.esmClass = smppESMUDHI
+			udh := []byte{0x05, 0x00, 0x03, ref[0], byte(len(parts)), byte(i + 1)}
+			sm.shortMessage = append(udh, part...)
+		}
+
+		resp, err := s.request(ctx, smppSubmitSM, sm.marshal())
+		if err != nil {
+			return Receipt{}, &SendError{Provider: "smpp", Retryable: true, Err: err}
+		}
+		if resp.status != smppStatusOK {
+			return Receipt{}, &SendError{
+				Provider:  "smpp",
+				Code:      fmt.Sprintf("0x%08X", resp.status),
+				Retryable: smppRetryable(resp.status),
+			}
+		}
+		if i == 0 {
+			parser := &pduParser{b: resp.body}
+			receipt = Receipt{Provider: "smpp", MessageID: parser.cstring()}
+		}
+	}
+	return receipt, nil
+}
+
+// smppRetryable marks throttling, queue-full and transient SMSC errors as retryable.
+func smppRetryable(status uint32) bool {
+	switch status {
+	case smppStatusThrottled, smppStatusMsgQFull, smppStatusSysErr, smppStatusTempAppErr:
+		return true
+	}
+	return false
+}
+
+// handleDeliver processes a deliver_sm; receipts are parsed and queued for OnReceipt.
+// It runs on the read loop, so it never waits.
+func (p *SMPPProvider) handleDeliver(body []byte) {
+	sm, err := parseSM(body)
+	if err != nil {
+		p.logger.Warn("malformed deliver_sm", "error", err)
+		return
+	}
+	if sm.esmClass&smppESMReceipt == 0 {
+		p.logger.Info("ignoring mobile originated message", "from", sm.source)
+		return
+	}
+	report := parseSMPPReceipt(string(sm.shortMessage), sm.tlvs)
+	if p.receipts == nil {
+		return
+	}
+	select {
+	case p.receipts <- report:
+	default:
+		p.logger.Warn("receipt queue full, dropping delivery receipt", "message_id", report.MessageID, "status", report.Status)
+	}
+}
+
+// parseSMPPReceipt reads the de-facto standard receipt text
+// "id:X sub:001 dlvrd:001 submit date:... done date:... stat:DELIVRD err:000 text:..."
+// preferring the receipted_message_id and message_state TLVs when present.
+func parseSMPPReceipt(text string, tlvs map[uint16][]byte) DeliveryReport {
+	fields := map[string]string{}
+	for _, key := range []string{"id", "stat", "err"} {
+		idx := strings.Index(strings.ToLower(text), key+":")
+		if idx < 0 {
+			continue
+		}
+		rest := text[idx+len(key)+1:]
+		if sp := strings.IndexByte(rest, ' '); sp >= 0 {
+			rest = rest[:sp]
+		}
+		fields[key] = rest
+	}
+
+	report := DeliveryReport{
+		Provider:  "smpp",
+		MessageID: fields["id"],
+		ErrorCode: fields["err"],
+		At:        time.Now(),
+	}
+	if v, ok := tlvs[smppTagReceiptedMessageID]; ok {
+		report.MessageID = strings.TrimRight(string(v), "\x00")
+	}
+
+	stat := strings.ToUpper(fields["stat"])
+	if v, ok := tlvs[smppTagMessageState]; ok && len(v) == 1 {
+		stat = smppMessageStates[v[0]]
+	}
+	switch stat {
+	case "DELIVRD":
+		report.Status = StatusDelivered
+	case "ACCEPTD", "ENROUTE":
+		report.Status = StatusSent
+	default:
+		report.Status = StatusFailed
+	}
+	return report
+}
+
+// smppMessageStates maps the message_state TLV to the receipt stat strings.
+var smppMessageStates = map[byte]string{
+	1: "ENROUTE", 2: "DELIVRD", 3: "EXPIRED", 4: "DELETED",
+	5: "UNDELIV", 6: "ACCEPTD", 7: "UNKNOWN", 8: "REJECTD",
+}
+
+// smppSession is one bound TCP connection.
+type smppSession struct {
+	conn     net.Conn
+	provider *SMPPProvider
+	timeout  time.Duration
+
+	wmu     sync.Mutex
+	mu      sync.Mutex
+	pending map[uint32]chan *pdu
+
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+func newSMPPSession(conn net.Conn, p *SMPPProvider, timeout time.Duration) *smppSession {
+	return &smppSession{
+		conn:     conn,
+		provider: p,
+		timeout:  timeout,
+		pending:  map[uint32]chan *pdu{},
+		done:     make(chan struct{}),
+	}
+}
+
+func (s *smppSession) closeWith(err error) {
+	s.closeOnce.Do(func() {
+		s.err = err
+		s.conn.Close()
+		close(s.done)
+	})
+}
+
+func (s *smppSession) close() { s.closeWith(errors.New("session closed")) }
+
+func (s *smppSession) write(p *pdu) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	_, err := s.conn.Write(p.marshal())
+	return err
+}
+
+// request sends a PDU and waits for the response with the same sequence number.
+func (s *smppSession) request(ctx context.Context, commandID uint32, body []byte) (*pdu, error) {
+	seq := s.provider.seq.Add(1)
+	ch := make(chan *pdu, 1)
+
+	s.mu.Lock()
+	s.pending[seq] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, seq)
+		s.mu.Unlock()
+	}()
+
+	if err := s.write(&pdu{commandID: commandID, seq: seq, body: body}); err != nil {
+		s.closeWith(err)
+		return nil, err
+	}
+
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+	select {
+	case resp := <-ch:
+		if resp.commandID == smppGenericNack {
+			return nil, fmt.Errorf("generic_nack status 0x%08X", resp.status)
+		}
+		return resp, nil
+	case <-s.done:
+		return nil, s.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, errors.New("response timeout")
+	}
+}
+
+func (s *smppSession) respond(req *pdu, commandID uint32, status uint32, body []byte) {
+	if err := s.write(&pdu{commandID: commandID, status: status, seq: req.seq, body: body}); err != nil {
+		s.closeWith(err)
+	}
+}
+
+func (s *smppSession) readLoop() {
+	for {
+		p, err := readPDU(s.conn)
+		if err != nil {
+			s.closeWith(err)
+			return
+		}
+
+		if p.isResponse() {
+			s.mu.Lock()
+			ch, ok := s.pending[p.seq]
+			s.mu.Unlock()
+			if ok {
+				ch <- p
+			}
+			continue
+		}
+
+		switch p.commandID {
+		case smppEnquireLink:
+			s.respond(p, smppEnquireLinkResp, smppStatusOK, nil)
+		case smppDeliverSM:
+			s.respond(p, smppDeliverSMResp, smppStatusOK, []byte{0})
+			s.provider.handleDeliver(p.body)
+		case smppUnbind:
+			s.respond(p, smppUnbindResp, smppStatusOK, nil)
+			s.closeWith(errors.New("unbound by smsc"))
+			return
+		default:
+			s.respond(p, smppGenericNack, smppStatusInvCmdID, nil)
+		}
+	}
+}
+
+// serve keeps the session alive with enquire_link until it fails or ctx is cancelled.
+func (s *smppSession) serve(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// Best effort unbind before closing
+			unbindCtx, cancel := context.WithTimeout(context.Background(), s.timeout)
+			s.request(unbindCtx, smppUnbind, nil)
+			cancel()
+			s.close()
+			return ctx.Err()
+		case <-s.done:
+			return s.err
+		case <-ticker.C:
+			if _, err := s.request(ctx, smppEnquireLink, nil); err != nil && ctx.Err() == nil {
+				s.closeWith(fmt.Errorf("enquire_link: %w", err))
+				return s.err
+			}
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package messenger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SMPP 3.4 command IDs used by the client.
+const (
+	smppGenericNack         uint32 = 0x80000000
+	smppBindTransceiver     uint32 = 0x00000009
+	smppBindTransceiverResp uint32 = 0x80000009
+	smppSubmitSM            uint32 = 0x00000004
+	smppSubmitSMResp        uint32 = 0x80000004
+	smppDeliverSM           uint32 = 0x00000005
+	smppDeliverSMResp       uint32 = 0x80000005
+	smppUnbind              uint32 = 0x00000006
+	smppUnbindResp          uint32 = 0x80000006
+	smppEnquireLink         uint32 = 0x00000015
+	smppEnquireLinkResp     uint32 = 0x80000015
+)
+
+// SMPP command_status values we act on.
+const (
+	smppStatusOK          uint32 = 0x00000000
+	smppStatusMsgQFull    uint32 = 0x00000014
+	smppStatusSysErr      uint32 = 0x00000008
+	smppStatusThrottled   uint32 = 0x00000058
+	smppStatusTempAppErr  uint32 = 0x00000064
+	smppStatusInvCmdID    uint32 = 0x00000003
+	smppStatusBindFail    uint32 = 0x0000000D
+	smppStatusInvPassword uint32 = 0x0000000E
+)
+
+// Optional parameter tags.
+const (
+	smppTagReceiptedMessageID uint16 = 0x001E
+	smppTagMessageState       uint16 = 0x0427
+)
+
+const (
+	smppHeaderLen  = 16
+	smppMaxPDULen  = 64 * 1024
+	smppVersion34  = 0x34
+	smppESMUDHI    = 0x40 // esm_class: user data header present
+	smppESMReceipt = 0x04 // esm_class: SMSC delivery receipt
+)
+
+type pdu struct {
+	commandID uint32
+	status    uint32
+	seq       uint32
+	body      []byte
+}
+
+func (p *pdu) isResponse() bool { return p.commandID&0x80000000 != 0 }
+
+func (p *pdu) marshal() []byte {
+	buf := make([]byte, smppHeaderLen+len(p.body))
+	binary.BigEndian.PutUint32(buf[0:], uint32(len(buf)))
+	binary.BigEndian.PutUint32(buf[4:], p.commandID)
+	binary.BigEndian.PutUint32(buf[8:], p.status)
+	binary.BigEndian.PutUint32(buf[12:], p.seq)
+	copy(buf[smppHeaderLen:], p.body)
+	return buf
+}
+
+func readPDU(r io.Reader) (*pdu, error) {
+	var hdr [smppHeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(hdr[0:])
+	if length < smppHeaderLen || length > smppMaxPDULen {
+		return nil, fmt.Errorf("smpp: invalid pdu length %d", length)
+	}
+	p := &pdu{
+		commandID: binary.BigEndian.Uint32(hdr[4:]),
+		status:    binary.BigEndian.Uint32(hdr[8:]),
+		seq:       binary.BigEndian.Uint32(hdr[12:]),
+		body:      make([]byte, length-smppHeaderLen),
+	}
+	if _, err := io.ReadFull(r, p.body); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// pduBuilder writes SMPP body fields.
+type pduBuilder struct{ bytes.Buffer }
+
+func (b *pduBuilder) cstring(s string) {
+	b.WriteString(s)
+	b.WriteByte(0)
+}
+
+func (b *pduBuilder) octet(v byte) { b.WriteByte(v) }
+
+func (b *pduBuilder) tlv(tag uint16, value []byte) {
+	var hdr [4]byte
+	binary.BigEndian.PutUint16(hdr[0:], tag)
+	binary.BigEndian.PutUint16(hdr[2:], uint16(len(value)))
+	b.Write(hdr[:])
+	b.Write(value)
+}
+
+var errShortPDU = errors.New("smpp: truncated pdu body")
+
+// pduParser reads SMPP body fields; the first error sticks.
+type pduParser struct {
+	b   []byte
+	err error
+}
+
+func (p *pduParser) cstring() string {
+	if p.err != nil {
+		return ""
+	}
+	i := bytes.IndexByte(p.b, 0)
+	if i < 0 {
+		p.err = errShortPDU
+		return ""
+	}
+	s := string(p.b[:i])
+	p.b = p.b[i+1:]
+	return s
+}
+
+func (p *pduParser) octet() byte {
+	if p.err != nil || len(p.b) < 1 {
+		p.err = errShortPDU
+		return 0
+	}
+	v := p.b[0]
+	p.b = p.b[1:]
+	return v
+}
+
+func (p *pduParser) bytes(n int) []byte {
+	if p.err != nil || len(p.b) < n {
+		p.err = errShortPDU
+		return nil
+	}
+	v := p.b[:n]
+	p.b = p.b[n:]
+	return v
+}
+
+// tlvs parses the remaining body as optional parameters.
+func (p *pduParser) tlvs() map[uint16][]byte {
+	out := map[uint16][]byte{}
+	for p.err == nil && len(p.b) >= 4 {
+		tag := binary.BigEndian.Uint16(p.b[0:])
+		n := int(binary.BigEndian.Uint16(p.b[2:]))
+		p.b = p.b[4:]
+		out[tag] = p.bytes(n)
+	}
+	return out
+}
+
+// smMessage is the shared layout of submit_sm and deliver_sm.
+type smMessage struct {
+	sourceTON, sourceNPI byte
+	source               string
+	destTON, destNPI     byte
+	dest                 string
+	esmClass             byte
+	registeredDelivery   byte
+	dataCoding           byte
+	shortMessage         []byte
+	tlvs                 map[uint16][]byte
+}
+
+func (m *smMessage) marshal() []byte {
+	var b pduBuilder
+	b.cstring("") // service_type
+	b.octet(m.sourceTON)
+	b.octet(m.sourceNPI)
+	b.cstring(m.source)
+	b.octet(m.destTON)
+	b.octet(m.destNPI)
+	b.cstring(m.dest)
+	b.octet(m.esmClass)
+	b.octet(0)    // protocol_id
+	b.octet(0)    // priority_flag
+	b.cstring("") // schedule_delivery_time
+	b.cstring("") // validity_period
+	b.octet(m.registeredDelivery)
+	b.octet(0) // replace_if_present_flag
+	b.octet(m.dataCoding)
+	b.octet(0) // sm_default_msg_id
+	b.octet(byte(len(m.shortMessage)))
+	b.Write(m.shortMessage)
+	for tag, v := range m.tlvs {
+		b.tlv(tag, v)
+	}
+	return b.Bytes()
+}
+
+func parseSM(body []byte) (*smMessage, error) {
+	p := &pduParser{b: body}
+	m := &smMessage{}
+	p.cstring() // service_type
+	m.sourceTON = p.octet()
+	m.sourceNPI = p.octet()
+	m.source = p.cstring()
+	m.destTON = p.octet()
+	m.destNPI = p.octet()
+	m.dest = p.cstring()
+	m.esmClass = p.octet()
+	p.octet()   // protocol_id
+	p.octet()   // priority_flag
+	p.cstring() // schedule_delivery_time
+	p.cstring() // validity_period
+	m.registeredDelivery = p.octet()
+	p.octet() // replace_if_present_flag
+	m.dataCoding = p.octet()
+	p.octet() // sm_default_msg_id
+	m.shortMessage = p.bytes(int(p.octet()))
+	m.tlvs = p.tlvs()
+	return m, p.err
+}
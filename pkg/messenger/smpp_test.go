@@ -0,0 +1,318 @@
+package messenger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMSC is an in-process SMSC speaking enough SMPP 3.4 for the client tests.
+type fakeSMSC struct {
+	t        *testing.T
+	ln       net.Listener
+	password string
+
+	mu         sync.Mutex
+	submitted  []*smMessage
+	binds      int
+	enquires   int
+	conns      []net.Conn
+	submitResp uint32 // command_status returned for submit_sm
+}
+
+func newFakeSMSC(t *testing.T, password string) *fakeSMSC {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f := &fakeSMSC{t: t, ln: ln, password: password}
+	go f.accept()
+	t.Cleanup(func() { ln.Close(); f.dropAll() })
+	return f
+}
+
+func (f *fakeSMSC) accept() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns = append(f.conns, conn)
+		f.mu.Unlock()
+		go f.serve(conn)
+	}
+}
+
+// dropAll severs every client connection, simulating a network failure.
+func (f *fakeSMSC) dropAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.conns {
+		c.Close()
+	}
+	f.conns = nil
+}
+
+func (f *fakeSMSC) serve(conn net.Conn) {
+	var wmu sync.Mutex
+	write := func(p *pdu) {
+		wmu.Lock()
+		defer wmu.Unlock()
+		conn.Write(p.marshal())
+	}
+
+	msgID := 0
+	for {
+		p, err := readPDU(conn)
+		if err != nil {
+			return
+		}
+		switch p.commandID {
+		case smppBindTransceiver:
+			parser := &pduParser{b: p.body}
+			parser.cstring() // system_id
+			status := smppStatusOK
+			if parser.cstring() != f.password {
+				status = smppStatusInvPassword
+			}
+			f.mu.Lock()
+			f.binds++
+			f.mu.Unlock()
+			var b pduBuilder
+			b.cstring("fake-smsc")
+			write(&pdu{commandID: smppBindTransceiverResp, status: status, seq: p.seq, body: b.Bytes()})
+
+		case smppSubmitSM:
+			sm, err := parseSM(p.body)
+			assert.NoError(f.t, err)
+			f.mu.Lock()
+			f.submitted = append(f.submitted, sm)
+			status := f.submitResp
+			f.mu.Unlock()
+
+			msgID++
+			id := fmt.Sprintf("msg-%d", msgID)
+			var b pduBuilder
+			b.cstring(id)
+			write(&pdu{commandID: smppSubmitSMResp, status: status, seq: p.seq, body: b.Bytes()})
+
+			if status == smppStatusOK && sm.registeredDelivery == 1 {
+				receipt := &smMessage{
+					source:       sm.dest,
+					dest:         sm.source,
+					esmClass:     smppESMReceipt,
+					shortMessage: []byte("id:" + id + " sub:001 dlvrd:001 submit date:2601011200 done date:2601011201 stat:DELIVRD err:000 text:"),
+				}
+				write(&pdu{commandID: smppDeliverSM, seq: 1000 + uint32(msgID), body: receipt.marshal()})
+			}
+
+		case smppEnquireLink:
+			f.mu.Lock()
+			f.enquires++
+			f.mu.Unlock()
+			write(&pdu{commandID: smppEnquireLinkResp, seq: p.seq})
+
+		case smppUnbind:
+			write(&pdu{commandID: smppUnbindResp, seq: p.seq})
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (f *fakeSMSC) snapshot() (binds, enquires int, submitted []*smMessage) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.binds, f.enquires, append([]*smMessage(nil), f.submitted...)
+}
+
+func newTestSMPP(t *testing.T, f *fakeSMSC, password string, onReceipt func(DeliveryReport)) *SMPPProvider {
+	p, err := NewSMPPProvider(SMPPConfig{
+		Addr:                f.ln.Addr().String(),
+		SystemID:            "addis",
+		Password:            password,
+		SourceAddr:          "AddisVerify",
+		SourceTON:           5,
+		EnquireLinkInterval: 50 * time.Millisecond,
+		ResponseTimeout:     time.Second,
+		ReconnectMin:        10 * time.Millisecond,
+		ReconnectMax:        50 * time.Millisecond,
+		OnReceipt:           onReceipt,
+		Logger:              slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestSMPPProvider_SendAndReceipt(t *testing.T) {
+	f := newFakeSMSC(t, "secret")
+	receipts := make(chan DeliveryReport, 4)
+	p := newTestSMPP(t, f, "secret", func(r DeliveryReport) { receipts <- r })
+
+	receipt, err := p.Send(context.Background(), Message{To: "+251911223344", Body: "Your code is 123456"})
+	require.NoError(t, err)
+	assert.Equal(t, Receipt{Provider: "smpp", MessageID: "msg-1"}, receipt)
+
+	_, _, submitted := f.snapshot()
+	require.Len(t, submitted, 1)
+	assert.Equal(t, "251911223344", submitted[0].dest)
+	assert.Equal(t, CodingGSM7, submitted[0].dataCoding)
+	assert.Equal(t, "Your code is 123456", decodeSMS(CodingGSM7, submitted[0].shortMessage))
+
+	select {
+	case r := <-receipts:
+		assert.Equal(t, "msg-1", r.MessageID)
+		assert.Equal(t, StatusDelivered, r.Status)
+	case <-time.After(time.Second):
+		t.Fatal("no delivery receipt")
+	}
+}
+
+func TestSMPPProvider_SlowReceiptHandlerDoesNotStallSession(t *testing.T) {
+	f := newFakeSMSC(t, "secret")
+	release := make(chan struct{})
+	defer close(release)
+	p := newTestSMPP(t, f, "secret", func(DeliveryReport) { <-release })
+
+	// The first receipt parks OnReceipt; later responses must still get through
+	for i := 0; i < 3; i++ {
+		_, err := p.Send(context.Background(), Message{To: "+251911223344", Body: "hi"})
+		require.NoError(t, err)
+	}
+	assert.True(t, p.Bound())
+}
+
+func TestSMPPProvider_AmharicUsesUCS2(t *testing.T) {
+	f := newFakeSMSC(t, "secret")
+	p := newTestSMPP(t, f, "secret", nil)
+
+	body := "የአዲስ ቬሪፋይ ኮድዎ 123456 ነው"
+	_, err := p.Send(context.Background(), Message{To: "+251911223344", Body: body})
+	require.NoError(t, err)
+
+	_, _, submitted := f.snapshot()
+	require.Len(t, submitted, 1)
+	assert.Equal(t, CodingUCS2, submitted[0].dataCoding)
+	assert.Equal(t, body, decodeSMS(CodingUCS2, submitted[0].shortMessage))
+}
+
+func TestSMPPProvider_LongMessageIsConcatenated(t *testing.T) {
+	f := newFakeSMSC(t, "secret")
+	p := newTestSMPP(t, f, "secret", nil)
+
+	body := ""
+	for i := 0; i < 10; i++ {
+		body += "ሰላም ለዓለም " // 10 Ethiopic runes per round, 100 total > 70
+	}
+	_, err := p.Send(context.Background(), Message{To: "+251911223344", Body: body})
+	require.NoError(t, err)
+
+	_, _, submitted := f.snapshot()
+	require.Len(t, submitted, 2)
+	var joined []byte
+	for i, sm := range submitted {
+		assert.Equal(t, byte(smppESMUDHI), sm.esmClass)
+		udh := sm.shortMessage[:6]
+		assert.Equal(t, byte(2), udh[4])   // total parts
+		assert.Equal(t, byte(i+1), udh[5]) // part number
+		joined = append(joined, sm.shortMessage[6:]...)
+	}
+	assert.Equal(t, body, decodeSMS(CodingUCS2, joined))
+}
+
+func TestSMPPProvider_EnquireLinkAndReconnect(t *testing.T) {
+	f := newFakeSMSC(t, "secret")
+	p := newTestSMPP(t, f, "secret", nil)
+
+	require.Eventually(t, func() bool {
+		_, enquires, _ := f.snapshot()
+		return enquires >= 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	f.dropAll()
+
+	require.Eventually(t, func() bool {
+		binds, _, _ := f.snapshot()
+		return binds >= 2 && p.Bound()
+	}, 2*time.Second, 10*time.Millisecond)
+
+	_, err := p.Send(context.Background(), Message{To: "+251911223344", Body: "after reconnect"})
+	assert.NoError(t, err)
+}
+
+func TestSMPPProvider_ErrorClassification(t *testing.T) {
+	f := newFakeSMSC(t, "secret")
+	p := newTestSMPP(t, f, "secret", nil)
+
+	f.mu.Lock()
+	f.submitResp = smppStatusThrottled
+	f.mu.Unlock()
+	_, err := p.Send(context.Background(), Message{To: "+251911223344", Body: "hi"})
+	assert.True(t, IsRetryable(err))
+
+	f.mu.Lock()
+	f.submitResp = 0x0000000B // ESME_RINVDSTADR
+	f.mu.Unlock()
+	_, err = p.Send(context.Background(), Message{To: "+251911223344", Body: "hi"})
+	assert.Error(t, err)
+	assert.False(t, IsRetryable(err))
+}
+
+func TestSMPPProvider_BindRejected(t *testing.T) {
+	f := newFakeSMSC(t, "secret")
+	p := newTestSMPP(t, f, "wrong", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := p.Send(ctx, Message{To: "+251911223344", Body: "hi"})
+	assert.Error(t, err)
+	assert.True(t, IsRetryable(err))
+	assert.False(t, p.Bound())
+}
+
+func TestSMPPProvider_GSMUsesSeptetLimits(t *testing.T) {
+	f := newFakeSMSC(t, "secret")
+	p := newTestSMPP(t, f, "secret", nil)
+
+	// 160 characters still fit one SMS
+	single := strings.Repeat("a", 160)
+	_, err := p.Send(context.Background(), Message{To: "+251911223344", Body: single})
+	require.NoError(t, err)
+	_, _, submitted := f.snapshot()
+	require.Len(t, submitted, 1)
+	assert.Equal(t, byte(0), submitted[0].esmClass)
+	assert.Equal(t, single, decodeSMS(CodingGSM7, submitted[0].shortMessage))
+
+	// 161 need two parts of at most 153
+	long := strings.Repeat("b", 161)
+	_, err = p.Send(context.Background(), Message{To: "+251911223344", Body: long})
+	require.NoError(t, err)
+	_, _, submitted = f.snapshot()
+	require.Len(t, submitted, 3)
+	var joined []byte
+	for _, sm := range submitted[1:] {
+		assert.Equal(t, byte(smppESMUDHI), sm.esmClass)
+		assert.LessOrEqual(t, len(sm.shortMessage)-6, 153)
+		joined = append(joined, sm.shortMessage[6:]...)
+	}
+	assert.Equal(t, long, decodeSMS(CodingGSM7, joined))
+	assert.Equal(t, 2, CountSegments(long).Count)
+}
+
+func TestParseSMPPReceipt_TLVOverridesText(t *testing.T) {
+	r := parseSMPPReceipt("id:abc stat:DELIVRD err:000", map[uint16][]byte{
+		smppTagReceiptedMessageID: []byte("XYZ\x00"),
+		smppTagMessageState:       {5},
+	})
+	assert.Equal(t, "XYZ", r.MessageID)
+	assert.Equal(t, StatusFailed, r.Status)
+}
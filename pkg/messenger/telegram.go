@@ -0,0 +1,89 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const telegramDefaultBaseURL = "https://gatewayapi.telegram.org"
+
+// TelegramConfig configures Telegram's Gateway API, which delivers verification
+// codes to the Telegram account registered on a phone number.
+type TelegramConfig struct {
+	Token string
+	// TTL is how long Telegram shows the code as valid (60-86400s). Zero leaves it unset.
+	TTL time.Duration
+	// BaseURL overrides the API host (used by tests).
+	BaseURL string
+	Timeout time.Duration
+}
+
+type telegramProvider struct {
+	cfg    TelegramConfig
+	client *http.Client
+}
+
+// NewTelegramProvider creates a provider for the Telegram Gateway API.
+// Telegram renders its own localized text, so only Message.Code is sent.
+func NewTelegramProvider(cfg TelegramConfig) (Provider, error) {
+	if cfg.Token == "" {
+		return nil, errors.New("telegram: gateway token is required")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = telegramDefaultBaseURL
+	}
+	return &telegramProvider{cfg: cfg, client: newHTTPClient(cfg.Timeout)}, nil
+}
+
+type telegramResponse struct {
+	OK     bool   `json:"ok"`
+	Error  string `json:"error"`
+	Result struct {
+		RequestID string `json:"request_id"`
+	} `json:"result"`
+}
+
+func (p *telegramProvider) Send(ctx context.Context, msg Message) (Receipt, error) {
+	if msg.Code == "" {
+		return Receipt{}, &SendError{Provider: "telegram", Err: errors.New("message has no code")}
+	}
+
+	payload := map[string]any{"phone_number": msg.To, "code": msg.Code}
+	if p.cfg.TTL > 0 {
+		payload["ttl"] = int(p.cfg.TTL.Seconds())
+	}
+	raw, _ := json.Marshal(payload)
+
+	endpoint := strings.TrimRight(p.cfg.BaseURL, "/") + "/sendVerificationMessage"
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(raw))
+	if err != nil {
+		return Receipt{}, &SendError{Provider: "telegram", Err: err}
+	}
+	req.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	status, body, err := do(ctx, p.client, "telegram", req)
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	var resp telegramResponse
+	_ = json.Unmarshal(body, &resp)
+	if status < 200 || status >= 300 || !resp.OK {
+		return Receipt{}, &SendError{
+			Provider:   "telegram",
+			StatusCode: status,
+			Code:       resp.Error,
+			// FLOOD_WAIT and server errors clear up; anything else (e.g. PHONE_NUMBER_INVALID) won't
+			Retryable: retryableStatus(status) || strings.HasPrefix(resp.Error, "FLOOD_WAIT"),
+			Err:       errors.New(resp.Error),
+		}
+	}
+
+	return Receipt{Provider: "telegram", MessageID: resp.Result.RequestID}, nil
+}
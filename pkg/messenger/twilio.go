@@ -0,0 +1,180 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const twilioDefaultBaseURL = "https://api.twilio.com"
+
+// TwilioConfig configures the Twilio REST adapter.
+type TwilioConfig struct {
+	AccountSID string
+	AuthToken  string
+	// From is the sender number or alphanumeric ID. Ignored when MessagingServiceSID is set.
+	From                string
+	MessagingServiceSID string
+	// StatusCallbackURL is the public URL of our receipt webhook. When set, Twilio posts
+	// delivery status updates there and the signature on each callback is verified against it.
+	StatusCallbackURL string
+	// WhatsAppFrom is the WhatsApp-enabled sender number; WhatsAppContentSID an approved OTP template.
+	WhatsAppFrom       string
+	WhatsAppContentSID string
+	// VoiceFrom is the caller ID used for voice OTP calls.
+	VoiceFrom string
+	// BaseURL overrides the API host (used by tests). Defaults to https://api.twilio.com.
+	BaseURL string
+	Timeout time.Duration
+}
+
+type twilioProvider struct {
+	cfg    TwilioConfig
+	client *http.Client
+}
+
+// NewTwilioProvider creates a provider that sends through Twilio's Messages API.
+func NewTwilioProvider(cfg TwilioConfig) (Provider, error) {
+	if cfg.From == "" && cfg.MessagingServiceSID == "" {
+		return nil, errors.New("twilio: from or messaging service sid is required")
+	}
+	return newTwilio(cfg)
+}
+
+func newTwilio(cfg TwilioConfig) (*twilioProvider, error) {
+	if cfg.AccountSID == "" || cfg.AuthToken == "" {
+		return nil, errors.New("twilio: account sid and auth token are required")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = twilioDefaultBaseURL
+	}
+	return &twilioProvider{cfg: cfg, client: newHTTPClient(cfg.Timeout)}, nil
+}
+
+type twilioResponse struct {
+	SID     string `json:"sid"`
+	Status  string `json:"status"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (p *twilioProvider) Send(ctx context.Context, msg Message) (Receipt, error) {
+	form := url.Values{}
+	form.Set("To", msg.To)
+	form.Set("Body", msg.Body)
+	if p.cfg.MessagingServiceSID != "" {
+		form.Set("MessagingServiceSid", p.cfg.MessagingServiceSID)
+	} else {
+		form.Set("From", p.cfg.From)
+	}
+	if p.cfg.StatusCallbackURL != "" {
+		form.Set("StatusCallback", p.cfg.StatusCallbackURL)
+	}
+	return p.post(ctx, "Messages.json", form)
+}
+
+// post creates a Twilio resource (message or call) and classifies the outcome.
+func (p *twilioProvider) post(ctx context.Context, resource string, form url.Values) (Receipt, error) {
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/%s",
+		strings.TrimRight(p.cfg.BaseURL, "/"), url.PathEscape(p.cfg.AccountSID), resource)
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Receipt{}, &SendError{Provider: "twilio", Err: err}
+	}
+	req.SetBasicAuth(p.cfg.AccountSID, p.cfg.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	status, body, err := do(ctx, p.client, "twilio", req)
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	var resp twilioResponse
+	_ = json.Unmarshal(body, &resp)
+
+	if status < 200 || status >= 300 {
+		sendErr := &SendError{Provider: "twilio", StatusCode: status, Retryable: retryableStatus(status)}
+		if resp.Code != 0 {
+			sendErr.Code = strconv.Itoa(resp.Code)
+		}
+		if resp.Message != "" {
+			sendErr.Err = errors.New(resp.Message)
+		}
+		return Receipt{}, sendErr
+	}
+	if resp.Status == "failed" || resp.Status == "undelivered" {
+		return Receipt{}, &SendError{Provider: "twilio", StatusCode: status, Err: fmt.Errorf("message %s", resp.Status)}
+	}
+
+	return Receipt{Provider: "twilio", MessageID: resp.SID}, nil
+}
+
+// twilioWhatsAppProvider sends through the same Messages API using whatsapp: addresses.
+type twilioWhatsAppProvider struct{ *twilioProvider }
+
+// NewTwilioWhatsAppProvider creates a WhatsApp provider on top of Twilio.
+// Business-initiated WhatsApp messages must use an approved template: set
+// WhatsAppContentSID to a template whose first variable is the code.
+func NewTwilioWhatsAppProvider(cfg TwilioConfig) (Provider, error) {
+	if cfg.WhatsAppFrom == "" {
+		return nil, errors.New("twilio: whatsapp from number is required")
+	}
+	p, err := newTwilio(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &twilioWhatsAppProvider{p}, nil
+}
+
+func (p *twilioWhatsAppProvider) Send(ctx context.Context, msg Message) (Receipt, error) {
+	form := url.Values{}
+	form.Set("To", "whatsapp:"+msg.To)
+	form.Set("From", "whatsapp:"+p.cfg.WhatsAppFrom)
+	if p.cfg.WhatsAppContentSID != "" && msg.Code != "" {
+		vars, _ := json.Marshal(map[string]string{"1": msg.Code})
+		form.Set("ContentSid", p.cfg.WhatsAppContentSID)
+		form.Set("ContentVariables", string(vars))
+	} else {
+		form.Set("Body", msg.Body)
+	}
+	if p.cfg.StatusCallbackURL != "" {
+		form.Set("StatusCallback", p.cfg.StatusCallbackURL)
+	}
+	return p.post(ctx, "Messages.json", form)
+}
+
+// twilioVoiceProvider places a call that reads the message out with text-to-speech.
+type twilioVoiceProvider struct{ *twilioProvider }
+
+// NewTwilioVoiceProvider creates a voice provider on top of Twilio's Calls API.
+// The message body is spoken twice so the code can be noted down.
+func NewTwilioVoiceProvider(cfg TwilioConfig) (Provider, error) {
+	if cfg.VoiceFrom == "" {
+		return nil, errors.New("twilio: voice caller id is required")
+	}
+	p, err := newTwilio(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &twilioVoiceProvider{p}, nil
+}
+
+func (p *twilioVoiceProvider) Send(ctx context.Context, msg Message) (Receipt, error) {
+	var say strings.Builder
+	xml.EscapeText(&say, []byte(msg.Body))
+	twiml := fmt.Sprintf(`<Response><Say>%[1]s</Say><Pause length="1"/><Say>%[1]s</Say></Response>`, say.String())
+
+	form := url.Values{}
+	form.Set("To", msg.To)
+	form.Set("From", p.cfg.VoiceFrom)
+	form.Set("Twiml", twiml)
+	return p.post(ctx, "Calls.json", form)
+}
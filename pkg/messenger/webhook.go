@@ -0,0 +1,212 @@
+package messenger
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSignature is returned when a callback cannot be proven to come from the provider.
+var ErrInvalidSignature = errors.New("messenger: invalid webhook signature")
+
+// ReceiptParser turns a provider's delivery status callback into a DeliveryReport.
+type ReceiptParser func(r *http.Request) (DeliveryReport, error)
+
+// ReceiptParsers returns a parser for every configured provider that can push
+// delivery receipts over HTTP, keyed by the provider name used in Receipt.Provider.
+// SMPP receipts arrive on the bind instead, through SMPPConfig.OnReceipt.
+//
+// Africa's Talking and gateway callbacks are not signed, so the shared webhookToken
+// is all that proves they came from the provider; without one they get no parser.
+func ReceiptParsers(cfg Config, webhookToken string) map[string]ReceiptParser {
+	drivers := cfg.Providers
+	if len(drivers) == 0 {
+		drivers = []string{cfg.Driver}
+	}
+
+	parsers := make(map[string]ReceiptParser)
+	for _, driver := range drivers {
+		switch driver {
+		case DriverTwilio:
+			// Without the public callback URL the signature cannot be checked
+			if cfg.Twilio.StatusCallbackURL != "" {
+				parsers["twilio"] = TwilioReceiptParser(cfg.Twilio.AuthToken, cfg.Twilio.StatusCallbackURL)
+			}
+		case DriverAfricasTalking:
+			if webhookToken != "" {
+				parsers["africastalking"] = AfricasTalkingReceiptParser()
+			}
+		case DriverGateway:
+			if webhookToken == "" {
+				continue
+			}
+			name := cfg.Gateway.Name
+			if name == "" {
+				name = "gateway"
+			}
+			parsers[name] = GatewayReceiptParser(name)
+		}
+	}
+	return parsers
+}
+
+// TwilioReceiptParser parses Twilio status callbacks and checks X-Twilio-Signature.
+// callbackURL must be exactly the StatusCallback URL Twilio was given.
+func TwilioReceiptParser(authToken, callbackURL string) ReceiptParser {
+	return func(r *http.Request) (DeliveryReport, error) {
+		if err := r.ParseForm(); err != nil {
+			return DeliveryReport{}, err
+		}
+		expected := twilioSignature(authToken, callbackURL, r.PostForm)
+		if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Twilio-Signature"))) {
+			return DeliveryReport{}, ErrInvalidSignature
+		}
+
+		report := DeliveryReport{
+			Provider:  "twilio",
+			MessageID: r.PostForm.Get("MessageSid"),
+			ErrorCode: r.PostForm.Get("ErrorCode"),
+			At:        time.Now(),
+		}
+		switch r.PostForm.Get("MessageStatus") {
+		case "accepted", "scheduled", "queued":
+			report.Status = StatusQueued
+		case "sending", "sent":
+			report.Status = StatusSent
+		case "delivered", "read":
+			report.Status = StatusDelivered
+		case "undelivered", "failed", "canceled":
+			report.Status = StatusFailed
+		default:
+			return DeliveryReport{}, fmt.Errorf("twilio: unknown message status %q", r.PostForm.Get("MessageStatus"))
+		}
+		if report.MessageID == "" {
+			return DeliveryReport{}, errors.New("twilio: callback without MessageSid")
+		}
+		return report, nil
+	}
+}
+
+// twilioSignature implements Twilio's request validation: HMAC-SHA1 over the
+// URL followed by every POST parameter name and value, sorted by name.
+func twilioSignature(authToken, callbackURL string, params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(callbackURL)
+	for _, k := range keys {
+		for _, v := range params[k] {
+			b.WriteString(k)
+			b.WriteString(v)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(b.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// AfricasTalkingReceiptParser parses Africa's Talking delivery report callbacks.
+// They are not signed: protect the endpoint with a secret in the callback URL.
+func AfricasTalkingReceiptParser() ReceiptParser {
+	return func(r *http.Request) (DeliveryReport, error) {
+		if err := r.ParseForm(); err != nil {
+			return DeliveryReport{}, err
+		}
+
+		report := DeliveryReport{
+			Provider:  "africastalking",
+			MessageID: r.PostForm.Get("id"),
+			ErrorCode: r.PostForm.Get("failureReason"),
+			At:        time.Now(),
+		}
+		switch r.PostForm.Get("status") {
+		case "Sent", "Submitted", "Buffered":
+			report.Status = StatusSent
+		case "Success":
+			report.Status = StatusDelivered
+		case "Failed", "Rejected", "AbsentSubscriber", "Expired":
+			report.Status = StatusFailed
+		default:
+			return DeliveryReport{}, fmt.Errorf("africastalking: unknown status %q", r.PostForm.Get("status"))
+		}
+		if report.MessageID == "" {
+			return DeliveryReport{}, errors.New("africastalking: callback without id")
+		}
+		return report, nil
+	}
+}
+
+// GatewayReceiptParser accepts a JSON or form callback carrying "message_id" (or "id"),
+// "status" and an optional "error_code". Status values are matched loosely so the
+// common aggregator and SMPP spellings (DELIVRD, UNDELIV, ...) all work.
+func GatewayReceiptParser(name string) ReceiptParser {
+	return func(r *http.Request) (DeliveryReport, error) {
+		var fields struct {
+			ID        string `json:"id"`
+			MessageID string `json:"message_id"`
+			Status    string `json:"status"`
+			ErrorCode string `json:"error_code"`
+		}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+				return DeliveryReport{}, fmt.Errorf("%s: decode callback: %w", name, err)
+			}
+		} else {
+			if err := r.ParseForm(); err != nil {
+				return DeliveryReport{}, err
+			}
+			fields.ID = r.Form.Get("id")
+			fields.MessageID = r.Form.Get("message_id")
+			fields.Status = r.Form.Get("status")
+			fields.ErrorCode = r.Form.Get("error_code")
+		}
+
+		report := DeliveryReport{
+			Provider:  name,
+			MessageID: fields.MessageID,
+			ErrorCode: fields.ErrorCode,
+			At:        time.Now(),
+		}
+		if report.MessageID == "" {
+			report.MessageID = fields.ID
+		}
+		if report.MessageID == "" {
+			return DeliveryReport{}, fmt.Errorf("%s: callback without message id", name)
+		}
+
+		status, ok := normalizeStatus(fields.Status)
+		if !ok {
+			return DeliveryReport{}, fmt.Errorf("%s: unknown status %q", name, fields.Status)
+		}
+		report.Status = status
+		return report, nil
+	}
+}
+
+// normalizeStatus maps the status words used by aggregators onto DeliveryStatus.
+func normalizeStatus(s string) (DeliveryStatus, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "queued", "pending", "scheduled":
+		return StatusQueued, true
+	case "sent", "submitted", "accepted", "acceptd", "enroute", "buffered":
+		return StatusSent, true
+	case "delivered", "delivrd", "success", "read":
+		return StatusDelivered, true
+	case "failed", "undelivered", "undeliv", "rejected", "rejectd", "expired", "deleted":
+		return StatusFailed, true
+	}
+	return "", false
+}
@@ -0,0 +1,135 @@
+package messenger
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func formRequest(target string, form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestTwilioReceiptParser(t *testing.T) {
+	const callback = "https://api.example.com/api/v1/webhooks/sms/twilio?token=s3cret"
+	parse := TwilioReceiptParser("auth-token", callback)
+	form := url.Values{"MessageSid": {"SM123"}, "MessageStatus": {"undelivered"}, "ErrorCode": {"30003"}}
+
+	t.Run("ValidSignature", func(t *testing.T) {
+		r := formRequest(callback, form)
+		r.Header.Set("X-Twilio-Signature", twilioSignature("auth-token", callback, form))
+
+		report, err := parse(r)
+		require.NoError(t, err)
+		assert.Equal(t, "twilio", report.Provider)
+		assert.Equal(t, "SM123", report.MessageID)
+		assert.Equal(t, StatusFailed, report.Status)
+		assert.Equal(t, "30003", report.ErrorCode)
+	})
+
+	t.Run("ForgedSignature", func(t *testing.T) {
+		r := formRequest(callback, form)
+		r.Header.Set("X-Twilio-Signature", twilioSignature("wrong-token", callback, form))
+
+		_, err := parse(r)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+}
+
+func TestTwilioSignature_KnownVector(t *testing.T) {
+	// Example from Twilio's request validation documentation
+	params := url.Values{
+		"CallSid": {"CA1234567890ABCDE"},
+		"Caller":  {"+12349013030"},
+		"Digits":  {"1234"},
+		"From":    {"+12349013030"},
+		"To":      {"+18005551212"},
+	}
+	got := twilioSignature("12345", "https://mycompany.com/myapp.php?foo=1&bar=2", params)
+	assert.Equal(t, "0/KCTR6DLpKmkAf8muzZqo1nDgQ=", got)
+}
+
+func TestAfricasTalkingReceiptParser(t *testing.T) {
+	parse := AfricasTalkingReceiptParser()
+
+	report, err := parse(formRequest("/", url.Values{"id": {"ATXid_1"}, "status": {"Success"}}))
+	require.NoError(t, err)
+	assert.Equal(t, StatusDelivered, report.Status)
+	assert.Equal(t, "ATXid_1", report.MessageID)
+
+	report, err = parse(formRequest("/", url.Values{"id": {"ATXid_2"}, "status": {"Rejected"}, "failureReason": {"InvalidPhoneNumber"}}))
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, report.Status)
+	assert.Equal(t, "InvalidPhoneNumber", report.ErrorCode)
+
+	_, err = parse(formRequest("/", url.Values{"id": {"ATXid_3"}, "status": {"Weird"}}))
+	assert.Error(t, err)
+}
+
+func TestGatewayReceiptParser(t *testing.T) {
+	parse := GatewayReceiptParser("ethiosms")
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"message_id":"m-1","status":"DELIVRD"}`))
+	r.Header.Set("Content-Type", "application/json")
+	report, err := parse(r)
+	require.NoError(t, err)
+	assert.Equal(t, "ethiosms", report.Provider)
+	assert.Equal(t, "m-1", report.MessageID)
+	assert.Equal(t, StatusDelivered, report.Status)
+
+	report, err = parse(formRequest("/", url.Values{"id": {"m-2"}, "status": {"undeliv"}, "error_code": {"001"}}))
+	require.NoError(t, err)
+	assert.Equal(t, "m-2", report.MessageID)
+	assert.Equal(t, StatusFailed, report.Status)
+}
+
+func TestReceiptParsers(t *testing.T) {
+	cfg := Config{
+		Providers: []string{DriverTwilio, DriverAfricasTalking, DriverGateway, DriverSMPP},
+		Gateway:   GatewayConfig{Name: "ethiosms"},
+	}
+	parsers := ReceiptParsers(cfg, "s3cret")
+	// Twilio needs its callback URL for signature checks; SMPP receipts come over the bind
+	assert.Len(t, parsers, 2)
+	assert.Contains(t, parsers, "africastalking")
+	assert.Contains(t, parsers, "ethiosms")
+
+	// Unsigned callbacks are refused outright without a shared token
+	assert.Empty(t, ReceiptParsers(cfg, ""))
+	cfg.Twilio = TwilioConfig{AuthToken: "auth-token", StatusCallbackURL: "https://api.example.com/api/v1/webhooks/sms/twilio"}
+	assert.Equal(t, []string{"twilio"}, slices.Collect(maps.Keys(ReceiptParsers(cfg, ""))))
+}
+
+func TestReceiptParsers_RoutedGatewayMatchesSendReceipt(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"m-7"}`))
+	}))
+	defer srv.Close()
+	cfg := Config{
+		Providers: []string{DriverGateway},
+		Gateway:   GatewayConfig{Name: "ethiosms", URL: srv.URL, MessageIDField: "id"},
+	}
+	p, err := New(cfg)
+	require.NoError(t, err)
+
+	receipt, err := p.Send(context.Background(), Message{To: "+251911223344", Body: "hi"})
+	require.NoError(t, err)
+
+	// The receipt webhook must report the same provider the message was recorded under
+	parse, ok := ReceiptParsers(cfg, "s3cret")[receipt.Provider]
+	require.True(t, ok, "no receipt parser for %q", receipt.Provider)
+	report, err := parse(formRequest("/", url.Values{"id": {"m-7"}, "status": {"DELIVRD"}}))
+	require.NoError(t, err)
+	assert.Equal(t, receipt.Provider, report.Provider)
+	assert.Equal(t, receipt.MessageID, report.MessageID)
+}
@@ -0,0 +1,161 @@
+// Package otp holds the one-time-password policy shared by sending, verification,
+// request validation and the SMS text.
+package otp
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yabeye/addis_verify_backend/pkg/random"
+)
+
+// Policy describes how OTP codes are generated and how often they may be resent.
+type Policy struct {
+	// Length is the number of characters in a code.
+	Length int
+	// Alphabet is the set of characters codes are drawn from.
+	Alphabet string
+	// TTL is how long a code stays valid after it is sent.
+	TTL time.Duration
+	// ResendCooldowns is the wait imposed after the 1st, 2nd, 3rd ... send.
+	// The last entry is reused until DailyCap is reached.
+	ResendCooldowns []time.Duration
+	// DailyCap is the number of codes a phone may receive in a rolling 24h window.
+	DailyCap int
+	// Channels lists the delivery channels clients may pick (sms, voice, whatsapp, telegram).
+	// Empty means SMS only.
+	Channels []string
+	// Fallbacks let a client switch channel early when a code has not been delivered.
+	Fallbacks []Fallback
+}
+
+// Fallback offers To when a code sent over From is still undelivered After it was sent.
+// Such a resend skips the regular cooldown (the daily cap still applies).
+type Fallback struct {
+	From  string
+	To    string
+	After time.Duration
+}
+
+// DailyWindow is the rolling window DailyCap applies to.
+const DailyWindow = 24 * time.Hour
+
+// DefaultPolicy returns the policy used when nothing is configured:
+// 6 digits, valid for 5 minutes, cooldowns of 60s, 2m and 5m, capped at 5 codes a day.
+func DefaultPolicy() Policy {
+	return Policy{
+		Length:          6,
+		Alphabet:        random.DigitAlphabet,
+		TTL:             5 * time.Minute,
+		ResendCooldowns: []time.Duration{time.Minute, 2 * time.Minute, 5 * time.Minute},
+		DailyCap:        5,
+		Channels:        []string{"sms"},
+	}
+}
+
+// Validate checks the policy is usable, so a bad config fails at startup rather than per request.
+func (p Policy) Validate() error {
+	switch {
+	case p.Length < 4 || p.Length > 12:
+		return errors.New("otp: length must be between 4 and 12")
+	case len(p.Alphabet) < 2:
+		return errors.New("otp: alphabet must contain at least 2 characters")
+	case p.TTL <= 0:
+		return errors.New("otp: ttl must be positive")
+	case len(p.ResendCooldowns) == 0:
+		return errors.New("otp: at least one resend cooldown is required")
+	case p.DailyCap < 1:
+		return errors.New("otp: daily cap must be at least 1")
+	}
+	for _, d := range p.ResendCooldowns {
+		if d <= 0 {
+			return errors.New("otp: resend cooldowns must be positive")
+		}
+	}
+	for _, f := range p.Fallbacks {
+		switch {
+		case !p.AllowsChannel(f.From) || !p.AllowsChannel(f.To):
+			return fmt.Errorf("otp: fallback %s->%s uses a disabled channel", f.From, f.To)
+		case f.From == f.To:
+			return fmt.Errorf("otp: fallback from %s to itself", f.From)
+		case f.After <= 0:
+			return fmt.Errorf("otp: fallback %s->%s needs a positive delay", f.From, f.To)
+		}
+	}
+	return nil
+}
+
+// Generate produces a new code according to the policy.
+func (p Policy) Generate() (string, error) {
+	return random.GenerateOTP(p.Length, p.Alphabet)
+}
+
+// Valid reports whether code has the right shape to have been produced by this policy.
+func (p Policy) Valid(code string) bool {
+	if len(code) != p.Length {
+		return false
+	}
+	for _, c := range code {
+		if !strings.ContainsRune(p.Alphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// ResendCooldown returns the wait before another code may be requested,
+// given how many codes have been sent in the current window (including this one).
+// Once the daily cap is reached it returns ok=false: the caller must wait for the window to reset.
+func (p Policy) ResendCooldown(sends int) (time.Duration, bool) {
+	if sends >= p.DailyCap {
+		return 0, false
+	}
+	if sends < 1 {
+		sends = 1
+	}
+	idx := min(sends, len(p.ResendCooldowns)) - 1
+	return p.ResendCooldowns[idx], true
+}
+
+// AllowsChannel reports whether clients may request delivery over channel.
+func (p Policy) AllowsChannel(channel string) bool {
+	if len(p.Channels) == 0 {
+		return channel == "sms"
+	}
+	return slices.Contains(p.Channels, channel)
+}
+
+// FallbackFor returns the fallback configured for codes sent over channel.
+func (p Policy) FallbackFor(channel string) (Fallback, bool) {
+	for _, f := range p.Fallbacks {
+		if f.From == channel {
+			return f, true
+		}
+	}
+	return Fallback{}, false
+}
+
+// ParseFallbacks parses "from=to:after" entries separated by commas, e.g. "sms=voice:30s".
+func ParseFallbacks(s string) ([]Fallback, error) {
+	var fallbacks []Fallback
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		from, rest, ok := strings.Cut(entry, "=")
+		to, after, ok2 := strings.Cut(rest, ":")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("otp: malformed fallback %q", entry)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(after))
+		if err != nil {
+			return nil, fmt.Errorf("otp: fallback %q: %w", entry, err)
+		}
+		fallbacks = append(fallbacks, Fallback{From: strings.TrimSpace(from), To: strings.TrimSpace(to), After: d})
+	}
+	return fallbacks, nil
+}
@@ -0,0 +1,75 @@
+package otp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Generate(t *testing.T) {
+	p := Policy{Length: 8, Alphabet: "ABC123", TTL: time.Minute, ResendCooldowns: []time.Duration{time.Minute}, DailyCap: 1}
+	assert.NoError(t, p.Validate())
+
+	code, err := p.Generate()
+	assert.NoError(t, err)
+	assert.Len(t, code, 8)
+	assert.True(t, p.Valid(code))
+	assert.False(t, p.Valid("ABC12"))
+	assert.False(t, p.Valid("ABC1234Z"))
+}
+
+func TestPolicy_ResendCooldown(t *testing.T) {
+	p := DefaultPolicy()
+
+	cases := []struct {
+		sends int
+		want  time.Duration
+		ok    bool
+	}{
+		{1, time.Minute, true},
+		{2, 2 * time.Minute, true},
+		{3, 5 * time.Minute, true},
+		{4, 5 * time.Minute, true},
+		{5, 0, false},
+	}
+	for _, c := range cases {
+		got, ok := p.ResendCooldown(c.sends)
+		assert.Equal(t, c.want, got, "sends=%d", c.sends)
+		assert.Equal(t, c.ok, ok, "sends=%d", c.sends)
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	p := DefaultPolicy()
+	p.Length = 2
+	assert.Error(t, p.Validate())
+
+	p = DefaultPolicy()
+	p.ResendCooldowns = nil
+	assert.Error(t, p.Validate())
+}
+
+func TestParseFallbacks(t *testing.T) {
+	fallbacks, err := ParseFallbacks("sms=voice:30s, whatsapp=sms:1m")
+	assert.NoError(t, err)
+	assert.Equal(t, []Fallback{
+		{From: "sms", To: "voice", After: 30 * time.Second},
+		{From: "whatsapp", To: "sms", After: time.Minute},
+	}, fallbacks)
+
+	_, err = ParseFallbacks("sms=voice")
+	assert.Error(t, err)
+
+	p := DefaultPolicy()
+	p.Fallbacks = fallbacks
+	assert.Error(t, p.Validate(), "voice and whatsapp are not enabled")
+
+	p.Channels = []string{"sms", "voice", "whatsapp"}
+	assert.NoError(t, p.Validate())
+	f, ok := p.FallbackFor("sms")
+	assert.True(t, ok)
+	assert.Equal(t, "voice", f.To)
+	_, ok = p.FallbackFor("voice")
+	assert.False(t, ok)
+}
@@ -0,0 +1,121 @@
+// Package phone turns the ways Ethiopians write mobile numbers into canonical
+// E.164 and tells which operator a number belongs to.
+//
+// Accepted inputs include 0911223344, 911223344, 251911223344, +251911223344,
+// 00251911223344 and any of those with spaces, dashes, dots or brackets,
+// e.g. "+251 (0) 91-122-3344".
+package phone
+
+import (
+	"errors"
+	"strings"
+)
+
+// CountryCode is Ethiopia's calling code.
+const CountryCode = "251"
+
+// Operator is the mobile network a number was allocated to.
+type Operator string
+
+const (
+	EthioTelecom Operator = "ethio_telecom"
+	Safaricom    Operator = "safaricom"
+)
+
+// nsnLength is the length of an Ethiopian national significant number (no trunk 0).
+const nsnLength = 9
+
+var (
+	// ErrInvalid is returned for input that is not a well-formed Ethiopian number.
+	ErrInvalid = errors.New("phone: invalid number")
+	// ErrNotMobile is returned for landlines and unallocated ranges, which cannot receive SMS.
+	ErrNotMobile = errors.New("phone: not a mobile number")
+)
+
+// Number is a validated Ethiopian mobile number.
+type Number struct {
+	// E164 is the canonical form, e.g. +251911223344.
+	E164     string
+	Operator Operator
+}
+
+func (n Number) String() string { return n.E164 }
+
+// Parse normalizes raw into a Number.
+func Parse(raw string) (Number, error) {
+	digits, international, ok := clean(raw)
+	if !ok {
+		return Number{}, ErrInvalid
+	}
+
+	nsn := digits
+	switch {
+	case international:
+		// Only Ethiopian numbers are served; "+251 0911..." is a common mix-up, so drop the trunk 0
+		rest, found := strings.CutPrefix(digits, CountryCode)
+		if !found {
+			return Number{}, ErrInvalid
+		}
+		nsn = strings.TrimPrefix(rest, "0")
+	case len(digits) == nsnLength+len(CountryCode) && strings.HasPrefix(digits, CountryCode):
+		nsn = digits[len(CountryCode):]
+	case len(digits) == nsnLength+1 && digits[0] == '0':
+		nsn = digits[1:]
+	}
+	if len(nsn) != nsnLength {
+		return Number{}, ErrInvalid
+	}
+
+	op, ok := operatorOf(nsn)
+	if !ok {
+		return Number{}, ErrNotMobile
+	}
+	return Number{E164: "+" + CountryCode + nsn, Operator: op}, nil
+}
+
+// Normalize is Parse for callers that only need the E.164 string.
+func Normalize(raw string) (string, error) {
+	n, err := Parse(raw)
+	return n.E164, err
+}
+
+// clean strips separators and the international prefix (+ or 00). It fails on
+// letters or a + anywhere but the start.
+func clean(raw string) (digits string, international bool, ok bool) {
+	raw = strings.TrimSpace(raw)
+	if rest, found := strings.CutPrefix(raw, "+"); found {
+		raw, international = rest, true
+	}
+	// "(+251)" style: the + sits after the bracket
+	if rest, found := strings.CutPrefix(raw, "(+"); found {
+		raw, international = "("+rest, true
+	}
+
+	var b strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", false, false
+		}
+	}
+	digits = b.String()
+	if rest, found := strings.CutPrefix(digits, "00"); found && !international {
+		digits, international = rest, true
+	}
+	return digits, international, digits != ""
+}
+
+// operatorOf maps the leading digits of a national number to its operator:
+// 9x is Ethio Telecom and 7x is Safaricom. Landlines start with 1-5 (Addis Ababa is 11).
+func operatorOf(nsn string) (Operator, bool) {
+	switch {
+	case nsn[0] == '9' && nsn[1] != '0':
+		return EthioTelecom, true
+	case nsn[0] == '7':
+		return Safaricom, true
+	}
+	return "", false
+}
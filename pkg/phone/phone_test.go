@@ -0,0 +1,54 @@
+package phone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	valid := []struct {
+		in   string
+		want string
+		op   Operator
+	}{
+		{"+251911223344", "+251911223344", EthioTelecom},
+		{"0911223344", "+251911223344", EthioTelecom},
+		{"911223344", "+251911223344", EthioTelecom},
+		{"251911223344", "+251911223344", EthioTelecom},
+		{"00251911223344", "+251911223344", EthioTelecom},
+		{"+251 91 122 3344", "+251911223344", EthioTelecom},
+		{" 091-122-3344 ", "+251911223344", EthioTelecom},
+		{"+251 (0) 91 122 3344", "+251911223344", EthioTelecom},
+		{"(+251) 911.22.33.44", "+251911223344", EthioTelecom},
+		{"0712345678", "+251712345678", Safaricom},
+		{"+251700000001", "+251700000001", Safaricom},
+	}
+	for _, c := range valid {
+		n, err := Parse(c.in)
+		if assert.NoError(t, err, c.in) {
+			assert.Equal(t, c.want, n.E164, c.in)
+			assert.Equal(t, c.op, n.Operator, c.in)
+		}
+	}
+
+	invalid := []struct {
+		in   string
+		want error
+	}{
+		{"", ErrInvalid},
+		{"+1 415 555 2671", ErrInvalid},
+		{"09112233", ErrInvalid},
+		{"09112233445", ErrInvalid},
+		{"0911abc344", ErrInvalid},
+		{"+251+911223344", ErrInvalid},
+		{"0111234567", ErrNotMobile}, // Addis Ababa landline
+		{"+251461234567", ErrNotMobile},
+		{"0901234567", ErrNotMobile},
+		{"0812345678", ErrNotMobile},
+	}
+	for _, c := range invalid {
+		_, err := Parse(c.in)
+		assert.ErrorIs(t, err, c.want, c.in)
+	}
+}
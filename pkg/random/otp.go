@@ -2,19 +2,27 @@ package random
 
 import (
 	"crypto/rand"
+	"errors"
 	"math/big"
 )
 
-// GenerateOTP produces a secure 6-digit numeric string
-func GenerateOTP() (string, error) {
-	const digits = "0123456789"
-	otp := make([]byte, 6)
+// DigitAlphabet is the default OTP alphabet.
+const DigitAlphabet = "0123456789"
+
+// GenerateOTP produces a cryptographically secure code of the given length
+// drawn uniformly from alphabet.
+func GenerateOTP(length int, alphabet string) (string, error) {
+	if length <= 0 || len(alphabet) < 2 {
+		return "", errors.New("random: invalid otp length or alphabet")
+	}
+	otp := make([]byte, length)
+	max := big.NewInt(int64(len(alphabet)))
 	for i := range otp {
-		num, err := rand.Int(rand.Reader, big.NewInt(int64(len(digits))))
+		num, err := rand.Int(rand.Reader, max)
 		if err != nil {
 			return "", err
 		}
-		otp[i] = digits[num.Int64()]
+		otp[i] = alphabet[num.Int64()]
 	}
 	return string(otp), nil
 }
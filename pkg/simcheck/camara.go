@@ -0,0 +1,116 @@
+package simcheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultTimeout is short because a check sits in front of every login.
+	defaultTimeout = 5 * time.Second
+	// maxResponseBody caps how much of an operator response we read.
+	maxResponseBody = 64 * 1024
+
+	camaraSwapPath      = "/sim-swap/v0/retrieve-date"
+	camaraRecyclingPath = "/number-recycling/v0.1/check"
+)
+
+// CAMARAConfig configures the adapter for operators exposing the GSMA CAMARA
+// SIM Swap and Number Recycling APIs.
+type CAMARAConfig struct {
+	// BaseURL is the API root both paths hang off.
+	BaseURL string
+	// Token is sent as a bearer token on every call.
+	Token   string
+	Timeout time.Duration
+}
+
+type camaraProvider struct {
+	cfg    CAMARAConfig
+	client *http.Client
+}
+
+// NewCAMARAProvider creates a provider backed by CAMARA APIs.
+func NewCAMARAProvider(cfg CAMARAConfig) (Provider, error) {
+	if cfg.BaseURL == "" || cfg.Token == "" {
+		return nil, errors.New("camara: base url and token are required")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &camaraProvider{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}, nil
+}
+
+func (p *camaraProvider) LastSwap(ctx context.Context, phone string) (time.Time, error) {
+	var resp struct {
+		// LatestSimChange is null when the SIM was never swapped
+		LatestSimChange *time.Time `json:"latestSimChange"`
+	}
+	if err := p.post(ctx, camaraSwapPath, map[string]string{"phoneNumber": phone}, &resp); err != nil {
+		return time.Time{}, err
+	}
+	if resp.LatestSimChange == nil {
+		return time.Time{}, nil
+	}
+	return *resp.LatestSimChange, nil
+}
+
+func (p *camaraProvider) Recycled(ctx context.Context, phone string, since time.Time) (bool, error) {
+	var resp struct {
+		PhoneNumberRecycled bool `json:"phoneNumberRecycled"`
+	}
+	err := p.post(ctx, camaraRecyclingPath, map[string]string{
+		"phoneNumber":   phone,
+		"specifiedDate": since.UTC().Format(time.DateOnly),
+	}, &resp)
+	return resp.PhoneNumberRecycled, err
+}
+
+// post sends payload to path and decodes a 200 answer into out.
+func (p *camaraProvider) post(ctx context.Context, path string, payload, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("camara: %w", err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return fmt.Errorf("camara: read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// CAMARA errors carry {"status", "code", "message"}
+		var apiErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(raw, &apiErr) == nil && apiErr.Code != "" {
+			return fmt.Errorf("camara: %s answered %d %s: %s", path, resp.StatusCode, apiErr.Code, apiErr.Message)
+		}
+		return fmt.Errorf("camara: %s answered %d", path, resp.StatusCode)
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("camara: decode response: %w", err)
+	}
+	return nil
+}
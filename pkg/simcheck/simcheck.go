@@ -0,0 +1,114 @@
+// Package simcheck asks the mobile operator whether a number changed hands: its SIM
+// was swapped, or the number was recycled to a new subscriber after lying dormant.
+//
+// An OTP only proves who holds the SIM today. Before that person is signed in to an
+// existing account, a Checker compares what the operator knows with when the
+// account's holder last proved they own the number.
+package simcheck
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Supported values for Config.Driver.
+const (
+	DriverNone   = "none"
+	DriverCAMARA = "camara"
+)
+
+// Hold reasons reported in a Verdict.
+const (
+	ReasonSIMSwap  = "sim_swap"
+	ReasonRecycled = "number_recycled"
+)
+
+// DefaultSwapWindow is how long after a SIM swap logins are held by default.
+const DefaultSwapWindow = 72 * time.Hour
+
+// Provider is an operator API that knows a number's history.
+type Provider interface {
+	// LastSwap returns when the SIM behind phone was last replaced, or the zero time
+	// when it never was.
+	LastSwap(ctx context.Context, phone string) (time.Time, error)
+	// Recycled reports whether phone was assigned to a new subscriber after since.
+	Recycled(ctx context.Context, phone string, since time.Time) (bool, error)
+}
+
+// Config selects the operator API and how recent a swap must be to matter.
+type Config struct {
+	Driver string
+	CAMARA CAMARAConfig
+	// SwapWindow holds logins for this long after a SIM swap. Defaults to 72h.
+	SwapWindow time.Duration
+}
+
+// Verdict is the outcome of a Check.
+type Verdict struct {
+	// Hold asks the caller to stop the login until the user proves they own the account.
+	Hold bool
+	// Reason is one of the Reason constants when Hold is set.
+	Reason string
+}
+
+// Checker turns what the operator knows into a Verdict.
+type Checker struct {
+	provider Provider
+	window   time.Duration
+	now      func() time.Time
+}
+
+// New builds the checker selected by cfg.Driver. With no driver every number passes.
+func New(cfg Config) (*Checker, error) {
+	var p Provider
+	switch cfg.Driver {
+	case "", DriverNone:
+	case DriverCAMARA:
+		var err error
+		if p, err = NewCAMARAProvider(cfg.CAMARA); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("simcheck: unknown driver %q", cfg.Driver)
+	}
+	return NewChecker(p, cfg.SwapWindow), nil
+}
+
+// NewChecker wraps provider. A nil provider disables the checks.
+func NewChecker(provider Provider, swapWindow time.Duration) *Checker {
+	if swapWindow <= 0 {
+		swapWindow = DefaultSwapWindow
+	}
+	return &Checker{provider: provider, window: swapWindow, now: time.Now}
+}
+
+// Enabled reports whether an operator API is configured.
+func (c *Checker) Enabled() bool {
+	return c.provider != nil
+}
+
+// Check holds a login on phone when the number was recycled after since, the time
+// the account's holder last proved they own it, or its SIM was swapped after since
+// and within the swap window.
+func (c *Checker) Check(ctx context.Context, phone string, since time.Time) (Verdict, error) {
+	if c.provider == nil {
+		return Verdict{}, nil
+	}
+	recycled, err := c.provider.Recycled(ctx, phone, since)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("simcheck: number recycling: %w", err)
+	}
+	if recycled {
+		return Verdict{Hold: true, Reason: ReasonRecycled}, nil
+	}
+
+	swapped, err := c.provider.LastSwap(ctx, phone)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("simcheck: sim swap: %w", err)
+	}
+	if swapped.After(since) && c.now().Sub(swapped) < c.window {
+		return Verdict{Hold: true, Reason: ReasonSIMSwap}, nil
+	}
+	return Verdict{}, nil
+}
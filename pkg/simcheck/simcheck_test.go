@@ -0,0 +1,106 @@
+package simcheck
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yabeye/addis_verify_backend/pkg/simcheck/simchecktest"
+)
+
+func TestChecker_CAMARA(t *testing.T) {
+	phone := "+251911223344"
+	bound := time.Now().Add(-30 * 24 * time.Hour)
+
+	setup := func(t *testing.T) (*Checker, *simchecktest.Server) {
+		srv := simchecktest.NewServer(t)
+		c, err := New(Config{Driver: DriverCAMARA, CAMARA: CAMARAConfig{BaseURL: srv.URL, Token: simchecktest.Token}})
+		require.NoError(t, err)
+		return c, srv
+	}
+
+	t.Run("A number with a clean history passes", func(t *testing.T) {
+		c, srv := setup(t)
+
+		v, err := c.Check(context.Background(), phone, bound)
+		require.NoError(t, err)
+		assert.False(t, v.Hold)
+		assert.Equal(t, 2, srv.Calls())
+	})
+
+	t.Run("Holds a recent swap", func(t *testing.T) {
+		c, srv := setup(t)
+		srv.Swap(phone, time.Now().Add(-time.Hour))
+
+		v, err := c.Check(context.Background(), phone, bound)
+		require.NoError(t, err)
+		assert.Equal(t, Verdict{Hold: true, Reason: ReasonSIMSwap}, v)
+	})
+
+	t.Run("Lets an old swap through", func(t *testing.T) {
+		c, srv := setup(t)
+		srv.Swap(phone, time.Now().Add(-DefaultSwapWindow-time.Hour))
+
+		v, err := c.Check(context.Background(), phone, bound)
+		require.NoError(t, err)
+		assert.False(t, v.Hold)
+	})
+
+	t.Run("A swap the holder already proved ownership after is settled", func(t *testing.T) {
+		c, srv := setup(t)
+		srv.Swap(phone, time.Now().Add(-2*time.Hour))
+
+		v, err := c.Check(context.Background(), phone, time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.False(t, v.Hold)
+	})
+
+	t.Run("Holds a number recycled since it was bound", func(t *testing.T) {
+		c, srv := setup(t)
+		srv.Recycle(phone, time.Now().Add(-7*24*time.Hour))
+
+		v, err := c.Check(context.Background(), phone, bound)
+		require.NoError(t, err)
+		assert.Equal(t, Verdict{Hold: true, Reason: ReasonRecycled}, v)
+
+		// Recycled before the account was bound to it is someone else's history
+		v, err = c.Check(context.Background(), phone, time.Now())
+		require.NoError(t, err)
+		assert.False(t, v.Hold)
+	})
+
+	t.Run("Surfaces operator failures", func(t *testing.T) {
+		c, srv := setup(t)
+		srv.Fail(http.StatusServiceUnavailable)
+
+		_, err := c.Check(context.Background(), phone, bound)
+		assert.ErrorContains(t, err, "503 UNAVAILABLE")
+	})
+
+	t.Run("Rejects a wrong token", func(t *testing.T) {
+		srv := simchecktest.NewServer(t)
+		c, err := New(Config{Driver: DriverCAMARA, CAMARA: CAMARAConfig{BaseURL: srv.URL, Token: "nope"}})
+		require.NoError(t, err)
+
+		_, err = c.Check(context.Background(), phone, bound)
+		assert.ErrorContains(t, err, "401")
+	})
+}
+
+func TestNew(t *testing.T) {
+	c, err := New(Config{})
+	require.NoError(t, err)
+	assert.False(t, c.Enabled())
+	v, err := c.Check(context.Background(), "+251911223344", time.Now())
+	require.NoError(t, err)
+	assert.False(t, v.Hold)
+
+	_, err = New(Config{Driver: DriverCAMARA})
+	assert.Error(t, err)
+	_, err = New(Config{Driver: "carrier-pigeon"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,147 @@
+// Package simchecktest runs an in-memory operator API speaking the CAMARA SIM Swap
+// and Number Recycling endpoints, for tests that exercise simcheck end to end.
+package simchecktest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Token is the bearer token the server accepts.
+const Token = "simchecktest-token"
+
+// Server is an operator API whose number history tests script with Swap and Recycle.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	swaps    map[string]time.Time
+	recycled map[string]time.Time
+	status   int
+	calls    int
+}
+
+// NewServer starts a server that is closed when t finishes. Every number starts
+// with a clean history.
+func NewServer(t testing.TB) *Server {
+	s := &Server{swaps: map[string]time.Time{}, recycled: map[string]time.Time{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sim-swap/v0/retrieve-date", s.retrieveDate)
+	mux.HandleFunc("POST /number-recycling/v0.1/check", s.checkRecycled)
+	s.Server = httptest.NewServer(s.guard(mux))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Swap records that phone's SIM was replaced at at.
+func (s *Server) Swap(phone string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.swaps[phone] = at
+}
+
+// Recycle records that phone was handed to a new subscriber at at.
+func (s *Server) Recycle(phone string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recycled[phone] = at
+}
+
+// Fail makes every later call answer status, as an operator outage would.
+// Zero goes back to answering normally.
+func (s *Server) Fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// Calls counts the requests that reached the server.
+func (s *Server) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func (s *Server) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.calls++
+		status := s.status
+		s.mu.Unlock()
+
+		switch {
+		case r.Header.Get("Authorization") != "Bearer "+Token:
+			writeError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "Authorization failed")
+		case status != 0:
+			writeError(w, status, "UNAVAILABLE", "Service unavailable")
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func (s *Server) retrieveDate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PhoneNumber string `json:"phoneNumber"`
+	}
+	if !decode(w, r, &req, &req.PhoneNumber) {
+		return
+	}
+	s.mu.Lock()
+	at, ok := s.swaps[req.PhoneNumber]
+	s.mu.Unlock()
+
+	resp := map[string]any{"latestSimChange": nil}
+	if ok {
+		resp["latestSimChange"] = at.UTC().Format(time.RFC3339)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) checkRecycled(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PhoneNumber   string `json:"phoneNumber"`
+		SpecifiedDate string `json:"specifiedDate"`
+	}
+	if !decode(w, r, &req, &req.PhoneNumber) {
+		return
+	}
+	since, err := time.Parse(time.DateOnly, req.SpecifiedDate)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "specifiedDate must be YYYY-MM-DD")
+		return
+	}
+	s.mu.Lock()
+	at, ok := s.recycled[req.PhoneNumber]
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]bool{"phoneNumberRecycled": ok && !at.Before(since)})
+}
+
+// decode reads the body into v, which names the number it asks about.
+func decode(w http.ResponseWriter, r *http.Request, v any, phone *string) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Malformed body")
+		return false
+	}
+	if !strings.HasPrefix(*phone, "+") {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "phoneNumber must be E.164")
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]any{"status": status, "code": code, "message": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,164 @@
+// Package templates renders localized SMS and notification text.
+//
+// Templates are Go text/template files laid out as <lang>/<name>.txt. A default
+// set for English, Amharic, Afaan Oromo and Tigrinya is compiled in; Load can
+// overlay a directory with the same layout so wording changes ship without a rebuild.
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"golang.org/x/text/language"
+)
+
+// Template names.
+const (
+	OTP = "otp"
+	// OTPVoice is read out by text-to-speech on voice calls.
+	OTPVoice = "otp_voice"
+	// PhoneChanged warns the previous number that the account moved away from it.
+	PhoneChanged = "phone_changed"
+)
+
+// Built-in languages (ISO 639-1). English is the fallback.
+const (
+	English    = "en"
+	Amharic    = "am"
+	AfaanOromo = "om"
+	Tigrinya   = "ti"
+)
+
+//go:embed defaults
+var defaults embed.FS
+
+// OTPData is passed to the OTP template.
+type OTPData struct {
+	Code    string
+	Minutes int
+	// Spoken is the code spelled out for text-to-speech (see SpellOut).
+	Spoken string
+}
+
+// PhoneChangedData is passed to the PhoneChanged template.
+type PhoneChangedData struct {
+	// Ending is the last digits of the new number; the rest stays private.
+	Ending string
+}
+
+// SpellOut separates the characters of code so speech engines read them one by one
+// ("4, 8, 2, 9, 1, 3") instead of as a number.
+func SpellOut(code string) string {
+	return strings.Join(strings.Split(code, ""), ", ")
+}
+
+// ErrUnknownTemplate is returned by Render for a name that has no template in any language.
+var ErrUnknownTemplate = errors.New("templates: unknown template")
+
+// Set holds parsed templates per language.
+type Set struct {
+	byLang  map[string]map[string]*template.Template
+	matcher language.Matcher
+}
+
+// Load parses the built-in templates and, when dir is not empty, overlays any
+// <lang>/<name>.txt files found there. New languages can be added the same way.
+func Load(dir string) (*Set, error) {
+	s := &Set{byLang: map[string]map[string]*template.Template{}}
+
+	sub, err := fs.Sub(defaults, "defaults")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.parseFS(sub); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := s.parseFS(os.DirFS(dir)); err != nil {
+			return nil, fmt.Errorf("templates: %s: %w", dir, err)
+		}
+	}
+
+	// English stays first so it is what the matcher falls back to
+	tags := make([]language.Tag, 0, len(s.byLang))
+	tags = append(tags, language.Make(English))
+	for lang := range s.byLang {
+		if lang != English {
+			tags = append(tags, language.Make(lang))
+		}
+	}
+	s.matcher = language.NewMatcher(tags)
+	return s, nil
+}
+
+func (s *Set) parseFS(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*/*.txt")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		raw, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		lang := path.Dir(file)
+		name := strings.TrimSuffix(path.Base(file), ".txt")
+
+		// SMS bodies are single line: drop the trailing newline editors add
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(strings.TrimRight(string(raw), "\r\n"))
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if s.byLang[lang] == nil {
+			s.byLang[lang] = map[string]*template.Template{}
+		}
+		s.byLang[lang][name] = tmpl
+	}
+	return nil
+}
+
+// Match picks the language to use: the account's preference when we have a
+// template set for it, otherwise the best match for the Accept-Language header,
+// otherwise English.
+func (s *Set) Match(preferred, acceptLanguage string) string {
+	if _, ok := s.byLang[preferred]; ok {
+		return preferred
+	}
+	tag, _ := language.MatchStrings(s.matcher, acceptLanguage)
+	base, _ := tag.Base()
+	if _, ok := s.byLang[base.String()]; ok {
+		return base.String()
+	}
+	return English
+}
+
+// Supported reports whether lang has a template set.
+func (s *Set) Supported(lang string) bool {
+	_, ok := s.byLang[lang]
+	return ok
+}
+
+// Render executes the named template in lang, falling back to English when
+// that language lacks the template.
+func (s *Set) Render(name, lang string, data any) (string, error) {
+	tmpl, ok := s.byLang[lang][name]
+	if !ok {
+		tmpl, ok = s.byLang[English][name]
+	}
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
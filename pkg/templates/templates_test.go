@@ -0,0 +1,91 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	s, err := Load("")
+	require.NoError(t, err)
+
+	assert.Equal(t, Amharic, s.Match("am", "en-US,en;q=0.9"), "account preference wins")
+	assert.Equal(t, Tigrinya, s.Match("", "ti-ET,en;q=0.5"))
+	assert.Equal(t, AfaanOromo, s.Match("", "fr;q=0.9,om;q=0.8"))
+	assert.Equal(t, English, s.Match("xx", "fr-FR"), "unsupported falls back to English")
+	assert.Equal(t, English, s.Match("", ""))
+}
+
+func TestRender_Defaults(t *testing.T) {
+	s, err := Load("")
+	require.NoError(t, err)
+
+	for _, lang := range []string{English, Amharic, AfaanOromo, Tigrinya} {
+		body, err := s.Render(OTP, lang, OTPData{Code: "482913", Minutes: 5})
+		require.NoError(t, err, lang)
+		assert.Contains(t, body, "482913", lang)
+	}
+
+	_, err = s.Render("nope", English, nil)
+	assert.ErrorIs(t, err, ErrUnknownTemplate)
+}
+
+func TestRender_PhoneChanged(t *testing.T) {
+	s, err := Load("")
+	require.NoError(t, err)
+
+	for _, lang := range []string{English, Amharic, AfaanOromo, Tigrinya} {
+		body, err := s.Render(PhoneChanged, lang, PhoneChangedData{Ending: "4455"})
+		require.NoError(t, err, lang)
+		assert.Contains(t, body, "4455", lang)
+	}
+}
+
+func TestLoad_DirectoryOverrides(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "en"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "so"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "en", "otp.txt"), []byte("Code: {{.Code}}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "so", "otp.txt"), []byte("Koodhkaagu waa {{.Code}}"), 0o644))
+
+	s, err := Load(dir)
+	require.NoError(t, err)
+
+	body, err := s.Render(OTP, English, OTPData{Code: "111111"})
+	require.NoError(t, err)
+	assert.Equal(t, "Code: 111111", body)
+
+	// New languages can be added from disk
+	assert.Equal(t, "so", s.Match("", "so-SO"))
+	body, err = s.Render(OTP, "so", OTPData{Code: "222222"})
+	require.NoError(t, err)
+	assert.Equal(t, "Koodhkaagu waa 222222", body)
+
+	// Untouched defaults survive the overlay
+	body, err = s.Render(OTP, Amharic, OTPData{Code: "333333", Minutes: 5})
+	require.NoError(t, err)
+	assert.Contains(t, body, "333333")
+}
+
+func TestLoad_BadTemplate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "en"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "en", "otp.txt"), []byte("{{.Code"), 0o644))
+
+	_, err := Load(dir)
+	assert.Error(t, err)
+}
+
+func TestRender_Voice(t *testing.T) {
+	s, err := Load("")
+	require.NoError(t, err)
+
+	// Voice is English only for now; other languages fall back to it
+	body, err := s.Render(OTPVoice, Amharic, OTPData{Code: "4829", Spoken: SpellOut("4829")})
+	require.NoError(t, err)
+	assert.Contains(t, body, "4, 8, 2, 9")
+}
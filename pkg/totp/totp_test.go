@@ -0,0 +1,88 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA1 key from the RFC 6238 appendix B test vectors.
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCode_RFC6238(t *testing.T) {
+	// The RFC lists 8-digit codes; ours are their last 6 digits
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range vectors {
+		assert.Equal(t, want, Code(rfcSecret, Step(time.Unix(unix, 0))), "t=%d", unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	got, ok := Validate(rfcSecret, "050471", now)
+	assert.True(t, ok)
+	assert.Equal(t, step, got)
+
+	// A code from the previous period is still accepted, and reports its own step
+	got, ok = Validate(rfcSecret, Code(rfcSecret, step-1), now)
+	assert.True(t, ok)
+	assert.Equal(t, step-1, got)
+
+	_, ok = Validate(rfcSecret, Code(rfcSecret, step-2), now)
+	assert.False(t, ok)
+	_, ok = Validate(rfcSecret, "050 471", now)
+	assert.True(t, ok)
+	_, ok = Validate(rfcSecret, "50471", now)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	secret, err := NewSecret()
+	require.NoError(t, err)
+	require.Len(t, secret, SecretSize)
+
+	u, err := url.Parse(URI("AddisVerify", "+251911223344", secret))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/AddisVerify:+251911223344", u.Path)
+	assert.Equal(t, Encode(secret), u.Query().Get("secret"))
+	assert.Equal(t, "AddisVerify", u.Query().Get("issuer"))
+	assert.Equal(t, "6", u.Query().Get("digits"))
+}
+
+func TestCipher(t *testing.T) {
+	c, err := NewCipher("test-key")
+	require.NoError(t, err)
+
+	sealed, err := c.Seal(rfcSecret, []byte("account-1"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), string(rfcSecret))
+
+	opened, err := c.Open(sealed, []byte("account-1"))
+	require.NoError(t, err)
+	assert.Equal(t, rfcSecret, opened)
+
+	// Bound to its owner and its key
+	_, err = c.Open(sealed, []byte("account-2"))
+	assert.Error(t, err)
+	other, err := NewCipher("other-key")
+	require.NoError(t, err)
+	_, err = other.Open(sealed, []byte("account-1"))
+	assert.Error(t, err)
+
+	_, err = NewCipher("")
+	assert.Error(t, err)
+}
@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TYPE message_status AS ENUM ('queued', 'sent', 'delivered', 'failed');
+
+-- One row per outbound SMS. The text itself is never stored: it carries the OTP.
+CREATE TABLE IF NOT EXISTS messages (
+    id UUID PRIMARY KEY,
+    phone VARCHAR(20) NOT NULL,
+    status message_status NOT NULL DEFAULT 'queued',
+    attempts INT NOT NULL DEFAULT 0,
+
+    -- Filled in once a provider accepts the message
+    provider VARCHAR(50),
+    provider_message_id VARCHAR(100),
+
+    -- Provider specific failure code (from a receipt) and our last send error
+    error_code VARCHAR(50),
+    last_error TEXT,
+
+    queued_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMPTZ,
+    delivered_at TIMESTAMPTZ,
+    failed_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_phone ON messages(phone, queued_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_provider_message_id
+    ON messages(provider, provider_message_id) WHERE provider_message_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS messages;
+DROP TYPE IF EXISTS message_status;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- ISO 639-1 code of the language SMS are sent in; NULL falls back to Accept-Language
+ALTER TABLE accounts ADD COLUMN preferred_language VARCHAR(8);
+
+-- What each SMS costs: GSM-7 or UCS-2, and how many parts it was split into
+ALTER TABLE messages ADD COLUMN encoding VARCHAR(8);
+ALTER TABLE messages ADD COLUMN segments INT NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE messages DROP COLUMN segments;
+ALTER TABLE messages DROP COLUMN encoding;
+ALTER TABLE accounts DROP COLUMN preferred_language;
+-- +goose StatementEnd
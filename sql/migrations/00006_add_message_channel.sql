@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- How the message travelled: sms, voice, whatsapp or telegram
+ALTER TABLE messages ADD COLUMN channel VARCHAR(16) NOT NULL DEFAULT 'sms';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE messages DROP COLUMN channel;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+-- One row per signed-in device. Tokens carry the session id, so each device can be
+-- signed out on its own instead of every login kicking out the previous one.
+CREATE TABLE IF NOT EXISTS sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+
+    -- What the client told us about itself at login
+    device_name VARCHAR(100),
+    user_agent VARCHAR(255),
+    ip_address VARCHAR(45),
+
+    -- Moved forward on every refresh: tokens issued before it are stale
+    token_valid_from TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_account_active ON sessions(account_id, last_seen_at DESC) WHERE revoked_at IS NULL;
+
+ALTER TABLE accounts DROP COLUMN token_valid_from;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE accounts ADD COLUMN token_valid_from TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+DROP TABLE IF EXISTS sessions;
+-- +goose StatementEnd
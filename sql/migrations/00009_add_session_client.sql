@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The client type picks token lifetimes and audience; amr is how the user logged in.
+-- Both are carried into every token the session's refreshes issue.
+ALTER TABLE sessions
+    ADD COLUMN client_type VARCHAR(16) NOT NULL DEFAULT 'mobile',
+    ADD COLUMN amr TEXT[] NOT NULL DEFAULT '{otp}';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions DROP COLUMN amr, DROP COLUMN client_type;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Third-party apps allowed to "Log in with AddisVerify" (OpenID Connect relying parties)
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    -- SHA-256 of the client secret; NULL for public clients (mobile and single-page
+    -- apps), which must use PKCE
+    secret_hash VARCHAR(64),
+    redirect_uris TEXT[] NOT NULL,
+    -- The most a user can be asked to share with this client
+    scopes TEXT[] NOT NULL,
+    logo_uri VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS oauth_clients;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- When the account moved to 'deleted'; the purge job erases it a grace period later
+ALTER TABLE accounts ADD COLUMN deleted_at TIMESTAMPTZ;
+-- Set only when the holder deleted the account themselves: until then, logging in
+-- again can bring it back
+ALTER TABLE accounts ADD COLUMN restore_until TIMESTAMPTZ;
+-- Set once personal data is gone and only an anonymized tombstone remains
+ALTER TABLE accounts ADD COLUMN purged_at TIMESTAMPTZ;
+
+-- Tombstones free the number for a new account with 'deleted:<id>'
+ALTER TABLE accounts ALTER COLUMN phone TYPE VARCHAR(50);
+
+CREATE INDEX IF NOT EXISTS idx_accounts_purge ON accounts(deleted_at) WHERE status = 'deleted' AND purged_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_accounts_purge;
+ALTER TABLE accounts ALTER COLUMN phone TYPE VARCHAR(20);
+ALTER TABLE accounts DROP COLUMN purged_at;
+ALTER TABLE accounts DROP COLUMN restore_until;
+ALTER TABLE accounts DROP COLUMN deleted_at;
+-- +goose StatementEnd
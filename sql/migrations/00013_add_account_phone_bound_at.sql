@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- When the holder last proved they own the account's number: at sign-up, on a
+-- phone change or recovery, and after confirming a SIM swap with a recovery code.
+-- An OTP alone only proves who holds the SIM today, so it doesn't move this.
+ALTER TABLE accounts ADD COLUMN phone_bound_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+UPDATE accounts SET phone_bound_at = created_at;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE accounts DROP COLUMN phone_bound_at;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Authenticator app (RFC 6238 TOTP) second factor. An account has at most one; it
+-- only guards logins once confirmed with a first code.
+CREATE TABLE IF NOT EXISTS account_totp (
+    account_id UUID PRIMARY KEY REFERENCES accounts(id) ON DELETE CASCADE,
+    -- AES-256-GCM sealed secret (nonce || ciphertext), bound to the account id
+    secret BYTEA NOT NULL,
+    confirmed_at TIMESTAMPTZ,
+    -- Time step of the last accepted code, so a code can't be replayed
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS account_totp;
+-- +goose StatementEnd
@@ -2,28 +2,177 @@
 
 -- name: UpsertAccount :one
 -- This is used ONLY during the VerifyOTP flow.
--- It moves the 'token_valid_from' forward to invalidate old sessions.
-INSERT INTO accounts (phone, token_valid_from)
-VALUES ($1, NOW())
+-- Sessions are separate rows, so logging in leaves other devices signed in.
+INSERT INTO accounts (phone)
+VALUES ($1)
 ON CONFLICT (phone) DO UPDATE 
 SET 
-    token_valid_from = EXCLUDED.token_valid_from,
     updated_at = CURRENT_TIMESTAMP
 RETURNING *;
 
 -- name: UpdateAccountStatus :exec
 -- This is for administrative or system changes. 
--- It does NOT touch token_valid_from, so the user stays logged in.
+-- It does NOT touch sessions, so the user stays logged in.
 UPDATE accounts 
 SET status = $2, updated_at = CURRENT_TIMESTAMP 
 WHERE id = $1;
 
+-- name: TransitionAccountStatus :execrows
+-- Moves an account along the status state machine. Zero rows means it was no
+-- longer in 'from_status' (someone else changed it first).
+-- Moving to 'deleted' starts the purge clock; no restore window is offered.
+UPDATE accounts
+SET status = sqlc.arg(to_status),
+    deleted_at = CASE WHEN sqlc.arg(to_status) = 'deleted' THEN NOW() END,
+    restore_until = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id) AND status = sqlc.arg(from_status);
+
 -- name: GetAccountByPhone :one
 SELECT * FROM accounts WHERE phone = $1 LIMIT 1;
 
 -- name: GetAccountByID :one
 SELECT * FROM accounts WHERE id = $1 LIMIT 1;
 
+-- name: DeleteAccount :execrows
+-- The holder deletes their own account; it can be restored until 'restore_until'.
+UPDATE accounts
+SET status = 'deleted', deleted_at = NOW(), restore_until = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND status = 'active';
+
+-- name: RestoreAccount :execrows
+-- Undoes a self-service deletion while the restore window is open.
+UPDATE accounts
+SET status = 'active', deleted_at = NULL, restore_until = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND status = 'deleted' AND restore_until > NOW();
+
+-- name: ListPurgeableAccounts :many
+-- Deleted accounts not purged yet that were deleted before the cutoff, oldest first.
+SELECT id FROM accounts
+WHERE status = 'deleted' AND purged_at IS NULL AND deleted_at < $1
+ORDER BY deleted_at
+LIMIT $2;
+
+-- name: PurgeAccount :execrows
+-- Erases everything that identifies the holder of a deleted account in one
+-- statement. The account row stays behind as an anonymized tombstone.
+WITH target AS (
+    SELECT id, phone FROM accounts
+    WHERE id = $1 AND status = 'deleted' AND purged_at IS NULL
+), deleted_users AS (
+    DELETE FROM users WHERE account_id IN (SELECT id FROM target)
+), deleted_address AS (
+    DELETE FROM address WHERE account_id IN (SELECT id FROM target)
+), deleted_sessions AS (
+    DELETE FROM sessions WHERE account_id IN (SELECT id FROM target)
+), deleted_messages AS (
+    DELETE FROM messages WHERE phone IN (SELECT phone FROM target)
+), deleted_recovery_codes AS (
+    DELETE FROM recovery_codes WHERE account_id IN (SELECT id FROM target)
+), deleted_totp AS (
+    DELETE FROM account_totp WHERE account_id IN (SELECT id FROM target)
+), anonymized_events AS (
+    UPDATE security_events SET ip_address = NULL, user_agent = NULL, session_id = NULL
+    WHERE account_id IN (SELECT id FROM target)
+)
+UPDATE accounts a
+SET phone = 'deleted:' || a.id::text, preferred_language = NULL,
+    restore_until = NULL, purged_at = NOW(), updated_at = CURRENT_TIMESTAMP
+FROM target
+WHERE a.id = target.id;
+
+-- name: GetAccountStatus :one
+-- Checked on every authenticated request, so it reads only the status.
+SELECT status FROM accounts WHERE id = $1;
+
+-- name: UpdateAccountLanguage :exec
+-- Sets the language OTP and notification SMS are sent in.
+UPDATE accounts
+SET preferred_language = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: ChangeAccountPhone :execrows
+-- Moves an active account to a new login phone. Zero rows means the account is no
+-- longer active or its phone changed since it was verified.
+UPDATE accounts
+SET phone = sqlc.arg(new_phone), phone_bound_at = NOW(), updated_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id) AND phone = sqlc.arg(old_phone) AND status = 'active';
+
+
+
+/***** SESSIONS *****/
+
+-- name: CreateSession :one
+-- Opens a session for a device after a successful OTP login.
+INSERT INTO sessions (account_id, device_name, user_agent, ip_address, client_type, amr)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetSession :one
+SELECT * FROM sessions WHERE id = $1 LIMIT 1;
+
+-- name: RotateSession :one
+-- Moves 'token_valid_from' forward on refresh so the spent refresh token stops working.
+UPDATE sessions
+SET token_valid_from = NOW(), last_seen_at = NOW(), ip_address = $2
+WHERE id = $1 AND revoked_at IS NULL
+RETURNING *;
+
+-- name: TouchSession :exec
+-- Records activity at most once a minute so authenticated requests rarely write.
+UPDATE sessions
+SET last_seen_at = NOW(), ip_address = $2
+WHERE id = $1 AND revoked_at IS NULL AND last_seen_at < NOW() - INTERVAL '1 minute';
+
+-- name: ListActiveSessions :many
+-- Sessions that can still refresh: without a live refresh token they are as good as gone.
+SELECT * FROM sessions s
+WHERE s.account_id = $1 AND s.revoked_at IS NULL
+  AND EXISTS (
+    SELECT 1 FROM refresh_tokens rt
+    WHERE rt.session_id = s.id AND rt.used_at IS NULL AND rt.expires_at > NOW()
+  )
+ORDER BY s.last_seen_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE id = $1 AND account_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllSessions :execrows
+-- Signs out every device, optionally keeping one (the caller's own).
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE account_id = $1 AND revoked_at IS NULL AND id IS DISTINCT FROM sqlc.narg('keep_id');
+
+-- name: ListSessionsByAccount :many
+-- Every session the account ever had, signed out or not, for data exports.
+SELECT * FROM sessions WHERE account_id = $1 ORDER BY created_at DESC;
+
+
+
+/***** REFRESH TOKENS *****/
+
+-- name: CreateRefreshToken :exec
+-- Remembers a refresh token's jti so its reuse can be detected.
+INSERT INTO refresh_tokens (id, session_id, parent_id, expires_at) VALUES ($1, $2, $3, $4);
+
+-- name: UseRefreshToken :execrows
+-- Spends a refresh token. Zero rows means it is unknown, expired or already used.
+UPDATE refresh_tokens
+SET used_at = NOW()
+WHERE id = $1 AND session_id = $2 AND used_at IS NULL AND expires_at > NOW();
+
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens WHERE id = $1 LIMIT 1;
+
+-- name: CreateSecurityEvent :exec
+INSERT INTO security_events (account_id, session_id, event_type, ip_address, user_agent, details)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: ListSecurityEvents :many
+SELECT * FROM security_events WHERE account_id = $1 ORDER BY created_at DESC;
+
 
 
 /***** USERS & ADDRESS *****/
@@ -90,4 +239,155 @@ SET
     government_id_image = COALESCE($3, government_id_image),
     passport_image = COALESCE($4, passport_image),
     updated_at = CURRENT_TIMESTAMP
-WHERE account_id = $1;
\ No newline at end of file
+WHERE account_id = $1;
+
+-- name: GetUserByAccountID :one
+SELECT * FROM users WHERE account_id = $1 LIMIT 1;
+
+-- name: GetAddressByAccountID :one
+SELECT * FROM address WHERE account_id = $1 LIMIT 1;
+
+
+/***** MESSAGES *****/
+
+-- name: CreateMessage :exec
+-- Records a message as soon as it is put on the delivery outbox.
+INSERT INTO messages (id, phone, channel, encoding, segments) VALUES ($1, $2, $3, $4, $5);
+
+-- name: MarkMessageSent :exec
+-- A provider accepted the message; receipts are matched on provider + provider_message_id.
+UPDATE messages
+SET
+    status = 'sent',
+    attempts = $2,
+    provider = $3,
+    provider_message_id = $4,
+    last_error = NULL,
+    sent_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND status = 'queued';
+
+-- name: RecordMessageAttempt :exec
+-- A send failed. Status only changes to 'failed' when the outbox gives up.
+UPDATE messages
+SET
+    status = $2,
+    attempts = $3,
+    last_error = $4,
+    failed_at = CASE WHEN $2 = 'failed'::message_status THEN CURRENT_TIMESTAMP ELSE failed_at END,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND status = 'queued';
+
+-- name: ApplyDeliveryReport :execrows
+-- Receipts can arrive late or out of order: a final state is never downgraded,
+-- except that carriers sometimes deliver after reporting a failure.
+UPDATE messages
+SET
+    status = $3,
+    error_code = $4,
+    delivered_at = CASE WHEN $3 = 'delivered'::message_status THEN $5 ELSE delivered_at END,
+    failed_at = CASE WHEN $3 = 'failed'::message_status THEN $5 ELSE failed_at END,
+    updated_at = CURRENT_TIMESTAMP
+WHERE provider = $1 AND provider_message_id = $2
+  AND (status IN ('queued', 'sent') OR (status = 'failed' AND $3 = 'delivered'::message_status));
+
+-- name: GetMessageByID :one
+SELECT * FROM messages WHERE id = $1 LIMIT 1;
+
+-- name: ListMessagesByPhone :many
+-- Newest first, for support staff answering "I never got my code".
+SELECT * FROM messages WHERE phone = $1 ORDER BY queued_at DESC LIMIT $2;
+
+
+
+/***** OAUTH CLIENTS *****/
+
+-- name: CreateOAuthClient :one
+-- Registers an OpenID Connect relying party.
+INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, scopes, logo_uri)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients WHERE id = $1 LIMIT 1;
+
+-- name: ListOAuthClients :many
+SELECT * FROM oauth_clients ORDER BY created_at DESC;
+
+
+
+/***** RECOVERY CODES *****/
+
+-- name: EnrollRecoveryCodes :execrows
+-- Issues an account's first codes. Zero rows means it already has some.
+INSERT INTO recovery_codes (account_id, code_hash)
+SELECT sqlc.arg(account_id)::uuid, unnest(sqlc.arg(code_hashes)::text[])
+WHERE NOT EXISTS (SELECT 1 FROM recovery_codes WHERE account_id = sqlc.arg(account_id));
+
+-- name: ReplaceRecoveryCodes :exec
+-- Regenerating voids every earlier code, used or not.
+WITH cleared AS (
+    DELETE FROM recovery_codes WHERE account_id = sqlc.arg(account_id)
+)
+INSERT INTO recovery_codes (account_id, code_hash)
+SELECT sqlc.arg(account_id)::uuid, unnest(sqlc.arg(code_hashes)::text[]);
+
+-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*) FROM recovery_codes WHERE account_id = $1 AND used_at IS NULL;
+
+-- name: RecoverAccount :execrows
+-- Spends a recovery code and moves the account to a new phone in one statement.
+-- Zero rows means the code is wrong or spent, or the account is not active.
+WITH spent AS (
+    UPDATE recovery_codes SET used_at = NOW()
+    WHERE account_id = sqlc.arg(id) AND code_hash = sqlc.arg(code_hash) AND used_at IS NULL
+      AND EXISTS (SELECT 1 FROM accounts WHERE id = sqlc.arg(id) AND status = 'active')
+    RETURNING account_id
+)
+UPDATE accounts
+SET phone = sqlc.arg(new_phone), phone_bound_at = NOW(), updated_at = CURRENT_TIMESTAMP
+WHERE id IN (SELECT account_id FROM spent);
+
+-- name: ConfirmPhoneOwner :execrows
+-- Spends a recovery code to show the holder of a number that changed hands still
+-- owns the account. Zero rows means the code is wrong or spent.
+WITH spent AS (
+    UPDATE recovery_codes SET used_at = NOW()
+    WHERE account_id = sqlc.arg(id) AND code_hash = sqlc.arg(code_hash) AND used_at IS NULL
+    RETURNING account_id
+)
+UPDATE accounts
+SET phone_bound_at = NOW(), updated_at = CURRENT_TIMESTAMP
+WHERE id IN (SELECT account_id FROM spent);
+
+-- name: UseRecoveryCode :execrows
+-- Spends a recovery code in place of another factor. Zero rows means it is wrong or spent.
+UPDATE recovery_codes SET used_at = NOW()
+WHERE account_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+/***** TOTP *****/
+
+-- name: EnrollTOTP :execrows
+-- Starts (or restarts) enrollment with a new sealed secret. Zero rows means the
+-- account already has a confirmed authenticator.
+INSERT INTO account_totp (account_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (account_id) DO UPDATE
+SET secret = EXCLUDED.secret, last_used_step = 0, created_at = CURRENT_TIMESTAMP
+WHERE account_totp.confirmed_at IS NULL;
+
+-- name: GetAccountTOTP :one
+SELECT * FROM account_totp WHERE account_id = $1 LIMIT 1;
+
+-- name: ConfirmTOTP :execrows
+-- Turns the authenticator on once the first code checks out.
+UPDATE account_totp SET confirmed_at = NOW(), last_used_step = sqlc.arg(step)
+WHERE account_id = sqlc.arg(account_id) AND confirmed_at IS NULL;
+
+-- name: UseTOTPStep :execrows
+-- Accepts a code's time step once. Zero rows means it, or a later one, was already used.
+UPDATE account_totp SET last_used_step = sqlc.arg(step)
+WHERE account_id = sqlc.arg(account_id) AND confirmed_at IS NOT NULL AND last_used_step < sqlc.arg(step);
+
+-- name: DeleteAccountTOTP :execrows
+DELETE FROM account_totp WHERE account_id = $1;